@@ -3,18 +3,41 @@ package api
 import (
 	"bytes"
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"gophkeeper/client/internal/config"
+	"gophkeeper/client/internal/models"
+	"io"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 )
 
+// UserAgent identifies the client and its version to the server, which shows it
+// in the session list. It is set by the commands package at startup.
+var UserAgent = "gophkeeper-cli"
+
+// deviceNameHeader carries the name of this device; the server records it for new sessions.
+const deviceNameHeader = "X-Device-Name"
+
+// requestIDHeader carries the ID the server assigned to a request.
+const requestIDHeader = "X-Request-Id"
+
+// maxErrorBodySize bounds how much of an error response is read.
+const maxErrorBodySize = 64 << 10
+
 // Client is a GophKeeper API client.
 type Client struct {
 	serverURL  string
 	httpClient *http.Client
+	// tlsErr is returned by every request if the configured certificates could not be loaded
+	tlsErr error
+	// hasClientCert reports whether a client certificate authenticates requests without a token
+	hasClientCert bool
+	// version caches the response of GET /api/version
+	version *models.VersionInfo
 }
 
 func NewClient() *Client {
@@ -34,6 +57,8 @@ func NewClientWithURL(serverURL string) *Client {
 		tlsConfig.InsecureSkipVerify = true
 	}
 
+	tlsErr := loadCertificates(tlsConfig)
+
 	return &Client{
 		serverURL: serverURL,
 		httpClient: &http.Client{
@@ -42,11 +67,51 @@ func NewClientWithURL(serverURL string) *Client {
 				TLSClientConfig: tlsConfig,
 			},
 		},
+		tlsErr:        tlsErr,
+		hasClientCert: len(tlsConfig.Certificates) > 0,
 	}
 }
 
+// loadCertificates adds the configured client certificate and trusted CAs to tlsConfig.
+func loadCertificates(tlsConfig *tls.Config) error {
+	if caFile := config.GetCACertFile(); caFile != "" {
+		caPEM, err := os.ReadFile(caFile)
+		if err != nil {
+			return fmt.Errorf("failed to read CA certificates: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return fmt.Errorf("no certificates found in %s", caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	certFile, keyFile := config.GetClientCertFiles()
+	if certFile == "" && keyFile == "" {
+		return nil
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load client certificate: %w", err)
+	}
+	tlsConfig.Certificates = []tls.Certificate{cert}
+	return nil
+}
+
+// URL returns the address of a server path, for links that are opened in a browser.
+func (c *Client) URL(path string) string {
+	return c.serverURL + path
+}
+
 // Request makes an HTTP request to the GophKeeper server without authentication.
 func (c *Client) Request(method, path string, body interface{}) (*http.Response, error) {
+	if c.tlsErr != nil {
+		return nil, c.tlsErr
+	}
+
 	var reqBody *bytes.Buffer
 	if body != nil {
 		jsonData, err := json.Marshal(body)
@@ -63,7 +128,7 @@ func (c *Client) Request(method, path string, body interface{}) (*http.Response,
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	req.Header.Set("Content-Type", "application/json")
+	setHeaders(req)
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
@@ -74,30 +139,102 @@ func (c *Client) Request(method, path string, body interface{}) (*http.Response,
 }
 
 // AuthenticatedRequest makes an HTTP request to the GophKeeper server with the JWT token.
+// If the access token has expired, it is refreshed once with the stored refresh token
+// and the request is retried. Without a stored token, a configured client certificate
+// authenticates the request. An API token from the environment takes precedence over both.
 func (c *Client) AuthenticatedRequest(method, path string, body interface{}) (*http.Response, error) {
+	var jsonData []byte
+	if body != nil {
+		var err error
+		jsonData, err = json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal request body: %w", err)
+		}
+	}
+
+	// API tokens do not expire like access tokens and cannot be refreshed
+	if apiToken := config.GetAPIToken(); apiToken != "" {
+		return c.doAuthenticated(method, path, jsonData, apiToken)
+	}
+
 	token, err := config.LoadToken()
-	if err != nil {
+	if err != nil && !c.hasClientCert {
 		return nil, fmt.Errorf("authentication required: %w", err)
 	}
 
-	var reqBody *bytes.Buffer
-	if body != nil {
-		jsonData, err := json.Marshal(body)
-		if err != nil {
-			return nil, fmt.Errorf("failed to marshal request body: %w", err)
+	resp, err := c.doAuthenticated(method, path, jsonData, token)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	token, refreshErr := c.Refresh()
+	if refreshErr != nil {
+		// Return the original 401 so that callers report it as usual
+		return resp, nil
+	}
+	resp.Body.Close()
+
+	return c.doAuthenticated(method, path, jsonData, token)
+}
+
+// Refresh exchanges the stored refresh token for new tokens, saves them and returns the new access token.
+func (c *Client) Refresh() (string, error) {
+	refreshToken, err := config.LoadRefreshToken()
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := c.Request(http.MethodPost, "/api/user/refresh", map[string]string{"refresh_token": refreshToken})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token refresh failed: %w", ParseError(resp))
+	}
+
+	var tokens models.TokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		return "", fmt.Errorf("failed to decode refresh response: %w", err)
+	}
+
+	if err := SaveTokens(tokens); err != nil {
+		return "", err
+	}
+	return tokens.Token, nil
+}
+
+// SaveTokens stores the access and refresh tokens returned by the server.
+func SaveTokens(tokens models.TokenResponse) error {
+	if tokens.Token == "" {
+		return fmt.Errorf("no token received")
+	}
+	if err := config.SaveToken(tokens.Token); err != nil {
+		return fmt.Errorf("failed to save token: %w", err)
+	}
+	if tokens.RefreshToken != "" {
+		if err := config.SaveRefreshToken(tokens.RefreshToken); err != nil {
+			return fmt.Errorf("failed to save refresh token: %w", err)
 		}
-		reqBody = bytes.NewBuffer(jsonData)
-	} else {
-		reqBody = bytes.NewBuffer(nil)
 	}
+	return nil
+}
 
-	req, err := http.NewRequest(method, c.serverURL+path, reqBody)
+func (c *Client) doAuthenticated(method, path string, body []byte, token string) (*http.Response, error) {
+	if c.tlsErr != nil {
+		return nil, c.tlsErr
+	}
+
+	req, err := http.NewRequest(method, c.serverURL+path, bytes.NewReader(body))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+token)
+	setHeaders(req)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
@@ -106,3 +243,28 @@ func (c *Client) AuthenticatedRequest(method, path string, body interface{}) (*h
 
 	return resp, nil
 }
+
+// setHeaders sets the headers sent with every request.
+func setHeaders(req *http.Request) {
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", UserAgent)
+	if hostname, err := os.Hostname(); err == nil {
+		req.Header.Set(deviceNameHeader, hostname)
+	}
+}
+
+// ParseError reads the error response of the server. Servers that answer with plain text
+// instead of a JSON error give an APIError with the text as its message and no code.
+func ParseError(resp *http.Response) *models.APIError {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+
+	apiErr := &models.APIError{}
+	if json.Unmarshal(body, apiErr) != nil || apiErr.Message == "" && apiErr.Code == "" {
+		apiErr = &models.APIError{Message: strings.TrimSpace(string(body))}
+	}
+	apiErr.Status = resp.StatusCode
+	if apiErr.RequestID == "" {
+		apiErr.RequestID = resp.Header.Get(requestIDHeader)
+	}
+	return apiErr
+}
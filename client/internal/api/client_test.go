@@ -1,11 +1,31 @@
 package api
 
 import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
 	"gophkeeper/client/internal/config"
+	"gophkeeper/client/internal/models"
+	"io"
+	"math/big"
+	"net"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 // TestNewClient tests the NewClient function
@@ -154,3 +174,484 @@ func TestAuthenticatedRequestTokenLoading(t *testing.T) {
 		t.Error("Token should have been loaded successfully")
 	}
 }
+
+// TestAuthenticatedRequestRefresh tests that an expired access token is refreshed and the request retried
+func TestAuthenticatedRequestRefresh(t *testing.T) {
+	t.Setenv("APPDATA", "")
+	t.Setenv("HOME", t.TempDir())
+
+	if err := config.SaveToken("expired-token"); err != nil {
+		t.Fatalf("Failed to save token: %v", err)
+	}
+	if err := config.SaveRefreshToken("refresh-1"); err != nil {
+		t.Fatalf("Failed to save refresh token: %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/user/refresh":
+			var req map[string]string
+			json.NewDecoder(r.Body).Decode(&req)
+			if req["refresh_token"] != "refresh-1" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			json.NewEncoder(w).Encode(models.TokenResponse{Token: "fresh-token", RefreshToken: "refresh-2", ExpiresIn: 900})
+		case "/api/secrets":
+			if r.Header.Get("Authorization") != "Bearer fresh-token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			body, _ := io.ReadAll(r.Body)
+			w.Write(body)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClientWithURL(server.URL)
+	resp, err := client.AuthenticatedRequest(http.MethodPost, "/api/secrets", map[string]string{"data": "x"})
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status %d after refresh, got %d", http.StatusOK, resp.StatusCode)
+	}
+	if body, _ := io.ReadAll(resp.Body); string(body) != `{"data":"x"}` {
+		t.Errorf("Expected request body to be resent, got %s", body)
+	}
+
+	if token, _ := config.LoadToken(); token != "fresh-token" {
+		t.Errorf("Expected new access token to be saved, got %q", token)
+	}
+	if token, _ := config.LoadRefreshToken(); token != "refresh-2" {
+		t.Errorf("Expected rotated refresh token to be saved, got %q", token)
+	}
+
+	// A failed refresh returns the original 401
+	config.SaveToken("expired-token")
+	config.SaveRefreshToken("revoked")
+	resp, err = client.AuthenticatedRequest(http.MethodGet, "/api/secrets", nil)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected status %d, got %d", http.StatusUnauthorized, resp.StatusCode)
+	}
+}
+
+func TestRequestHeaders(t *testing.T) {
+	oldUserAgent := UserAgent
+	UserAgent = "gophkeeper-cli/1.2.3"
+	defer func() { UserAgent = oldUserAgent }()
+
+	var got http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+	}))
+	defer server.Close()
+
+	resp, err := NewClientWithURL(server.URL).Request(http.MethodPost, "/api/user/login", nil)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if ua := got.Get("User-Agent"); ua != "gophkeeper-cli/1.2.3" {
+		t.Errorf("Expected User-Agent %q, got %q", "gophkeeper-cli/1.2.3", ua)
+	}
+	if hostname, err := os.Hostname(); err == nil && got.Get(deviceNameHeader) != hostname {
+		t.Errorf("Expected device name %q, got %q", hostname, got.Get(deviceNameHeader))
+	}
+}
+
+// TestClientCertificate tests that a configured client certificate authenticates requests
+// to a server with a certificate from a private CA
+func TestClientCertificate(t *testing.T) {
+	t.Setenv("APPDATA", "")
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	caDER, _ := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	caCert, _ := x509.ParseCertificate(caDER)
+
+	issue := func(serial int64, template *x509.Certificate) (tls.Certificate, []byte, []byte) {
+		key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		template.SerialNumber = big.NewInt(serial)
+		template.NotBefore = time.Now().Add(-time.Minute)
+		template.NotAfter = time.Now().Add(time.Hour)
+		der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatalf("Failed to issue certificate: %v", err)
+		}
+		keyDER, _ := x509.MarshalECPrivateKey(key)
+		return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key},
+			pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+			pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	}
+	serverCert, _, _ := issue(2, &x509.Certificate{
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	_, clientCertPEM, clientKeyPEM := issue(3, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "backup"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+		return path
+	}
+	t.Setenv("GOPHKEEPER_CA_CERT", write("ca.crt", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER})))
+	t.Setenv("GOPHKEEPER_CLIENT_CERT", write("client.crt", clientCertPEM))
+	t.Setenv("GOPHKEEPER_CLIENT_KEY", write("client.key", clientKeyPEM))
+
+	pool := x509.NewCertPool()
+	pool.AddCert(caCert)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" || r.TLS.PeerCertificates[0].Subject.CommonName != "backup" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	// No token is stored, so the certificate alone authenticates the request
+	resp, err := NewClientWithURL(server.URL).AuthenticatedRequest(http.MethodGet, "/api/secrets", nil)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	t.Setenv("GOPHKEEPER_CLIENT_KEY", filepath.Join(dir, "missing.key"))
+	if _, err := NewClientWithURL(server.URL).Request(http.MethodGet, "/", nil); err == nil {
+		t.Error("Expected an error for a missing client key")
+	}
+}
+
+// TestAPITokenFromEnvironment tests that GOPHKEEPER_TOKEN replaces the stored login tokens
+func TestAPITokenFromEnvironment(t *testing.T) {
+	t.Setenv("APPDATA", "")
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("GOPHKEEPER_TOKEN", "gkp_test")
+	config.SaveToken("stored-token")
+	config.SaveRefreshToken("refresh-1")
+
+	var authorizations []string
+	refreshed := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/user/refresh" {
+			refreshed = true
+		}
+		authorizations = append(authorizations, r.Header.Get("Authorization"))
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	resp, err := NewClientWithURL(server.URL).AuthenticatedRequest(http.MethodGet, "/api/secrets", nil)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if len(authorizations) != 1 || authorizations[0] != "Bearer gkp_test" {
+		t.Errorf("Expected a single request with the API token, got %v", authorizations)
+	}
+	if refreshed {
+		t.Error("Expected no refresh for an API token")
+	}
+}
+
+// TestLoginSRP tests SRP registration and login against a server that only knows the verifier
+func TestLoginSRP(t *testing.T) {
+	t.Setenv("APPDATA", "")
+	t.Setenv("HOME", t.TempDir())
+	defaultParams := SRPParams
+	SRPParams = models.SRPParams{Memory: 19 * 1024, Time: 2, Parallelism: 1}
+	defer func() { SRPParams = defaultParams }()
+
+	var registered models.SRPRegisterRequest
+	var aPublic, b, bPublic *big.Int
+	forgeProof := false
+	var paramsOverride *models.SRPParams
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/user/srp/register":
+			json.NewDecoder(r.Body).Decode(&registered)
+			w.WriteHeader(http.StatusCreated)
+		case "/api/user/srp/login":
+			var req models.SRPStartRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			if req.Login != registered.Login {
+				// As a server without SRP
+				http.NotFound(w, r)
+				return
+			}
+			// B = k*v + g^b mod N
+			aPublic = new(big.Int).SetBytes(req.ClientPublic)
+			b = big.NewInt(123456789)
+			bPublic = new(big.Int).Mul(srpK, new(big.Int).SetBytes(registered.Verifier))
+			bPublic.Add(bPublic, new(big.Int).Exp(srpG, b, srpN))
+			bPublic.Mod(bPublic, srpN)
+			params := registered.Params
+			if paramsOverride != nil {
+				params = *paramsOverride
+			}
+			json.NewEncoder(w).Encode(models.SRPStartResponse{Session: "s", Salt: registered.Salt, Params: params, ServerPublic: srpPad(bPublic)})
+		case "/api/user/srp/login/verify":
+			var req models.SRPVerifyRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			// S = (A * v^u) ^ b mod N
+			u := new(big.Int).SetBytes(srpHash(srpPad(aPublic), srpPad(bPublic)))
+			premaster := new(big.Int).Exp(new(big.Int).SetBytes(registered.Verifier), u, srpN)
+			premaster.Mul(premaster, aPublic)
+			premaster.Exp(premaster, b, srpN)
+			key := srpHash(srpPad(premaster))
+			if !bytes.Equal(req.Proof, srpClientProof(registered.Login, registered.Salt, aPublic, bPublic, key)) {
+				http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+				return
+			}
+			if forgeProof {
+				key = []byte("forged")
+			}
+			w.Header().Set(srpServerProofHeader, base64.StdEncoding.EncodeToString(srpHash(srpPad(aPublic), req.Proof, key)))
+			json.NewEncoder(w).Encode(models.TokenResponse{Token: "access"})
+		}
+	}))
+	defer server.Close()
+	client := NewClientWithURL(server.URL)
+
+	resp, err := client.RegisterSRP("alice", "alice-password", "")
+	if err != nil || resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected registration to succeed, got %v", err)
+	}
+	if payload, _ := json.Marshal(registered); bytes.Contains(payload, []byte("alice-password")) {
+		t.Error("Expected the password not to be sent")
+	}
+
+	if resp, err := client.LoginSRP("alice", "alice-password"); err != nil || resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected SRP login to succeed, got %v", err)
+	}
+	if resp, err := client.LoginSRP("alice", "wrong-password"); err != nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for a wrong password, got %v", http.StatusUnauthorized, err)
+	}
+	if _, err := client.LoginSRP("bob", "bob-password"); !errors.Is(err, ErrSRPUnavailable) {
+		t.Errorf("Expected ErrSRPUnavailable, got %v", err)
+	}
+
+	// Argon2id parameters above the limit are rejected before deriving the key
+	for _, params := range []models.SRPParams{
+		{Memory: 4 << 20, Time: 2, Parallelism: 1},
+		{Memory: 19 * 1024, Time: 1000, Parallelism: 1},
+		{Memory: 19 * 1024, Time: 2, Parallelism: 255},
+	} {
+		paramsOverride = &params
+		if _, err := client.LoginSRP("alice", "alice-password"); err == nil || !strings.Contains(err.Error(), "above the limit") {
+			t.Errorf("Expected parameters %+v to be rejected, got %v", params, err)
+		}
+	}
+	paramsOverride = nil
+
+	forgeProof = true
+	if _, err := client.LoginSRP("alice", "alice-password"); err == nil {
+		t.Error("Expected an error for a wrong server proof")
+	}
+
+	// Accounts that use SRP are recorded per server
+	if err := client.RememberSRP("alice"); err != nil {
+		t.Fatalf("Failed to record SRP account: %v", err)
+	}
+	if uses, err := client.UsesSRP("alice"); err != nil || !uses {
+		t.Errorf("Expected alice to use SRP, got %v, %v", uses, err)
+	}
+	if uses, _ := client.UsesSRP("bob"); uses {
+		t.Error("Expected bob not to use SRP")
+	}
+	if uses, _ := NewClientWithURL("https://other.example").UsesSRP("alice"); uses {
+		t.Error("Expected the record to be limited to the server")
+	}
+}
+
+// TestParseError tests decoding JSON error responses and plain text ones of older servers
+func TestParseError(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   http.Header
+		body     string
+		expected models.APIError
+	}{
+		{
+			name: "JSON error",
+			body: `{"code":"login_throttled","message":"Too many failed login attempts","details":{"retry_after":30},"request_id":"abc-1"}`,
+			expected: models.APIError{
+				Code: "login_throttled", Message: "Too many failed login attempts",
+				Details: map[string]any{"retry_after": float64(30)}, RequestID: "abc-1", Status: http.StatusTooManyRequests,
+			},
+		},
+		{
+			name:     "plain text",
+			header:   http.Header{"X-Request-Id": {"abc-2"}},
+			body:     "Invalid credentials\n",
+			expected: models.APIError{Message: "Invalid credentials", RequestID: "abc-2", Status: http.StatusTooManyRequests},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{
+				StatusCode: http.StatusTooManyRequests,
+				Header:     tt.header,
+				Body:       io.NopCloser(bytes.NewBufferString(tt.body)),
+			}
+			if resp.Header == nil {
+				resp.Header = http.Header{}
+			}
+
+			apiErr := ParseError(resp)
+			if apiErr.Code != tt.expected.Code || apiErr.Message != tt.expected.Message ||
+				apiErr.RequestID != tt.expected.RequestID || apiErr.Status != tt.expected.Status ||
+				len(apiErr.Details) != len(tt.expected.Details) || apiErr.Details["retry_after"] != tt.expected.Details["retry_after"] {
+				t.Errorf("Expected %+v, got %+v", tt.expected, *apiErr)
+			}
+		})
+	}
+}
+
+// TestVersion tests that the client detects API v2 once and falls back to API v1 on
+// servers without GET /api/version
+func TestVersion(t *testing.T) {
+	tests := []struct {
+		name         string
+		handler      http.HandlerFunc
+		expectedPath string
+		expectedV2   bool
+	}{
+		{
+			name: "API v2",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				json.NewEncoder(w).Encode(models.VersionInfo{APIVersions: []string{"v1", "v2"}, Registration: "open"})
+			},
+			expectedPath: "/api/v2/secrets",
+			expectedV2:   true,
+		},
+		{
+			name:         "old server",
+			handler:      http.NotFound,
+			expectedPath: "/api/secrets",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				if r.URL.Path != "/api/version" {
+					t.Errorf("Unexpected request to %s", r.URL.Path)
+				}
+				tt.handler(w, r)
+			}))
+			defer server.Close()
+
+			client := NewClientWithURL(server.URL)
+			for range 2 {
+				path, v2, err := client.SecretsPath()
+				if err != nil || path != tt.expectedPath || v2 != tt.expectedV2 {
+					t.Errorf("Expected %s, got %s, %v, %v", tt.expectedPath, path, v2, err)
+				}
+			}
+			if requests != 1 {
+				t.Errorf("Expected the version to be requested once, got %d requests", requests)
+			}
+		})
+	}
+
+	// Other failures are reported instead of falling back
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	if _, _, err := NewClientWithURL(server.URL).SecretsPath(); err == nil {
+		t.Error("Expected an error for a failed version request")
+	}
+}
+
+// TestCheckPassword tests that the client applies the password policy of the server and
+// looks up breached passwords by the prefix of their hash only
+func TestCheckPassword(t *testing.T) {
+	breached := fmt.Sprintf("%X", sha1.Sum([]byte("password123")))
+	var prefixes []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/version":
+			json.NewEncoder(w).Encode(models.VersionInfo{
+				APIVersions:    []string{"v1", "v2"},
+				PasswordPolicy: models.PasswordPolicy{MinLength: 10, MaxLength: 20, BreachCheck: true},
+			})
+		case strings.HasPrefix(r.URL.Path, "/api/user/breached-passwords/"):
+			prefix := strings.TrimPrefix(r.URL.Path, "/api/user/breached-passwords/")
+			prefixes = append(prefixes, prefix)
+			suffixes := []string{"0000000000000000000000000000000000A"}
+			if prefix == breached[:5] {
+				suffixes = append(suffixes, breached[5:])
+			}
+			json.NewEncoder(w).Encode(models.BreachedPasswords{Suffixes: suffixes})
+		default:
+			t.Errorf("Unexpected request to %s", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClientWithURL(server.URL)
+	rejected := map[string]string{
+		"short":                 "at least 10 characters",
+		strings.Repeat("x", 21): "at most 20 characters",
+		"Alice-Login":           "differ from the login",
+		"password123":           "breached passwords",
+	}
+	for password, reason := range rejected {
+		if err := client.CheckPassword("alice-login", password); err == nil || !strings.Contains(err.Error(), reason) {
+			t.Errorf("Expected %q to be rejected with %q, got %v", password, reason, err)
+		}
+	}
+	if err := client.CheckPassword("alice-login", "correct horse"); err != nil {
+		t.Errorf("Expected the password to be accepted, got %v", err)
+	}
+	if len(prefixes) != 2 || prefixes[0] != breached[:5] {
+		t.Errorf("Expected two lookups by a 5 digit prefix, got %v", prefixes)
+	}
+
+	// Without a breach list on the server, nothing is looked up
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/version" {
+			t.Errorf("Unexpected request to %s", r.URL.Path)
+		}
+		json.NewEncoder(w).Encode(models.VersionInfo{PasswordPolicy: models.PasswordPolicy{MinLength: 8}})
+	})
+	if err := NewClientWithURL(server.URL).CheckPassword("alice", "password123"); err != nil {
+		t.Errorf("Expected the password to be accepted, got %v", err)
+	}
+}
@@ -0,0 +1,205 @@
+package api
+
+import (
+	"encoding/json"
+	"gophkeeper/client/internal/models"
+	"net/http"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// openAPIDocument is the OpenAPI document the server serves and validates requests against
+const openAPIDocument = "../../../server/internal/openapi/openapi.json"
+
+// openAPISchema is the part of a schema the contract test needs
+type openAPISchema struct {
+	Ref        string                    `json:"$ref"`
+	Type       string                    `json:"type"`
+	Properties map[string]*openAPISchema `json:"properties"`
+	Items      *openAPISchema            `json:"items"`
+	OneOf      []*openAPISchema          `json:"oneOf"`
+}
+
+type openAPIContent map[string]struct {
+	Schema *openAPISchema `json:"schema"`
+}
+
+type openAPIOperation struct {
+	RequestBody *struct {
+		Content openAPIContent `json:"content"`
+	} `json:"requestBody"`
+	Responses map[string]struct {
+		Content openAPIContent `json:"content"`
+	} `json:"responses"`
+}
+
+// TestOpenAPIContract tests that the requests and responses of the CLI match the OpenAPI
+// document of the server
+func TestOpenAPIContract(t *testing.T) {
+	data, err := os.ReadFile(openAPIDocument)
+	if err != nil {
+		t.Skipf("OpenAPI document of the server not found: %v", err)
+	}
+	var doc struct {
+		Paths      map[string]map[string]*openAPIOperation `json:"paths"`
+		Components struct {
+			Schemas map[string]*openAPISchema `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("Failed to parse the OpenAPI document: %v", err)
+	}
+	resolve := func(schema *openAPISchema) *openAPISchema {
+		for schema != nil && schema.Ref != "" {
+			schema = doc.Components.Schemas[strings.TrimPrefix(schema.Ref, "#/components/schemas/")]
+		}
+		return schema
+	}
+	operation := func(method, path string) *openAPIOperation {
+		t.Helper()
+		op := doc.Paths[path][strings.ToLower(method)]
+		if op == nil {
+			t.Fatalf("%s %s is not documented", method, path)
+		}
+		return op
+	}
+
+	// Every property the CLI sends is documented
+	var checkValue func(schema *openAPISchema, value any, field string) []string
+	checkValue = func(schema *openAPISchema, value any, field string) []string {
+		schema = resolve(schema)
+		// A value of a oneOf must be documented by one of the alternatives
+		if len(schema.OneOf) > 0 {
+			var undocumented []string
+			for i, alternative := range schema.OneOf {
+				if missing := checkValue(alternative, value, field); i == 0 || len(missing) < len(undocumented) {
+					undocumented = missing
+				}
+			}
+			return undocumented
+		}
+		var undocumented []string
+		switch value := value.(type) {
+		case map[string]any:
+			for name, property := range value {
+				if propertySchema, ok := schema.Properties[name]; ok {
+					undocumented = append(undocumented, checkValue(propertySchema, property, field+name+".")...)
+				} else {
+					undocumented = append(undocumented, field+name)
+				}
+			}
+		case []any:
+			for _, item := range value {
+				undocumented = append(undocumented, checkValue(schema.Items, item, field)...)
+			}
+		}
+		return undocumented
+	}
+	requests := []struct {
+		method string
+		path   string
+		body   any
+	}{
+		{http.MethodPost, "/api/user/register", models.RegisterRequest{Login: "alice", Password: "x", Invite: "code"}},
+		{http.MethodPost, "/api/user/login", models.LoginRequest{Login: "alice", Password: "x"}},
+		{http.MethodPost, "/api/user/login/totp", models.MFALoginRequest{Challenge: "c", Code: "1", RecoveryCode: "2"}},
+		{http.MethodPost, "/api/user/recover", models.RecoverRequest{Login: "alice", RecoveryCode: "c", Password: "x", Salt: []byte{1}, Verifier: []byte{1}}},
+		{http.MethodPost, "/api/user/srp/register", models.SRPRegisterRequest{Login: "alice", Salt: []byte{1}, Verifier: []byte{1}, Invite: "code"}},
+		{http.MethodPut, "/api/user/srp", models.SRPEnableRequest{Login: "alice", Password: "x", Salt: []byte{1}, Verifier: []byte{1}}},
+		{http.MethodPost, "/api/user/srp/login", models.SRPStartRequest{Login: "alice", ClientPublic: []byte{1}}},
+		{http.MethodPost, "/api/user/srp/login/verify", models.SRPVerifyRequest{Session: "s", Proof: []byte{1}}},
+		{http.MethodPost, "/api/user/oidc/token", models.OIDCCodeRequest{Code: "c"}},
+		{http.MethodPost, "/api/user/oidc/device/token", models.OIDCDeviceTokenRequest{DeviceCode: "c"}},
+		{http.MethodPost, "/api/user/oidc/link", models.OIDCLinkRequest{LinkCode: "c"}},
+		{http.MethodPost, "/api/user/ldap/link", models.LDAPLinkRequest{Login: "alice", Password: "x"}},
+		{http.MethodPost, "/api/secrets", models.Secret{Type: models.TextDataType, Data: []byte("x"), Metadata: "m"}},
+		{http.MethodPut, "/api/secrets/{id}", models.Secret{ID: 1, Type: models.TextDataType, Data: []byte("x")}},
+		{http.MethodPost, "/api/v2/secrets", models.SecretV2Request{Type: "login", Metadata: "m", Payload: models.LoginPayload{Login: "alice", Password: "x", Raw: []byte{1}}}},
+		{http.MethodPut, "/api/v2/secrets/{id}", models.SecretV2Request{Type: "bankcard", Payload: models.BankCardPayload{Number: "1", Holder: "A", Expiry: "12/30", CVV: "1", Raw: []byte{1}}, Revision: 1}},
+	}
+	for _, req := range requests {
+		op := operation(req.method, req.path)
+		if op.RequestBody == nil {
+			t.Errorf("%s %s has no documented body", req.method, req.path)
+			continue
+		}
+		payload, _ := json.Marshal(req.body)
+		var value any
+		json.Unmarshal(payload, &value)
+		if undocumented := checkValue(op.RequestBody.Content["application/json"].Schema, value, ""); len(undocumented) > 0 {
+			t.Errorf("%T sends undocumented properties to %s %s: %v", req.body, req.method, req.path, undocumented)
+		}
+	}
+
+	// Every field the CLI reads from a response is documented
+	responses := []struct {
+		method string
+		path   string
+		status int
+		body   any
+	}{
+		{http.MethodPost, "/api/user/register", http.StatusCreated, models.RecoveryCodes{}},
+		{http.MethodPost, "/api/user/login", http.StatusOK, models.TokenResponse{}},
+		{http.MethodPost, "/api/user/login", http.StatusAccepted, models.MFAChallenge{}},
+		{http.MethodPost, "/api/user/refresh", http.StatusOK, models.TokenResponse{}},
+		{http.MethodPost, "/api/user/srp/login", http.StatusOK, models.SRPStartResponse{}},
+		{http.MethodGet, "/api/user/breached-passwords/{prefix}", http.StatusOK, models.BreachedPasswords{}},
+		{http.MethodGet, "/api/user/recovery-codes", http.StatusOK, models.RecoveryCodesStatus{}},
+		{http.MethodPost, "/api/user/recovery-codes", http.StatusOK, models.RecoveryCodes{}},
+		{http.MethodGet, "/api/user/sessions", http.StatusOK, []models.Session{}},
+		{http.MethodPost, "/api/user/totp", http.StatusOK, models.TOTPEnrollment{}},
+		{http.MethodPost, "/api/user/totp/confirm", http.StatusOK, models.RecoveryCodes{}},
+		{http.MethodPost, "/api/user/oidc/device", http.StatusOK, models.DeviceAuthorization{}},
+		{http.MethodGet, "/api/secrets", http.StatusOK, []models.Secret{}},
+		{http.MethodGet, "/api/secrets/{id}", http.StatusOK, models.Secret{}},
+		{http.MethodPost, "/api/secrets", http.StatusCreated, models.Secret{}},
+		{http.MethodPut, "/api/secrets/{id}", http.StatusOK, models.Secret{}},
+		{http.MethodGet, "/api/secrets", http.StatusBadRequest, models.APIError{}},
+		{http.MethodGet, "/api/version", http.StatusOK, models.VersionInfo{}},
+		{http.MethodGet, "/api/v2/secrets", http.StatusOK, []models.SecretV2{}},
+		{http.MethodGet, "/api/v2/secrets/{id}", http.StatusOK, models.SecretV2{}},
+		{http.MethodPut, "/api/v2/secrets/{id}", http.StatusConflict, models.APIError{}},
+	}
+	for _, resp := range responses {
+		op := operation(resp.method, resp.path)
+		documented, ok := op.Responses[strconv.Itoa(resp.status)]
+		if !ok {
+			documented, ok = op.Responses["default"]
+		}
+		if !ok {
+			t.Errorf("Status %d of %s %s is not documented", resp.status, resp.method, resp.path)
+			continue
+		}
+		schema := resolve(documented.Content["application/json"].Schema)
+		bodyType := reflect.TypeOf(resp.body)
+		if bodyType.Kind() == reflect.Slice {
+			bodyType = bodyType.Elem()
+			schema = resolve(schema.Items)
+		}
+		for _, name := range jsonFields(bodyType) {
+			if _, ok := schema.Properties[name]; !ok {
+				t.Errorf("%s reads the undocumented property %s of %s %s", bodyType, name, resp.method, resp.path)
+			}
+		}
+	}
+}
+
+// jsonFields returns the JSON names of the fields of a struct, including embedded structs
+func jsonFields(structType reflect.Type) []string {
+	var names []string
+	for i := range structType.NumField() {
+		field := structType.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		switch {
+		case name == "-":
+		case field.Anonymous && name == "":
+			names = append(names, jsonFields(field.Type)...)
+		case name != "":
+			names = append(names, name)
+		}
+	}
+	return names
+}
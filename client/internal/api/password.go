@@ -0,0 +1,61 @@
+package api
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"gophkeeper/client/internal/models"
+	"net/http"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// breachRangePrefixLength is the number of hex digits of the SHA-1 hash sent to the server
+// to look up a password in its breach list. The server only learns the prefix, which is
+// shared by many passwords, not the hash itself.
+const breachRangePrefixLength = 5
+
+// CheckPassword checks a new password against the password policy of the server. The
+// server cannot check the passwords of SRP registrations and recoveries, so the client
+// does before sending the verifier.
+func (c *Client) CheckPassword(login, password string) error {
+	version, err := c.Version()
+	if err != nil {
+		return err
+	}
+	policy := version.PasswordPolicy
+
+	length := utf8.RuneCountInString(password)
+	if length < policy.MinLength {
+		return fmt.Errorf("password rejected: must be at least %d characters long", policy.MinLength)
+	}
+	if policy.MaxLength > 0 && length > policy.MaxLength {
+		return fmt.Errorf("password rejected: must be at most %d characters long", policy.MaxLength)
+	}
+	if strings.EqualFold(password, login) {
+		return fmt.Errorf("password rejected: must differ from the login")
+	}
+	if !policy.BreachCheck {
+		return nil
+	}
+
+	hash := fmt.Sprintf("%X", sha1.Sum([]byte(password)))
+	resp, err := c.Request(http.MethodGet, "/api/user/breached-passwords/"+hash[:breachRangePrefixLength], nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("breached password check failed: %w", ParseError(resp))
+	}
+
+	var breached models.BreachedPasswords
+	if err := json.NewDecoder(resp.Body).Decode(&breached); err != nil {
+		return fmt.Errorf("failed to decode breached passwords: %w", err)
+	}
+	if slices.Contains(breached.Suffixes, hash[breachRangePrefixLength:]) {
+		return fmt.Errorf("password rejected: appears in a list of breached passwords")
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gophkeeper/client/internal/config"
+	"gophkeeper/client/internal/models"
+	"math/big"
+	"net/http"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// srpN and srpG are the 2048-bit group of RFC 5054, appendix A, as used by the server.
+var (
+	srpN, _ = new(big.Int).SetString("AC6BDB41324A9A9BF166DE5E1389582FAF72B6651987EE07FC3192943DB56050"+
+		"A37329CBB4A099ED8193E0757767A13DD52312AB4B03310DCD7F48A9DA04FD50"+
+		"E8083969EDB767B0CF6095179A163AB3661A05FBD5FAAAE82918A9962F0B93B8"+
+		"55F97993EC975EEAA80D740ADBF4FF747359D041D5C33EA71D281E446B14773B"+
+		"CA97B43A23FB801676BD207A436C6481F1D2B9078717461A5B9D32E688F87748"+
+		"544523B524B0D57D5EA77A2775D2ECFA032CFBDBF52FB3786160279004E57AE6"+
+		"AF874E7303CE53299CCC041C7BC308D82A5698F3A8D0C38271AE35F8E9DBFBB6"+
+		"94B5C803D89F7AE435DE236D525F54759B65E372FCD68EF20FA7111F9E4AFF73", 16)
+	srpG = big.NewInt(2)
+	srpK = new(big.Int).SetBytes(srpHash(srpPad(srpN), srpPad(srpG)))
+)
+
+// srpServerProofHeader carries the proof M2 of the server on a successful SRP login.
+const srpServerProofHeader = "X-SRP-Server-Proof"
+
+// SRPParams are the Argon2id parameters of new verifiers (RFC 9106, section 4).
+var SRPParams = models.SRPParams{Memory: 64 * 1024, Time: 3, Parallelism: 4}
+
+// maxSRPParams bound the Argon2id parameters a server can ask for at login, so that a
+// malicious server cannot make the client exhaust its memory or CPU: 1 GiB, 10 iterations
+// and 16 lanes.
+var maxSRPParams = models.SRPParams{Memory: 1 << 20, Time: 10, Parallelism: 16}
+
+// ErrSRPUnavailable is returned by LoginSRP if the server does not offer SRP logins.
+var ErrSRPUnavailable = errors.New("the server does not offer SRP logins for this account")
+
+// RegisterSRP registers a user with an SRP verifier, so that the password never leaves the client.
+// The invite code is only required when registration on the server is invite-only.
+func (c *Client) RegisterSRP(login, password, invite string) (*http.Response, error) {
+	salt, verifier, err := newSRPVerifier(login, password, SRPParams)
+	if err != nil {
+		return nil, err
+	}
+	return c.Request(http.MethodPost, "/api/user/srp/register", models.SRPRegisterRequest{
+		Login:    login,
+		Salt:     salt,
+		Verifier: verifier,
+		Params:   SRPParams,
+		Invite:   invite,
+	})
+}
+
+// EnableSRP replaces the password hash of the logged in user with an SRP verifier.
+// The password is sent once more to prove ownership of the account.
+func (c *Client) EnableSRP(login, password string) (*http.Response, error) {
+	salt, verifier, err := newSRPVerifier(login, password, SRPParams)
+	if err != nil {
+		return nil, err
+	}
+	return c.AuthenticatedRequest(http.MethodPut, "/api/user/srp", models.SRPEnableRequest{
+		Login:    login,
+		Password: password,
+		Salt:     salt,
+		Verifier: verifier,
+		Params:   SRPParams,
+	})
+}
+
+// Recover resets the password of an account with a recovery code. Like registration, it
+// sends only an SRP verifier of the new password, so the account uses SRP afterwards.
+func (c *Client) Recover(login, recoveryCode, password string) (*http.Response, error) {
+	salt, verifier, err := newSRPVerifier(login, password, SRPParams)
+	if err != nil {
+		return nil, err
+	}
+	return c.Request(http.MethodPost, "/api/user/recover", models.RecoverRequest{
+		Login:        login,
+		RecoveryCode: recoveryCode,
+		Salt:         salt,
+		Verifier:     verifier,
+		Params:       SRPParams,
+	})
+}
+
+// LoginSRP logs in with SRP-6a without sending the password. It returns the response of
+// the last request, which is handled like the response of a password login, after checking
+// that the server knows the verifier. If the server does not offer SRP it returns
+// ErrSRPUnavailable; the caller must not fall back to sending the password on its own.
+func (c *Client) LoginSRP(login, password string) (*http.Response, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate SRP key: %w", err)
+	}
+	a := new(big.Int).SetBytes(secret)
+	aPublic := new(big.Int).Exp(srpG, a, srpN)
+
+	resp, err := c.Request(http.MethodPost, "/api/user/srp/login", models.SRPStartRequest{Login: login, ClientPublic: srpPad(aPublic)})
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusPreconditionFailed, http.StatusNotFound:
+		// Servers without SRP support answer 404, older ones 412 for password accounts
+		resp.Body.Close()
+		return nil, ErrSRPUnavailable
+	default:
+		return resp, nil
+	}
+
+	var started models.SRPStartResponse
+	err = json.NewDecoder(resp.Body).Decode(&started)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode SRP response: %w", err)
+	}
+
+	if started.Params.Memory > maxSRPParams.Memory || started.Params.Time > maxSRPParams.Time ||
+		started.Params.Parallelism > maxSRPParams.Parallelism {
+		return nil, fmt.Errorf("the server asked for Argon2id parameters above the limit (m=%d, t=%d, p=%d)",
+			started.Params.Memory, started.Params.Time, started.Params.Parallelism)
+	}
+
+	b := new(big.Int).SetBytes(started.ServerPublic)
+	if b.Sign() == 0 || b.Cmp(srpN) >= 0 {
+		return nil, fmt.Errorf("invalid SRP server public key")
+	}
+	u := new(big.Int).SetBytes(srpHash(srpPad(aPublic), srpPad(b)))
+	if u.Sign() == 0 {
+		return nil, fmt.Errorf("invalid SRP server public key")
+	}
+
+	// S = (B - k * g^x) ^ (a + u * x) mod N
+	x := srpPrivateKey(login, password, started.Salt, started.Params)
+	base := new(big.Int).Exp(srpG, x, srpN)
+	base.Mul(base, srpK)
+	base.Sub(b, base)
+	base.Mod(base, srpN)
+	exponent := new(big.Int).Mul(u, x)
+	exponent.Add(exponent, a)
+	key := srpHash(srpPad(new(big.Int).Exp(base, exponent, srpN)))
+
+	proof := srpClientProof(login, started.Salt, aPublic, b, key)
+	resp, err = c.Request(http.MethodPost, "/api/user/srp/login/verify", models.SRPVerifyRequest{Session: started.Session, Proof: proof})
+	if err != nil || resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+		return resp, err
+	}
+
+	serverProof, _ := base64.StdEncoding.DecodeString(resp.Header.Get(srpServerProofHeader))
+	if !hmac.Equal(serverProof, srpHash(srpPad(aPublic), proof, key)) {
+		resp.Body.Close()
+		return nil, fmt.Errorf("the server could not prove that it knows the SRP verifier")
+	}
+	return resp, nil
+}
+
+// RememberSRP records that login uses SRP on the server, so that password logins to the
+// account are refused from then on.
+func (c *Client) RememberSRP(login string) error {
+	return config.SaveSRPAccount(c.serverURL, login)
+}
+
+// UsesSRP reports whether login was recorded to use SRP on the server.
+func (c *Client) UsesSRP(login string) (bool, error) {
+	return config.IsSRPAccount(c.serverURL, login)
+}
+
+// newSRPVerifier returns a random salt and the verifier v = g^x mod N of a password.
+func newSRPVerifier(login, password string, params models.SRPParams) (salt, verifier []byte, err error) {
+	salt = make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	x := srpPrivateKey(login, password, salt, params)
+	return salt, new(big.Int).Exp(srpG, x, srpN).Bytes(), nil
+}
+
+// srpPrivateKey is x = H(salt | Argon2id(login ":" password, salt)).
+func srpPrivateKey(login, password string, salt []byte, params models.SRPParams) *big.Int {
+	stretched := argon2.IDKey([]byte(login+":"+password), salt, params.Time, params.Memory, params.Parallelism, 32)
+	return new(big.Int).SetBytes(srpHash(salt, stretched))
+}
+
+// srpClientProof is M1 = H(H(N) xor H(g) | H(I) | s | A | B | K).
+func srpClientProof(login string, salt []byte, a, b *big.Int, key []byte) []byte {
+	hn, hg := srpHash(srpPad(srpN)), srpHash(srpPad(srpG))
+	for i := range hn {
+		hn[i] ^= hg[i]
+	}
+	return srpHash(hn, srpHash([]byte(login)), salt, srpPad(a), srpPad(b), key)
+}
+
+func srpHash(values ...[]byte) []byte {
+	h := sha256.New()
+	for _, value := range values {
+		h.Write(value)
+	}
+	return h.Sum(nil)
+}
+
+// srpPad encodes a number with the length of N, as RFC 5054 requires for hashing.
+func srpPad(n *big.Int) []byte {
+	return n.FillBytes(make([]byte, (srpN.BitLen()+7)/8))
+}
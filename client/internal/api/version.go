@@ -0,0 +1,50 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"gophkeeper/client/internal/models"
+	"net/http"
+)
+
+// Version returns the API versions and capabilities of the server. The result is cached
+// by the client. Servers older than GET /api/version support only API v1.
+func (c *Client) Version() (models.VersionInfo, error) {
+	if c.version != nil {
+		return *c.version, nil
+	}
+
+	resp, err := c.Request(http.MethodGet, "/api/version", nil)
+	if err != nil {
+		return models.VersionInfo{}, err
+	}
+	defer resp.Body.Close()
+
+	var version models.VersionInfo
+	switch resp.StatusCode {
+	case http.StatusOK:
+		if err := json.NewDecoder(resp.Body).Decode(&version); err != nil {
+			return models.VersionInfo{}, fmt.Errorf("failed to decode version response: %w", err)
+		}
+	case http.StatusNotFound:
+		version = models.VersionInfo{APIVersions: []string{"v1"}}
+	default:
+		return models.VersionInfo{}, fmt.Errorf("version request failed: %w", ParseError(resp))
+	}
+
+	c.version = &version
+	return version, nil
+}
+
+// SecretsPath returns the path of the secrets API the server supports best: /api/v2/secrets
+// or /api/secrets. It reports whether that is API v2.
+func (c *Client) SecretsPath() (string, bool, error) {
+	version, err := c.Version()
+	if err != nil {
+		return "", false, err
+	}
+	if version.Supports("v2") {
+		return "/api/v2/secrets", true, nil
+	}
+	return "/api/secrets", false, nil
+}
@@ -1,7 +1,6 @@
 package commands
 
 import (
-	"encoding/json"
 	"fmt"
 	"gophkeeper/client/internal/api"
 	"net/http"
@@ -23,7 +22,12 @@ var deleteCmd = &cobra.Command{
 		}
 
 		client := api.NewClient()
-		resp, err := client.AuthenticatedRequest(http.MethodDelete, fmt.Sprintf("/api/secrets/%d", secretID), nil)
+		path, _, err := client.SecretsPath()
+		if err != nil {
+			fmt.Printf("Error sending request: %v\n", err)
+			return
+		}
+		resp, err := client.AuthenticatedRequest(http.MethodDelete, fmt.Sprintf("%s/%d", path, secretID), nil)
 		if err != nil {
 			fmt.Printf("Error sending request: %v\n", err)
 			return
@@ -31,17 +35,7 @@ var deleteCmd = &cobra.Command{
 		defer resp.Body.Close()
 
 		if resp.StatusCode != http.StatusNoContent {
-			// Read the response body for more detailed error message
-			// (even for 404, the server handler might write a message)
-			// Assuming the server returns JSON error messages
-			var errMessage map[string]string
-			if json.NewDecoder(resp.Body).Decode(&errMessage) == nil {
-				if msg, ok := errMessage["message"]; ok {
-					fmt.Printf("Deletion failed: %s (Status: %d)\n", msg, resp.StatusCode)
-					return
-				}
-			}
-			fmt.Printf("Deletion failed: Unexpected status code %d\n", resp.StatusCode)
+			printFailure("Deletion failed", resp)
 			return
 		}
 
@@ -0,0 +1,39 @@
+package commands
+
+import (
+	"fmt"
+	"gophkeeper/client/internal/api"
+	"net/http"
+)
+
+// printFailure prints the error response of the server after prefix, such as
+// "Operation failed", with a hint for errors the user can act on.
+func printFailure(prefix string, resp *http.Response) {
+	apiErr := api.ParseError(resp)
+	fmt.Printf("%s: %v\n", prefix, apiErr)
+
+	switch apiErr.Code {
+	case "invalid_token", "token_revoked":
+		fmt.Println("Log in again with 'gophkeeper-cli login'.")
+	case "login_throttled":
+		if retryAfter, ok := apiErr.Details["retry_after"].(float64); ok {
+			fmt.Printf("Too many failed attempts. Try again in %.0f seconds.\n", retryAfter)
+		}
+	case "revision_conflict":
+		if revision, ok := apiErr.Details["revision"].(float64); ok {
+			fmt.Printf("The secret was modified since, its current revision is %.0f. Get it again before updating.\n", revision)
+		}
+	case "recent_login_required":
+		fmt.Println("Log in again with 'gophkeeper-cli login' and repeat the command.")
+	case "identity_link_required":
+		if linkCode, ok := apiErr.Details["link_code"].(string); ok {
+			printLinkHint(linkCode)
+		}
+	}
+}
+
+// printLinkHint tells how to link an identity provider account to an existing account.
+func printLinkHint(linkCode string) {
+	fmt.Println("An account with this login already exists. To sign in with the identity provider, link it:")
+	fmt.Printf("\n  gophkeeper-cli login -l <login> -p <password> --link-code %s\n\n", linkCode)
+}
@@ -5,8 +5,10 @@ import (
 	"fmt"
 	"gophkeeper/client/internal/api"
 	"gophkeeper/client/internal/models"
-	"io"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 )
@@ -18,17 +20,33 @@ var getCmd = &cobra.Command{
 Requires authentication.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		secretID, _ := cmd.Flags().GetInt("id")
+		metadata, _ := cmd.Flags().GetString("metadata")
+		keyword, _ := cmd.Flags().GetString("keyword")
 
 		client := api.NewClient()
-		var resp *http.Response
-		var err error
+		path, v2, err := client.SecretsPath()
+		if err != nil {
+			fmt.Printf("Error sending request: %v\n", err)
+			return
+		}
 
+		var resp *http.Response
 		if secretID != 0 {
 			// Get specific secret by ID
-			resp, err = client.AuthenticatedRequest(http.MethodGet, fmt.Sprintf("/api/secrets/%d", secretID), nil)
+			resp, err = client.AuthenticatedRequest(http.MethodGet, fmt.Sprintf("%s/%d", path, secretID), nil)
 		} else {
-			// Get all secrets
-			resp, err = client.AuthenticatedRequest(http.MethodGet, "/api/secrets", nil)
+			// Get all secrets, optionally filtered on the server
+			query := url.Values{}
+			if metadata != "" {
+				query.Set("metadata", metadata)
+			}
+			if keyword != "" {
+				query.Set("keyword", keyword)
+			}
+			if len(query) > 0 {
+				path += "?" + query.Encode()
+			}
+			resp, err = client.AuthenticatedRequest(http.MethodGet, path, nil)
 		}
 
 		if err != nil {
@@ -38,38 +56,93 @@ Requires authentication.`,
 		defer resp.Body.Close()
 
 		if resp.StatusCode != http.StatusOK {
-			bodyBytes, _ := io.ReadAll(resp.Body)
-			fmt.Printf("Operation failed: %s (Status: %d)\n", string(bodyBytes), resp.StatusCode)
+			printFailure("Operation failed", resp)
 			return
 		}
 
-		if secretID != 0 {
-			var secret models.Secret
-			if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
-				fmt.Printf("Error decoding secret: %v\n", err)
-				return
+		var secrets []string
+		if v2 {
+			var decoded []models.SecretV2
+			if secretID != 0 {
+				decoded = make([]models.SecretV2, 1)
+				err = json.NewDecoder(resp.Body).Decode(&decoded[0])
+			} else {
+				err = json.NewDecoder(resp.Body).Decode(&decoded)
 			}
-			fmt.Printf("Secret ID: %d, Type: %s, Data: %s, Metadata: %s\n", secret.ID, secret.Type.String(), string(secret.Data), secret.Metadata)
-		} else {
-			var secrets []models.Secret
-			if err := json.NewDecoder(resp.Body).Decode(&secrets); err != nil {
-				fmt.Printf("Error decoding secrets: %v\n", err)
-				return
+			for _, secret := range decoded {
+				secrets = append(secrets, formatSecretV2(secret))
 			}
-			if len(secrets) == 0 {
-				fmt.Println("No secrets found.")
-				return
+		} else {
+			var decoded []models.Secret
+			if secretID != 0 {
+				decoded = make([]models.Secret, 1)
+				err = json.NewDecoder(resp.Body).Decode(&decoded[0])
+			} else {
+				err = json.NewDecoder(resp.Body).Decode(&decoded)
 			}
-			fmt.Println("Your secrets:")
-			for _, secret := range secrets {
-				fmt.Printf("  ID: %d, Type: %s, Data: %s, Metadata: %s\n", secret.ID, secret.Type.String(), string(secret.Data), secret.Metadata)
+			for _, secret := range decoded {
+				secrets = append(secrets, fmt.Sprintf("ID: %d, Type: %s, Data: %s, Metadata: %s", secret.ID, secret.Type.String(), string(secret.Data), secret.Metadata))
 			}
 		}
+		if err != nil {
+			fmt.Printf("Error decoding secrets: %v\n", err)
+			return
+		}
+
+		if secretID != 0 {
+			fmt.Printf("Secret %s\n", secrets[0])
+			return
+		}
+		if len(secrets) == 0 {
+			fmt.Println("No secrets found.")
+			return
+		}
+		fmt.Println("Your secrets:")
+		for _, secret := range secrets {
+			fmt.Printf("  %s\n", secret)
+		}
 	},
 }
 
+// formatSecretV2 describes a secret of API v2 on one line, with the fields of its payload.
+func formatSecretV2(secret models.SecretV2) string {
+	var fields []string
+	switch secret.Type {
+	case "login":
+		var login models.LoginPayload
+		json.Unmarshal(secret.Payload, &login)
+		if login.Raw != nil {
+			fields = append(fields, "Data: "+string(login.Raw))
+		} else {
+			fields = append(fields, "Login: "+login.Login, "Password: "+login.Password)
+		}
+	case "text":
+		var text models.TextPayload
+		json.Unmarshal(secret.Payload, &text)
+		fields = append(fields, "Data: "+text.Text)
+	case "bankcard":
+		var card models.BankCardPayload
+		json.Unmarshal(secret.Payload, &card)
+		if card.Raw != nil {
+			fields = append(fields, "Data: "+string(card.Raw))
+		} else {
+			fields = append(fields, "Number: "+card.Number, "Holder: "+card.Holder, "Expiry: "+card.Expiry, "CVV: "+card.CVV)
+		}
+	default:
+		var binary models.BinaryPayload
+		json.Unmarshal(secret.Payload, &binary)
+		fields = append(fields, "Data: "+string(binary.Data))
+	}
+
+	return fmt.Sprintf("ID: %d, Type: %s, %s, Metadata: %s, Revision: %d, Updated: %s",
+		secret.ID, secret.Type, strings.Join(fields, ", "), secret.Metadata, secret.Revision,
+		secret.UpdatedAt.Local().Format(time.DateTime))
+}
+
 func init() {
 	rootCmd.AddCommand(getCmd)
 
 	getCmd.Flags().IntP("id", "i", 0, "Optional: ID of the secret to retrieve")
+	getCmd.Flags().StringP("metadata", "m", "", "Optional: only secrets whose metadata is exactly this value")
+	getCmd.Flags().StringP("keyword", "k", "", "Optional: only secrets whose metadata contains this word")
 }
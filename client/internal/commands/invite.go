@@ -0,0 +1,124 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"gophkeeper/client/internal/api"
+	"gophkeeper/client/internal/models"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var inviteCmd = &cobra.Command{
+	Use:   "invite",
+	Short: "Manage registration invites",
+	Long: `Issue, list and revoke single-use invite codes for servers where registration is
+invite-only. Requires authentication as an administrator.`,
+}
+
+var inviteExpires time.Duration
+
+var inviteCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Issue an invite code",
+	Run: func(cmd *cobra.Command, args []string) {
+		client := api.NewClient()
+		resp, err := client.AuthenticatedRequest(http.MethodPost, "/api/invites", models.CreateInviteRequest{
+			ExpiresIn: int64(inviteExpires.Seconds()),
+		})
+		if err != nil {
+			fmt.Printf("Error sending request: %v\n", err)
+			return
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusCreated {
+			printFailure("Operation failed", resp)
+			return
+		}
+
+		var created models.CreatedInvite
+		if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+			fmt.Printf("Error decoding invite: %v\n", err)
+			return
+		}
+
+		fmt.Printf("Invite %s created, valid until %s:\n\n  %s\n\n", created.ID, created.ExpiresAt.Local().Format(time.DateTime), created.Code)
+		fmt.Println("Register with: gophkeeper-cli register -l <login> -p <password> --invite <code>")
+	},
+}
+
+var inviteListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List invites",
+	Run: func(cmd *cobra.Command, args []string) {
+		client := api.NewClient()
+		resp, err := client.AuthenticatedRequest(http.MethodGet, "/api/invites", nil)
+		if err != nil {
+			fmt.Printf("Error sending request: %v\n", err)
+			return
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			printFailure("Operation failed", resp)
+			return
+		}
+
+		var invites []models.Invite
+		if err := json.NewDecoder(resp.Body).Decode(&invites); err != nil {
+			fmt.Printf("Error decoding invites: %v\n", err)
+			return
+		}
+		if len(invites) == 0 {
+			fmt.Println("No invites found.")
+			return
+		}
+
+		fmt.Println("Invites:")
+		for _, invite := range invites {
+			status := "unused"
+			if invite.UsedAt != nil {
+				status = fmt.Sprintf("used by %s at %s", invite.UsedBy, invite.UsedAt.Local().Format(time.DateTime))
+			} else if time.Now().After(invite.ExpiresAt) {
+				status = "expired"
+			}
+			fmt.Printf("  ID: %s\n    Created: %s, Expires: %s\n    Status: %s\n",
+				invite.ID, invite.CreatedAt.Local().Format(time.DateTime), invite.ExpiresAt.Local().Format(time.DateTime), status)
+		}
+	},
+}
+
+var inviteRevokeCmd = &cobra.Command{
+	Use:   "revoke <id>",
+	Short: "Revoke an invite",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		client := api.NewClient()
+		resp, err := client.AuthenticatedRequest(http.MethodDelete, "/api/invites/"+url.PathEscape(args[0]), nil)
+		if err != nil {
+			fmt.Printf("Error sending request: %v\n", err)
+			return
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusNoContent {
+			printFailure("Operation failed", resp)
+			return
+		}
+
+		fmt.Println("Invite revoked.")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(inviteCmd)
+	inviteCmd.AddCommand(inviteCreateCmd)
+	inviteCmd.AddCommand(inviteListCmd)
+	inviteCmd.AddCommand(inviteRevokeCmd)
+
+	inviteCreateCmd.Flags().DurationVar(&inviteExpires, "expires", 0, "Lifetime of the invite, e.g. 72h (default: set by the server)")
+}
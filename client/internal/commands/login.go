@@ -1,11 +1,10 @@
 package commands
 
 import (
-	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"gophkeeper/client/internal/api"
-	"gophkeeper/client/internal/config"
 	"gophkeeper/client/internal/models"
 	"net/http"
 
@@ -15,58 +14,179 @@ import (
 var loginCmd = &cobra.Command{
 	Use:   "login",
 	Short: "Login to GophKeeper",
-	Long:  `Login to the GophKeeper server with your username and password to obtain an authentication token.`,
+	Long: `Login to the GophKeeper server with your username and password to obtain an authentication token.
+If two-factor authentication is enabled, the code from your authenticator app is asked for as well.
+The password is never sent: the login uses SRP. Accounts that still log in with a
+password (e.g. LDAP accounts) need --no-srp, which is refused for accounts that this
+client has seen using SRP on the server; switch them with "srp enable".
+
+With --sso, sign in through the identity provider of the server (OpenID Connect) in a
+browser instead; add --device on machines without a browser to enter a code on another device.
+If the identity provider account has the login of an existing account, the sign-in prints a
+link code: log in with the password and --link-code to allow single sign-on to that account.
+Likewise, --ldap-login and --ldap-password link a directory account to the account after
+logging in, so that the directory password logs in to it too.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		login, _ := cmd.Flags().GetString("login")
 		password, _ := cmd.Flags().GetString("password")
+		totpCode, _ := cmd.Flags().GetString("totp")
+		recoveryCode, _ := cmd.Flags().GetString("recovery-code")
+		sso, _ := cmd.Flags().GetBool("sso")
+		device, _ := cmd.Flags().GetBool("device")
+		linkCode, _ := cmd.Flags().GetString("link-code")
+		noSRP, _ := cmd.Flags().GetBool("no-srp")
+		ldapLogin, _ := cmd.Flags().GetString("ldap-login")
+		ldapPassword, _ := cmd.Flags().GetString("ldap-password")
 
-		if login == "" || password == "" {
-			fmt.Println("Error: Login and password cannot be empty.")
-			cmd.Help()
+		if sso && linkCode != "" {
+			fmt.Println("Error: --link-code requires a login with the password.")
 			return
 		}
-
-		user := models.User{
-			Login:    login,
-			Password: password,
+		if (ldapLogin == "") != (ldapPassword == "") {
+			fmt.Println("Error: --ldap-login and --ldap-password must be given together.")
+			return
 		}
 
 		client := api.NewClient()
-		resp, err := client.Request(http.MethodPost, "/api/user/login", user)
+		var resp *http.Response
+		var err error
+		switch {
+		case sso && device:
+			resp, err = deviceLogin(client)
+		case sso:
+			resp, err = browserLogin(client)
+		case login == "" || password == "":
+			fmt.Println("Error: Login and password cannot be empty.")
+			cmd.Help()
+			return
+		case noSRP:
+			usesSRP, recordErr := client.UsesSRP(login)
+			if recordErr != nil {
+				fmt.Printf("Error: %v\n", recordErr)
+				return
+			}
+			if usesSRP {
+				fmt.Printf("Error: %s logs in with SRP on this server; refusing to send the password.\n", login)
+				return
+			}
+			resp, err = client.Request(http.MethodPost, "/api/user/login", models.LoginRequest{
+				Login:    login,
+				Password: password,
+			})
+		default:
+			resp, err = client.LoginSRP(login, password)
+			if errors.Is(err, api.ErrSRPUnavailable) {
+				fmt.Printf("Error: %v. Add --no-srp to send the password to the server instead.\n", err)
+				return
+			}
+		}
+		var linkErr *linkRequiredError
+		if errors.As(err, &linkErr) {
+			fmt.Printf("Login failed: %v\n", err)
+			printLinkHint(linkErr.linkCode)
+			return
+		}
 		if err != nil {
 			fmt.Printf("Error sending login request: %v\n", err)
 			return
 		}
 		defer resp.Body.Close()
 
+		if resp.StatusCode == http.StatusAccepted {
+			var challenge models.MFAChallenge
+			if err := json.NewDecoder(resp.Body).Decode(&challenge); err != nil {
+				fmt.Printf("Error decoding login response: %v\n", err)
+				return
+			}
+
+			if totpCode == "" && recoveryCode == "" {
+				if totpCode, err = prompt("Two-factor code (or recovery code): "); err != nil {
+					fmt.Printf("Error: %v\n", err)
+					return
+				}
+				// Recovery codes are longer than TOTP codes
+				if len(totpCode) > 8 {
+					recoveryCode, totpCode = totpCode, ""
+				}
+			}
+
+			resp, err = client.Request(http.MethodPost, "/api/user/login/totp", models.MFALoginRequest{
+				Challenge:    challenge.Challenge,
+				Code:         totpCode,
+				RecoveryCode: recoveryCode,
+			})
+			if err != nil {
+				fmt.Printf("Error sending login request: %v\n", err)
+				return
+			}
+			defer resp.Body.Close()
+		}
+
 		if resp.StatusCode != http.StatusOK {
-			buf := new(bytes.Buffer)
-			buf.ReadFrom(resp.Body)
-			fmt.Printf("Login failed: %s\n", buf.String())
+			printFailure("Login failed", resp)
+			if resp.StatusCode == http.StatusUnauthorized && !sso && !noSRP {
+				fmt.Println("If the account still logs in with a password, add --no-srp.")
+			}
 			return
 		}
 
-		var result map[string]string
+		var result models.TokenResponse
 		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
 			fmt.Printf("Error decoding login response: %v\n", err)
 			return
 		}
 
-		token, ok := result["token"]
-		if !ok || token == "" {
+		if result.Token == "" {
 			fmt.Println("Login failed: no token received.")
 			return
 		}
 
-		// Store the token locally
+		// Store the tokens locally
 		// TODO: Implement secure storage of token, for now just in config.
-		err = config.SaveToken(token)
-		if err != nil {
+		if err := api.SaveTokens(result); err != nil {
 			fmt.Printf("Error saving token: %v\n", err)
 			return
 		}
 
 		fmt.Println("Login successful! Token saved.")
+		switch {
+		case noSRP:
+			fmt.Println("The password was sent to the server. Switch the account to SRP with 'gophkeeper-cli srp enable' if it allows it.")
+		case !sso:
+			if err := client.RememberSRP(login); err != nil {
+				fmt.Printf("Warning: %v\n", err)
+			}
+		}
+
+		if linkCode != "" {
+			resp, err := client.AuthenticatedRequest(http.MethodPost, "/api/user/oidc/link", models.OIDCLinkRequest{LinkCode: linkCode})
+			if err != nil {
+				fmt.Printf("Error sending link request: %v\n", err)
+				return
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != http.StatusNoContent {
+				printFailure("Linking failed", resp)
+				return
+			}
+			fmt.Println("Identity provider account linked. You can now log in with --sso.")
+		}
+
+		if ldapLogin != "" {
+			resp, err := client.AuthenticatedRequest(http.MethodPost, "/api/user/ldap/link", models.LDAPLinkRequest{Login: ldapLogin, Password: ldapPassword})
+			if err != nil {
+				fmt.Printf("Error sending link request: %v\n", err)
+				return
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != http.StatusNoContent {
+				printFailure("Linking failed", resp)
+				return
+			}
+			fmt.Println("Directory account linked. You can now log in with its password and --no-srp.")
+		}
 	},
 }
 
@@ -75,6 +195,12 @@ func init() {
 
 	loginCmd.Flags().StringP("login", "l", "", "User login/username")
 	loginCmd.Flags().StringP("password", "p", "", "User password")
-	loginCmd.MarkFlagRequired("login")
-	loginCmd.MarkFlagRequired("password")
+	loginCmd.Flags().String("totp", "", "Two-factor code; prompted for if required and not given")
+	loginCmd.Flags().String("recovery-code", "", "Two-factor recovery code, if the authenticator is not available")
+	loginCmd.Flags().Bool("sso", false, "Sign in through the identity provider of the server in a browser")
+	loginCmd.Flags().Bool("device", false, "With --sso, sign in by entering a code on another device")
+	loginCmd.Flags().Bool("no-srp", false, "Send the password to the server, for accounts that do not use SRP")
+	loginCmd.Flags().String("link-code", "", "Link the identity provider account of a failed --sso sign-in after logging in")
+	loginCmd.Flags().String("ldap-login", "", "Link the directory account with this login after logging in")
+	loginCmd.Flags().String("ldap-password", "", "Password of the directory account to link")
 }
@@ -0,0 +1,50 @@
+package commands
+
+import (
+	"fmt"
+	"gophkeeper/client/internal/api"
+	"gophkeeper/client/internal/config"
+	"net/http"
+
+	"github.com/spf13/cobra"
+)
+
+var logoutCmd = &cobra.Command{
+	Use:   "logout",
+	Short: "Logout from GophKeeper",
+	Long: `Revoke the current tokens on the GophKeeper server and remove them from this device.
+The local tokens are removed even if the server cannot be reached.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if _, err := config.LoadToken(); err != nil {
+			fmt.Println("Not logged in.")
+			return
+		}
+
+		body := map[string]string{}
+		if refreshToken, err := config.LoadRefreshToken(); err == nil {
+			body["refresh_token"] = refreshToken
+		}
+
+		client := api.NewClient()
+		resp, err := client.AuthenticatedRequest(http.MethodPost, "/api/user/logout", body)
+		if err != nil {
+			fmt.Printf("Warning: could not revoke tokens on the server: %v\n", err)
+		} else {
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusNoContent {
+				fmt.Printf("Warning: could not revoke tokens on the server: %v\n", api.ParseError(resp))
+			}
+		}
+
+		if err := config.DeleteTokens(); err != nil {
+			fmt.Printf("Error removing local tokens: %v\n", err)
+			return
+		}
+
+		fmt.Println("Logged out.")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(logoutCmd)
+}
@@ -0,0 +1,21 @@
+package commands
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// stdin is shared by prompts so that buffered input is not lost between them
+var stdin = bufio.NewReader(os.Stdin)
+
+// prompt prints a message and reads one line from standard input.
+func prompt(message string) (string, error) {
+	fmt.Print(message)
+	line, err := stdin.ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("failed to read input: %w", err)
+	}
+	return strings.TrimSpace(line), nil
+}
@@ -0,0 +1,129 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"gophkeeper/client/internal/api"
+	"gophkeeper/client/internal/models"
+	"net/http"
+
+	"github.com/spf13/cobra"
+)
+
+var recoverCmd = &cobra.Command{
+	Use:   "recover",
+	Short: "Reset a forgotten password with a recovery code",
+	Long: `Set a new password with one of the recovery codes shown at registration.
+All sessions of the account are ended; log in again with the new password.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		login, _ := cmd.Flags().GetString("login")
+		code, _ := cmd.Flags().GetString("code")
+		password, _ := cmd.Flags().GetString("password")
+
+		client := api.NewClient()
+		if err := client.CheckPassword(login, password); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+
+		resp, err := client.Recover(login, code, password)
+		if err != nil {
+			fmt.Printf("Error sending request: %v\n", err)
+			return
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusNoContent {
+			printFailure("Recovery failed", resp)
+			return
+		}
+
+		fmt.Println("Password reset. Log in with the new password.")
+		if err := client.RememberSRP(login); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		}
+	},
+}
+
+var recoveryCodesCmd = &cobra.Command{
+	Use:   "recovery-codes",
+	Short: "Manage account recovery codes",
+	Long: `Show how many account recovery codes are left or replace them with new ones.
+Requires authentication.`,
+}
+
+var recoveryCodesStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the number of unused recovery codes",
+	Run: func(cmd *cobra.Command, args []string) {
+		client := api.NewClient()
+		resp, err := client.AuthenticatedRequest(http.MethodGet, "/api/user/recovery-codes", nil)
+		if err != nil {
+			fmt.Printf("Error sending request: %v\n", err)
+			return
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			printFailure("Operation failed", resp)
+			return
+		}
+
+		var status models.RecoveryCodesStatus
+		if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+			fmt.Printf("Error decoding response: %v\n", err)
+			return
+		}
+
+		fmt.Printf("Unused recovery codes: %d\n", status.Remaining)
+		if status.Remaining == 0 {
+			fmt.Println("Generate new ones with: gophkeeper-cli recovery-codes regenerate")
+		}
+	},
+}
+
+var recoveryCodesRegenerateCmd = &cobra.Command{
+	Use:   "regenerate",
+	Short: "Replace the recovery codes with new ones",
+	Long: `Generate new account recovery codes; the old ones stop working.
+The server only allows this shortly after logging in.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		client := api.NewClient()
+		resp, err := client.AuthenticatedRequest(http.MethodPost, "/api/user/recovery-codes", nil)
+		if err != nil {
+			fmt.Printf("Error sending request: %v\n", err)
+			return
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			printFailure("Operation failed", resp)
+			return
+		}
+
+		var recovery models.RecoveryCodes
+		if err := json.NewDecoder(resp.Body).Decode(&recovery); err != nil {
+			fmt.Printf("Error decoding response: %v\n", err)
+			return
+		}
+
+		fmt.Println("Recovery codes (each works once; store them safely, they are not shown again):")
+		for _, code := range recovery.RecoveryCodes {
+			fmt.Printf("  %s\n", code)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(recoverCmd)
+	rootCmd.AddCommand(recoveryCodesCmd)
+	recoveryCodesCmd.AddCommand(recoveryCodesStatusCmd)
+	recoveryCodesCmd.AddCommand(recoveryCodesRegenerateCmd)
+
+	recoverCmd.Flags().StringP("login", "l", "", "User login/username")
+	recoverCmd.Flags().StringP("code", "c", "", "Recovery code")
+	recoverCmd.Flags().StringP("password", "p", "", "New password")
+	recoverCmd.MarkFlagRequired("login")
+	recoverCmd.MarkFlagRequired("code")
+	recoverCmd.MarkFlagRequired("password")
+}
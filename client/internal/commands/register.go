@@ -1,7 +1,7 @@
 package commands
 
 import (
-	"bytes"
+	"encoding/json"
 	"fmt"
 	"gophkeeper/client/internal/api"
 	"gophkeeper/client/internal/models"
@@ -13,10 +13,15 @@ import (
 var registerCmd = &cobra.Command{
 	Use:   "register",
 	Short: "Register a new user",
-	Long:  `Register a new user with a username and password on the GophKeeper server.`,
+	Long: `Register a new user with a username and password on the GophKeeper server.
+The password is not sent to the server: it only stores an SRP verifier derived from it.
+For servers without SRP, --no-srp registers with a password that is sent to the server.
+If registration on the server is invite-only, pass the invite code from an administrator with --invite.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		login, _ := cmd.Flags().GetString("login")
 		password, _ := cmd.Flags().GetString("password")
+		invite, _ := cmd.Flags().GetString("invite")
+		noSRP, _ := cmd.Flags().GetBool("no-srp")
 
 		if login == "" || password == "" {
 			fmt.Println("Error: Login and password cannot be empty.")
@@ -24,13 +29,31 @@ var registerCmd = &cobra.Command{
 			return
 		}
 
-		user := models.User{
-			Login:    login,
-			Password: password,
+		client := api.NewClient()
+		// The server never sees the password with SRP, so it cannot check it against its policy
+		if !noSRP {
+			if err := client.CheckPassword(login, password); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return
+			}
 		}
 
-		client := api.NewClient()
-		resp, err := client.Request(http.MethodPost, "/api/user/register", user)
+		var resp *http.Response
+		var err error
+		if noSRP {
+			resp, err = client.Request(http.MethodPost, "/api/user/register", models.RegisterRequest{
+				Login:    login,
+				Password: password,
+				Invite:   invite,
+			})
+		} else {
+			resp, err = client.RegisterSRP(login, password, invite)
+		}
+		if err == nil && resp.StatusCode == http.StatusNotFound && !noSRP {
+			resp.Body.Close()
+			fmt.Println("Error: the server does not support SRP. Add --no-srp to register with a password sent to the server.")
+			return
+		}
 		if err != nil {
 			fmt.Printf("Error sending registration request: %v\n", err)
 			return
@@ -38,13 +61,28 @@ var registerCmd = &cobra.Command{
 		defer resp.Body.Close()
 
 		if resp.StatusCode != http.StatusCreated {
-			buf := new(bytes.Buffer)
-			buf.ReadFrom(resp.Body)
-			fmt.Printf("Registration failed: %s\n", buf.String())
+			printFailure("Registration failed", resp)
+			return
+		}
+
+		var registered models.RecoveryCodes
+		if err := json.NewDecoder(resp.Body).Decode(&registered); err != nil {
+			fmt.Printf("Error decoding registration response: %v\n", err)
 			return
 		}
 
 		fmt.Println("User registered successfully!")
+		if !noSRP {
+			if err := client.RememberSRP(login); err != nil {
+				fmt.Printf("Warning: %v\n", err)
+			}
+		}
+		if len(registered.RecoveryCodes) > 0 {
+			fmt.Println("Recovery codes reset the password if you forget it (each works once; store them safely, they are not shown again):")
+			for _, code := range registered.RecoveryCodes {
+				fmt.Printf("  %s\n", code)
+			}
+		}
 	},
 }
 
@@ -53,6 +91,8 @@ func init() {
 
 	registerCmd.Flags().StringP("login", "l", "", "User login/username")
 	registerCmd.Flags().StringP("password", "p", "", "User password")
+	registerCmd.Flags().String("invite", "", "Invite code, if registration is invite-only")
+	registerCmd.Flags().Bool("no-srp", false, "Send the password to the server, for servers without SRP")
 	registerCmd.MarkFlagRequired("login")
 	registerCmd.MarkFlagRequired("password")
 }
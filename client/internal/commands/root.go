@@ -2,6 +2,7 @@ package commands
 
 import (
 	"fmt"
+	"gophkeeper/client/internal/api"
 	"os"
 
 	"github.com/spf13/cobra"
@@ -23,6 +24,7 @@ your sensitive information like logins, passwords, and other private data.`,
 func Execute() {
 	// Set the version string for the root command
 	rootCmd.Version = fmt.Sprintf("%s (Build Date: %s)", Version, BuildDate)
+	api.UserAgent = "gophkeeper-cli/" + Version
 
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
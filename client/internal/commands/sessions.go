@@ -0,0 +1,89 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"gophkeeper/client/internal/api"
+	"gophkeeper/client/internal/models"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var sessionsCmd = &cobra.Command{
+	Use:   "sessions",
+	Short: "Manage login sessions",
+	Long: `List the devices your account is logged in on and revoke their sessions.
+Requires authentication.`,
+}
+
+var sessionsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List login sessions",
+	Run: func(cmd *cobra.Command, args []string) {
+		client := api.NewClient()
+		resp, err := client.AuthenticatedRequest(http.MethodGet, "/api/user/sessions", nil)
+		if err != nil {
+			fmt.Printf("Error sending request: %v\n", err)
+			return
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			printFailure("Operation failed", resp)
+			return
+		}
+
+		var sessions []models.Session
+		if err := json.NewDecoder(resp.Body).Decode(&sessions); err != nil {
+			fmt.Printf("Error decoding sessions: %v\n", err)
+			return
+		}
+		if len(sessions) == 0 {
+			fmt.Println("No sessions found.")
+			return
+		}
+
+		fmt.Println("Your sessions:")
+		for _, session := range sessions {
+			current := ""
+			if session.Current {
+				current = " (current)"
+			}
+			fmt.Printf("  ID: %s%s\n    Device: %s, Client: %s, IP: %s\n    Logged in: %s, Last seen: %s\n",
+				session.ID, current, session.DeviceName, session.ClientVersion, session.IP,
+				session.CreatedAt.Local().Format(time.DateTime), session.LastSeenAt.Local().Format(time.DateTime))
+		}
+	},
+}
+
+var sessionsRevokeCmd = &cobra.Command{
+	Use:   "revoke <id>",
+	Short: "Revoke a login session",
+	Long:  `Log out the device of a session. Its tokens stop working immediately.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		client := api.NewClient()
+		resp, err := client.AuthenticatedRequest(http.MethodDelete, "/api/user/sessions/"+url.PathEscape(args[0]), nil)
+		if err != nil {
+			fmt.Printf("Error sending request: %v\n", err)
+			return
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusNoContent {
+			printFailure("Operation failed", resp)
+			return
+		}
+
+		fmt.Println("Session revoked.")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(sessionsCmd)
+	sessionsCmd.AddCommand(sessionsListCmd)
+	sessionsCmd.AddCommand(sessionsRevokeCmd)
+}
@@ -1,7 +1,6 @@
 package commands
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
 	"gophkeeper/client/internal/api"
@@ -15,51 +14,60 @@ var setCmd = &cobra.Command{
 	Use:   "set",
 	Short: "Store a new secret",
 	Long: `Store a new secret of a specified type (login/password, text, binary, bank card)
-on the GophKeeper server. Requires authentication.`,
+on the GophKeeper server. Requires authentication.
+
+Login secrets take --login and --password, bank cards --number, --holder, --expiry and --cvv;
+--data stores the value as is for every type. With --revision, an update fails if the
+secret was modified since that revision (see "get").`,
 	Run: func(cmd *cobra.Command, args []string) {
 		secretTypeStr, _ := cmd.Flags().GetString("type")
-		dataStr, _ := cmd.Flags().GetString("data")
 		metadata, _ := cmd.Flags().GetString("metadata")
 		secretID, _ := cmd.Flags().GetInt("id") // 0 if not provided
+		revision, _ := cmd.Flags().GetInt("revision")
+
+		secretType, ok := models.ParseSecretType(secretTypeStr)
+		if !ok {
+			fmt.Printf("Error: Invalid secret type '%s'. Valid types are: login, text, binary, bankcard.\n", secretTypeStr)
+			return
+		}
 
-		if secretTypeStr == "" || dataStr == "" {
-			fmt.Println("Error: Secret type and data cannot be empty.")
+		payload, err := secretPayload(cmd, secretType)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
 			cmd.Help()
 			return
 		}
 
-		var secretType models.SecretType
-		switch secretTypeStr {
-		case "login":
-			secretType = models.LoginPasswordType
-		case "text":
-			secretType = models.TextDataType
-		case "binary":
-			secretType = models.BinaryDataType
-		case "bankcard":
-			secretType = models.BankCardType
-		default:
-			fmt.Printf("Error: Invalid secret type '%s'. Valid types are: login, text, binary, bankcard.\n", secretTypeStr)
+		client := api.NewClient()
+		path, v2, err := client.SecretsPath()
+		if err != nil {
+			fmt.Printf("Error sending request: %v\n", err)
+			return
+		}
+		if revision != 0 && !v2 {
+			fmt.Println("Error: --revision requires a server with API v2.")
 			return
 		}
 
-		secret := models.Secret{
-			Type:     secretType,
-			Data:     []byte(dataStr),
-			Metadata: metadata,
+		var body any
+		if v2 {
+			body = models.SecretV2Request{Type: secretTypeStr, Metadata: metadata, Payload: payload, Revision: revision}
+		} else {
+			data, err := payloadData(payload)
+			if err != nil {
+				fmt.Printf("Error encoding secret: %v\n", err)
+				return
+			}
+			body = models.Secret{ID: secretID, Type: secretType, Data: data, Metadata: metadata}
 		}
 
-		client := api.NewClient()
 		var resp *http.Response
-		var err error
-
 		if secretID != 0 {
 			// Update existing secret
-			secret.ID = secretID
-			resp, err = client.AuthenticatedRequest(http.MethodPut, fmt.Sprintf("/api/secrets/%d", secretID), secret)
+			resp, err = client.AuthenticatedRequest(http.MethodPut, fmt.Sprintf("%s/%d", path, secretID), body)
 		} else {
 			// Create new secret
-			resp, err = client.AuthenticatedRequest(http.MethodPost, "/api/secrets", secret)
+			resp, err = client.AuthenticatedRequest(http.MethodPost, path, body)
 		}
 
 		if err != nil {
@@ -69,26 +77,97 @@ on the GophKeeper server. Requires authentication.`,
 		defer resp.Body.Close()
 
 		if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
-			buf := new(bytes.Buffer)
-			buf.ReadFrom(resp.Body)
-			fmt.Printf("Operation failed: %s (Status: %d)\n", buf.String(), resp.StatusCode)
+			printFailure("Operation failed", resp)
 			return
 		}
 
-		var resultSecret models.Secret
+		// The ID and the revision are the only fields both versions need
+		var resultSecret models.SecretV2
 		if err := json.NewDecoder(resp.Body).Decode(&resultSecret); err != nil {
 			fmt.Printf("Error decoding response: %v\n", err)
 			return
 		}
 
-		if secretID != 0 {
+		switch {
+		case secretID != 0 && v2:
+			fmt.Printf("Secret ID %d updated successfully! Revision: %d\n", resultSecret.ID, resultSecret.Revision)
+		case secretID != 0:
 			fmt.Printf("Secret ID %d updated successfully!\n", resultSecret.ID)
-		} else {
+		default:
 			fmt.Printf("Secret created successfully with ID: %d\n", resultSecret.ID)
 		}
 	},
 }
 
+// secretPayload builds the API v2 payload of a secret from the flags of the set command.
+func secretPayload(cmd *cobra.Command, secretType models.SecretType) (any, error) {
+	flag := func(name string) string {
+		value, _ := cmd.Flags().GetString(name)
+		return value
+	}
+	data := flag("data")
+
+	switch secretType {
+	case models.LoginPasswordType:
+		login := models.LoginPayload{Login: flag("login"), Password: flag("password")}
+		if login.Login != "" || login.Password != "" {
+			if data != "" {
+				return nil, fmt.Errorf("--data cannot be combined with --login and --password")
+			}
+			return login, nil
+		}
+		if data == "" {
+			return nil, fmt.Errorf("login secrets need --login and --password or --data")
+		}
+		return models.LoginPayload{Raw: []byte(data)}, nil
+	case models.BankCardType:
+		card := models.BankCardPayload{Number: flag("number"), Holder: flag("holder"), Expiry: flag("expiry"), CVV: flag("cvv")}
+		if card.Number != "" || card.Holder != "" || card.Expiry != "" || card.CVV != "" {
+			if data != "" {
+				return nil, fmt.Errorf("--data cannot be combined with the card flags")
+			}
+			if card.Number == "" {
+				return nil, fmt.Errorf("bank card secrets need --number")
+			}
+			return card, nil
+		}
+		if data == "" {
+			return nil, fmt.Errorf("bank card secrets need --number or --data")
+		}
+		return models.BankCardPayload{Raw: []byte(data)}, nil
+	case models.TextDataType:
+		if data == "" {
+			return nil, fmt.Errorf("secret data cannot be empty")
+		}
+		return models.TextPayload{Text: data}, nil
+	default:
+		if data == "" {
+			return nil, fmt.Errorf("secret data cannot be empty")
+		}
+		return models.BinaryPayload{Data: []byte(data)}, nil
+	}
+}
+
+// payloadData converts a payload to the data of an API v1 secret, in the format API v2
+// servers store it: text and binary data as is, login and bank card fields as JSON.
+func payloadData(payload any) ([]byte, error) {
+	switch payload := payload.(type) {
+	case models.TextPayload:
+		return []byte(payload.Text), nil
+	case models.BinaryPayload:
+		return payload.Data, nil
+	case models.LoginPayload:
+		if payload.Raw != nil {
+			return payload.Raw, nil
+		}
+	case models.BankCardPayload:
+		if payload.Raw != nil {
+			return payload.Raw, nil
+		}
+	}
+	return json.Marshal(payload)
+}
+
 func init() {
 	rootCmd.AddCommand(setCmd)
 
@@ -96,7 +175,13 @@ func init() {
 	setCmd.Flags().StringP("data", "d", "", "The secret data to store")
 	setCmd.Flags().StringP("metadata", "m", "", "Optional metadata for the secret")
 	setCmd.Flags().IntP("id", "i", 0, "Optional: ID of the secret to update (if omitted, creates a new secret)")
+	setCmd.Flags().Int("revision", 0, "Optional: revision of the secret to update; the update fails if it was modified since")
+	setCmd.Flags().String("login", "", "Login of a login secret")
+	setCmd.Flags().String("password", "", "Password of a login secret")
+	setCmd.Flags().String("number", "", "Card number of a bank card secret")
+	setCmd.Flags().String("holder", "", "Card holder of a bank card secret")
+	setCmd.Flags().String("expiry", "", "Expiry date of a bank card secret, e.g. 12/30")
+	setCmd.Flags().String("cvv", "", "CVV of a bank card secret")
 
 	setCmd.MarkFlagRequired("type")
-	setCmd.MarkFlagRequired("data")
 }
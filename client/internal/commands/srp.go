@@ -0,0 +1,55 @@
+package commands
+
+import (
+	"fmt"
+	"gophkeeper/client/internal/api"
+	"net/http"
+
+	"github.com/spf13/cobra"
+)
+
+var srpCmd = &cobra.Command{
+	Use:   "srp",
+	Short: "Manage password-less authentication (SRP)",
+	Long: `With SRP the server stores a verifier instead of a password hash, and logins prove
+knowledge of the password without sending it. Requires authentication.`,
+}
+
+var srpEnableCmd = &cobra.Command{
+	Use:   "enable",
+	Short: "Switch the account to SRP logins",
+	Long: `Replace the password hash of your account with an SRP verifier. The password is sent
+one last time to confirm the change; afterwards the account only accepts SRP logins.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		login, _ := cmd.Flags().GetString("login")
+		password, _ := cmd.Flags().GetString("password")
+
+		client := api.NewClient()
+		resp, err := client.EnableSRP(login, password)
+		if err != nil {
+			fmt.Printf("Error sending request: %v\n", err)
+			return
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusNoContent {
+			printFailure("Operation failed", resp)
+			return
+		}
+
+		fmt.Println("SRP enabled. Your password is no longer sent to the server.")
+		if err := client.RememberSRP(login); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(srpCmd)
+	srpCmd.AddCommand(srpEnableCmd)
+
+	srpEnableCmd.Flags().StringP("login", "l", "", "User login/username")
+	srpEnableCmd.Flags().StringP("password", "p", "", "Current password")
+	srpEnableCmd.MarkFlagRequired("login")
+	srpEnableCmd.MarkFlagRequired("password")
+}
@@ -0,0 +1,134 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gophkeeper/client/internal/api"
+	"gophkeeper/client/internal/models"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// ssoLoginTimeout bounds the time to finish a sign-in in the browser
+const ssoLoginTimeout = 5 * time.Minute
+
+// minDevicePollInterval is the polling interval when the server does not give one (RFC 8628)
+const minDevicePollInterval = 5 * time.Second
+
+// linkRequiredError is returned by browserLogin when the identity provider account has the
+// login of an existing account, which the user must link to it after a password login
+type linkRequiredError struct {
+	linkCode string
+}
+
+func (e *linkRequiredError) Error() string {
+	return "the identity provider account is not linked to a GophKeeper account"
+}
+
+// browserLogin signs in through the identity provider of the server in a browser. The
+// server redirects the browser back to a listener on the loopback interface with a login
+// code, which is exchanged for tokens. It returns the response of the exchange, or a
+// linkRequiredError if the server sent a link code instead.
+func browserLogin(client *api.Client) (*http.Response, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for the sign-in: %w", err)
+	}
+
+	// callbacks receive the query of the redirect with a login code or a link code
+	callbacks := make(chan url.Values, 1)
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if r.URL.Path != "/callback" || (query.Get("code") == "" && query.Get("link_code") == "") {
+			http.NotFound(w, r)
+			return
+		}
+		if query.Get("code") != "" {
+			fmt.Fprintln(w, "Signed in to GophKeeper. You can close this window.")
+		} else {
+			fmt.Fprintln(w, "Link this account in the terminal to finish signing in. You can close this window.")
+		}
+		select {
+		case callbacks <- query:
+		default:
+		}
+	})}
+	go server.Serve(listener)
+	defer server.Close()
+
+	redirectURI := fmt.Sprintf("http://%s/callback", listener.Addr())
+	fmt.Println("Open this URL in your browser to sign in:")
+	fmt.Printf("\n  %s\n\n", client.URL("/api/user/oidc/login?redirect_uri="+url.QueryEscape(redirectURI)))
+	fmt.Println("Waiting for the sign-in to finish...")
+
+	select {
+	case query := <-callbacks:
+		if query.Get("code") == "" {
+			return nil, &linkRequiredError{linkCode: query.Get("link_code")}
+		}
+		return client.Request(http.MethodPost, "/api/user/oidc/token", models.OIDCCodeRequest{Code: query.Get("code")})
+	case <-time.After(ssoLoginTimeout):
+		return nil, errors.New("timed out waiting for the sign-in")
+	}
+}
+
+// deviceLogin signs in with a code entered on another device, for terminals without a
+// browser. It returns the response with the tokens, or the failed response of the server.
+func deviceLogin(client *api.Client) (*http.Response, error) {
+	resp, err := client.Request(http.MethodPost, "/api/user/oidc/device", nil)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return resp, nil
+	}
+
+	var authorization models.DeviceAuthorization
+	err = json.NewDecoder(resp.Body).Decode(&authorization)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode device authorization: %w", err)
+	}
+
+	if authorization.VerificationURIComplete != "" {
+		fmt.Printf("Open %s to sign in,\nor visit %s and enter the code %s\n",
+			authorization.VerificationURIComplete, authorization.VerificationURI, authorization.UserCode)
+	} else {
+		fmt.Printf("Visit %s and enter the code %s\n", authorization.VerificationURI, authorization.UserCode)
+	}
+
+	interval := max(time.Duration(authorization.Interval)*time.Second, minDevicePollInterval)
+	deadline := time.Now().Add(time.Duration(authorization.ExpiresIn) * time.Second)
+	for time.Now().Before(deadline) {
+		time.Sleep(interval)
+
+		resp, err := client.Request(http.MethodPost, "/api/user/oidc/device/token",
+			models.OIDCDeviceTokenRequest{DeviceCode: authorization.DeviceCode})
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusBadRequest {
+			return resp, nil
+		}
+
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		var apiErr models.APIError
+		json.Unmarshal(body, &apiErr)
+		switch apiErr.Code {
+		case "authorization_pending":
+		case "slow_down":
+			interval += minDevicePollInterval
+		default:
+			// Hand the failure to the caller, which prints it
+			resp.Body = io.NopCloser(bytes.NewReader(body))
+			return resp, nil
+		}
+	}
+	return nil, errors.New("the device code expired before the sign-in finished")
+}
@@ -0,0 +1,179 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"gophkeeper/client/internal/api"
+	"gophkeeper/client/internal/models"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var tokenCmd = &cobra.Command{
+	Use:   "token",
+	Short: "Manage API tokens for automation",
+	Long: `Create, list and revoke long-lived API tokens for scripts and CI pipelines.
+A token is used by setting the GOPHKEEPER_TOKEN environment variable instead of logging in.
+API tokens can only access secrets. Requires authentication.`,
+}
+
+var (
+	tokenName           string
+	tokenServiceAccount string
+	tokenReadOnly       bool
+	tokenSecretIDs      []int
+	tokenKeywords       []string
+	tokenExpires        time.Duration
+)
+
+var tokenCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Create an API token",
+	Long: `Create a named API token. Without --secret-id and --keyword the token can access
+all your secrets; with them, only the listed secrets and secrets whose metadata contains
+one of the keywords.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		req := models.CreateAPITokenRequest{
+			Name:           tokenName,
+			ServiceAccount: tokenServiceAccount,
+			Scope: models.TokenScope{
+				ReadOnly:  tokenReadOnly,
+				SecretIDs: tokenSecretIDs,
+				Keywords:  tokenKeywords,
+			},
+			ExpiresIn: int64(tokenExpires.Seconds()),
+		}
+
+		client := api.NewClient()
+		resp, err := client.AuthenticatedRequest(http.MethodPost, "/api/tokens", req)
+		if err != nil {
+			fmt.Printf("Error sending request: %v\n", err)
+			return
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusCreated {
+			printFailure("Operation failed", resp)
+			return
+		}
+
+		var created models.CreatedAPIToken
+		if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+			fmt.Printf("Error decoding token: %v\n", err)
+			return
+		}
+
+		fmt.Printf("Token %s created. Store it now, it will not be shown again:\n\n  %s\n\n", created.ID, created.Token)
+		fmt.Println("Use it with: GOPHKEEPER_TOKEN=<token> gophkeeper-cli get")
+	},
+}
+
+var tokenListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List API tokens",
+	Run: func(cmd *cobra.Command, args []string) {
+		client := api.NewClient()
+		resp, err := client.AuthenticatedRequest(http.MethodGet, "/api/tokens", nil)
+		if err != nil {
+			fmt.Printf("Error sending request: %v\n", err)
+			return
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			printFailure("Operation failed", resp)
+			return
+		}
+
+		var tokens []models.APIToken
+		if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+			fmt.Printf("Error decoding tokens: %v\n", err)
+			return
+		}
+		if len(tokens) == 0 {
+			fmt.Println("No API tokens found.")
+			return
+		}
+
+		fmt.Println("Your API tokens:")
+		for _, token := range tokens {
+			name := token.Name
+			if token.ServiceAccount != "" {
+				name += " (service account: " + token.ServiceAccount + ")"
+			}
+			fmt.Printf("  ID: %s\n    Name: %s\n    Scope: %s\n    Created: %s, Expires: %s, Last used: %s\n",
+				token.ID, name, describeScope(token.Scope), token.CreatedAt.Local().Format(time.DateTime),
+				formatOptionalTime(token.ExpiresAt, "never"), formatOptionalTime(token.LastUsedAt, "never"))
+		}
+	},
+}
+
+var tokenRevokeCmd = &cobra.Command{
+	Use:   "revoke <id>",
+	Short: "Revoke an API token",
+	Long:  `Revoke an API token. It stops working immediately.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		client := api.NewClient()
+		resp, err := client.AuthenticatedRequest(http.MethodDelete, "/api/tokens/"+url.PathEscape(args[0]), nil)
+		if err != nil {
+			fmt.Printf("Error sending request: %v\n", err)
+			return
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusNoContent {
+			printFailure("Operation failed", resp)
+			return
+		}
+
+		fmt.Println("Token revoked.")
+	},
+}
+
+// describeScope summarizes a token scope for display.
+func describeScope(scope models.TokenScope) string {
+	access := "read-write"
+	if scope.ReadOnly {
+		access = "read-only"
+	}
+	if len(scope.SecretIDs) == 0 && len(scope.Keywords) == 0 {
+		return access + ", all secrets"
+	}
+
+	var limits []string
+	if len(scope.SecretIDs) > 0 {
+		limits = append(limits, fmt.Sprintf("secrets %v", scope.SecretIDs))
+	}
+	if len(scope.Keywords) > 0 {
+		limits = append(limits, "keywords "+strings.Join(scope.Keywords, ", "))
+	}
+	return access + ", " + strings.Join(limits, "; ")
+}
+
+// formatOptionalTime formats a time in the local zone or returns fallback if it is nil.
+func formatOptionalTime(t *time.Time, fallback string) string {
+	if t == nil {
+		return fallback
+	}
+	return t.Local().Format(time.DateTime)
+}
+
+func init() {
+	rootCmd.AddCommand(tokenCmd)
+	tokenCmd.AddCommand(tokenCreateCmd)
+	tokenCmd.AddCommand(tokenListCmd)
+	tokenCmd.AddCommand(tokenRevokeCmd)
+
+	tokenCreateCmd.Flags().StringVarP(&tokenName, "name", "n", "", "Name of the token (required)")
+	tokenCreateCmd.Flags().StringVar(&tokenServiceAccount, "service-account", "", "Service account the token is issued to, e.g. ci")
+	tokenCreateCmd.Flags().BoolVar(&tokenReadOnly, "read-only", false, "Only allow reading secrets")
+	tokenCreateCmd.Flags().IntSliceVar(&tokenSecretIDs, "secret-id", nil, "Allow access to a secret by ID (repeatable)")
+	tokenCreateCmd.Flags().StringSliceVarP(&tokenKeywords, "keyword", "k", nil, "Allow access to secrets whose metadata contains the keyword (repeatable)")
+	tokenCreateCmd.Flags().DurationVar(&tokenExpires, "expires", 0, "Lifetime of the token, e.g. 720h (default: no expiry)")
+	tokenCreateCmd.MarkFlagRequired("name")
+}
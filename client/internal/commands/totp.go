@@ -0,0 +1,120 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"gophkeeper/client/internal/api"
+	"gophkeeper/client/internal/models"
+	"net/http"
+
+	"github.com/spf13/cobra"
+)
+
+var totpCmd = &cobra.Command{
+	Use:   "totp",
+	Short: "Manage two-factor authentication",
+	Long: `Enable or disable two-factor authentication with an authenticator app (TOTP).
+Requires authentication.`,
+}
+
+var totpEnableCmd = &cobra.Command{
+	Use:   "enable",
+	Short: "Enable two-factor authentication",
+	Long: `Generate a TOTP secret for your authenticator app, confirm it with a code and
+print one-time recovery codes for when the authenticator is not available.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		client := api.NewClient()
+		resp, err := client.AuthenticatedRequest(http.MethodPost, "/api/user/totp", nil)
+		if err != nil {
+			fmt.Printf("Error sending request: %v\n", err)
+			return
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			printFailure("Operation failed", resp)
+			return
+		}
+
+		var enrollment models.TOTPEnrollment
+		if err := json.NewDecoder(resp.Body).Decode(&enrollment); err != nil {
+			fmt.Printf("Error decoding response: %v\n", err)
+			return
+		}
+
+		fmt.Println("Add this account to your authenticator app:")
+		fmt.Printf("  Secret: %s\n  URI:    %s\n\n", enrollment.Secret, enrollment.URI)
+
+		code, err := prompt("Enter the code shown by the app: ")
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+
+		resp, err = client.AuthenticatedRequest(http.MethodPost, "/api/user/totp/confirm", map[string]string{"code": code})
+		if err != nil {
+			fmt.Printf("Error sending request: %v\n", err)
+			return
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			printFailure("Operation failed", resp)
+			return
+		}
+
+		var recovery models.RecoveryCodes
+		if err := json.NewDecoder(resp.Body).Decode(&recovery); err != nil {
+			fmt.Printf("Error decoding response: %v\n", err)
+			return
+		}
+
+		fmt.Println("Two-factor authentication enabled.")
+		fmt.Println("Recovery codes (each works once; store them safely, they are not shown again):")
+		for _, code := range recovery.RecoveryCodes {
+			fmt.Printf("  %s\n", code)
+		}
+	},
+}
+
+var totpDisableCmd = &cobra.Command{
+	Use:   "disable",
+	Short: "Disable two-factor authentication",
+	Run: func(cmd *cobra.Command, args []string) {
+		code, _ := cmd.Flags().GetString("code")
+		recoveryCode, _ := cmd.Flags().GetString("recovery-code")
+
+		if code == "" && recoveryCode == "" {
+			var err error
+			if code, err = prompt("Two-factor code: "); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return
+			}
+		}
+
+		client := api.NewClient()
+		resp, err := client.AuthenticatedRequest(http.MethodDelete, "/api/user/totp",
+			map[string]string{"code": code, "recovery_code": recoveryCode})
+		if err != nil {
+			fmt.Printf("Error sending request: %v\n", err)
+			return
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusNoContent {
+			printFailure("Operation failed", resp)
+			return
+		}
+
+		fmt.Println("Two-factor authentication disabled.")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(totpCmd)
+	totpCmd.AddCommand(totpEnableCmd)
+	totpCmd.AddCommand(totpDisableCmd)
+
+	totpDisableCmd.Flags().String("code", "", "Current two-factor code")
+	totpDisableCmd.Flags().String("recovery-code", "", "Recovery code, if the authenticator is not available")
+}
@@ -0,0 +1,37 @@
+package commands
+
+import (
+	"fmt"
+	"gophkeeper/client/internal/api"
+	"net/http"
+
+	"github.com/spf13/cobra"
+)
+
+var unlockCmd = &cobra.Command{
+	Use:   "unlock",
+	Short: "Unlock your account after failed login attempts",
+	Long: `Lift a temporary lockout of your account caused by failed login attempts,
+for example to log in on a new device while someone is guessing your password.
+Requires authentication, so run it on a device where you are still logged in.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		client := api.NewClient()
+		resp, err := client.AuthenticatedRequest(http.MethodPost, "/api/user/unlock", nil)
+		if err != nil {
+			fmt.Printf("Error sending request: %v\n", err)
+			return
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusNoContent {
+			printFailure("Operation failed", resp)
+			return
+		}
+
+		fmt.Println("Account unlocked.")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(unlockCmd)
+}
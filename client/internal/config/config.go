@@ -1,15 +1,23 @@
 package config
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 )
 
 const (
-	tokenFileName    = "gophkeeper_token.txt"
-	defaultServerURL = "http://localhost:8080"
-	serverURLEnvVar  = "SERVER_URL"
+	tokenFileName        = "gophkeeper_token.txt"
+	refreshTokenFileName = "gophkeeper_refresh_token.txt"
+	srpAccountsFileName  = "gophkeeper_srp_accounts.json"
+	defaultServerURL     = "http://localhost:8080"
+	serverURLEnvVar      = "SERVER_URL"
+	clientCertEnvVar     = "GOPHKEEPER_CLIENT_CERT"
+	clientKeyEnvVar      = "GOPHKEEPER_CLIENT_KEY"
+	caCertEnvVar         = "GOPHKEEPER_CA_CERT"
+	apiTokenEnvVar       = "GOPHKEEPER_TOKEN"
 )
 
 func GetServerURL() string {
@@ -20,6 +28,24 @@ func GetServerURL() string {
 	return url
 }
 
+// GetClientCertFiles returns the paths of the TLS client certificate and key presented
+// to the server, or empty strings if none is configured.
+func GetClientCertFiles() (certFile, keyFile string) {
+	return os.Getenv(clientCertEnvVar), os.Getenv(clientKeyEnvVar)
+}
+
+// GetCACertFile returns the path of a PEM bundle of CAs trusted for the server certificate
+// in addition to the system ones, or an empty string if none is configured.
+func GetCACertFile() string {
+	return os.Getenv(caCertEnvVar)
+}
+
+// GetAPIToken returns the API token to authenticate with instead of the stored login tokens,
+// or an empty string if none is configured.
+func GetAPIToken() string {
+	return os.Getenv(apiTokenEnvVar)
+}
+
 // GetConfigDir returns the appropriate configuration directory for the OS.
 func GetConfigDir() (string, error) {
 	var configDir string
@@ -61,3 +87,93 @@ func LoadToken() (string, error) {
 	}
 	return string(data), nil
 }
+
+// SaveRefreshToken saves the refresh token to a file.
+func SaveRefreshToken(token string) error {
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return err
+	}
+	tokenPath := filepath.Join(configDir, refreshTokenFileName)
+	return os.WriteFile(tokenPath, []byte(token), 0600)
+}
+
+// LoadRefreshToken loads the refresh token from a file.
+func LoadRefreshToken() (string, error) {
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	tokenPath := filepath.Join(configDir, refreshTokenFileName)
+	data, err := os.ReadFile(tokenPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read refresh token file: %w", err)
+	}
+	return string(data), nil
+}
+
+// DeleteTokens removes the stored access and refresh tokens.
+func DeleteTokens() error {
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range []string{tokenFileName, refreshTokenFileName} {
+		if err := os.Remove(filepath.Join(configDir, name)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove token file: %w", err)
+		}
+	}
+	return nil
+}
+
+// SaveSRPAccount records that login uses SRP on the server at serverURL.
+func SaveSRPAccount(serverURL, login string) error {
+	accounts, err := loadSRPAccounts()
+	if err != nil {
+		return err
+	}
+	if slices.Contains(accounts[serverURL], login) {
+		return nil
+	}
+	accounts[serverURL] = append(accounts[serverURL], login)
+
+	data, err := json.MarshalIndent(accounts, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode SRP accounts: %w", err)
+	}
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(configDir, srpAccountsFileName), data, 0600)
+}
+
+// IsSRPAccount reports whether login was recorded to use SRP on the server at serverURL.
+func IsSRPAccount(serverURL, login string) (bool, error) {
+	accounts, err := loadSRPAccounts()
+	if err != nil {
+		return false, err
+	}
+	return slices.Contains(accounts[serverURL], login), nil
+}
+
+// loadSRPAccounts returns the logins that use SRP by server URL.
+func loadSRPAccounts() (map[string][]string, error) {
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	accounts := make(map[string][]string)
+	data, err := os.ReadFile(filepath.Join(configDir, srpAccountsFileName))
+	if os.IsNotExist(err) {
+		return accounts, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SRP accounts: %w", err)
+	}
+	if err := json.Unmarshal(data, &accounts); err != nil {
+		return nil, fmt.Errorf("failed to decode SRP accounts: %w", err)
+	}
+	return accounts, nil
+}
@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+// APIToken is a long-lived token for automation, as listed by the server.
+type APIToken struct {
+	ID             string     `json:"id"`
+	Name           string     `json:"name"`
+	ServiceAccount string     `json:"service_account,omitempty"`
+	Scope          TokenScope `json:"scope"`
+	CreatedAt      time.Time  `json:"created_at"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt     *time.Time `json:"last_used_at,omitempty"`
+}
+
+// TokenScope limits what an API token may do with the user's secrets.
+type TokenScope struct {
+	ReadOnly  bool     `json:"read_only"`
+	SecretIDs []int    `json:"secret_ids,omitempty"`
+	Keywords  []string `json:"keywords,omitempty"`
+}
+
+// CreateAPITokenRequest is the body of POST /api/tokens.
+type CreateAPITokenRequest struct {
+	Name           string     `json:"name"`
+	ServiceAccount string     `json:"service_account,omitempty"`
+	Scope          TokenScope `json:"scope"`
+	// ExpiresIn is the lifetime in seconds; zero creates a token that does not expire
+	ExpiresIn int64 `json:"expires_in,omitempty"`
+}
+
+// CreatedAPIToken is returned when a token is created. The token is shown only once.
+type CreatedAPIToken struct {
+	Token string `json:"token"`
+	APIToken
+}
@@ -0,0 +1,31 @@
+package models
+
+import "fmt"
+
+// APIError is the body of every error response of the server.
+type APIError struct {
+	// Code identifies the failure, e.g. "not_found" or "login_throttled"
+	Code    string         `json:"code"`
+	Message string         `json:"message"`
+	Details map[string]any `json:"details,omitempty"`
+	// RequestID matches the response to the server logs
+	RequestID string `json:"request_id,omitempty"`
+	// Status is the HTTP status of the response
+	Status int `json:"-"`
+}
+
+func (e *APIError) Error() string {
+	msg := e.Message
+	if msg == "" {
+		msg = "unexpected response"
+	}
+	if e.Code != "" {
+		msg = fmt.Sprintf("%s (%s, Status: %d)", msg, e.Code, e.Status)
+	} else {
+		msg = fmt.Sprintf("%s (Status: %d)", msg, e.Status)
+	}
+	if e.RequestID != "" {
+		msg += fmt.Sprintf(" [request ID %s]", e.RequestID)
+	}
+	return msg
+}
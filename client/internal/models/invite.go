@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// Invite allows one registration while registration on the server is invite-only.
+type Invite struct {
+	ID        string     `json:"id"`
+	CreatedBy *int       `json:"created_by,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedBy    string     `json:"used_by,omitempty"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+}
+
+// CreateInviteRequest is the body of POST /api/invites.
+type CreateInviteRequest struct {
+	// ExpiresIn is the lifetime in seconds; zero uses the default of the server
+	ExpiresIn int64 `json:"expires_in,omitempty"`
+}
+
+// CreatedInvite is returned when an invite is created. The code is shown only once.
+type CreatedInvite struct {
+	Code string `json:"code"`
+	Invite
+}
@@ -0,0 +1,17 @@
+package models
+
+// RecoverRequest resets the password of an account with a recovery code. Either the
+// password or an SRP verifier of the new password is set.
+type RecoverRequest struct {
+	Login        string    `json:"login"`
+	RecoveryCode string    `json:"recovery_code"`
+	Password     string    `json:"password,omitempty"`
+	Salt         []byte    `json:"salt,omitempty"`
+	Verifier     []byte    `json:"verifier,omitempty"`
+	Params       SRPParams `json:"params"`
+}
+
+// RecoveryCodesStatus is the number of unused account recovery codes.
+type RecoveryCodesStatus struct {
+	Remaining int `json:"remaining"`
+}
@@ -1,5 +1,10 @@
 package models
 
+import (
+	"encoding/json"
+	"time"
+)
+
 type SecretType int
 
 const (
@@ -31,3 +36,64 @@ type Secret struct {
 	Data     []byte     `json:"data"`
 	Metadata string     `json:"metadata"`
 }
+
+// ParseSecretType returns the secret type with the given name.
+func ParseSecretType(name string) (SecretType, bool) {
+	for st := LoginPasswordType; st <= BankCardType; st++ {
+		if st.String() == name {
+			return st, true
+		}
+	}
+	return 0, false
+}
+
+// SecretV2 is a secret in API v2: its type is a name and its data is a payload object
+// whose fields depend on the type.
+type SecretV2 struct {
+	ID       int    `json:"id"`
+	Type     string `json:"type"`
+	Metadata string `json:"metadata"`
+	// Payload is decoded into the payload type of Type
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+	Revision  int             `json:"revision"`
+}
+
+// SecretV2Request is the body of POST /api/v2/secrets and PUT /api/v2/secrets/{id}.
+type SecretV2Request struct {
+	Type     string `json:"type"`
+	Metadata string `json:"metadata,omitempty"`
+	// Payload is a LoginPayload, TextPayload, BinaryPayload or BankCardPayload
+	Payload any `json:"payload"`
+	// Revision makes the server reject the update if the secret was modified since
+	Revision int `json:"revision,omitempty"`
+}
+
+// LoginPayload is the payload of login secrets.
+type LoginPayload struct {
+	Login    string `json:"login"`
+	Password string `json:"password"`
+	// Raw is data stored through API v1 in another format
+	Raw []byte `json:"raw,omitempty"`
+}
+
+// TextPayload is the payload of text secrets.
+type TextPayload struct {
+	Text string `json:"text"`
+}
+
+// BinaryPayload is the payload of binary secrets.
+type BinaryPayload struct {
+	Data []byte `json:"data"`
+}
+
+// BankCardPayload is the payload of bank card secrets.
+type BankCardPayload struct {
+	Number string `json:"number"`
+	Holder string `json:"holder,omitempty"`
+	Expiry string `json:"expiry,omitempty"`
+	CVV    string `json:"cvv,omitempty"`
+	// Raw is data stored through API v1 in another format
+	Raw []byte `json:"raw,omitempty"`
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// Session is a login of the user on a device, as listed by the server.
+type Session struct {
+	ID            string    `json:"id"`
+	DeviceName    string    `json:"device_name"`
+	ClientVersion string    `json:"client_version"`
+	IP            string    `json:"ip"`
+	CreatedAt     time.Time `json:"created_at"`
+	LastSeenAt    time.Time `json:"last_seen_at"`
+	Current       bool      `json:"current"`
+}
@@ -0,0 +1,46 @@
+package models
+
+// SRPParams are the Argon2id parameters that derive the SRP private key from the password.
+type SRPParams struct {
+	Memory      uint32 `json:"m"`
+	Time        uint32 `json:"t"`
+	Parallelism uint8  `json:"p"`
+}
+
+// SRPRegisterRequest registers a user with an SRP verifier instead of a password.
+type SRPRegisterRequest struct {
+	Login    string    `json:"login"`
+	Salt     []byte    `json:"salt"`
+	Verifier []byte    `json:"verifier"`
+	Params   SRPParams `json:"params"`
+	Invite   string    `json:"invite,omitempty"`
+}
+
+// SRPEnableRequest replaces the password hash of the authenticated user with an SRP verifier.
+type SRPEnableRequest struct {
+	Login    string    `json:"login"`
+	Password string    `json:"password"`
+	Salt     []byte    `json:"salt"`
+	Verifier []byte    `json:"verifier"`
+	Params   SRPParams `json:"params"`
+}
+
+// SRPStartRequest starts an SRP login with the public key A of the client.
+type SRPStartRequest struct {
+	Login        string `json:"login"`
+	ClientPublic []byte `json:"a"`
+}
+
+// SRPStartResponse is returned by the server when an SRP login starts.
+type SRPStartResponse struct {
+	Session      string    `json:"session"`
+	Salt         []byte    `json:"salt"`
+	Params       SRPParams `json:"params"`
+	ServerPublic []byte    `json:"b"`
+}
+
+// SRPVerifyRequest finishes an SRP login with the proof M1 of the client.
+type SRPVerifyRequest struct {
+	Session string `json:"session"`
+	Proof   []byte `json:"proof"`
+}
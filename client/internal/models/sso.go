@@ -0,0 +1,26 @@
+package models
+
+// OIDCCodeRequest exchanges a login code from a browser sign-in for tokens.
+type OIDCCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// DeviceAuthorization is returned by the server when a device sign-in starts.
+type DeviceAuthorization struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete,omitempty"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval,omitempty"`
+}
+
+// OIDCDeviceTokenRequest polls the server for the tokens of a device sign-in.
+type OIDCDeviceTokenRequest struct {
+	DeviceCode string `json:"device_code"`
+}
+
+// OIDCLinkRequest links the identity provider account of a sign-in to the logged-in user.
+type OIDCLinkRequest struct {
+	LinkCode string `json:"link_code"`
+}
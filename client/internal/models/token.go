@@ -0,0 +1,22 @@
+package models
+
+// TokenResponse is returned by the server on login and token refresh.
+type TokenResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+// MFAChallenge is returned by the server on login when two-factor authentication is enabled.
+type MFAChallenge struct {
+	MFARequired bool   `json:"mfa_required"`
+	Challenge   string `json:"challenge"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// MFALoginRequest exchanges an MFA challenge and a second factor for tokens.
+type MFALoginRequest struct {
+	Challenge    string `json:"challenge"`
+	Code         string `json:"code,omitempty"`
+	RecoveryCode string `json:"recovery_code,omitempty"`
+}
@@ -0,0 +1,12 @@
+package models
+
+// TOTPEnrollment is returned by the server when two-factor enrollment starts.
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// RecoveryCodes is returned by the server when two-factor authentication is enabled.
+type RecoveryCodes struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
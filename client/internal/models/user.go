@@ -5,3 +5,23 @@ type User struct {
 	Login    string `json:"login"`
 	Password string `json:"password"`
 }
+
+// RegisterRequest registers a user with a password.
+type RegisterRequest struct {
+	Login    string `json:"login"`
+	Password string `json:"password"`
+	// Invite is the invite code required when registration on the server is invite-only
+	Invite string `json:"invite,omitempty"`
+}
+
+// LoginRequest logs a user in with a password.
+type LoginRequest struct {
+	Login    string `json:"login"`
+	Password string `json:"password"`
+}
+
+// LDAPLinkRequest links a directory account to the logged-in user.
+type LDAPLinkRequest struct {
+	Login    string `json:"login"`
+	Password string `json:"password"`
+}
@@ -0,0 +1,36 @@
+package models
+
+import "slices"
+
+// VersionInfo is the response of GET /api/version.
+type VersionInfo struct {
+	APIVersions []string `json:"api_versions"`
+	SecretTypes []string `json:"secret_types"`
+	// Capabilities are the optional features enabled on the server, e.g. "oidc" or "seal"
+	Capabilities []string `json:"capabilities"`
+	// Registration is the registration mode: open, invite-only or closed
+	Registration string `json:"registration"`
+	// PasswordPolicy is the policy for the passwords of new users
+	PasswordPolicy PasswordPolicy `json:"password_policy"`
+}
+
+// Supports reports whether the server supports the API version, e.g. "v2".
+func (v VersionInfo) Supports(version string) bool {
+	return slices.Contains(v.APIVersions, version)
+}
+
+// PasswordPolicy is the policy for the passwords of new users. Clients check it themselves
+// for SRP registrations, since the server never sees the password.
+type PasswordPolicy struct {
+	MinLength int `json:"min_length"`
+	// MaxLength is 0 if there is no limit
+	MaxLength int `json:"max_length,omitempty"`
+	// BreachCheck is set if passwords from GET /api/user/breached-passwords/{prefix} are refused
+	BreachCheck bool `json:"breach_check"`
+}
+
+// BreachedPasswords is the response of GET /api/user/breached-passwords/{prefix}.
+type BreachedPasswords struct {
+	// Suffixes are the remaining hex digits of the SHA-1 hashes with the prefix
+	Suffixes []string `json:"suffixes"`
+}
@@ -1,15 +1,61 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
 	"gophkeeper/server/internal/api"
 	"gophkeeper/server/internal/auth"
 	"gophkeeper/server/internal/config"
+	"gophkeeper/server/internal/crypto"
 	"gophkeeper/server/internal/storage"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+const (
+	// revocationCleanupInterval is how often revocations of expired tokens are removed
+	revocationCleanupInterval = time.Hour
+	// loginThrottleCleanupInterval is how often stale failed login records are removed
+	loginThrottleCleanupInterval = 10 * time.Minute
+	// pendingLoginCleanupInterval is how often unfinished SRP and OIDC logins are removed
+	pendingLoginCleanupInterval = 30 * time.Second
+	// minJWTSecretLength is the shortest shared secret used without a warning
+	minJWTSecretLength = 32
 )
 
 func main() {
+	// An optional subcommand precedes the flags, e.g. "gophkeeper-server rekey --config ..."
+	command := ""
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		command = os.Args[1]
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+	}
+
+	switch command {
+	case "", "rekey", "unlock", "invite":
+	case "init":
+		runInit(os.Args[1:])
+		return
+	case "unseal":
+		runUnseal(os.Args[1:])
+		return
+	default:
+		log.Fatalf("Unknown command: %s", command)
+	}
+
 	log.Println("Starting GophKeeper server...")
 
 	// Load configuration
@@ -21,7 +67,13 @@ func main() {
 	log.Printf("Configuration loaded: storage_type=%s, server_address=%s", cfg.StorageType, cfg.ServerAddress)
 
 	// Initialize JWT Manager
-	jwtManager := auth.NewJWTManager(cfg.JWTSecret)
+	jwtManager, err := newJWTManager(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize token signing: %v", err)
+	}
+	jwtManager.SetAccessTokenTTL(time.Duration(cfg.AccessTokenTTL))
+	jwtManager.SetIssuer(cfg.JWTIssuer)
+	jwtManager.SetAudience(cfg.JWTAudience)
 
 	// Initialize storage based on configuration
 	var store storage.Store
@@ -42,31 +94,427 @@ func main() {
 		log.Println("Successfully connected to PostgreSQL database")
 	}
 
-	// Wrap store with encryption if encryption key is provided
-	if cfg.EncryptionKey != "" {
-		log.Println("Encryption enabled for secret data")
-		encryptedStore, err := storage.NewEncryptedStore(store, cfg.EncryptionKey)
+	loginThrottle := newLoginThrottle(cfg, store)
+	if command == "unlock" {
+		if cfg.IsMemoryStorage() {
+			log.Fatal("In-memory storage is not shared with the running server; restart it to clear lockouts")
+		}
+		runUnlock(loginThrottle, flag.Args())
+		return
+	}
+	if command == "invite" {
+		if cfg.IsMemoryStorage() {
+			log.Fatal("In-memory storage is not shared with the running server; invites must be stored in PostgreSQL")
+		}
+		runInvite(store, time.Duration(cfg.InviteTTL), flag.Args())
+		return
+	}
+
+	// Wrap store with encryption if encryption keys are provided
+	var encryptedStore *storage.EncryptedStore
+	var seal *crypto.Seal
+	if cfg.EncryptionEnabled() {
+		keySources := crypto.KeySources{Salts: store, Seals: store}
+		if cfg.KMSAddress != "" {
+			keySources.Transit, err = newTransitClient(cfg)
+			if err != nil {
+				log.Fatalf("Failed to initialize key management service client: %v", err)
+			}
+		}
+
+		keySpecs := cfg.EncryptionKeySpecs()
+		keyring, err := crypto.ParseKeySpecs(context.Background(), keySpecs, keySources)
+		if err != nil {
+			log.Fatalf("Failed to load encryption keys: %v", err)
+		}
+		for _, spec := range keySpecs {
+			if crypto.SpecFormat(spec) == crypto.FormatLegacy {
+				log.Println("WARNING: A legacy encryption key is configured. Add a new key and run rekey to migrate away from it.")
+			}
+		}
+		log.Printf("Encryption enabled for secret data (primary key ID: %s)", keyring.Primary().KeyID())
+
+		seal = keyring.Seal()
+		if seal != nil {
+			log.Println("Sealed mode enabled: secrets are unavailable until the server is unsealed")
+		}
+
+		encryptedStore, err = storage.NewEncryptedStore(store, keyring)
 		if err != nil {
 			log.Fatalf("Failed to initialize encryption: %v", err)
 		}
+		encryptedStore.SetStrictBinding(cfg.StrictBinding)
+		encryptedStore.SetBlindIndex(cfg.BlindIndex)
 		store = encryptedStore
 	} else {
 		log.Println("WARNING: Encryption is disabled. Secrets will be stored in plaintext.")
 	}
 
+	if command == "rekey" {
+		if encryptedStore == nil {
+			log.Fatal("Re-encryption requires encryption keys to be configured")
+		}
+		if seal != nil {
+			unsealLocally(seal)
+		}
+		runRekey(encryptedStore)
+		return
+	}
+
 	// Initialize API handlers
+	revocations := auth.NewRevocationList(store)
+	jwtManager.SetRevocationList(revocations)
+	go revocations.Run(context.Background(), revocationCleanupInterval)
+
+	go loginThrottle.Run(context.Background(), loginThrottleCleanupInterval)
+
+	if err := setPasswordHasher(cfg); err != nil {
+		log.Fatalf("Invalid password hashing configuration: %v", err)
+	}
+	passwordPolicy, err := newPasswordPolicy(cfg)
+	if err != nil {
+		log.Fatalf("Failed to load password policy: %v", err)
+	}
+
 	apiHandler := api.New(store, jwtManager)
+	apiHandler.SetPasswordPolicy(passwordPolicy)
+	apiHandler.SetRegistrationMode(api.RegistrationMode(cfg.RegistrationMode), time.Duration(cfg.InviteTTL))
+	jwtManager.SetAPITokenAuth(apiHandler.ResolveAPIToken)
+	if len(cfg.TLSClientCertUsers) > 0 {
+		mapping, err := auth.ParseClientCertMapping(cfg.TLSClientCertUsers)
+		if err != nil {
+			log.Fatalf("Invalid client certificate mapping: %v", err)
+		}
+		jwtManager.SetClientCertAuth(mapping, apiHandler.ResolveUser)
+	}
+	apiHandler.SetRefreshTokenTTL(time.Duration(cfg.RefreshTokenTTL))
+	apiHandler.SetLoginThrottle(loginThrottle)
+	if seal != nil {
+		apiHandler.SetSeal(seal)
+	}
+	if cfg.OIDCIssuer != "" {
+		provider, err := auth.NewOIDCProvider(context.Background(), auth.OIDCConfig{
+			Issuer:       cfg.OIDCIssuer,
+			ClientID:     cfg.OIDCClientID,
+			ClientSecret: cfg.OIDCClientSecret,
+			RedirectURL:  cfg.OIDCRedirectURL,
+			Scopes:       cfg.OIDCScopes,
+			LoginClaim:   cfg.OIDCLoginClaim,
+		}, nil)
+		if err != nil {
+			log.Fatalf("Failed to set up single sign-on: %v", err)
+		}
+		apiHandler.SetOIDC(provider, cfg.OIDCAutoProvision)
+		log.Printf("Single sign-on enabled with %s", cfg.OIDCIssuer)
+	}
+	if cfg.LDAPURL != "" {
+		ldapAuth, err := newLDAPAuthenticator(cfg)
+		if err != nil {
+			log.Fatalf("Failed to set up LDAP authentication: %v", err)
+		}
+		apiHandler.AddAuthenticator(ldapAuth, cfg.LDAPAutoProvision)
+		log.Printf("LDAP authentication enabled with %s", cfg.LDAPURL)
+	}
+
+	go apiHandler.Run(context.Background(), pendingLoginCleanupInterval)
 
 	// Initialize router
 	router := api.NewRouter(apiHandler, jwtManager)
 
+	var tlsConfig *tls.Config
+	if cfg.EnableTLS {
+		tlsConfig, err = newTLSConfig(cfg)
+		if err != nil {
+			log.Fatalf("Failed to configure TLS: %v", err)
+		}
+	}
+
+	if cfg.GRPCAddress != "" {
+		go serveGRPC(cfg, apiHandler, jwtManager, tlsConfig)
+	}
+
 	// Start server with or without TLS
 	if cfg.EnableTLS {
 		log.Printf("Server is listening on %s (HTTPS enabled)", cfg.ServerAddress)
 		log.Printf("Using TLS certificate: %s", cfg.TLSCertFile)
-		log.Fatal(http.ListenAndServeTLS(cfg.ServerAddress, cfg.TLSCertFile, cfg.TLSKeyFile, router))
+		server := &http.Server{Addr: cfg.ServerAddress, Handler: router, TLSConfig: tlsConfig}
+		log.Fatal(server.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile))
 	} else {
 		log.Printf("Server is listening on %s (HTTP mode - consider enabling TLS for production)", cfg.ServerAddress)
 		log.Fatal(http.ListenAndServe(cfg.ServerAddress, router))
 	}
 }
+
+// serveGRPC runs the gRPC API on its own address with the TLS configuration of the REST API
+// A nil tlsConfig serves plaintext
+func serveGRPC(cfg *config.Config, apiHandler *api.API, jwtManager *auth.JWTManager, tlsConfig *tls.Config) {
+	var opts []grpc.ServerOption
+	if tlsConfig != nil {
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			log.Fatalf("Failed to load TLS certificate for gRPC: %v", err)
+		}
+		grpcTLSConfig := tlsConfig.Clone()
+		grpcTLSConfig.Certificates = []tls.Certificate{cert}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(grpcTLSConfig)))
+	}
+
+	listener, err := net.Listen("tcp", cfg.GRPCAddress)
+	if err != nil {
+		log.Fatalf("Failed to listen for gRPC: %v", err)
+	}
+
+	if tlsConfig != nil {
+		log.Printf("gRPC API is listening on %s (TLS enabled)", cfg.GRPCAddress)
+	} else {
+		log.Printf("gRPC API is listening on %s (plaintext - consider enabling TLS for production)", cfg.GRPCAddress)
+	}
+	log.Fatal(api.NewGRPCServer(apiHandler, jwtManager, opts...).Serve(listener))
+}
+
+// runRekey migrates all stored data to the primary encryption key and reports progress
+func runRekey(encryptedStore *storage.EncryptedStore) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	log.Println("Re-encrypting stored data with the primary key...")
+	result, err := encryptedStore.Rekey(ctx, func(p storage.RekeyProgress) {
+		log.Printf("Progress: %d/%d users, %d data keys rewrapped, %d secrets re-encrypted",
+			p.UsersDone, p.UsersTotal, p.DataKeysRewrapped, p.SecretsReencrypted)
+	})
+	var incompleteErr storage.ErrRekeyIncomplete
+	if err != nil && !errors.As(err, &incompleteErr) {
+		log.Fatalf("Re-encryption failed after %d/%d users: %v", result.UsersDone, result.UsersTotal, err)
+	}
+
+	log.Printf("Re-encryption finished: %d users, %d data keys rewrapped, %d secrets re-encrypted, %d skipped (changed concurrently)",
+		result.UsersTotal, result.DataKeysRewrapped, result.SecretsReencrypted, result.SecretsSkipped)
+
+	if len(result.FailedSecretIDs) > 0 {
+		log.Printf("WARNING: %d secrets failed the integrity check and may have been tampered with: %v",
+			len(result.FailedSecretIDs), result.FailedSecretIDs)
+	}
+	if err != nil {
+		log.Printf("Users that could not be migrated: %v", result.ErrorUserIDs)
+		log.Printf("Secrets that could not be migrated: %v", result.ErrorSecretIDs)
+		log.Fatalf("Re-encryption incomplete, run it again after fixing the cause: %v", err)
+	}
+	if len(result.FailedSecretIDs) > 0 {
+		os.Exit(1)
+	}
+}
+
+// newJWTManager creates the token manager from the configured signing key or shared secret
+// Without either, an ephemeral key is generated: access tokens then become invalid on restart
+// and clients obtain new ones with their refresh tokens
+func newJWTManager(cfg *config.Config) (*auth.JWTManager, error) {
+	if cfg.JWTSecret != "" {
+		if len(cfg.JWTSecret) < minJWTSecretLength {
+			log.Printf("WARNING: jwt_secret is shorter than %d bytes; consider jwt_signing_key_file instead", minJWTSecretLength)
+		}
+		return auth.NewJWTManager(cfg.JWTSecret), nil
+	}
+
+	if cfg.JWTSigningKeyFile == "" {
+		log.Println("WARNING: No JWT signing key configured; using an ephemeral key that changes on every restart")
+		signingKey, err := auth.GenerateSigningKey()
+		if err != nil {
+			return nil, err
+		}
+		return auth.NewJWTManagerWithKeys(signingKey)
+	}
+
+	content, err := crypto.ReadPrivateFile(cfg.JWTSigningKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key: %w", err)
+	}
+	signingKey, err := auth.ParseSigningKey(content)
+	clear(content)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signing key %s: %w", cfg.JWTSigningKeyFile, err)
+	}
+
+	var verificationKeys []*auth.SigningKey
+	for _, path := range cfg.JWTVerificationKeyFiles {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read verification key: %w", err)
+		}
+		key, err := auth.ParseVerificationKey(content)
+		clear(content)
+		if err != nil {
+			return nil, fmt.Errorf("invalid verification key %s: %w", path, err)
+		}
+		verificationKeys = append(verificationKeys, key)
+	}
+
+	log.Printf("Signing tokens with %s key %s (%d verification keys)", signingKey.Algorithm(), signingKey.ID, len(verificationKeys))
+	return auth.NewJWTManagerWithKeys(signingKey, verificationKeys...)
+}
+
+// newTLSConfig creates the server TLS configuration, which verifies client certificates
+// against tls_client_ca_file unless tls_client_auth is "none"
+func newTLSConfig(cfg *config.Config) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.TLSClientAuth == config.TLSClientAuthNone {
+		return tlsConfig, nil
+	}
+
+	caPEM, err := os.ReadFile(cfg.TLSClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CA bundle: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("no certificates found in %s", cfg.TLSClientCAFile)
+	}
+	tlsConfig.ClientCAs = pool
+
+	if cfg.TLSClientAuth == config.TLSClientAuthRequire {
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	} else {
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	log.Printf("Client certificates: %s (%d identities mapped to users)", cfg.TLSClientAuth, len(cfg.TLSClientCertUsers))
+	return tlsConfig, nil
+}
+
+// setPasswordHasher selects the hasher of new passwords
+func setPasswordHasher(cfg *config.Config) error {
+	if cfg.PasswordHasher == config.PasswordHasherBcrypt {
+		hasher, err := auth.NewBcryptHasher(cfg.BcryptCost)
+		if err != nil {
+			return err
+		}
+		auth.SetPasswordHasher(hasher)
+		return nil
+	}
+
+	params := auth.DefaultArgon2idParams
+	params.Memory = cfg.Argon2Memory
+	params.Time = cfg.Argon2Time
+	params.Parallelism = cfg.Argon2Parallelism
+	hasher, err := auth.NewArgon2idHasher(params)
+	if err != nil {
+		return err
+	}
+	auth.SetPasswordHasher(hasher)
+	return nil
+}
+
+// newPasswordPolicy creates the rules for passwords of new users
+func newPasswordPolicy(cfg *config.Config) (auth.PasswordPolicy, error) {
+	policy := auth.DefaultPasswordPolicy
+	policy.MinLength = cfg.PasswordMinLength
+	if cfg.PasswordBreachListFile != "" {
+		breached, err := auth.LoadBreachList(cfg.PasswordBreachListFile)
+		if err != nil {
+			return policy, err
+		}
+		policy.Breached = breached
+		log.Printf("Loaded %d breached passwords", breached.Len())
+	}
+	return policy, nil
+}
+
+// newLDAPAuthenticator creates the authenticator for directory credentials
+func newLDAPAuthenticator(cfg *config.Config) (*auth.LDAPAuthenticator, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.LDAPCAFile != "" {
+		caPEM, err := os.ReadFile(cfg.LDAPCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read LDAP CA bundle: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.LDAPCAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if !cfg.LDAPStartTLS && strings.HasPrefix(strings.ToLower(cfg.LDAPURL), "ldap:") {
+		log.Println("WARNING: LDAP passwords are sent unencrypted; use ldaps:// or ldap_start_tls")
+	}
+
+	return auth.NewLDAPAuthenticator(auth.LDAPConfig{
+		URL:            cfg.LDAPURL,
+		StartTLS:       cfg.LDAPStartTLS,
+		TLSConfig:      tlsConfig,
+		BindDN:         cfg.LDAPBindDN,
+		BindPassword:   cfg.LDAPBindPassword,
+		BaseDN:         cfg.LDAPBaseDN,
+		UserFilter:     cfg.LDAPUserFilter,
+		GroupAttribute: cfg.LDAPGroupAttribute,
+		GroupRoles:     cfg.LDAPGroupRoles,
+	})
+}
+
+// newLoginThrottle creates the brute-force protection for logins with the configured lockout
+func newLoginThrottle(cfg *config.Config, store storage.Store) *auth.LoginThrottle {
+	account := auth.DefaultAccountThrottlePolicy
+	account.LockoutThreshold = cfg.LoginLockoutThreshold
+	account.LockoutDuration = time.Duration(cfg.LoginLockoutDuration)
+	return auth.NewLoginThrottle(store, account, auth.DefaultIPThrottlePolicy)
+}
+
+// runUnlock lifts lockouts of the given logins or client IP addresses
+func runUnlock(throttle *auth.LoginThrottle, targets []string) {
+	if len(targets) == 0 {
+		log.Fatal("Usage: gophkeeper-server unlock [flags] <login or IP address>...")
+	}
+
+	ctx := context.Background()
+	for _, target := range targets {
+		var err error
+		if net.ParseIP(target) != nil {
+			err = throttle.UnlockIP(ctx, target)
+		} else {
+			err = throttle.Unlock(ctx, target)
+		}
+		if err != nil {
+			log.Fatalf("Failed to unlock %s: %v", target, err)
+		}
+		log.Printf("Unlocked %s", target)
+	}
+}
+
+// runInvite issues invite codes as an operator; the optional argument is their number
+func runInvite(store storage.Store, ttl time.Duration, args []string) {
+	count := 1
+	if len(args) > 1 {
+		log.Fatal("Usage: gophkeeper-server invite [flags] [count]")
+	}
+	if len(args) == 1 {
+		var err error
+		if count, err = strconv.Atoi(args[0]); err != nil || count < 1 {
+			log.Fatalf("Invalid number of invites: %s", args[0])
+		}
+	}
+
+	ctx := context.Background()
+	for range count {
+		code, invite, err := auth.NewInvite(nil, ttl)
+		if err != nil {
+			log.Fatalf("Failed to generate invite: %v", err)
+		}
+		if err := store.CreateInvite(ctx, invite); err != nil {
+			log.Fatalf("Failed to create invite: %v", err)
+		}
+		fmt.Println(code)
+	}
+	log.Printf("Issued %d invite(s), valid until %s", count, time.Now().Add(ttl).Format(time.DateTime))
+}
+
+// newTransitClient creates a client for the configured transit key management service
+func newTransitClient(cfg *config.Config) (*crypto.TransitClient, error) {
+	var token string
+	if cfg.KMSTokenFile != "" {
+		content, err := crypto.ReadPrivateFile(cfg.KMSTokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read token file: %w", err)
+		}
+		token = strings.TrimSpace(string(content))
+	}
+
+	return crypto.NewTransitClient(cfg.KMSAddress, token, nil)
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"gophkeeper/server/internal/api"
+	"gophkeeper/server/internal/crypto"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// operatorClient sends requests to the /api/sys endpoints of a running server
+type operatorClient struct {
+	address    string
+	httpClient *http.Client
+}
+
+// newOperatorClient parses the flags shared by the operator commands
+func newOperatorClient(fs *flag.FlagSet, args []string) (*operatorClient, error) {
+	address := fs.String("address", "http://localhost:8080", "Address of the running server")
+	caCert := fs.String("ca-cert", "", "Path to the CA certificate of the server (for self-signed certificates)")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if *caCert != "" {
+		pem, err := os.ReadFile(*caCert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", *caCert)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+
+	return &operatorClient{
+		address:    strings.TrimSuffix(*address, "/"),
+		httpClient: &http.Client{Timeout: 30 * time.Second, Transport: transport},
+	}, nil
+}
+
+// post sends body to the endpoint and decodes the JSON response into out
+func (c *operatorClient) post(path string, body, out any) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.httpClient.Post(c.address+path, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%s (Status: %d)", strings.TrimSpace(string(message)), resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// runInit initializes the seal of a running server and prints the unseal shares
+func runInit(args []string) {
+	fs := flag.NewFlagSet("init", flag.ExitOnError)
+	shares := fs.Int("shares", 5, "Number of unseal shares to generate")
+	threshold := fs.Int("threshold", 3, "Number of shares required to unseal")
+
+	client, err := newOperatorClient(fs, args)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var resp api.InitResponse
+	if err := client.post("/api/sys/init", api.InitRequest{Shares: *shares, Threshold: *threshold}, &resp); err != nil {
+		log.Fatalf("Initialization failed: %v", err)
+	}
+
+	for i, share := range resp.Shares {
+		fmt.Printf("Unseal share %d: %s\n", i+1, share)
+	}
+	fmt.Printf("\nThe server is sealed. Distribute the shares to different operators;\n"+
+		"any %d of them unseal the server with `gophkeeper-server unseal`.\n"+
+		"The shares are not stored anywhere and cannot be shown again.\n", resp.Threshold)
+}
+
+// runUnseal submits unseal shares read from standard input, one per line,
+// so that they do not appear in process listings or shell history
+func runUnseal(args []string) {
+	fs := flag.NewFlagSet("unseal", flag.ExitOnError)
+	reset := fs.Bool("reset", false, "Discard the shares submitted so far")
+
+	client, err := newOperatorClient(fs, args)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var status crypto.SealStatus
+	if *reset {
+		if err := client.post("/api/sys/unseal", api.UnsealRequest{Reset: true}, &status); err != nil {
+			log.Fatalf("Reset failed: %v", err)
+		}
+		fmt.Println("Unseal progress reset")
+		return
+	}
+
+	fmt.Fprintln(os.Stderr, "Enter unseal shares, one per line:")
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		share := strings.TrimSpace(scanner.Text())
+		if share == "" {
+			continue
+		}
+
+		if err := client.post("/api/sys/unseal", api.UnsealRequest{Share: share}, &status); err != nil {
+			log.Fatalf("Unseal failed: %v", err)
+		}
+		if !status.Sealed {
+			fmt.Println("Server unsealed")
+			return
+		}
+		fmt.Printf("Unseal progress: %d/%d\n", status.Progress, status.Threshold)
+	}
+	if err := scanner.Err(); err != nil {
+		log.Fatalf("Failed to read shares: %v", err)
+	}
+
+	fmt.Println("Server is still sealed")
+	os.Exit(1)
+}
+
+// unsealLocally unseals the seal of this process with shares read from standard input;
+// offline commands such as rekey cannot be unsealed through the API
+func unsealLocally(seal *crypto.Seal) {
+	ctx := context.Background()
+
+	status, err := seal.Status(ctx)
+	if err != nil {
+		log.Fatalf("Failed to get seal status: %v", err)
+	}
+	if !status.Initialized {
+		log.Fatal("The seal is not initialized; start the server and run `gophkeeper-server init` first")
+	}
+
+	fmt.Fprintf(os.Stderr, "Enter %d unseal shares, one per line:\n", status.Threshold)
+	scanner := bufio.NewScanner(os.Stdin)
+	for seal.Sealed() && scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		share, err := base64.StdEncoding.DecodeString(line)
+		if err != nil {
+			log.Fatal("Invalid share")
+		}
+		if _, err := seal.Unseal(ctx, share); err != nil {
+			log.Fatalf("Unseal failed: %v", err)
+		}
+	}
+
+	if seal.Sealed() {
+		log.Fatal("Not enough unseal shares")
+	}
+}
@@ -0,0 +1,292 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gophkeeper/server/internal/apierror"
+	"gophkeeper/server/internal/auth"
+	"gophkeeper/server/internal/models"
+	"gophkeeper/server/internal/storage"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// apiTokenTouchInterval limits how often the last use of an API token is written.
+const apiTokenTouchInterval = time.Minute
+
+// maxAPITokenTTL is the longest lifetime of an expiring API token. It also keeps
+// expires_in from overflowing when it is converted to a duration.
+const maxAPITokenTTL = 10 * 365 * 24 * time.Hour
+
+// CreateAPITokenRequest is the body of POST /api/tokens.
+type CreateAPITokenRequest struct {
+	Name           string            `json:"name"`
+	ServiceAccount string            `json:"service_account"`
+	Scope          models.TokenScope `json:"scope"`
+	// ExpiresIn is the lifetime of the token in seconds; zero creates a token that does not expire
+	ExpiresIn int64 `json:"expires_in"`
+}
+
+// CreateAPITokenResponse returns a new API token. The token itself is shown only once.
+type CreateAPITokenResponse struct {
+	Token string `json:"token"`
+	models.APIToken
+}
+
+// CreateAPIToken creates a named API token for the authenticated user.
+func (a *API) CreateAPIToken(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		apierror.Write(w, "User ID not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	var req CreateAPITokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	req.ServiceAccount = strings.TrimSpace(req.ServiceAccount)
+	if req.Name == "" || len(req.Name) > maxSessionFieldLength || len(req.ServiceAccount) > maxSessionFieldLength {
+		apierror.Write(w, "Token name is required and must be at most 255 bytes", http.StatusBadRequest)
+		return
+	}
+	if req.ExpiresIn < 0 || req.ExpiresIn > int64(maxAPITokenTTL/time.Second) {
+		apierror.Write(w, fmt.Sprintf("expires_in must be between 0 and %d", int64(maxAPITokenTTL/time.Second)), http.StatusBadRequest)
+		return
+	}
+
+	id, err := auth.NewAPITokenID()
+	if err != nil {
+		apierror.Write(w, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+	token, hash, err := auth.GenerateAPIToken()
+	if err != nil {
+		apierror.Write(w, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	apiToken := models.APIToken{
+		ID:             id,
+		UserID:         userID,
+		Name:           req.Name,
+		ServiceAccount: req.ServiceAccount,
+		TokenHash:      hash,
+		Scope:          normalizeScope(req.Scope),
+		CreatedAt:      now,
+	}
+	if req.ExpiresIn > 0 {
+		expiresAt := now.Add(time.Duration(req.ExpiresIn) * time.Second)
+		apiToken.ExpiresAt = &expiresAt
+	}
+
+	if err := a.store.CreateAPIToken(ctx, apiToken); err != nil {
+		apierror.Write(w, "Failed to create token", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(CreateAPITokenResponse{Token: token, APIToken: apiToken})
+}
+
+// GetAPITokens returns the API tokens of the authenticated user.
+func (a *API) GetAPITokens(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		apierror.Write(w, "User ID not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	tokens, err := a.store.GetAPITokens(ctx, userID)
+	if err != nil {
+		apierror.Write(w, "Failed to get tokens", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tokens)
+}
+
+// DeleteAPIToken revokes an API token of the authenticated user.
+func (a *API) DeleteAPIToken(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		apierror.Write(w, "User ID not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	if err := a.store.DeleteAPIToken(ctx, userID, chi.URLParam(r, "id")); err != nil {
+		var notFoundErr storage.ErrAPITokenNotFound
+		if errors.As(err, &notFoundErr) {
+			apierror.Write(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		apierror.Write(w, "Failed to revoke token", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// revokeAPITokens revokes all API tokens of a user.
+func (a *API) revokeAPITokens(ctx context.Context, userID int) error {
+	tokens, err := a.store.GetAPITokens(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, token := range tokens {
+		if err := a.store.DeleteAPIToken(ctx, userID, token.ID); err != nil {
+			// A token revoked concurrently is gone already
+			var notFoundErr storage.ErrAPITokenNotFound
+			if !errors.As(err, &notFoundErr) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ResolveAPIToken returns the claims of a valid API token. It is the auth.APITokenResolver
+// for APITokenMiddleware.
+func (a *API) ResolveAPIToken(ctx context.Context, token string) (*auth.Claims, bool, error) {
+	apiToken, err := a.store.GetAPITokenByHash(ctx, auth.HashAPIToken(token))
+	if err != nil {
+		var notFoundErr storage.ErrAPITokenNotFound
+		if errors.As(err, &notFoundErr) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+
+	now := time.Now()
+	if apiToken.ExpiresAt != nil && now.After(*apiToken.ExpiresAt) {
+		return nil, false, nil
+	}
+
+	if apiToken.LastUsedAt == nil || now.Sub(*apiToken.LastUsedAt) >= apiTokenTouchInterval {
+		if err := a.store.TouchAPIToken(ctx, apiToken.ID, now); err != nil {
+			log.Printf("Failed to record use of API token %s: %v", apiToken.ID, err)
+		}
+	}
+
+	claims := &auth.Claims{UserID: apiToken.UserID, APITokenID: apiToken.ID, Scope: &apiToken.Scope}
+	if apiToken.ExpiresAt != nil {
+		// Long-lived calls, such as gRPC streams, end when the token expires
+		claims.ExpiresAt = jwt.NewNumericDate(*apiToken.ExpiresAt)
+	}
+	return claims, true, nil
+}
+
+// RequireWriteScope rejects requests that modify data with a read-only API token.
+func (a *API) RequireWriteScope(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scope := requestScope(r)
+		if scope != nil && scope.ReadOnly && r.Method != http.MethodGet && r.Method != http.MethodHead {
+			apierror.WriteCode(w, "API token is read-only", http.StatusForbidden, apierror.CodeReadOnlyToken, nil)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestScope returns the scope of the API token of a request, or nil if the request
+// is not authenticated with an API token.
+func requestScope(r *http.Request) *models.TokenScope {
+	claims, ok := auth.GetClaimsFromContext(r.Context())
+	if !ok {
+		return nil
+	}
+	return claims.Scope
+}
+
+// scopeAllows reports whether a scope grants access to a secret.
+// A nil scope allows every secret.
+func scopeAllows(scope *models.TokenScope, secret models.Secret) bool {
+	if !restrictsSecrets(scope) {
+		return true
+	}
+	if slices.Contains(scope.SecretIDs, secret.ID) {
+		return true
+	}
+	for _, keyword := range scope.Keywords {
+		if storage.HasKeyword(secret.Metadata, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// restrictsSecrets reports whether a scope limits the secrets a token may access.
+func restrictsSecrets(scope *models.TokenScope) bool {
+	return scope != nil && (len(scope.SecretIDs) > 0 || len(scope.Keywords) > 0)
+}
+
+// checkSecretScope loads a secret and reports whether the API token of the request may
+// access it. Secrets outside the scope are reported as not found.
+func (a *API) checkSecretScope(w http.ResponseWriter, r *http.Request, userID, secretID int) bool {
+	err := a.secretInScope(r.Context(), requestScope(r), userID, secretID)
+	if err == nil {
+		return true
+	}
+
+	var secretNotFoundErr storage.ErrSecretNotFound
+	if errors.As(err, &secretNotFoundErr) {
+		apierror.Write(w, err.Error(), http.StatusNotFound)
+		return false
+	}
+	if reportIntegrityError(w, userID, err) {
+		return false
+	}
+	apierror.Write(w, "Failed to retrieve secret", http.StatusInternalServerError)
+	return false
+}
+
+// secretInScope returns storage.ErrSecretNotFound if scope does not allow a secret.
+func (a *API) secretInScope(ctx context.Context, scope *models.TokenScope, userID, secretID int) error {
+	if !restrictsSecrets(scope) {
+		return nil
+	}
+
+	secret, err := a.store.GetSecretByID(ctx, userID, secretID)
+	if err != nil {
+		return err
+	}
+	if !scopeAllows(scope, secret) {
+		return storage.NewErrSecretNotFound(secretID)
+	}
+	return nil
+}
+
+// normalizeScope drops duplicate secret IDs and keywords.
+func normalizeScope(scope models.TokenScope) models.TokenScope {
+	slices.Sort(scope.SecretIDs)
+	scope.SecretIDs = slices.Compact(scope.SecretIDs)
+
+	var keywords []string
+	for _, keyword := range scope.Keywords {
+		keyword = strings.ToLower(strings.TrimSpace(keyword))
+		if keyword != "" && !slices.Contains(keywords, keyword) {
+			keywords = append(keywords, keyword)
+		}
+	}
+	scope.Keywords = keywords
+	return scope
+}
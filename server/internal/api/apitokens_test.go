@@ -0,0 +1,167 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"gophkeeper/server/internal/auth"
+	"gophkeeper/server/internal/models"
+	"gophkeeper/server/internal/storage"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestAPITokens tests creating, using, scoping and revoking API tokens
+func TestAPITokens(t *testing.T) {
+	store := storage.NewMemStore()
+	jwtManager := auth.NewJWTManager("test-secret")
+	jwtManager.SetRevocationList(auth.NewRevocationList(store))
+	api := New(store, jwtManager)
+	jwtManager.SetAPITokenAuth(api.ResolveAPIToken)
+	router := NewRouter(api, jwtManager)
+
+	user, _ := store.CreateUser(context.Background(), models.User{Login: "alice", Password: "x"})
+	other, _ := store.CreateUser(context.Background(), models.User{Login: "bob", Password: "x"})
+	userJWT, _ := jwtManager.GenerateJWT(user.ID)
+	otherJWT, _ := jwtManager.GenerateJWT(other.ID)
+
+	deploy, _ := store.CreateSecret(context.Background(), models.Secret{UserID: user.ID, Data: []byte("d"), Metadata: "Deploy key for CI"})
+	personal, _ := store.CreateSecret(context.Background(), models.Secret{UserID: user.ID, Data: []byte("p"), Metadata: "Bank card"})
+	pinned, _ := store.CreateSecret(context.Background(), models.Secret{UserID: user.ID, Data: []byte("s"), Metadata: "Signing key"})
+
+	do := func(method, path, token string, body any) *httptest.ResponseRecorder {
+		payload, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, path, bytes.NewReader(payload))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+	create := func(req CreateAPITokenRequest) CreateAPITokenResponse {
+		resp := do(http.MethodPost, "/api/tokens", userJWT, req)
+		if resp.Code != http.StatusCreated {
+			t.Fatalf("Expected status %d for token creation, got %d: %s", http.StatusCreated, resp.Code, resp.Body)
+		}
+		var created CreateAPITokenResponse
+		json.NewDecoder(resp.Body).Decode(&created)
+		return created
+	}
+	secretIDs := func(token string) []int {
+		resp := do(http.MethodGet, "/api/secrets", token, nil)
+		if resp.Code != http.StatusOK {
+			t.Fatalf("Expected status %d for secret list, got %d", http.StatusOK, resp.Code)
+		}
+		var secrets []models.Secret
+		json.NewDecoder(resp.Body).Decode(&secrets)
+		ids := []int{}
+		for _, secret := range secrets {
+			ids = append(ids, secret.ID)
+		}
+		return ids
+	}
+
+	if resp := do(http.MethodPost, "/api/tokens", userJWT, CreateAPITokenRequest{}); resp.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d without a name, got %d", http.StatusBadRequest, resp.Code)
+	}
+	if resp := do(http.MethodPost, "/api/tokens", userJWT, CreateAPITokenRequest{Name: "forever", ExpiresIn: math.MaxInt64}); resp.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for a too long lifetime, got %d", http.StatusBadRequest, resp.Code)
+	}
+
+	// An unrestricted token acts like the user on secrets only
+	full := create(CreateAPITokenRequest{Name: "laptop backup"})
+	if !auth.IsAPIToken(full.Token) || full.ExpiresAt != nil {
+		t.Errorf("Expected a non-expiring API token, got %+v", full)
+	}
+	if ids := secretIDs(full.Token); len(ids) != 3 {
+		t.Errorf("Expected 3 secrets, got %v", ids)
+	}
+	if resp := do(http.MethodGet, "/api/user/sessions", full.Token, nil); resp.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d for sessions with an API token, got %d", http.StatusForbidden, resp.Code)
+	}
+	if resp := do(http.MethodPost, "/api/tokens", full.Token, CreateAPITokenRequest{Name: "escalate"}); resp.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d for token creation with an API token, got %d", http.StatusForbidden, resp.Code)
+	}
+
+	// A read-only service account token limited to a keyword and a secret ID
+	ci := create(CreateAPITokenRequest{
+		Name:           "pipeline",
+		ServiceAccount: "ci",
+		Scope:          models.TokenScope{ReadOnly: true, SecretIDs: []int{pinned.ID, pinned.ID}, Keywords: []string{" CI ", "ci"}},
+		ExpiresIn:      3600,
+	})
+	if len(ci.Scope.SecretIDs) != 1 || len(ci.Scope.Keywords) != 1 || ci.Scope.Keywords[0] != "ci" {
+		t.Errorf("Expected normalized scope, got %+v", ci.Scope)
+	}
+	if ids := secretIDs(ci.Token); len(ids) != 2 {
+		t.Errorf("Expected secrets %d and %d, got %v", deploy.ID, pinned.ID, ids)
+	}
+	path := func(id int) string { return fmt.Sprintf("/api/secrets/%d", id) }
+	if resp := do(http.MethodGet, path(deploy.ID), ci.Token, nil); resp.Code != http.StatusOK {
+		t.Errorf("Expected status %d for a secret in scope, got %d", http.StatusOK, resp.Code)
+	}
+	if resp := do(http.MethodGet, path(personal.ID), ci.Token, nil); resp.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for a secret outside the scope, got %d", http.StatusNotFound, resp.Code)
+	}
+	if resp := do(http.MethodDelete, path(deploy.ID), ci.Token, nil); resp.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d for deletion with a read-only token, got %d", http.StatusForbidden, resp.Code)
+	}
+
+	// A writable token limited to a keyword
+	writer := create(CreateAPITokenRequest{Name: "rotation", Scope: models.TokenScope{Keywords: []string{"ci"}}})
+	if resp := do(http.MethodPost, "/api/secrets", writer.Token, models.Secret{Data: []byte("x"), Metadata: "Other"}); resp.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d for creating a secret outside the scope, got %d", http.StatusForbidden, resp.Code)
+	}
+	if resp := do(http.MethodPost, "/api/secrets", writer.Token, models.Secret{Data: []byte("x"), Metadata: "New CI token"}); resp.Code != http.StatusCreated {
+		t.Errorf("Expected status %d for creating a secret in scope, got %d", http.StatusCreated, resp.Code)
+	}
+	if resp := do(http.MethodPut, path(deploy.ID), writer.Token, models.Secret{Data: []byte("x"), Metadata: "Moved away"}); resp.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d for moving a secret out of the scope, got %d", http.StatusForbidden, resp.Code)
+	}
+	if resp := do(http.MethodPut, path(personal.ID), writer.Token, models.Secret{Data: []byte("x"), Metadata: "CI"}); resp.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for updating a secret outside the scope, got %d", http.StatusNotFound, resp.Code)
+	}
+	if resp := do(http.MethodDelete, path(personal.ID), writer.Token, nil); resp.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for deleting a secret outside the scope, got %d", http.StatusNotFound, resp.Code)
+	}
+	if resp := do(http.MethodDelete, path(deploy.ID), writer.Token, nil); resp.Code != http.StatusNoContent {
+		t.Errorf("Expected status %d for deleting a secret in scope, got %d", http.StatusNoContent, resp.Code)
+	}
+
+	// Listing shows usage but never the token or its hash
+	resp := do(http.MethodGet, "/api/tokens", userJWT, nil)
+	if bytes.Contains(resp.Body.Bytes(), []byte(full.Token)) || bytes.Contains(resp.Body.Bytes(), []byte("token_hash")) {
+		t.Error("Expected token list not to contain tokens")
+	}
+	var tokens []models.APIToken
+	json.NewDecoder(resp.Body).Decode(&tokens)
+	if len(tokens) != 3 || tokens[0].ID != writer.ID || tokens[1].ServiceAccount != "ci" || tokens[0].LastUsedAt == nil {
+		t.Errorf("Expected 3 tokens newest first with usage recorded, got %+v", tokens)
+	}
+
+	// Revocation is limited to the owner and takes effect immediately
+	if resp := do(http.MethodDelete, "/api/tokens/"+full.ID, otherJWT, nil); resp.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d when revoking another user's token, got %d", http.StatusNotFound, resp.Code)
+	}
+	if resp := do(http.MethodDelete, "/api/tokens/"+full.ID, userJWT, nil); resp.Code != http.StatusNoContent {
+		t.Errorf("Expected status %d when revoking a token, got %d", http.StatusNoContent, resp.Code)
+	}
+	if resp := do(http.MethodGet, "/api/secrets", full.Token, nil); resp.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for a revoked token, got %d", http.StatusUnauthorized, resp.Code)
+	}
+
+	// Expired tokens are rejected
+	expired := time.Now().Add(-time.Minute)
+	store.CreateAPIToken(context.Background(), models.APIToken{
+		ID: "expired", UserID: user.ID, Name: "old", TokenHash: auth.HashAPIToken(auth.APITokenPrefix + "expired"),
+		CreatedAt: expired.Add(-time.Hour), ExpiresAt: &expired,
+	})
+	if resp := do(http.MethodGet, "/api/secrets", auth.APITokenPrefix+"expired", nil); resp.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for an expired token, got %d", http.StatusUnauthorized, resp.Code)
+	}
+}
@@ -0,0 +1,234 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"gophkeeper/server/internal/apierror"
+	"gophkeeper/server/internal/auth"
+	"gophkeeper/server/internal/models"
+	"gophkeeper/server/internal/storage"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// authBackend is an authenticator tried by Login.
+type authBackend struct {
+	auth.Authenticator
+	// external reports whether users are managed outside GophKeeper; their roles are
+	// synchronized on every login.
+	external bool
+	// provision creates local users for external users on their first login
+	provision bool
+}
+
+// AddAuthenticator makes Login also accept users of an external authenticator, such as
+// an LDAP directory, after the local passwords. With autoProvision, a local user is
+// created and linked on the first login of an external user who is not linked to one.
+func (a *API) AddAuthenticator(authenticator auth.Authenticator, autoProvision bool) {
+	a.authenticators = append(a.authenticators, authBackend{
+		Authenticator: authenticator,
+		external:      true,
+		provision:     autoProvision,
+	})
+}
+
+// passwordHash looks up the password hash of a local user for the local authenticator.
+func (a *API) passwordHash(ctx context.Context, login string) (string, bool, error) {
+	user, err := a.store.GetUserByLogin(ctx, login)
+	if err != nil {
+		var userNotFoundErr storage.ErrUserNotFound
+		if errors.As(err, &userNotFoundErr) {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+	return user.Password, true, nil
+}
+
+// updatePasswordHash stores a rehashed password of a local user for the local authenticator.
+func (a *API) updatePasswordHash(ctx context.Context, login, hash string) error {
+	user, err := a.store.GetUserByLogin(ctx, login)
+	if err != nil {
+		return err
+	}
+	return a.store.SetUserPassword(ctx, user.ID, hash)
+}
+
+// LDAPLinkRequest links a directory account to the logged in user.
+type LDAPLinkRequest struct {
+	Login    string `json:"login"`
+	Password string `json:"password"`
+}
+
+// authenticate checks a login and password with each authenticator in turn and returns
+// the local user of the first that accepts them. It returns auth.ErrInvalidCredentials
+// if none does, or the error of an authenticator that failed.
+func (a *API) authenticate(ctx context.Context, login, password string) (models.User, error) {
+	backend, authenticated, err := a.checkCredentials(ctx, a.authenticators, login, password)
+	if err != nil {
+		return models.User{}, err
+	}
+	return a.authenticatedUser(ctx, backend, authenticated)
+}
+
+// checkCredentials checks a login and password with each of the backends in turn and
+// returns the first that accepts them.
+func (a *API) checkCredentials(ctx context.Context, backends []authBackend, login, password string) (authBackend, auth.AuthenticatedUser, error) {
+	var backendErr error
+	for _, backend := range backends {
+		authenticated, err := backend.Authenticate(ctx, login, password)
+		if errors.Is(err, auth.ErrInvalidCredentials) {
+			continue
+		}
+		if err != nil {
+			// A directory that is down must not keep the other users out
+			log.Printf("Authenticator %s failed: %v", backend.Name(), err)
+			backendErr = err
+			continue
+		}
+		return backend, authenticated, nil
+	}
+
+	if backendErr != nil {
+		return authBackend{}, auth.AuthenticatedUser{}, backendErr
+	}
+	return authBackend{}, auth.AuthenticatedUser{}, auth.ErrInvalidCredentials
+}
+
+// authenticatedUser returns the local user of an authenticated login. External users
+// are found by the link to their account, which is created when they are provisioned
+// or linked with LDAPLink; a local user with the same login is never taken over.
+func (a *API) authenticatedUser(ctx context.Context, backend authBackend, authenticated auth.AuthenticatedUser) (models.User, error) {
+	if !backend.external {
+		return a.store.GetUserByLogin(ctx, authenticated.Login)
+	}
+
+	user, err := a.store.GetUserByIdentity(ctx, authenticated.Issuer, authenticated.Subject)
+	var identityNotFoundErr storage.ErrIdentityNotFound
+	switch {
+	case errors.As(err, &identityNotFoundErr) && backend.provision:
+		if user, err = a.provisionExternalUser(ctx, backend, authenticated); err != nil {
+			return models.User{}, err
+		}
+	case errors.As(err, &identityNotFoundErr):
+		log.Printf("No user linked to %s user %s", backend.Name(), authenticated.Subject)
+		return models.User{}, auth.ErrInvalidCredentials
+	case err != nil:
+		return models.User{}, err
+	}
+
+	if !slices.Equal(user.Roles, authenticated.Roles) {
+		if err := a.store.SetUserRoles(ctx, user.ID, authenticated.Roles); err != nil {
+			return models.User{}, err
+		}
+		user.Roles = authenticated.Roles
+	}
+	return user, nil
+}
+
+// provisionExternalUser creates a local user for an external user and links it. It
+// returns auth.ErrInvalidCredentials if the login is taken by another user, who has to
+// link the account explicitly.
+func (a *API) provisionExternalUser(ctx context.Context, backend authBackend, authenticated auth.AuthenticatedUser) (models.User, error) {
+	user, err := a.provisionUser(ctx, authenticated.Login)
+	var userExistsErr storage.ErrUserExists
+	if errors.As(err, &userExistsErr) {
+		log.Printf("Login %s of %s user %s is taken by an unlinked user", authenticated.Login, backend.Name(), authenticated.Subject)
+		return models.User{}, auth.ErrInvalidCredentials
+	}
+	if err != nil {
+		return models.User{}, err
+	}
+
+	link, err := a.store.LinkIdentity(ctx, models.UserIdentity{
+		Issuer:    authenticated.Issuer,
+		Subject:   authenticated.Subject,
+		UserID:    user.ID,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		return models.User{}, err
+	}
+	if link.UserID != user.ID {
+		// Linked by a concurrent login
+		return a.store.GetUserByID(ctx, link.UserID)
+	}
+	log.Printf("Provisioned user %d for %s user %s", user.ID, backend.Name(), authenticated.Subject)
+	return user, nil
+}
+
+// externalAuthenticators returns the authenticators of users managed outside GophKeeper.
+func (a *API) externalAuthenticators() []authBackend {
+	var backends []authBackend
+	for _, backend := range a.authenticators {
+		if backend.external {
+			backends = append(backends, backend)
+		}
+	}
+	return backends
+}
+
+// LDAPLink links a directory account to the logged in user, who proves to own it with
+// the directory password. Afterwards the user can log in with either password. Like
+// logins, wrong passwords are throttled.
+func (a *API) LDAPLink(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	claims, ok := auth.GetClaimsFromContext(ctx)
+	if !ok {
+		apierror.Write(w, "User ID not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	var req LDAPLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Login == "" {
+		apierror.Write(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	recent, err := a.isRecentLogin(ctx, claims)
+	if err != nil {
+		apierror.Write(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	if !recent {
+		apierror.WriteCode(w, "Log in again to link a directory account", http.StatusForbidden, apierror.CodeRecentLoginNeeded, nil)
+		return
+	}
+
+	if !a.checkLoginThrottle(w, r, req.Login) {
+		return
+	}
+	_, authenticated, err := a.checkCredentials(ctx, a.externalAuthenticators(), req.Login, req.Password)
+	if errors.Is(err, auth.ErrInvalidCredentials) {
+		a.loginFailed(ctx, req.Login, clientIP(r))
+		apierror.WriteCode(w, "Invalid credentials", http.StatusUnauthorized, apierror.CodeInvalidCredentials, nil)
+		return
+	}
+	if err != nil {
+		apierror.Write(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	a.loginSucceeded(ctx, req.Login)
+
+	link, err := a.store.LinkIdentity(ctx, models.UserIdentity{
+		Issuer:    authenticated.Issuer,
+		Subject:   authenticated.Subject,
+		UserID:    claims.UserID,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		apierror.Write(w, "Failed to link account", http.StatusInternalServerError)
+		return
+	}
+	if link.UserID != claims.UserID {
+		apierror.Write(w, "The directory account is linked to another user", http.StatusConflict)
+		return
+	}
+	log.Printf("Linked directory account %s to user %d", authenticated.Subject, claims.UserID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,21 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"gophkeeper/server/internal/storage"
+)
+
+// ResolveUser returns the ID of the user with a login. It is the auth.UserResolver
+// for client certificate authentication.
+func (a *API) ResolveUser(ctx context.Context, login string) (int, bool, error) {
+	user, err := a.store.GetUserByLogin(ctx, login)
+	if err != nil {
+		var notFoundErr storage.ErrUserNotFound
+		if errors.As(err, &notFoundErr) {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+	return user.ID, true, nil
+}
@@ -0,0 +1,139 @@
+package api
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"gophkeeper/server/internal/auth"
+	"gophkeeper/server/internal/models"
+	"gophkeeper/server/internal/storage"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestClientCertAuth tests authenticating requests with mapped TLS client certificates
+func TestClientCertAuth(t *testing.T) {
+	if _, err := auth.ParseClientCertMapping(map[string]string{"IP=10.0.0.1": "alice"}); err == nil {
+		t.Error("Expected an error for an unknown identity type")
+	}
+	mapping, err := auth.ParseClientCertMapping(map[string]string{
+		"dns=Backup.Example.com": "alice",
+		"CN=reporting":           "missing",
+	})
+	if err != nil {
+		t.Fatalf("Failed to parse mapping: %v", err)
+	}
+
+	store := storage.NewMemStore()
+	alice, _ := store.CreateUser(context.Background(), models.User{Login: "alice", Password: "x"})
+	bob, _ := store.CreateUser(context.Background(), models.User{Login: "bob", Password: "x"})
+
+	jwtManager := auth.NewJWTManager("test-secret")
+	jwtManager.SetRevocationList(auth.NewRevocationList(store))
+	api := New(store, jwtManager)
+	jwtManager.SetClientCertAuth(mapping, api.ResolveUser)
+
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	caDER, _ := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	caCert, _ := x509.ParseCertificate(caDER)
+
+	issue := func(serial int64, commonName string, dnsNames ...string) tls.Certificate {
+		key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: commonName},
+			DNSNames:     dnsNames,
+			NotBefore:    time.Now().Add(-time.Minute),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatalf("Failed to issue certificate: %v", err)
+		}
+		return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(caCert)
+	server := httptest.NewUnstartedServer(NewRouter(api, jwtManager))
+	server.TLS = &tls.Config{ClientCAs: pool, ClientAuth: tls.VerifyClientCertIfGiven}
+	server.StartTLS()
+	defer server.Close()
+
+	get := func(cert *tls.Certificate, token string) int {
+		transport := server.Client().Transport.(*http.Transport).Clone()
+		if cert != nil {
+			transport.TLSClientConfig.Certificates = []tls.Certificate{*cert}
+		}
+		req, _ := http.NewRequest(http.MethodGet, server.URL+"/api/user/sessions", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := (&http.Client{Transport: transport}).Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	mapped := issue(2, "backup", "backup.example.com")
+	if code := get(&mapped, ""); code != http.StatusOK {
+		t.Errorf("Expected status %d for a mapped certificate, got %d", http.StatusOK, code)
+	}
+	unmapped := issue(3, "laptop", "laptop.example.com")
+	if code := get(&unmapped, ""); code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for an unmapped certificate, got %d", http.StatusUnauthorized, code)
+	}
+	orphan := issue(4, "reporting")
+	if code := get(&orphan, ""); code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for a certificate of a missing user, got %d", http.StatusUnauthorized, code)
+	}
+	if code := get(nil, ""); code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d without certificate or token, got %d", http.StatusUnauthorized, code)
+	}
+
+	// A bearer token takes precedence over the certificate
+	token, _ := jwtManager.GenerateJWT(bob.ID)
+	if code := get(&unmapped, token); code != http.StatusOK {
+		t.Errorf("Expected status %d with a bearer token, got %d", http.StatusOK, code)
+	}
+	if code := get(&mapped, "invalid"); code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d with an invalid bearer token, got %d", http.StatusUnauthorized, code)
+	}
+
+	// A certificate with the mapped name from another CA does not authenticate
+	selfKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	selfTemplate, _ := x509.ParseCertificate(mapped.Certificate[0])
+	selfDER, _ := x509.CreateCertificate(rand.Reader, selfTemplate, selfTemplate, &selfKey.PublicKey, selfKey)
+	transport := server.Client().Transport.(*http.Transport).Clone()
+	transport.TLSClientConfig.Certificates = []tls.Certificate{{Certificate: [][]byte{selfDER}, PrivateKey: selfKey}}
+	if resp, err := (&http.Client{Transport: transport}).Get(server.URL + "/api/user/sessions"); err == nil {
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Expected status %d for an untrusted certificate, got %d", http.StatusUnauthorized, resp.StatusCode)
+		}
+	}
+
+	if userID, found, err := api.ResolveUser(context.Background(), "alice"); err != nil || !found || userID != alice.ID {
+		t.Errorf("Expected alice to resolve to %d, got %d, %v, %v", alice.ID, userID, found, err)
+	}
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"gophkeeper/server/internal/apierror"
+	"gophkeeper/server/internal/auth"
+	"gophkeeper/server/internal/models"
+	"gophkeeper/server/internal/storage"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestErrorResponses tests the JSON error envelope of handlers and the auth middleware
+func TestErrorResponses(t *testing.T) {
+	store := storage.NewMemStore()
+	jwtManager := auth.NewJWTManager("test-secret")
+	api := New(store, jwtManager)
+	api.SetLoginThrottle(auth.NewLoginThrottle(store,
+		auth.ThrottlePolicy{FreeAttempts: 0, BaseDelay: time.Minute, MaxDelay: time.Hour, Window: time.Hour},
+		auth.ThrottlePolicy{FreeAttempts: 10, BaseDelay: time.Minute, MaxDelay: time.Hour, Window: time.Hour},
+	))
+	router := NewRouter(api, jwtManager)
+
+	hashedPassword, _ := auth.HashPassword("correct horse battery")
+	user, _ := store.CreateUser(context.Background(), models.User{Login: "alice", Password: hashedPassword})
+	token, _ := jwtManager.GenerateJWT(user.ID)
+
+	do := func(method, path, token, requestID string, body any) (*httptest.ResponseRecorder, apierror.Response) {
+		payload, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, path, bytes.NewReader(payload))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		if requestID != "" {
+			req.Header.Set(apierror.RequestIDHeader, requestID)
+		}
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		var envelope apierror.Response
+		if resp.Code >= http.StatusBadRequest {
+			if contentType := resp.Header().Get("Content-Type"); contentType != "application/json" {
+				t.Errorf("Expected a JSON error for %s %s, got %s", method, path, contentType)
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+				t.Errorf("Failed to decode the error of %s %s: %v", method, path, err)
+			}
+		}
+		return resp, envelope
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		body   any
+		status int
+		code   string
+	}{
+		{"missing token", http.MethodGet, "/api/secrets", "", nil, http.StatusUnauthorized, apierror.CodeUnauthenticated},
+		{"invalid token", http.MethodGet, "/api/secrets", "garbage", nil, http.StatusUnauthorized, apierror.CodeInvalidToken},
+		{"unknown secret", http.MethodGet, "/api/secrets/42", token, nil, http.StatusNotFound, apierror.CodeNotFound},
+		{"invalid secret ID", http.MethodDelete, "/api/secrets/abc", token, nil, http.StatusBadRequest, apierror.CodeInvalidRequest},
+		{"weak password", http.MethodPost, "/api/user/register", "", RegisterRequest{Login: "bob", Password: "short"}, http.StatusBadRequest, apierror.CodeWeakPassword},
+		{"taken login", http.MethodPost, "/api/user/register", "", RegisterRequest{Login: "alice", Password: "correct horse battery"}, http.StatusConflict, apierror.CodeUserExists},
+		{"wrong password", http.MethodPost, "/api/user/login", "", models.User{Login: "alice", Password: "wrong"}, http.StatusUnauthorized, apierror.CodeInvalidCredentials},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, envelope := do(tt.method, tt.path, tt.token, "", tt.body)
+			if resp.Code != tt.status || envelope.Code != tt.code || envelope.Message == "" {
+				t.Errorf("Expected status %d with code %s, got %d: %+v", tt.status, tt.code, resp.Code, envelope)
+			}
+			if envelope.RequestID == "" || envelope.RequestID != resp.Header().Get(apierror.RequestIDHeader) {
+				t.Errorf("Expected the request ID of the %s header, got %q", apierror.RequestIDHeader, envelope.RequestID)
+			}
+		})
+	}
+
+	// The client may choose the request ID, and throttled logins say when to retry
+	resp, envelope := do(http.MethodPost, "/api/user/login", "", "trace-123", models.User{Login: "alice", Password: "wrong"})
+	if resp.Code != http.StatusTooManyRequests || envelope.Code != apierror.CodeLoginThrottled || envelope.RequestID != "trace-123" {
+		t.Errorf("Expected a throttled login with the request ID trace-123, got %d: %+v", resp.Code, envelope)
+	}
+	if retryAfter, ok := envelope.Details["retry_after"].(float64); !ok || retryAfter <= 0 {
+		t.Errorf("Expected retry_after in the details, got %v", envelope.Details)
+	}
+}
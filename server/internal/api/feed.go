@@ -0,0 +1,81 @@
+package api
+
+import (
+	"gophkeeper/server/internal/models"
+	"sync"
+)
+
+// changeFeedBuffer is how many changes a watcher may fall behind before it is dropped
+const changeFeedBuffer = 64
+
+type changeKind int
+
+const (
+	changeCreated changeKind = iota + 1
+	changeUpdated
+	changeDeleted
+)
+
+// secretChange is a change to a secret. Deleted secrets only have their ID set.
+type secretChange struct {
+	Kind   changeKind
+	Secret models.Secret
+}
+
+// changeFeed delivers the secret changes made through the REST and gRPC APIs to the
+// watchers of their owner. It is kept in memory, so watchers only see changes made
+// through the same server instance.
+type changeFeed struct {
+	mu       sync.Mutex
+	watchers map[int]map[chan secretChange]struct{}
+}
+
+func newChangeFeed() *changeFeed {
+	return &changeFeed{watchers: make(map[int]map[chan secretChange]struct{})}
+}
+
+// subscribe returns a channel of the changes to the secrets of a user and a function
+// that ends the subscription. The channel is closed if the watcher falls too far behind.
+func (f *changeFeed) subscribe(userID int) (<-chan secretChange, func()) {
+	ch := make(chan secretChange, changeFeedBuffer)
+
+	f.mu.Lock()
+	if f.watchers[userID] == nil {
+		f.watchers[userID] = make(map[chan secretChange]struct{})
+	}
+	f.watchers[userID][ch] = struct{}{}
+	f.mu.Unlock()
+
+	return ch, func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.remove(userID, ch)
+	}
+}
+
+// publish sends a change to the watchers of a user without blocking.
+func (f *changeFeed) publish(userID int, change secretChange) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for ch := range f.watchers[userID] {
+		select {
+		case ch <- change:
+		default:
+			// A watcher that missed a change must resynchronize
+			f.remove(userID, ch)
+		}
+	}
+}
+
+// remove closes and forgets a watcher. It is called with mu held.
+func (f *changeFeed) remove(userID int, ch chan secretChange) {
+	if _, ok := f.watchers[userID][ch]; !ok {
+		return
+	}
+	close(ch)
+	delete(f.watchers[userID], ch)
+	if len(f.watchers[userID]) == 0 {
+		delete(f.watchers, userID)
+	}
+}
@@ -0,0 +1,508 @@
+package api
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"gophkeeper/server/internal/auth"
+	"gophkeeper/server/internal/models"
+	"gophkeeper/server/internal/pb"
+	"gophkeeper/server/internal/storage"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// grpcWriteMethods are the methods a read-only API token cannot call.
+var grpcWriteMethods = map[string]bool{
+	pb.SecretService_CreateSecret_FullMethodName: true,
+	pb.SecretService_UpdateSecret_FullMethodName: true,
+	pb.SecretService_DeleteSecret_FullMethodName: true,
+}
+
+// NewGRPCServer creates a gRPC server with the user, secret and sync services of the API.
+// It shares the storage and tokens of the REST API; opts typically add TLS credentials.
+func NewGRPCServer(api *API, jwtManager *auth.JWTManager, opts ...grpc.ServerOption) *grpc.Server {
+	interceptor := &grpcAuthInterceptor{api: api, jwtManager: jwtManager}
+	opts = append(opts,
+		grpc.ChainUnaryInterceptor(interceptor.unary),
+		grpc.ChainStreamInterceptor(interceptor.stream),
+	)
+
+	server := grpc.NewServer(opts...)
+	pb.RegisterUserServiceServer(server, &userService{api: api})
+	pb.RegisterSecretServiceServer(server, &secretService{api: api})
+	pb.RegisterSyncServiceServer(server, &syncService{api: api, auth: interceptor})
+	return server
+}
+
+// grpcAuthInterceptor authenticates the calls of SecretService and SyncService like
+// /api/secrets: with a token in the "authorization" metadata or a client certificate.
+type grpcAuthInterceptor struct {
+	api        *API
+	jwtManager *auth.JWTManager
+}
+
+func (i *grpcAuthInterceptor) unary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, err := i.authenticate(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (i *grpcAuthInterceptor) stream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := i.authenticate(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &authenticatedStream{ServerStream: ss, ctx: ctx})
+}
+
+// authenticate stores the claims of a call in its context. UserService is public.
+func (i *grpcAuthInterceptor) authenticate(ctx context.Context, method string) (context.Context, error) {
+	if strings.HasPrefix(method, "/"+pb.UserService_ServiceDesc.ServiceName+"/") {
+		return ctx, nil
+	}
+
+	claims, err := i.claims(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Scope != nil && claims.Scope.ReadOnly && grpcWriteMethods[method] {
+		return nil, status.Error(codes.PermissionDenied, "API token is read-only")
+	}
+
+	return auth.ContextWithClaims(ctx, claims), nil
+}
+
+// claims checks the credentials of a call. Streams check them again while they run, so
+// that revoked and expired credentials end them.
+func (i *grpcAuthInterceptor) claims(ctx context.Context) (*auth.Claims, error) {
+	if i.api.seal != nil && i.api.seal.Sealed() {
+		return nil, status.Error(codes.Unavailable, "Server is sealed")
+	}
+
+	var authorization string
+	if values := metadata.ValueFromIncomingContext(ctx, "authorization"); len(values) > 0 {
+		authorization = values[0]
+	}
+
+	claims, err := i.jwtManager.Authenticate(ctx, authorization, peerCertificate(ctx), true)
+	if err != nil {
+		var authErr *auth.AuthError
+		switch {
+		case errors.As(err, &authErr) && authErr.Forbidden:
+			return nil, status.Error(codes.PermissionDenied, authErr.Message)
+		case errors.As(err, &authErr):
+			return nil, status.Error(codes.Unauthenticated, authErr.Message)
+		default:
+			return nil, status.Error(codes.Internal, "Server error")
+		}
+	}
+	return claims, nil
+}
+
+// authenticatedStream replaces the context of a stream with the authenticated one.
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+// peerCertificate returns the verified client certificate of a call, or nil.
+func peerCertificate(ctx context.Context) *x509.Certificate {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.VerifiedChains) == 0 {
+		return nil
+	}
+	return tlsInfo.State.VerifiedChains[0][0]
+}
+
+// grpcClient describes the client of a call as a session without IDs and times.
+func grpcClient(ctx context.Context, deviceName string) models.Session {
+	client := models.Session{DeviceName: deviceName}
+	if values := metadata.ValueFromIncomingContext(ctx, "user-agent"); len(values) > 0 {
+		client.ClientVersion = values[0]
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		client.IP = p.Addr.String()
+		if host, _, err := net.SplitHostPort(client.IP); err == nil {
+			client.IP = host
+		}
+	}
+	return client
+}
+
+// grpcError converts an error of the helpers shared with the REST API to a gRPC status.
+func grpcError(err error) error {
+	var reqErr *requestError
+	if !errors.As(err, &reqErr) {
+		return status.Error(codes.Internal, "Server error")
+	}
+
+	code := codes.Internal
+	switch reqErr.Status {
+	case http.StatusBadRequest:
+		code = codes.InvalidArgument
+	case http.StatusUnauthorized:
+		code = codes.Unauthenticated
+	case http.StatusForbidden:
+		code = codes.PermissionDenied
+	case http.StatusNotFound:
+		code = codes.NotFound
+	case http.StatusConflict:
+		code = codes.AlreadyExists
+	case http.StatusPreconditionFailed:
+		code = codes.FailedPrecondition
+	case http.StatusTooManyRequests:
+		code = codes.ResourceExhausted
+	case http.StatusServiceUnavailable:
+		code = codes.Unavailable
+	}
+	return status.Error(code, reqErr.Message)
+}
+
+// secretError converts an error of a secret operation to a gRPC status.
+func secretError(userID int, err error) error {
+	var secretNotFoundErr storage.ErrSecretNotFound
+	if errors.As(err, &secretNotFoundErr) {
+		return status.Error(codes.NotFound, err.Error())
+	}
+	var integrityErr storage.ErrSecretIntegrity
+	if errors.As(err, &integrityErr) {
+		logIntegrityError(userID, integrityErr)
+		return status.Error(codes.DataLoss, integrityErr.Error())
+	}
+	return status.Error(codes.Internal, "Server error")
+}
+
+// callerID returns the user ID and API token scope of an authenticated call.
+func callerID(ctx context.Context) (int, *models.TokenScope, error) {
+	claims, ok := auth.GetClaimsFromContext(ctx)
+	if !ok {
+		return 0, nil, status.Error(codes.Internal, "Token claims not found in context")
+	}
+	return claims.UserID, claims.Scope, nil
+}
+
+func secretToPB(secret models.Secret) *pb.Secret {
+	return &pb.Secret{
+		Id:       int64(secret.ID),
+		Type:     pb.SecretType(secret.Type),
+		Data:     secret.Data,
+		Metadata: secret.Metadata,
+	}
+}
+
+func tokensToPB(tokens TokenResponse) *pb.Tokens {
+	return &pb.Tokens{
+		Token:        tokens.Token,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresIn:    int32(tokens.ExpiresIn),
+	}
+}
+
+// userService implements pb.UserServiceServer.
+type userService struct {
+	pb.UnimplementedUserServiceServer
+	api *API
+}
+
+func (s *userService) Register(ctx context.Context, req *pb.RegisterRequest) (*pb.RegisterResponse, error) {
+	a := s.api
+
+	if err := a.passwordPolicy.Check(req.Login, req.Password); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if err := a.allowRegistration(req.Invite); err != nil {
+		return nil, grpcError(err)
+	}
+
+	hashedPassword, err := auth.HashPassword(req.Password)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "Failed to hash password")
+	}
+
+	createdUser, err := a.registerUser(ctx, models.User{Login: req.Login, Password: hashedPassword}, req.Invite)
+	if err != nil {
+		var reqErr *requestError
+		if !errors.As(err, &reqErr) {
+			return nil, status.Error(codes.Internal, "Failed to create user")
+		}
+		return nil, grpcError(err)
+	}
+
+	recoveryCodes, err := a.issueRecoveryCodes(ctx, createdUser.ID)
+	if err != nil {
+		log.Printf("Failed to issue recovery codes for user %d: %v", createdUser.ID, err)
+	}
+
+	return &pb.RegisterResponse{UserId: int64(createdUser.ID), Login: createdUser.Login, RecoveryCodes: recoveryCodes}, nil
+}
+
+func (s *userService) Login(ctx context.Context, req *pb.LoginRequest) (*pb.LoginResponse, error) {
+	a := s.api
+	client := grpcClient(ctx, req.DeviceName)
+
+	if err := a.loginThrottled(ctx, req.Login, client.IP); err != nil {
+		return nil, grpcError(err)
+	}
+
+	user, err := a.authenticate(ctx, req.Login, req.Password)
+	if err != nil {
+		// Unknown logins are throttled like wrong passwords
+		if errors.Is(err, auth.ErrInvalidCredentials) {
+			a.loginFailed(ctx, req.Login, client.IP)
+			return nil, status.Error(codes.Unauthenticated, "Invalid credentials")
+		}
+		return nil, status.Error(codes.Internal, "Server error")
+	}
+
+	tokens, challenge, err := a.finishLogin(ctx, user, client)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	if challenge != nil {
+		return &pb.LoginResponse{Result: &pb.LoginResponse_MfaChallenge{MfaChallenge: &pb.MFAChallenge{
+			Challenge: challenge.Challenge,
+			ExpiresIn: int32(challenge.ExpiresIn),
+		}}}, nil
+	}
+	return &pb.LoginResponse{Result: &pb.LoginResponse_Tokens{Tokens: tokensToPB(tokens)}}, nil
+}
+
+func (s *userService) LoginTOTP(ctx context.Context, req *pb.LoginTOTPRequest) (*pb.Tokens, error) {
+	if req.Challenge == "" {
+		return nil, status.Error(codes.InvalidArgument, "Challenge is required")
+	}
+
+	tokens, err := s.api.loginTOTP(ctx, MFALoginRequest{
+		Challenge:       req.Challenge,
+		TOTPCodeRequest: TOTPCodeRequest{Code: req.Code, RecoveryCode: req.RecoveryCode},
+	}, grpcClient(ctx, req.DeviceName))
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return tokensToPB(tokens), nil
+}
+
+func (s *userService) Refresh(ctx context.Context, req *pb.RefreshRequest) (*pb.Tokens, error) {
+	if req.RefreshToken == "" {
+		return nil, status.Error(codes.InvalidArgument, "Refresh token is required")
+	}
+
+	tokens, err := s.api.rotateRefreshToken(ctx, req.RefreshToken, grpcClient(ctx, "").IP)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return tokensToPB(tokens), nil
+}
+
+// secretService implements pb.SecretServiceServer.
+type secretService struct {
+	pb.UnimplementedSecretServiceServer
+	api *API
+}
+
+func (s *secretService) CreateSecret(ctx context.Context, req *pb.CreateSecretRequest) (*pb.Secret, error) {
+	userID, scope, err := callerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	secret := models.Secret{UserID: userID, Type: models.SecretType(req.Type), Data: req.Data, Metadata: req.Metadata}
+	if !scopeAllows(scope, secret) {
+		return nil, status.Error(codes.PermissionDenied, "Secret is outside the scope of the API token")
+	}
+
+	createdSecret, err := s.api.store.CreateSecret(ctx, secret)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "Failed to create secret")
+	}
+	s.api.changes.publish(userID, secretChange{Kind: changeCreated, Secret: createdSecret})
+
+	return secretToPB(createdSecret), nil
+}
+
+func (s *secretService) GetSecret(ctx context.Context, req *pb.GetSecretRequest) (*pb.Secret, error) {
+	userID, scope, err := callerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := s.api.store.GetSecretByID(ctx, userID, int(req.Id))
+	if err != nil {
+		return nil, secretError(userID, err)
+	}
+	if !scopeAllows(scope, secret) {
+		return nil, status.Error(codes.NotFound, storage.NewErrSecretNotFound(int(req.Id)).Error())
+	}
+
+	return secretToPB(secret), nil
+}
+
+func (s *secretService) ListSecrets(req *pb.ListSecretsRequest, stream grpc.ServerStreamingServer[pb.Secret]) error {
+	ctx := stream.Context()
+
+	userID, scope, err := callerID(ctx)
+	if err != nil {
+		return err
+	}
+
+	secrets, err := s.api.store.SearchSecrets(ctx, userID, models.SecretQuery{Metadata: req.Metadata, Keyword: req.Keyword})
+	if err != nil {
+		return secretError(userID, err)
+	}
+
+	for _, secret := range secrets {
+		if !scopeAllows(scope, secret) {
+			continue
+		}
+		if err := stream.Send(secretToPB(secret)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *secretService) UpdateSecret(ctx context.Context, req *pb.UpdateSecretRequest) (*pb.Secret, error) {
+	userID, scope, err := callerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	secret := models.Secret{ID: int(req.Id), UserID: userID, Type: models.SecretType(req.Type), Data: req.Data, Metadata: req.Metadata}
+	if err := s.api.secretInScope(ctx, scope, userID, secret.ID); err != nil {
+		return nil, secretError(userID, err)
+	}
+	if !scopeAllows(scope, secret) {
+		return nil, status.Error(codes.PermissionDenied, "Secret is outside the scope of the API token")
+	}
+
+	updatedSecret, err := s.api.store.UpdateSecret(ctx, secret)
+	if err != nil {
+		return nil, secretError(userID, err)
+	}
+	s.api.changes.publish(userID, secretChange{Kind: changeUpdated, Secret: updatedSecret})
+
+	return secretToPB(updatedSecret), nil
+}
+
+func (s *secretService) DeleteSecret(ctx context.Context, req *pb.DeleteSecretRequest) (*pb.DeleteSecretResponse, error) {
+	userID, scope, err := callerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	secretID := int(req.Id)
+	if err := s.api.secretInScope(ctx, scope, userID, secretID); err != nil {
+		return nil, secretError(userID, err)
+	}
+
+	if err := s.api.store.DeleteSecret(ctx, userID, secretID); err != nil {
+		return nil, secretError(userID, err)
+	}
+	s.api.changes.publish(userID, secretChange{Kind: changeDeleted, Secret: models.Secret{ID: secretID, UserID: userID}})
+
+	return &pb.DeleteSecretResponse{}, nil
+}
+
+// syncService implements pb.SyncServiceServer.
+type syncService struct {
+	pb.UnimplementedSyncServiceServer
+	api  *API
+	auth *grpcAuthInterceptor
+}
+
+// watchAuthInterval is how often Watch checks the credentials of an idle stream again.
+var watchAuthInterval = 30 * time.Second
+
+// Watch streams the changes to the secrets of the caller. API tokens limited to
+// keywords do not see deletions, as the metadata of a deleted secret is gone.
+func (s *syncService) Watch(req *pb.WatchRequest, stream grpc.ServerStreamingServer[pb.SecretChange]) error {
+	ctx := stream.Context()
+
+	userID, scope, err := callerID(ctx)
+	if err != nil {
+		return err
+	}
+
+	changes, unsubscribe := s.api.changes.subscribe(userID)
+	defer unsubscribe()
+
+	// The headers tell the client that no later change will be missed
+	if err := stream.SendHeader(metadata.MD{}); err != nil {
+		return err
+	}
+
+	// The stream outlives the check of its credentials: logouts, revoked sessions and API
+	// tokens and expired access tokens must end it too
+	recheck := time.NewTicker(watchAuthInterval)
+	defer recheck.Stop()
+	var expired <-chan time.Time
+	if claims, ok := auth.GetClaimsFromContext(ctx); ok && claims.ExpiresAt != nil {
+		expiry := time.NewTimer(time.Until(claims.ExpiresAt.Time))
+		defer expiry.Stop()
+		expired = expiry.C
+	}
+
+	for {
+		var change secretChange
+		var ok bool
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-expired:
+			return status.Error(codes.Unauthenticated, "Invalid or expired token")
+		case <-recheck.C:
+			if _, err := s.auth.claims(ctx); err != nil {
+				return err
+			}
+			continue
+		case change, ok = <-changes:
+		}
+		if !ok {
+			return status.Error(codes.Aborted, "Too many changes missed; list the secrets again and resume watching")
+		}
+		if !scopeAllows(scope, change.Secret) {
+			continue
+		}
+		if _, err := s.auth.claims(ctx); err != nil {
+			return err
+		}
+
+		msg := &pb.SecretChange{SecretId: int64(change.Secret.ID)}
+		switch change.Kind {
+		case changeCreated:
+			msg.Kind = pb.SecretChange_KIND_CREATED
+			msg.Secret = secretToPB(change.Secret)
+		case changeUpdated:
+			msg.Kind = pb.SecretChange_KIND_UPDATED
+			msg.Secret = secretToPB(change.Secret)
+		case changeDeleted:
+			msg.Kind = pb.SecretChange_KIND_DELETED
+		}
+		if err := stream.Send(msg); err != nil {
+			return err
+		}
+	}
+}
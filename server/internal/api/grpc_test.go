@@ -0,0 +1,231 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gophkeeper/server/internal/auth"
+	"gophkeeper/server/internal/models"
+	"gophkeeper/server/internal/pb"
+	"gophkeeper/server/internal/storage"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// TestGRPC tests the gRPC services against the storage and tokens shared with the REST API
+func TestGRPC(t *testing.T) {
+	store := storage.NewMemStore()
+	jwtManager := auth.NewJWTManager("test-secret")
+	jwtManager.SetRevocationList(auth.NewRevocationList(store))
+	api := New(store, jwtManager)
+	jwtManager.SetAPITokenAuth(api.ResolveAPIToken)
+	router := NewRouter(api, jwtManager)
+
+	listener := bufconn.Listen(1 << 20)
+	server := NewGRPCServer(api, jwtManager)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	users := pb.NewUserServiceClient(conn)
+	secrets := pb.NewSecretServiceClient(conn)
+	syncClient := pb.NewSyncServiceClient(conn)
+	ctx := context.Background()
+	withToken := func(token string) context.Context {
+		return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+	}
+	expectCode := func(err error, code codes.Code, what string) {
+		t.Helper()
+		if status.Code(err) != code {
+			t.Errorf("Expected %s for %s, got %v", code, what, err)
+		}
+	}
+	rest := func(method, path, token string, body any) *httptest.ResponseRecorder {
+		payload, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, path, bytes.NewReader(payload))
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+
+	registered, err := users.Register(ctx, &pb.RegisterRequest{Login: "alice", Password: "correct horse battery"})
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	if registered.Login != "alice" || len(registered.RecoveryCodes) == 0 {
+		t.Errorf("Expected alice with recovery codes, got %v", registered)
+	}
+	_, err = users.Register(ctx, &pb.RegisterRequest{Login: "alice", Password: "correct horse battery"})
+	expectCode(err, codes.AlreadyExists, "a taken login")
+
+	_, err = users.Login(ctx, &pb.LoginRequest{Login: "alice", Password: "wrong password"})
+	expectCode(err, codes.Unauthenticated, "a wrong password")
+	login, err := users.Login(ctx, &pb.LoginRequest{Login: "alice", Password: "correct horse battery", DeviceName: "build agent"})
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	tokens := login.GetTokens()
+	if tokens == nil || tokens.Token == "" {
+		t.Fatalf("Expected tokens, got %v", login)
+	}
+	sessions, _ := store.GetSessions(ctx, int(registered.UserId))
+	if len(sessions) != 1 || sessions[0].DeviceName != "build agent" {
+		t.Errorf("Expected a session of the build agent, got %+v", sessions)
+	}
+
+	refreshed, err := users.Refresh(ctx, &pb.RefreshRequest{RefreshToken: tokens.RefreshToken})
+	if err != nil || refreshed.Token == "" {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+	_, err = users.Refresh(ctx, &pb.RefreshRequest{RefreshToken: tokens.RefreshToken})
+	expectCode(err, codes.Unauthenticated, "a reused refresh token")
+
+	login, _ = users.Login(ctx, &pb.LoginRequest{Login: "alice", Password: "correct horse battery"})
+	token := login.GetTokens().Token
+
+	_, err = secrets.GetSecret(ctx, &pb.GetSecretRequest{Id: 1})
+	expectCode(err, codes.Unauthenticated, "a call without a token")
+
+	// Changes made through either API reach the watcher
+	watchCtx, cancel := context.WithCancel(withToken(token))
+	defer cancel()
+	watch, err := syncClient.Watch(watchCtx, &pb.WatchRequest{})
+	if err != nil {
+		t.Fatalf("Watch failed: %v", err)
+	}
+	if _, err := watch.Header(); err != nil {
+		t.Fatalf("Watch failed: %v", err)
+	}
+
+	created, err := secrets.CreateSecret(withToken(token), &pb.CreateSecretRequest{
+		Type: pb.SecretType_SECRET_TYPE_TEXT, Data: []byte("note"), Metadata: "Deploy notes",
+	})
+	if err != nil {
+		t.Fatalf("CreateSecret failed: %v", err)
+	}
+	resp := rest(http.MethodPost, "/api/secrets", token, models.Secret{Data: []byte("pin"), Metadata: "Bank card"})
+	var card models.Secret
+	json.NewDecoder(resp.Body).Decode(&card)
+	if _, err := secrets.UpdateSecret(withToken(token), &pb.UpdateSecretRequest{
+		Id: created.Id, Type: pb.SecretType_SECRET_TYPE_TEXT, Data: []byte("new note"), Metadata: "Deploy notes",
+	}); err != nil {
+		t.Fatalf("UpdateSecret failed: %v", err)
+	}
+	rest(http.MethodDelete, fmt.Sprintf("/api/secrets/%d", card.ID), token, nil)
+
+	expected := []struct {
+		kind pb.SecretChange_Kind
+		id   int64
+		data string
+	}{
+		{pb.SecretChange_KIND_CREATED, created.Id, "note"},
+		{pb.SecretChange_KIND_CREATED, int64(card.ID), "pin"},
+		{pb.SecretChange_KIND_UPDATED, created.Id, "new note"},
+		{pb.SecretChange_KIND_DELETED, int64(card.ID), ""},
+	}
+	for _, want := range expected {
+		change, err := watch.Recv()
+		if err != nil {
+			t.Fatalf("Watch ended: %v", err)
+		}
+		if change.Kind != want.kind || change.SecretId != want.id || string(change.GetSecret().GetData()) != want.data {
+			t.Errorf("Expected %v of secret %d with %q, got %v", want.kind, want.id, want.data, change)
+		}
+	}
+
+	secret, err := secrets.GetSecret(withToken(token), &pb.GetSecretRequest{Id: created.Id})
+	if err != nil || string(secret.Data) != "new note" {
+		t.Errorf("Expected the updated secret, got %v, %v", secret, err)
+	}
+	_, err = secrets.GetSecret(withToken(token), &pb.GetSecretRequest{Id: int64(card.ID)})
+	expectCode(err, codes.NotFound, "a deleted secret")
+
+	// Large lists are streamed one secret per message
+	for i := range 5 {
+		secrets.CreateSecret(withToken(token), &pb.CreateSecretRequest{Data: []byte("x"), Metadata: fmt.Sprintf("Server %d", i)})
+	}
+	list, err := secrets.ListSecrets(withToken(token), &pb.ListSecretsRequest{Keyword: "server"})
+	if err != nil {
+		t.Fatalf("ListSecrets failed: %v", err)
+	}
+	count := 0
+	for {
+		_, err := list.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("ListSecrets failed: %v", err)
+		}
+		count++
+	}
+	if count != 5 {
+		t.Errorf("Expected 5 secrets, got %d", count)
+	}
+
+	// API tokens keep their scope
+	resp = rest(http.MethodPost, "/api/tokens", token, CreateAPITokenRequest{
+		Name: "ci", Scope: models.TokenScope{ReadOnly: true, SecretIDs: []int{int(created.Id)}},
+	})
+	var apiToken CreateAPITokenResponse
+	json.NewDecoder(resp.Body).Decode(&apiToken)
+	_, err = secrets.CreateSecret(withToken(apiToken.Token), &pb.CreateSecretRequest{Data: []byte("x")})
+	expectCode(err, codes.PermissionDenied, "a read-only API token")
+	if _, err := secrets.GetSecret(withToken(apiToken.Token), &pb.GetSecretRequest{Id: created.Id}); err != nil {
+		t.Errorf("Expected the secret in the scope, got %v", err)
+	}
+	list, _ = secrets.ListSecrets(withToken(apiToken.Token), &pb.ListSecretsRequest{})
+	if first, err := list.Recv(); err != nil || first.Id != created.Id {
+		t.Errorf("Expected only the secret in the scope, got %v, %v", first, err)
+	}
+	if _, err := list.Recv(); !errors.Is(err, io.EOF) {
+		t.Errorf("Expected only the secret in the scope, got %v", err)
+	}
+	// Watchers end when their session is logged out, checked on the next change
+	login, _ = users.Login(ctx, &pb.LoginRequest{Login: "alice", Password: "correct horse battery"})
+	loggedOut := login.GetTokens().Token
+	watch, err = syncClient.Watch(withToken(loggedOut), &pb.WatchRequest{})
+	if err != nil {
+		t.Fatalf("Watch failed: %v", err)
+	}
+	watch.Header()
+	rest(http.MethodPost, "/api/user/logout", loggedOut, nil)
+	secrets.CreateSecret(withToken(token), &pb.CreateSecretRequest{Data: []byte("x")})
+	_, err = watch.Recv()
+	expectCode(err, codes.Unauthenticated, "a watcher of a logged out session")
+
+	// Idle watchers notice revoked API tokens too
+	watchAuthInterval = 10 * time.Millisecond
+	t.Cleanup(func() { watchAuthInterval = 30 * time.Second })
+	watch, err = syncClient.Watch(withToken(apiToken.Token), &pb.WatchRequest{})
+	if err != nil {
+		t.Fatalf("Watch failed: %v", err)
+	}
+	watch.Header()
+	rest(http.MethodDelete, "/api/tokens/"+apiToken.ID, token, nil)
+	_, err = watch.Recv()
+	expectCode(err, codes.Unauthenticated, "a watcher with a revoked API token")
+}
@@ -1,13 +1,22 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"gophkeeper/server/internal/apierror"
 	"gophkeeper/server/internal/auth"
+	"gophkeeper/server/internal/crypto"
 	"gophkeeper/server/internal/models"
 	"gophkeeper/server/internal/storage"
+	"log"
+	"math"
 	"net/http"
+	"slices"
 	"strconv"
+	"sync"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 )
@@ -16,42 +25,103 @@ import (
 type API struct {
 	store      storage.Store
 	jwtManager *auth.JWTManager
+	seal       *crypto.Seal
+	throttle   *auth.LoginThrottle
+	refreshTTL time.Duration
+
+	oidc          *auth.OIDCProvider
+	oidcProvision bool
+	oidcLogins    *pendingLogins[pendingOIDCLogin]
+	// oidcLinks are identity provider accounts waiting to be linked to an existing user
+	oidcLinks *pendingLogins[auth.OIDCIdentity]
+
+	// authenticators check passwords at login, the local one first
+	authenticators []authBackend
+	passwordPolicy auth.PasswordPolicy
+
+	srpLogins *pendingLogins[srpLogin]
+	// srpKey derives the fake SRP salts of unknown logins; it is loaded from the store on
+	// first use, so that the salts stay the same across restarts and server instances
+	srpKeyMu sync.Mutex
+	srpKey   []byte
+
+	registrationMode RegistrationMode
+	inviteTTL        time.Duration
+
+	// changes feeds the secret changes to gRPC watchers
+	changes *changeFeed
 }
 
 // New creates a new API structure.
 func New(store storage.Store, jwtManager *auth.JWTManager) *API {
-	return &API{store: store, jwtManager: jwtManager}
+	a := &API{
+		store:          store,
+		jwtManager:     jwtManager,
+		refreshTTL:     auth.DefaultRefreshTokenTTL,
+		passwordPolicy: auth.DefaultPasswordPolicy,
+		srpLogins:      newPendingLogins[srpLogin](srpLoginTTL),
+		inviteTTL:      DefaultInviteTTL,
+		changes:        newChangeFeed(),
+	}
+	a.authenticators = []authBackend{{Authenticator: auth.NewLocalAuthenticator(a.passwordHash, a.updatePasswordHash)}}
+	return a
+}
+
+// SetRefreshTokenTTL sets the lifetime of issued refresh tokens.
+func (a *API) SetRefreshTokenTTL(ttl time.Duration) {
+	a.refreshTTL = ttl
+}
+
+// SetPasswordPolicy sets the rules for passwords of new users.
+func (a *API) SetPasswordPolicy(policy auth.PasswordPolicy) {
+	a.passwordPolicy = policy
+}
+
+// SetSeal enables sealed mode: secret operations are rejected until the seal is unsealed
+// through the /api/sys endpoints.
+func (a *API) SetSeal(seal *crypto.Seal) {
+	a.seal = seal
+}
+
+// RegisterRequest is the body of POST /api/user/register.
+type RegisterRequest struct {
+	Login    string `json:"login"`
+	Password string `json:"password"`
+	// Invite is the invite code required in invite-only registration mode
+	Invite string `json:"invite,omitempty"`
 }
 
 func (a *API) Register(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	var user models.User
-	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	var req RegisterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	hashedPassword, err := auth.HashPassword(user.Password)
+	if err := a.passwordPolicy.Check(req.Login, req.Password); err != nil {
+		apierror.WriteCode(w, err.Error(), http.StatusBadRequest, apierror.CodeWeakPassword, nil)
+		return
+	}
+
+	if !a.checkRegistration(w, req.Invite) {
+		return
+	}
+
+	hashedPassword, err := auth.HashPassword(req.Password)
 	if err != nil {
-		http.Error(w, "Failed to hash password", http.StatusInternalServerError)
+		apierror.Write(w, "Failed to hash password", http.StatusInternalServerError)
 		return
 	}
-	user.Password = hashedPassword
 
-	createdUser, err := a.store.CreateUser(ctx, user)
+	createdUser, err := a.registerUser(ctx, models.User{Login: req.Login, Password: hashedPassword}, req.Invite)
 	if err != nil {
-		var userExistsErr storage.ErrUserExists
-		if errors.As(err, &userExistsErr) {
-			http.Error(w, err.Error(), http.StatusConflict)
-			return
-		}
-		http.Error(w, "Failed to create user", http.StatusInternalServerError)
+		writeRegistrationError(w, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(createdUser)
+	a.respondRegistered(w, r, createdUser)
 }
 
 func (a *API) Login(w http.ResponseWriter, r *http.Request) {
@@ -59,193 +129,373 @@ func (a *API) Login(w http.ResponseWriter, r *http.Request) {
 
 	var creds models.User
 	if err := json.NewDecoder(r.Body).Decode(&creds); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		apierror.Write(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if !a.checkLoginThrottle(w, r, creds.Login) {
 		return
 	}
 
-	user, err := a.store.GetUserByLogin(ctx, creds.Login)
+	user, err := a.authenticate(ctx, creds.Login, creds.Password)
 	if err != nil {
-		var userNotFoundErr storage.ErrUserNotFound
-		if errors.As(err, &userNotFoundErr) {
-			http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		// Unknown logins are throttled like wrong passwords
+		if errors.Is(err, auth.ErrInvalidCredentials) {
+			a.loginFailed(ctx, creds.Login, clientIP(r))
+			apierror.WriteCode(w, "Invalid credentials", http.StatusUnauthorized, apierror.CodeInvalidCredentials, nil)
 			return
 		}
-		http.Error(w, "Server error", http.StatusInternalServerError) // Generic error for other storage issues
+		apierror.Write(w, "Server error", http.StatusInternalServerError) // Generic error for storage and directory issues
 		return
 	}
 
-	if !auth.CheckPasswordHash(creds.Password, user.Password) {
-		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
-		return
-	}
+	a.completeLogin(w, r, user)
+}
 
-	token, err := a.jwtManager.GenerateJWT(user.ID)
+// completeLogin responds to a login with verified credentials: with an MFA challenge if
+// the user has two-factor authentication enabled, and with tokens otherwise.
+func (a *API) completeLogin(w http.ResponseWriter, r *http.Request, user models.User) {
+	tokens, challenge, err := a.finishLogin(r.Context(), user, requestClient(r))
 	if err != nil {
-		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		writeRequestError(w, err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"token": token})
+	if challenge != nil {
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(challenge)
+		return
+	}
+	json.NewEncoder(w).Encode(tokens)
 }
 
-func (a *API) CreateSecret(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
+// finishLogin completes a login with verified credentials. It returns an MFA challenge
+// if the user has two-factor authentication enabled, and starts a session for client
+// otherwise.
+func (a *API) finishLogin(ctx context.Context, user models.User, client models.Session) (TokenResponse, *MFAChallengeResponse, error) {
+	mfaRequired, err := a.requiresTOTP(ctx, user.ID)
+	if err != nil {
+		return TokenResponse{}, nil, err
+	}
+	if mfaRequired {
+		// Failures are reset only once the second factor is verified too
+		challenge, err := a.jwtManager.GenerateMFAChallenge(user.ID)
+		if err != nil {
+			return TokenResponse{}, nil, fmt.Errorf("failed to generate challenge: %w", err)
+		}
+		return TokenResponse{}, &MFAChallengeResponse{
+			MFARequired: true,
+			Challenge:   challenge,
+			ExpiresIn:   int(auth.MFAChallengeTTL.Seconds()),
+		}, nil
+	}
 
-	userID, ok := auth.GetUserIDFromContext(r.Context())
-	if !ok {
-		http.Error(w, "User ID not found in context", http.StatusInternalServerError)
-		return
+	a.loginSucceeded(ctx, user.Login)
+
+	client.UserID = user.ID
+	sessionID, err := a.createSession(ctx, client)
+	if err != nil {
+		return TokenResponse{}, nil, err
 	}
 
+	resp, err := a.issueTokens(ctx, user.ID, sessionID)
+	if err != nil {
+		return TokenResponse{}, nil, err
+	}
+	return resp, nil, nil
+}
+
+func (a *API) CreateSecret(w http.ResponseWriter, r *http.Request) {
 	var secret models.Secret
 	if err := json.NewDecoder(r.Body).Decode(&secret); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		apierror.Write(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
-	secret.UserID = userID // Ensure secret is for the authenticated user
 
-	createdSecret, err := a.store.CreateSecret(ctx, secret)
-	if err != nil {
-		http.Error(w, "Failed to create secret", http.StatusInternalServerError)
+	createdSecret, ok := a.createSecret(w, r, secret)
+	if !ok {
 		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(createdSecret)
 }
 
 func (a *API) GetSecrets(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
+	secrets, ok := a.listSecrets(w, r)
+	if !ok {
+		return
+	}
 
-	userID, ok := auth.GetUserIDFromContext(r.Context())
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(secrets)
+}
+
+func (a *API) GetSecretByID(w http.ResponseWriter, r *http.Request) {
+	secret, ok := a.getSecret(w, r)
 	if !ok {
-		http.Error(w, "User ID not found in context", http.StatusInternalServerError)
 		return
 	}
 
-	secrets, err := a.store.GetSecrets(ctx, userID)
-	if err != nil {
-		http.Error(w, "Failed to retrieve secrets", http.StatusInternalServerError)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(secret)
+}
+
+func (a *API) UpdateSecret(w http.ResponseWriter, r *http.Request) {
+	var secret models.Secret
+	if err := json.NewDecoder(r.Body).Decode(&secret); err != nil {
+		apierror.Write(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	updatedSecret, ok := a.updateSecret(w, r, secret)
+	if !ok {
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(secrets)
+	json.NewEncoder(w).Encode(updatedSecret)
 }
 
-func (a *API) GetSecretByID(w http.ResponseWriter, r *http.Request) {
+func (a *API) DeleteSecret(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
 	userID, ok := auth.GetUserIDFromContext(r.Context())
 	if !ok {
-		http.Error(w, "User ID not found in context", http.StatusInternalServerError)
+		apierror.Write(w, "User ID not found in context", http.StatusInternalServerError)
 		return
 	}
 
-	secretIDStr := chi.URLParam(r, "id")
-	if secretIDStr == "" {
-		http.Error(w, "Missing secret ID", http.StatusBadRequest)
+	secretID, ok := secretIDParam(w, r)
+	if !ok {
 		return
 	}
 
-	secretID, err := strconv.Atoi(secretIDStr)
-	if err != nil {
-		http.Error(w, "Invalid secret ID", http.StatusBadRequest)
+	if !a.checkSecretScope(w, r, userID, secretID) {
 		return
 	}
 
-	secret, err := a.store.GetSecretByID(ctx, userID, secretID)
+	err := a.store.DeleteSecret(ctx, userID, secretID)
 	if err != nil {
 		var secretNotFoundErr storage.ErrSecretNotFound
 		if errors.As(err, &secretNotFoundErr) {
-			http.Error(w, err.Error(), http.StatusNotFound)
+			apierror.Write(w, err.Error(), http.StatusNotFound)
 			return
 		}
-		http.Error(w, "Failed to retrieve secret", http.StatusInternalServerError)
+		apierror.Write(w, "Failed to delete secret", http.StatusInternalServerError)
 		return
 	}
+	a.changes.publish(userID, secretChange{Kind: changeDeleted, Secret: models.Secret{ID: secretID, UserID: userID}})
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(secret)
+	w.WriteHeader(http.StatusNoContent) // 204 No Content for successful deletion
 }
 
-func (a *API) UpdateSecret(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
+// The secret handlers of both API versions share the helpers below. On failure they write
+// the error response and return false.
 
+// createSecret stores a new secret of the user of the request.
+func (a *API) createSecret(w http.ResponseWriter, r *http.Request, secret models.Secret) (models.Secret, bool) {
 	userID, ok := auth.GetUserIDFromContext(r.Context())
 	if !ok {
-		http.Error(w, "User ID not found in context", http.StatusInternalServerError)
-		return
+		apierror.Write(w, "User ID not found in context", http.StatusInternalServerError)
+		return models.Secret{}, false
 	}
+	secret.UserID = userID // Ensure secret is for the authenticated user
+	secret.ID = 0          // IDs are assigned by the store
 
-	secretIDStr := chi.URLParam(r, "id")
-	if secretIDStr == "" {
-		http.Error(w, "Missing secret ID", http.StatusBadRequest)
-		return
+	if !scopeAllows(requestScope(r), secret) {
+		apierror.WriteCode(w, "Secret is outside the scope of the API token", http.StatusForbidden, apierror.CodeOutOfScope, nil)
+		return models.Secret{}, false
 	}
 
-	secretID, err := strconv.Atoi(secretIDStr)
+	createdSecret, err := a.store.CreateSecret(r.Context(), secret)
 	if err != nil {
-		http.Error(w, "Invalid secret ID", http.StatusBadRequest)
-		return
+		apierror.Write(w, "Failed to create secret", http.StatusInternalServerError)
+		return models.Secret{}, false
 	}
+	a.changes.publish(userID, secretChange{Kind: changeCreated, Secret: createdSecret})
 
-	var secret models.Secret
-	if err := json.NewDecoder(r.Body).Decode(&secret); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
+	return createdSecret, true
+}
+
+// listSecrets returns the secrets of the user of the request that match its query and
+// are in the scope of its API token.
+func (a *API) listSecrets(w http.ResponseWriter, r *http.Request) ([]models.Secret, bool) {
+	userID, ok := auth.GetUserIDFromContext(r.Context())
+	if !ok {
+		apierror.Write(w, "User ID not found in context", http.StatusInternalServerError)
+		return nil, false
 	}
 
-	secret.ID = secretID
-	secret.UserID = userID
+	query := models.SecretQuery{
+		Metadata: r.URL.Query().Get("metadata"),
+		Keyword:  r.URL.Query().Get("keyword"),
+	}
+
+	secrets, err := a.store.SearchSecrets(r.Context(), userID, query)
+	if err != nil {
+		if reportIntegrityError(w, userID, err) {
+			return nil, false
+		}
+		apierror.Write(w, "Failed to retrieve secrets", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if scope := requestScope(r); restrictsSecrets(scope) {
+		secrets = slices.DeleteFunc(secrets, func(secret models.Secret) bool {
+			return !scopeAllows(scope, secret)
+		})
+	}
+	return secrets, true
+}
+
+// getSecret returns the secret with the ID of the request path.
+func (a *API) getSecret(w http.ResponseWriter, r *http.Request) (models.Secret, bool) {
+	userID, ok := auth.GetUserIDFromContext(r.Context())
+	if !ok {
+		apierror.Write(w, "User ID not found in context", http.StatusInternalServerError)
+		return models.Secret{}, false
+	}
+
+	secretID, ok := secretIDParam(w, r)
+	if !ok {
+		return models.Secret{}, false
+	}
 
-	updatedSecret, err := a.store.UpdateSecret(ctx, secret)
+	secret, err := a.store.GetSecretByID(r.Context(), userID, secretID)
 	if err != nil {
 		var secretNotFoundErr storage.ErrSecretNotFound
 		if errors.As(err, &secretNotFoundErr) {
-			http.Error(w, err.Error(), http.StatusNotFound)
-			return
+			apierror.Write(w, err.Error(), http.StatusNotFound)
+			return models.Secret{}, false
 		}
-		http.Error(w, "Failed to update secret", http.StatusInternalServerError)
-		return
+		if reportIntegrityError(w, userID, err) {
+			return models.Secret{}, false
+		}
+		apierror.Write(w, "Failed to retrieve secret", http.StatusInternalServerError)
+		return models.Secret{}, false
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(updatedSecret)
+	if !scopeAllows(requestScope(r), secret) {
+		apierror.Write(w, storage.NewErrSecretNotFound(secretID).Error(), http.StatusNotFound)
+		return models.Secret{}, false
+	}
+	return secret, true
 }
 
-func (a *API) DeleteSecret(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
-
+// updateSecret replaces the secret with the ID of the request path. A revision set on
+// secret must be the current one.
+func (a *API) updateSecret(w http.ResponseWriter, r *http.Request, secret models.Secret) (models.Secret, bool) {
 	userID, ok := auth.GetUserIDFromContext(r.Context())
 	if !ok {
-		http.Error(w, "User ID not found in context", http.StatusInternalServerError)
-		return
+		apierror.Write(w, "User ID not found in context", http.StatusInternalServerError)
+		return models.Secret{}, false
 	}
 
-	secretIDStr := chi.URLParam(r, "id")
-	if secretIDStr == "" {
-		http.Error(w, "Missing secret ID", http.StatusBadRequest)
-		return
+	secretID, ok := secretIDParam(w, r)
+	if !ok {
+		return models.Secret{}, false
 	}
+	secret.ID = secretID
+	secret.UserID = userID
 
-	secretID, err := strconv.Atoi(secretIDStr)
-	if err != nil {
-		http.Error(w, "Invalid secret ID", http.StatusBadRequest)
-		return
+	if !a.checkSecretScope(w, r, userID, secretID) {
+		return models.Secret{}, false
+	}
+	if !scopeAllows(requestScope(r), secret) {
+		apierror.WriteCode(w, "Secret is outside the scope of the API token", http.StatusForbidden, apierror.CodeOutOfScope, nil)
+		return models.Secret{}, false
 	}
 
-	err = a.store.DeleteSecret(ctx, userID, secretID)
+	updatedSecret, err := a.store.UpdateSecret(r.Context(), secret)
 	if err != nil {
 		var secretNotFoundErr storage.ErrSecretNotFound
 		if errors.As(err, &secretNotFoundErr) {
-			http.Error(w, err.Error(), http.StatusNotFound)
-			return
+			apierror.Write(w, err.Error(), http.StatusNotFound)
+			return models.Secret{}, false
 		}
-		http.Error(w, "Failed to delete secret", http.StatusInternalServerError)
+		var conflictErr storage.ErrRevisionConflict
+		if errors.As(err, &conflictErr) {
+			apierror.WriteCode(w, err.Error(), http.StatusConflict, apierror.CodeRevisionConflict,
+				map[string]any{"revision": conflictErr.Revision})
+			return models.Secret{}, false
+		}
+		apierror.Write(w, "Failed to update secret", http.StatusInternalServerError)
+		return models.Secret{}, false
+	}
+	a.changes.publish(userID, secretChange{Kind: changeUpdated, Secret: updatedSecret})
+
+	return updatedSecret, true
+}
+
+// secretIDParam returns the secret ID of the request path.
+func secretIDParam(w http.ResponseWriter, r *http.Request) (int, bool) {
+	secretIDStr := chi.URLParam(r, "id")
+	if secretIDStr == "" {
+		apierror.Write(w, "Missing secret ID", http.StatusBadRequest)
+		return 0, false
+	}
+
+	secretID, err := strconv.Atoi(secretIDStr)
+	if err != nil {
+		apierror.Write(w, "Invalid secret ID", http.StatusBadRequest)
+		return 0, false
+	}
+	return secretID, true
+}
+
+// reportIntegrityError logs and responds to a secret whose ciphertext does not belong to it.
+// It returns false if err is not an integrity error.
+func reportIntegrityError(w http.ResponseWriter, userID int, err error) bool {
+	var integrityErr storage.ErrSecretIntegrity
+	if !errors.As(err, &integrityErr) {
+		return false
+	}
+
+	logIntegrityError(userID, integrityErr)
+	apierror.WriteCode(w, integrityErr.Error(), http.StatusInternalServerError, apierror.CodeSecretIntegrity, nil)
+	return true
+}
+
+func logIntegrityError(userID int, err storage.ErrSecretIntegrity) {
+	log.Printf("SECURITY: secret %d of user %d failed the integrity check; its ciphertext may have been moved or tampered with",
+		err.SecretID, userID)
+}
+
+// requestError rejects a request with an HTTP status. Helpers shared by the REST and
+// gRPC APIs return it for client errors; other errors are server errors.
+type requestError struct {
+	Status int
+	// Code is the error code of the response; the code of Status is used if it is empty
+	Code    string
+	Message string
+	// RetryAfter is sent in the Retry-After header if set
+	RetryAfter time.Duration
+}
+
+func (e *requestError) Error() string {
+	return e.Message
+}
+
+// writeRequestError responds with the status of a *requestError, or with 500 for other errors.
+func writeRequestError(w http.ResponseWriter, err error) {
+	var reqErr *requestError
+	if !errors.As(err, &reqErr) {
+		apierror.Write(w, "Server error", http.StatusInternalServerError)
 		return
 	}
 
-	w.WriteHeader(http.StatusNoContent) // 204 No Content for successful deletion
+	code := reqErr.Code
+	if code == "" {
+		code = apierror.CodeForStatus(reqErr.Status)
+	}
+	var details map[string]any
+	if reqErr.RetryAfter > 0 {
+		retryAfter := int(math.Ceil(reqErr.RetryAfter.Seconds()))
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		details = map[string]any{"retry_after": retryAfter}
+	}
+	apierror.WriteCode(w, reqErr.Message, reqErr.Status, code, details)
 }
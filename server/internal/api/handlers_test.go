@@ -119,13 +119,16 @@ func TestLogin(t *testing.T) {
 			},
 			expectedStatus: http.StatusOK,
 			checkResponse: func(t *testing.T, resp *httptest.ResponseRecorder) {
-				var result map[string]string
+				var result TokenResponse
 				if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
 					t.Fatalf("Failed to decode response: %v", err)
 				}
-				if result["token"] == "" {
+				if result.Token == "" {
 					t.Error("Expected token in response")
 				}
+				if result.RefreshToken == "" {
+					t.Error("Expected refresh token in response")
+				}
 			},
 		},
 		{
@@ -282,6 +285,50 @@ func TestGetSecrets(t *testing.T) {
 	}
 }
 
+// TestGetSecretsSearch tests filtering secrets by metadata and keyword
+func TestGetSecretsSearch(t *testing.T) {
+	store := storage.NewMemStore()
+	jwtManager := auth.NewJWTManager("test-secret")
+	api := New(store, jwtManager)
+
+	store.CreateSecret(context.Background(), models.Secret{UserID: 1, Data: []byte("data1"), Metadata: "Mail account"})
+	store.CreateSecret(context.Background(), models.Secret{UserID: 1, Data: []byte("data2"), Metadata: "Bank card"})
+
+	tests := []struct {
+		name          string
+		query         string
+		expectedCount int
+	}{
+		{name: "no filter", query: "", expectedCount: 2},
+		{name: "exact metadata", query: "?metadata=Bank+card", expectedCount: 1},
+		{name: "keyword", query: "?keyword=mail", expectedCount: 1},
+		{name: "no match", query: "?metadata=Bank", expectedCount: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/secrets"+tt.query, nil)
+			ctx := context.WithValue(req.Context(), auth.UserIDContextKey, 1)
+			req = req.WithContext(ctx)
+			resp := httptest.NewRecorder()
+
+			api.GetSecrets(resp, req)
+
+			if resp.Code != http.StatusOK {
+				t.Fatalf("Expected status %d, got %d", http.StatusOK, resp.Code)
+			}
+
+			var secrets []models.Secret
+			if err := json.NewDecoder(resp.Body).Decode(&secrets); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if len(secrets) != tt.expectedCount {
+				t.Errorf("Expected %d secrets, got %d", tt.expectedCount, len(secrets))
+			}
+		})
+	}
+}
+
 // TestGetSecretByID tests the GetSecretByID handler
 func TestGetSecretByID(t *testing.T) {
 	tests := []struct {
@@ -0,0 +1,202 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gophkeeper/server/internal/apierror"
+	"gophkeeper/server/internal/auth"
+	"gophkeeper/server/internal/models"
+	"gophkeeper/server/internal/storage"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// RegistrationMode controls who can register with /api/user/register.
+type RegistrationMode string
+
+// Registration modes
+const (
+	RegistrationOpen       RegistrationMode = "open"
+	RegistrationInviteOnly RegistrationMode = "invite-only"
+	RegistrationClosed     RegistrationMode = "closed"
+)
+
+// DefaultInviteTTL is the lifetime of invites issued without an explicit expiry.
+const DefaultInviteTTL = 7 * 24 * time.Hour
+
+// maxInviteTTL is the longest lifetime of an invite. It also keeps expires_in from
+// overflowing when it is converted to a duration.
+const maxInviteTTL = 365 * 24 * time.Hour
+
+// InviteIssuerRole is the role of users who may issue and revoke invites.
+const InviteIssuerRole = "admin"
+
+// CreateInviteRequest is the body of POST /api/invites.
+type CreateInviteRequest struct {
+	// ExpiresIn is the lifetime of the invite in seconds; zero uses the default of the server
+	ExpiresIn int64 `json:"expires_in"`
+}
+
+// CreateInviteResponse returns a new invite. The code itself is shown only once.
+type CreateInviteResponse struct {
+	Code string `json:"code"`
+	models.Invite
+}
+
+// SetRegistrationMode sets who can register and the default lifetime of invites.
+func (a *API) SetRegistrationMode(mode RegistrationMode, inviteTTL time.Duration) {
+	a.registrationMode = mode
+	a.inviteTTL = inviteTTL
+}
+
+// checkRegistration enforces the registration mode for a new user before the request is
+// processed further. The invite itself is checked by registerUser.
+// It writes the error response and returns false if the registration is not allowed.
+func (a *API) checkRegistration(w http.ResponseWriter, invite string) bool {
+	if err := a.allowRegistration(invite); err != nil {
+		writeRequestError(w, err)
+		return false
+	}
+	return true
+}
+
+// allowRegistration is checkRegistration without the response: a registration that is
+// not allowed returns a *requestError.
+func (a *API) allowRegistration(invite string) error {
+	switch a.registrationMode {
+	case RegistrationClosed:
+		return &requestError{Status: http.StatusForbidden, Code: apierror.CodeRegistrationClosed, Message: "Registration is closed"}
+	case RegistrationInviteOnly:
+		if invite == "" {
+			return &requestError{Status: http.StatusForbidden, Code: apierror.CodeInviteRequired, Message: "An invite code is required to register"}
+		}
+	}
+	return nil
+}
+
+// registerUser creates a user allowed by allowRegistration. In invite-only mode the invite
+// is used up together with the creation of the user, so a registration that fails, e.g.
+// because the login is taken, leaves it unused. Invalid invites and taken logins return
+// a *requestError.
+func (a *API) registerUser(ctx context.Context, user models.User, invite string) (models.User, error) {
+	var err error
+	if a.registrationMode == RegistrationInviteOnly {
+		user, err = a.store.CreateUserWithInvite(ctx, user, auth.HashInviteCode(invite), time.Now())
+	} else {
+		user, err = a.store.CreateUser(ctx, user)
+	}
+
+	var userExistsErr storage.ErrUserExists
+	var invalidInviteErr storage.ErrInvalidInvite
+	switch {
+	case errors.As(err, &userExistsErr):
+		return models.User{}, &requestError{Status: http.StatusConflict, Code: apierror.CodeUserExists, Message: err.Error()}
+	case errors.As(err, &invalidInviteErr):
+		return models.User{}, &requestError{Status: http.StatusForbidden, Code: apierror.CodeInvalidInvite, Message: "Invalid, used or expired invite code"}
+	case err != nil:
+		return models.User{}, err
+	}
+	return user, nil
+}
+
+// writeRegistrationError responds with the error of registerUser.
+func writeRegistrationError(w http.ResponseWriter, err error) {
+	var reqErr *requestError
+	if !errors.As(err, &reqErr) {
+		apierror.Write(w, "Failed to create user", http.StatusInternalServerError)
+		return
+	}
+	writeRequestError(w, err)
+}
+
+// RequireInviteIssuer rejects requests of users without InviteIssuerRole.
+func (a *API) RequireInviteIssuer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.GetUserIDFromContext(r.Context())
+		if !ok {
+			apierror.Write(w, "User ID not found in context", http.StatusInternalServerError)
+			return
+		}
+		user, err := a.store.GetUserByID(r.Context(), userID)
+		if err != nil {
+			apierror.Write(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		if !slices.Contains(user.Roles, InviteIssuerRole) {
+			apierror.Write(w, "Only administrators can manage invites", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// CreateInvite issues a single-use invite code.
+func (a *API) CreateInvite(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		apierror.Write(w, "User ID not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	var req CreateInviteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.ExpiresIn < 0 || req.ExpiresIn > int64(maxInviteTTL/time.Second) {
+		apierror.Write(w, fmt.Sprintf("expires_in must be between 0 and %d", int64(maxInviteTTL/time.Second)), http.StatusBadRequest)
+		return
+	}
+	ttl := a.inviteTTL
+	if req.ExpiresIn > 0 {
+		ttl = time.Duration(req.ExpiresIn) * time.Second
+	}
+
+	code, invite, err := auth.NewInvite(&userID, ttl)
+	if err != nil {
+		apierror.Write(w, "Failed to generate invite", http.StatusInternalServerError)
+		return
+	}
+	if err := a.store.CreateInvite(ctx, invite); err != nil {
+		apierror.Write(w, "Failed to create invite", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(CreateInviteResponse{Code: code, Invite: invite})
+}
+
+// GetInvites returns all invites.
+func (a *API) GetInvites(w http.ResponseWriter, r *http.Request) {
+	invites, err := a.store.GetInvites(r.Context())
+	if err != nil {
+		apierror.Write(w, "Failed to get invites", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(invites)
+}
+
+// DeleteInvite revokes an invite.
+func (a *API) DeleteInvite(w http.ResponseWriter, r *http.Request) {
+	if err := a.store.DeleteInvite(r.Context(), chi.URLParam(r, "id")); err != nil {
+		var notFoundErr storage.ErrInviteNotFound
+		if errors.As(err, &notFoundErr) {
+			apierror.Write(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		apierror.Write(w, "Failed to revoke invite", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
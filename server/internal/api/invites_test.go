@@ -0,0 +1,179 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"gophkeeper/server/internal/auth"
+	"gophkeeper/server/internal/models"
+	"gophkeeper/server/internal/storage"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestRegistrationModes tests open, invite-only and closed registration and invite management
+func TestRegistrationModes(t *testing.T) {
+	store := storage.NewMemStore()
+	jwtManager := auth.NewJWTManager("test-secret")
+	api := New(store, jwtManager)
+	router := NewRouter(api, jwtManager)
+
+	do := func(method, path, token string, body any) *httptest.ResponseRecorder {
+		payload, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, path, bytes.NewReader(payload))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+	register := func(login, invite string) int {
+		return do(http.MethodPost, "/api/user/register", "", RegisterRequest{Login: login, Password: "correct horse battery", Invite: invite}).Code
+	}
+
+	// Open registration ignores fields other than the credentials
+	resp := do(http.MethodPost, "/api/user/register", "", map[string]any{"login": "admin", "password": "correct horse battery", "roles": []string{"admin"}})
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d", http.StatusCreated, resp.Code)
+	}
+	admin, _ := store.GetUserByLogin(context.Background(), "admin")
+	if len(admin.Roles) != 0 {
+		t.Errorf("Expected no roles from the registration request, got %v", admin.Roles)
+	}
+	user, _ := store.CreateUser(context.Background(), models.User{Login: "bob", Password: "x"})
+	store.SetUserRoles(context.Background(), admin.ID, []string{InviteIssuerRole})
+	adminToken, _ := jwtManager.GenerateJWT(admin.ID)
+	userToken, _ := jwtManager.GenerateJWT(user.ID)
+
+	api.SetRegistrationMode(RegistrationClosed, DefaultInviteTTL)
+	if code := register("carol", ""); code != http.StatusForbidden {
+		t.Errorf("Expected status %d while registration is closed, got %d", http.StatusForbidden, code)
+	}
+
+	api.SetRegistrationMode(RegistrationInviteOnly, DefaultInviteTTL)
+	if code := register("carol", ""); code != http.StatusForbidden {
+		t.Errorf("Expected status %d without an invite, got %d", http.StatusForbidden, code)
+	}
+	if resp := do(http.MethodPost, "/api/invites", userToken, CreateInviteRequest{}); resp.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d for an invite from a regular user, got %d", http.StatusForbidden, resp.Code)
+	}
+
+	if resp := do(http.MethodPost, "/api/invites", adminToken, CreateInviteRequest{ExpiresIn: math.MaxInt64}); resp.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for a too long lifetime, got %d", http.StatusBadRequest, resp.Code)
+	}
+	resp = do(http.MethodPost, "/api/invites", adminToken, CreateInviteRequest{ExpiresIn: 3600})
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d for an invite, got %d: %s", http.StatusCreated, resp.Code, resp.Body)
+	}
+	var invite CreateInviteResponse
+	json.NewDecoder(resp.Body).Decode(&invite)
+	if invite.Code == "" || invite.CreatedBy == nil || *invite.CreatedBy != admin.ID || time.Until(invite.ExpiresAt) > time.Hour {
+		t.Errorf("Expected an invite by the admin for an hour, got %+v", invite)
+	}
+
+	// A taken login does not spend the invite
+	if code := register("bob", invite.Code); code != http.StatusConflict {
+		t.Errorf("Expected status %d for a taken login, got %d", http.StatusConflict, code)
+	}
+	if code := register("carol", invite.Code); code != http.StatusCreated {
+		t.Errorf("Expected status %d with an invite, got %d", http.StatusCreated, code)
+	}
+	if code := register("dave", invite.Code); code != http.StatusForbidden {
+		t.Errorf("Expected status %d for a used invite, got %d", http.StatusForbidden, code)
+	}
+
+	// Expired invites are rejected
+	code, expired, _ := auth.NewInvite(nil, -time.Minute)
+	store.CreateInvite(context.Background(), expired)
+	if status := register("dave", code); status != http.StatusForbidden {
+		t.Errorf("Expected status %d for an expired invite, got %d", http.StatusForbidden, status)
+	}
+
+	// SRP registration needs an invite too
+	code, operatorInvite, _ := auth.NewInvite(nil, time.Hour)
+	store.CreateInvite(context.Background(), operatorInvite)
+	verifier, _ := newTestSRPVerifier("dave", "dave-password", auth.MinSRPParams)
+	srpRegister := SRPRegisterRequest{Login: "dave", Salt: verifier.Salt, Verifier: verifier.Verifier, Params: verifier.Params}
+	if resp := do(http.MethodPost, "/api/user/srp/register", "", srpRegister); resp.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d for SRP registration without an invite, got %d", http.StatusForbidden, resp.Code)
+	}
+	srpRegister.Invite = code
+	if resp := do(http.MethodPost, "/api/user/srp/register", "", srpRegister); resp.Code != http.StatusCreated {
+		t.Errorf("Expected status %d for SRP registration with an invite, got %d", http.StatusCreated, resp.Code)
+	}
+
+	// Listing shows usage but never the codes
+	resp = do(http.MethodGet, "/api/invites", adminToken, nil)
+	if bytes.Contains(resp.Body.Bytes(), []byte(invite.Code)) {
+		t.Error("Expected invite list not to contain codes")
+	}
+	var invites []models.Invite
+	json.NewDecoder(resp.Body).Decode(&invites)
+	if len(invites) != 3 || invites[2].UsedBy != "carol" || invites[0].UsedBy != "dave" || invites[1].UsedAt != nil {
+		t.Errorf("Expected 3 invites used by carol and dave, got %+v", invites)
+	}
+
+	if resp := do(http.MethodDelete, "/api/invites/"+expired.ID, adminToken, nil); resp.Code != http.StatusNoContent {
+		t.Errorf("Expected status %d when revoking an invite, got %d", http.StatusNoContent, resp.Code)
+	}
+	if resp := do(http.MethodDelete, "/api/invites/"+expired.ID, adminToken, nil); resp.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for a revoked invite, got %d", http.StatusNotFound, resp.Code)
+	}
+}
+
+// TestInviteConcurrentRegistration tests that concurrent registrations of a login use up
+// only the invite of the registration that succeeds
+func TestInviteConcurrentRegistration(t *testing.T) {
+	store := storage.NewMemStore()
+	jwtManager := auth.NewJWTManager("test-secret")
+	api := New(store, jwtManager)
+	api.SetRegistrationMode(RegistrationInviteOnly, time.Hour)
+	router := NewRouter(api, jwtManager)
+
+	register := func(login, invite string) int {
+		payload, _ := json.Marshal(RegisterRequest{Login: login, Password: "correct horse battery", Invite: invite})
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/api/user/register", bytes.NewReader(payload)))
+		return resp.Code
+	}
+
+	codes := make([]string, 2)
+	for i := range codes {
+		code, invite, _ := auth.NewInvite(nil, time.Hour)
+		store.CreateInvite(context.Background(), invite)
+		codes[i] = code
+	}
+
+	statuses := make([]int, len(codes))
+	var wg sync.WaitGroup
+	for i, code := range codes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			statuses[i] = register("erin", code)
+		}()
+	}
+	wg.Wait()
+	slices.Sort(statuses)
+	if statuses[0] != http.StatusCreated || statuses[1] != http.StatusConflict {
+		t.Fatalf("Expected one registration and one conflict, got %v", statuses)
+	}
+
+	// Exactly one invite is left for another login
+	registered := 0
+	for i, code := range codes {
+		if register(fmt.Sprintf("frank%d", i), code) == http.StatusCreated {
+			registered++
+		}
+	}
+	if registered != 1 {
+		t.Errorf("Expected the invite of the conflict to stay unused, %d invites were left", registered)
+	}
+}
@@ -0,0 +1,17 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// jwksMaxAge is how long clients may cache the key set. Keys are rotated by adding
+// the new key as a verification key first, so caches learn it before it signs tokens.
+const jwksMaxAge = "300"
+
+// JWKS serves the public keys that verify GophKeeper tokens.
+func (a *API) JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age="+jwksMaxAge)
+	json.NewEncoder(w).Encode(a.jwtManager.JWKS())
+}
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"gophkeeper/server/internal/auth"
+	"gophkeeper/server/internal/storage"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestJWKS tests asymmetric token signing, key rotation and the JWKS endpoint
+func TestJWKS(t *testing.T) {
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	parse := func(key any) *auth.SigningKey {
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			t.Fatalf("Failed to marshal key: %v", err)
+		}
+		signingKey, err := auth.ParseSigningKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+		if err != nil {
+			t.Fatalf("Failed to parse key: %v", err)
+		}
+		return signingKey
+	}
+	edKey, err := auth.GenerateSigningKey()
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	keys := map[string]*auth.SigningKey{"EdDSA": edKey, "ES256": parse(ecKey), "RS256": parse(rsaKey)}
+	for alg, key := range keys {
+		if key.Algorithm() != alg {
+			t.Errorf("Expected algorithm %s, got %s", alg, key.Algorithm())
+		}
+		manager, err := auth.NewJWTManagerWithKeys(key)
+		if err != nil {
+			t.Fatalf("Failed to create %s manager: %v", alg, err)
+		}
+		token, _ := manager.GenerateJWT(42)
+		if userID, err := manager.ValidateJWT(token); err != nil || userID != 42 {
+			t.Errorf("Expected %s token of user 42 to validate, got %d, %v", alg, userID, err)
+		}
+	}
+
+	// A public key alone cannot sign
+	publicDER, _ := x509.MarshalPKIXPublicKey(&ecKey.PublicKey)
+	publicKey, err := auth.ParseVerificationKey(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}))
+	if err != nil {
+		t.Fatalf("Failed to parse public key: %v", err)
+	}
+	if publicKey.ID != keys["ES256"].ID {
+		t.Errorf("Expected public key ID %s, got %s", keys["ES256"].ID, publicKey.ID)
+	}
+	if _, err := auth.NewJWTManagerWithKeys(publicKey); err == nil {
+		t.Error("Expected an error for a signing key without the private key")
+	}
+
+	// Rotation: the old key keeps validating tokens it signed
+	oldManager, _ := auth.NewJWTManagerWithKeys(keys["ES256"])
+	oldToken, _ := oldManager.GenerateJWT(1)
+
+	manager, _ := auth.NewJWTManagerWithKeys(edKey, publicKey)
+	if _, err := manager.ValidateJWT(oldToken); err != nil {
+		t.Errorf("Expected token of a verification key to validate, got %v", err)
+	}
+
+	unknownManager, _ := auth.NewJWTManagerWithKeys(keys["RS256"])
+	unknownToken, _ := unknownManager.GenerateJWT(1)
+	if _, err := manager.ValidateJWT(unknownToken); err == nil {
+		t.Error("Expected token of an unknown key to be rejected")
+	}
+
+	secretToken, _ := auth.NewJWTManager("test-secret").GenerateJWT(1)
+	if _, err := manager.ValidateJWT(secretToken); err == nil {
+		t.Error("Expected HS256 token to be rejected with asymmetric keys")
+	}
+
+	// Issuer and audience
+	manager.SetIssuer("gophkeeper")
+	manager.SetAudience("gophkeeper")
+	token, _ := manager.GenerateJWT(1)
+	if _, err := manager.ValidateJWT(token); err != nil {
+		t.Errorf("Expected token with issuer and audience to validate, got %v", err)
+	}
+	if _, err := manager.ValidateJWT(oldToken); err == nil {
+		t.Error("Expected token without issuer and audience to be rejected")
+	}
+	manager.SetAudience("other")
+	if _, err := manager.ValidateJWT(token); err == nil {
+		t.Error("Expected token for another audience to be rejected")
+	}
+	manager.SetAudience("gophkeeper")
+
+	// JWKS endpoint
+	router := NewRouter(New(storage.NewMemStore(), manager), manager)
+	req := httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, resp.Code)
+	}
+	if resp.Header().Get("Cache-Control") == "" {
+		t.Error("Expected Cache-Control header")
+	}
+
+	var set auth.JSONWebKeySet
+	json.NewDecoder(resp.Body).Decode(&set)
+	if len(set.Keys) != 2 {
+		t.Fatalf("Expected 2 keys, got %d", len(set.Keys))
+	}
+	if set.Keys[0].Kid != edKey.ID || set.Keys[0].Alg != "EdDSA" || set.Keys[0].Crv != "Ed25519" {
+		t.Errorf("Expected signing key first, got %+v", set.Keys[0])
+	}
+	if set.Keys[1].Kid != publicKey.ID || set.Keys[1].Alg != "ES256" || set.Keys[1].Y == "" {
+		t.Errorf("Expected verification key second, got %+v", set.Keys[1])
+	}
+
+	// With a shared secret there are no public keys
+	secretManager := auth.NewJWTManager("test-secret")
+	router = NewRouter(New(storage.NewMemStore(), secretManager), secretManager)
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+	set = auth.JSONWebKeySet{}
+	json.NewDecoder(resp.Body).Decode(&set)
+	if resp.Code != http.StatusOK || len(set.Keys) != 0 {
+		t.Errorf("Expected empty key set, got status %d with %d keys", resp.Code, len(set.Keys))
+	}
+}
@@ -0,0 +1,311 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"gophkeeper/server/internal/auth"
+	"gophkeeper/server/internal/models"
+	"gophkeeper/server/internal/storage"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+const (
+	testLDAPBindDN       = "cn=reader,dc=example,dc=com"
+	testLDAPBindPassword = "reader-secret"
+	testLDAPStartTLSOID  = "1.3.6.1.4.1.1466.20037"
+)
+
+// testLDAPEntry is a user of the LDAP stand-in.
+type testLDAPEntry struct {
+	uid      string
+	password string
+	groups   []string
+}
+
+func (e testLDAPEntry) dn() string {
+	return fmt.Sprintf("uid=%s,ou=people,dc=example,dc=com", e.uid)
+}
+
+// newTestLDAP starts an LDAP stand-in that supports StartTLS, simple binds and searches
+// by uid. Credentials are only accepted over TLS. It returns the URL and CA pool.
+func newTestLDAP(t *testing.T, entries ...testLDAPEntry) (string, *x509.CertPool) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, _ := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	cert, _ := x509.ParseCertificate(der)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveTestLDAP(conn, tlsConfig, entries)
+		}
+	}()
+	return "ldap://" + listener.Addr().String(), pool
+}
+
+func serveTestLDAP(conn net.Conn, tlsConfig *tls.Config, entries []testLDAPEntry) {
+	defer func() { conn.Close() }()
+
+	encrypted, bound := false, ""
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		messageID := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+
+		reply := func(ops ...*ber.Packet) {
+			for _, op := range ops {
+				message := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+				message.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, ""))
+				message.AppendChild(op)
+				conn.Write(message.Bytes())
+			}
+		}
+
+		switch op.Tag {
+		case ldap.ApplicationUnbindRequest:
+			return
+		case ldap.ApplicationExtendedRequest:
+			if op.Children[0].Data.String() != testLDAPStartTLSOID || encrypted {
+				reply(testLDAPResult(ldap.ApplicationExtendedResponse, ldap.LDAPResultProtocolError))
+				continue
+			}
+			reply(testLDAPResult(ldap.ApplicationExtendedResponse, ldap.LDAPResultSuccess))
+			tlsConn := tls.Server(conn, tlsConfig)
+			if tlsConn.Handshake() != nil {
+				return
+			}
+			conn, encrypted = tlsConn, true
+		case ldap.ApplicationBindRequest:
+			name, password := op.Children[1].Value.(string), op.Children[2].Data.String()
+			code := ldap.LDAPResultInvalidCredentials
+			switch {
+			case !encrypted:
+				code = ldap.LDAPResultConfidentialityRequired
+			case name == testLDAPBindDN && password == testLDAPBindPassword:
+				code = ldap.LDAPResultSuccess
+			default:
+				for _, entry := range entries {
+					if name == entry.dn() && password == entry.password {
+						code = ldap.LDAPResultSuccess
+					}
+				}
+			}
+			if code == ldap.LDAPResultSuccess {
+				bound = name
+			}
+			reply(testLDAPResult(ldap.ApplicationBindResponse, code))
+		case ldap.ApplicationSearchRequest:
+			if bound != testLDAPBindDN {
+				reply(testLDAPResult(ldap.ApplicationSearchResultDone, ldap.LDAPResultInsufficientAccessRights))
+				continue
+			}
+			filter, _ := ldap.DecompileFilter(op.Children[6])
+			var results []*ber.Packet
+			for _, entry := range entries {
+				if !strings.EqualFold(filter, "(uid="+ldap.EscapeFilter(entry.uid)+")") {
+					continue
+				}
+				result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "")
+				result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.dn(), ""))
+				attributes := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+				attribute := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+				attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "memberOf", ""))
+				values := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "")
+				for _, group := range entry.groups {
+					values.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, group, ""))
+				}
+				attribute.AppendChild(values)
+				attributes.AppendChild(attribute)
+				result.AppendChild(attributes)
+				results = append(results, result)
+			}
+			reply(append(results, testLDAPResult(ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess))...)
+		default:
+			return
+		}
+	}
+}
+
+func testLDAPResult(application ber.Tag, code int) *ber.Packet {
+	result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, application, nil, "")
+	result.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, ""))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	return result
+}
+
+// TestLDAPLogin tests login with directory credentials next to local passwords
+func TestLDAPLogin(t *testing.T) {
+	ldapURL, caPool := newTestLDAP(t,
+		testLDAPEntry{uid: "alice", password: "alice-dir-pass", groups: []string{
+			"CN=Vault-Users,OU=Groups,DC=example,DC=com",
+			"cn=vault-admins,ou=groups,dc=example,dc=com",
+			"cn=printers,ou=groups,dc=example,dc=com",
+		}},
+		testLDAPEntry{uid: "dave", password: "dave-dir-pass", groups: []string{"cn=printers,ou=groups,dc=example,dc=com"}},
+		testLDAPEntry{uid: "bob", password: "bob-dir-pass", groups: []string{"cn=vault-users,ou=groups,dc=example,dc=com"}},
+	)
+	newLDAP := func(url string) *auth.LDAPAuthenticator {
+		authenticator, err := auth.NewLDAPAuthenticator(auth.LDAPConfig{
+			URL:          url,
+			StartTLS:     true,
+			TLSConfig:    &tls.Config{RootCAs: caPool},
+			BindDN:       testLDAPBindDN,
+			BindPassword: testLDAPBindPassword,
+			BaseDN:       "dc=example,dc=com",
+			UserFilter:   "(uid=%s)",
+			GroupRoles: map[string]string{
+				"cn=vault-users,ou=groups,dc=example,dc=com":  "user",
+				"cn=vault-admins,ou=groups,dc=example,dc=com": "admin",
+			},
+		})
+		if err != nil {
+			t.Fatalf("Failed to create LDAP authenticator: %v", err)
+		}
+		return authenticator
+	}
+
+	newRouter := func(store storage.Store, authenticator auth.Authenticator, autoProvision bool) http.Handler {
+		jwtManager := auth.NewJWTManager("test-secret")
+		api := New(store, jwtManager)
+		api.AddAuthenticator(authenticator, autoProvision)
+		return NewRouter(api, jwtManager)
+	}
+	do := func(router http.Handler, path, token string, body any) *httptest.ResponseRecorder {
+		payload, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(payload))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+	login := func(router http.Handler, login, password string) int {
+		return do(router, "/api/user/login", "", models.User{Login: login, Password: password}).Code
+	}
+
+	store := storage.NewMemStore()
+	localHash, _ := auth.HashPassword("carol-local-pass")
+	store.CreateUser(context.Background(), models.User{Login: "carol", Password: localHash})
+	bobHash, _ := auth.HashPassword("bob-local-pass")
+	bob, _ := store.CreateUser(context.Background(), models.User{Login: "bob", Password: bobHash})
+	router := newRouter(store, newLDAP(ldapURL), true)
+
+	tests := []struct {
+		name     string
+		login    string
+		password string
+		want     int
+	}{
+		{"Local user", "carol", "carol-local-pass", http.StatusOK},
+		{"Directory user", "alice", "alice-dir-pass", http.StatusOK},
+		{"Directory login in another case", "Alice", "alice-dir-pass", http.StatusOK},
+		{"Wrong directory password", "alice", "wrong", http.StatusUnauthorized},
+		{"Empty password", "alice", "", http.StatusUnauthorized},
+		{"No mapped group", "dave", "dave-dir-pass", http.StatusUnauthorized},
+		{"Filter injection", "*", "alice-dir-pass", http.StatusUnauthorized},
+		{"Unknown user", "eve", "x", http.StatusUnauthorized},
+		{"Directory user with the login of an unlinked local user", "bob", "bob-dir-pass", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := login(router, tt.login, tt.password); code != tt.want {
+				t.Errorf("Expected status %d, got %d", tt.want, code)
+			}
+		})
+	}
+
+	alice, err := store.GetUserByLogin(context.Background(), "alice")
+	if err != nil {
+		t.Fatalf("Expected provisioned user alice, got %v", err)
+	}
+	if !slices.Equal(alice.Roles, []string{"admin", "user"}) {
+		t.Errorf("Expected roles [admin user], got %v", alice.Roles)
+	}
+	if _, err := store.GetUserByLogin(context.Background(), "Alice"); err == nil {
+		t.Error("Expected a single user for logins differing in case")
+	}
+
+	// The local user links the directory account with its password
+	var tokens TokenResponse
+	json.NewDecoder(do(router, "/api/user/login", "", models.User{Login: "bob", Password: "bob-local-pass"}).Body).Decode(&tokens)
+	if resp := do(router, "/api/user/ldap/link", "", LDAPLinkRequest{Login: "bob", Password: "bob-dir-pass"}); resp.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for an unauthenticated link, got %d", http.StatusUnauthorized, resp.Code)
+	}
+	if resp := do(router, "/api/user/ldap/link", tokens.Token, LDAPLinkRequest{Login: "bob", Password: "wrong"}); resp.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for a wrong directory password, got %d", http.StatusUnauthorized, resp.Code)
+	}
+	if resp := do(router, "/api/user/ldap/link", tokens.Token, LDAPLinkRequest{Login: "bob", Password: "bob-dir-pass"}); resp.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d for the link, got %d: %s", http.StatusNoContent, resp.Code, resp.Body)
+	}
+	if code := login(router, "bob", "bob-dir-pass"); code != http.StatusOK {
+		t.Errorf("Expected status %d for the linked directory account, got %d", http.StatusOK, code)
+	}
+	if linked, _ := store.GetUserByID(context.Background(), bob.ID); !slices.Equal(linked.Roles, []string{"user"}) {
+		t.Errorf("Expected the roles of the directory account, got %v", linked.Roles)
+	}
+	json.NewDecoder(do(router, "/api/user/login", "", models.User{Login: "carol", Password: "carol-local-pass"}).Body).Decode(&tokens)
+	if resp := do(router, "/api/user/ldap/link", tokens.Token, LDAPLinkRequest{Login: "bob", Password: "bob-dir-pass"}); resp.Code != http.StatusConflict {
+		t.Errorf("Expected status %d for an account linked to another user, got %d", http.StatusConflict, resp.Code)
+	}
+
+	// Without provisioning, directory users need a linked user, not only the same login
+	unlinked := storage.NewMemStore()
+	unlinked.CreateUser(context.Background(), models.User{Login: "alice", Password: localHash})
+	if code := login(newRouter(unlinked, newLDAP(ldapURL), false), "alice", "alice-dir-pass"); code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d without provisioning, got %d", http.StatusUnauthorized, code)
+	}
+
+	// Local users can log in while the directory is down
+	closed, _ := net.Listen("tcp", "127.0.0.1:0")
+	closed.Close()
+	downRouter := newRouter(store, newLDAP("ldap://"+closed.Addr().String()), true)
+	if code := login(downRouter, "carol", "carol-local-pass"); code != http.StatusOK {
+		t.Errorf("Expected status %d for a local user, got %d", http.StatusOK, code)
+	}
+	if code := login(downRouter, "alice", "alice-dir-pass"); code != http.StatusInternalServerError {
+		t.Errorf("Expected status %d while the directory is down, got %d", http.StatusInternalServerError, code)
+	}
+}
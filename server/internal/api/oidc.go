@@ -0,0 +1,397 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"gophkeeper/server/internal/apierror"
+	"gophkeeper/server/internal/auth"
+	"gophkeeper/server/internal/models"
+	"gophkeeper/server/internal/storage"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// oidcLoginTTL is the time a user has to complete a sign-in in the browser.
+const oidcLoginTTL = 10 * time.Minute
+
+// OIDCCodeRequest is the body of POST /api/user/oidc/token.
+type OIDCCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// OIDCDeviceTokenRequest is the body of POST /api/user/oidc/device/token.
+type OIDCDeviceTokenRequest struct {
+	DeviceCode string `json:"device_code"`
+}
+
+// OIDCLinkRequest is the body of POST /api/user/oidc/link.
+type OIDCLinkRequest struct {
+	LinkCode string `json:"link_code"`
+}
+
+// errOIDCUserUnknown is returned for identity provider accounts without a local user
+// when users are not provisioned automatically.
+var errOIDCUserUnknown = errors.New("no user for this identity provider account")
+
+// oidcLinkRequiredError is returned for identity provider accounts whose login belongs
+// to an existing user. The account is only linked to that user when the user presents
+// the link code to POST /api/user/oidc/link after a login with the password.
+type oidcLinkRequiredError struct {
+	linkCode string
+}
+
+func (e *oidcLinkRequiredError) Error() string {
+	return "identity provider account must be linked to the existing user"
+}
+
+// pendingOIDCLogin is a browser sign-in waiting for the callback of the identity provider.
+type pendingOIDCLogin struct {
+	codeVerifier string
+	nonce        string
+	// clientRedirect is the loopback address of a CLI waiting for a login code
+	clientRedirect string
+}
+
+// SetOIDC enables single sign-on with an OpenID Connect identity provider. With autoProvision,
+// a local user is created on the first sign-in of an account that matches no user.
+func (a *API) SetOIDC(provider *auth.OIDCProvider, autoProvision bool) {
+	a.oidc = provider
+	a.oidcProvision = autoProvision
+	a.oidcLogins = newPendingLogins[pendingOIDCLogin](oidcLoginTTL)
+	a.oidcLinks = newPendingLogins[auth.OIDCIdentity](oidcLoginTTL)
+}
+
+// OIDCLogin redirects the browser to the identity provider. A CLI passes the loopback
+// address it listens on as redirect_uri to receive a login code after the sign-in.
+func (a *API) OIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if !a.oidc.SupportsAuthCode() {
+		apierror.Write(w, "Browser sign-in is not configured", http.StatusNotFound)
+		return
+	}
+
+	clientRedirect := r.URL.Query().Get("redirect_uri")
+	if clientRedirect != "" && !isLoopbackURL(clientRedirect) {
+		apierror.Write(w, "redirect_uri must be a loopback http URL", http.StatusBadRequest)
+		return
+	}
+
+	state, err := auth.NewOIDCState()
+	if err != nil {
+		apierror.Write(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	nonce, err := auth.NewOIDCState()
+	if err != nil {
+		apierror.Write(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	verifier, challenge, err := auth.NewPKCE()
+	if err != nil {
+		apierror.Write(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	a.oidcLogins.add(state, pendingOIDCLogin{
+		codeVerifier:   verifier,
+		nonce:          nonce,
+		clientRedirect: clientRedirect,
+	})
+	http.Redirect(w, r, a.oidc.AuthCodeURL(state, nonce, challenge), http.StatusFound)
+}
+
+// OIDCCallback completes a browser sign-in. It returns tokens or an MFA challenge, or
+// redirects to the CLI that started the sign-in with a login code for
+// POST /api/user/oidc/token, or with a link code if the account must be linked first.
+func (a *API) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	login, ok := a.oidcLogins.take(query.Get("state"))
+	if !ok {
+		apierror.Write(w, "Unknown or expired sign-in", http.StatusBadRequest)
+		return
+	}
+	if providerErr := query.Get("error"); providerErr != "" {
+		apierror.Write(w, "Sign-in failed: "+providerErr, http.StatusUnauthorized)
+		return
+	}
+
+	identity, err := a.oidc.Exchange(ctx, query.Get("code"), login.codeVerifier, login.nonce)
+	if err != nil {
+		log.Printf("OIDC sign-in failed: %v", err)
+		apierror.Write(w, "Sign-in failed", http.StatusUnauthorized)
+		return
+	}
+	user, err := a.resolveOIDCUser(ctx, identity)
+	var linkErr *oidcLinkRequiredError
+	if errors.As(err, &linkErr) && login.clientRedirect != "" {
+		redirectToClient(w, r, login.clientRedirect, "link_code", linkErr.linkCode)
+		return
+	}
+	if err != nil {
+		writeOIDCError(w, err)
+		return
+	}
+
+	if login.clientRedirect != "" {
+		code, err := a.jwtManager.GenerateLoginCode(user.ID)
+		if err != nil {
+			apierror.Write(w, "Failed to generate token", http.StatusInternalServerError)
+			return
+		}
+		redirectToClient(w, r, login.clientRedirect, "code", code)
+		return
+	}
+
+	a.completeLogin(w, r, user)
+}
+
+// redirectToClient redirects the browser to the loopback address of a CLI with a query
+// parameter for it.
+func redirectToClient(w http.ResponseWriter, r *http.Request, clientRedirect, name, value string) {
+	target, _ := url.Parse(clientRedirect)
+	params := target.Query()
+	params.Set(name, value)
+	target.RawQuery = params.Encode()
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+// OIDCToken exchanges a login code from OIDCCallback for tokens, or for an MFA challenge
+// if the user has two-factor authentication enabled.
+func (a *API) OIDCToken(w http.ResponseWriter, r *http.Request) {
+	var req OIDCCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		apierror.Write(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	claims, err := a.jwtManager.UseLoginCode(r.Context(), req.Code)
+	if err != nil {
+		apierror.Write(w, "Invalid or expired login code", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := a.store.GetUserByID(r.Context(), claims.UserID)
+	if err != nil {
+		apierror.Write(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	a.completeLogin(w, r, user)
+}
+
+// OIDCDevice starts a device sign-in: the user enters the returned code at the
+// verification URI on any device while the client polls POST /api/user/oidc/device/token.
+func (a *API) OIDCDevice(w http.ResponseWriter, r *http.Request) {
+	if !a.oidc.SupportsDeviceFlow() {
+		apierror.Write(w, "Device sign-in is not supported by the identity provider", http.StatusNotFound)
+		return
+	}
+
+	authorization, err := a.oidc.StartDeviceAuthorization(r.Context())
+	if err != nil {
+		log.Printf("OIDC device authorization failed: %v", err)
+		apierror.Write(w, "Identity provider unavailable", http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(authorization)
+}
+
+// OIDCDeviceToken returns tokens, or an MFA challenge, once the user has completed a device
+// sign-in. Until then it responds with 400 and the error authorization_pending or
+// slow_down, as in RFC 8628.
+func (a *API) OIDCDeviceToken(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req OIDCDeviceTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.DeviceCode == "" {
+		apierror.Write(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	identity, err := a.oidc.PollDeviceToken(ctx, req.DeviceCode)
+	if err != nil {
+		var oidcErr *auth.OIDCError
+		if !errors.As(err, &oidcErr) {
+			log.Printf("OIDC device sign-in failed: %v", err)
+			oidcErr = &auth.OIDCError{Code: "access_denied"}
+		}
+		status := http.StatusUnauthorized
+		if oidcErr.Code == auth.OIDCAuthorizationPending || oidcErr.Code == auth.OIDCSlowDown {
+			status = http.StatusBadRequest
+		}
+		// The OAuth error code is the code of the response
+		apierror.WriteCode(w, oidcErr.Error(), status, oidcErr.Code, nil)
+		return
+	}
+
+	user, err := a.resolveOIDCUser(ctx, identity)
+	if err != nil {
+		writeOIDCError(w, err)
+		return
+	}
+	a.completeLogin(w, r, user)
+}
+
+// OIDCLink links the identity provider account of a link code to the authenticated user.
+// The login must be recent, so that a stolen access token cannot add a way to sign in.
+func (a *API) OIDCLink(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	claims, ok := auth.GetClaimsFromContext(ctx)
+	if !ok {
+		apierror.Write(w, "User ID not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	var req OIDCLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.LinkCode == "" {
+		apierror.Write(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	recent, err := a.isRecentLogin(ctx, claims)
+	if err != nil {
+		apierror.Write(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	if !recent {
+		apierror.WriteCode(w, "Log in again to link an identity provider account", http.StatusForbidden, apierror.CodeRecentLoginNeeded, nil)
+		return
+	}
+
+	identity, ok := a.oidcLinks.take(req.LinkCode)
+	if !ok {
+		apierror.WriteCode(w, "Invalid or expired link code", http.StatusBadRequest, apierror.CodeInvalidCode, nil)
+		return
+	}
+
+	link, err := a.linkIdentity(ctx, identity, claims.UserID)
+	if err != nil {
+		apierror.Write(w, "Failed to link account", http.StatusInternalServerError)
+		return
+	}
+	if link.UserID != claims.UserID {
+		apierror.Write(w, "The identity provider account is linked to another user", http.StatusConflict)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeOIDCError responds with the failure to find the user of an identity provider account.
+func writeOIDCError(w http.ResponseWriter, err error) {
+	var linkErr *oidcLinkRequiredError
+	switch {
+	case errors.As(err, &linkErr):
+		apierror.WriteCode(w, "Log in with your password to link this account", http.StatusConflict,
+			apierror.CodeLinkRequired, map[string]any{"link_code": linkErr.linkCode})
+	case errors.Is(err, errOIDCUserUnknown):
+		apierror.Write(w, "No GophKeeper account for this user", http.StatusForbidden)
+	default:
+		apierror.Write(w, "Server error", http.StatusInternalServerError)
+	}
+}
+
+// resolveOIDCUser returns the local user of an identity provider account. An account
+// without a user gets a new one if autoProvision is set. It is never linked to an existing
+// user by the login claim alone, since whoever registered that login first may not be the
+// owner of the account: that takes an explicit link by the user with the returned
+// oidcLinkRequiredError.
+func (a *API) resolveOIDCUser(ctx context.Context, identity auth.OIDCIdentity) (models.User, error) {
+	user, err := a.store.GetUserByIdentity(ctx, identity.Issuer, identity.Subject)
+	if err == nil {
+		return user, nil
+	}
+	var identityNotFoundErr storage.ErrIdentityNotFound
+	if !errors.As(err, &identityNotFoundErr) {
+		return models.User{}, err
+	}
+
+	_, err = a.store.GetUserByLogin(ctx, identity.Login)
+	var userNotFoundErr storage.ErrUserNotFound
+	switch {
+	case err == nil:
+		return models.User{}, a.linkRequired(identity)
+	case !errors.As(err, &userNotFoundErr):
+		return models.User{}, err
+	case !a.oidcProvision:
+		return models.User{}, errOIDCUserUnknown
+	}
+
+	user, err = a.provisionUser(ctx, identity.Login)
+	var userExistsErr storage.ErrUserExists
+	if errors.As(err, &userExistsErr) {
+		// Registered since, possibly by someone else
+		return models.User{}, a.linkRequired(identity)
+	}
+	if err != nil {
+		return models.User{}, err
+	}
+
+	link, err := a.linkIdentity(ctx, identity, user.ID)
+	if err != nil {
+		return models.User{}, err
+	}
+	if link.UserID != user.ID {
+		// Linked by a concurrent sign-in
+		return a.store.GetUserByID(ctx, link.UserID)
+	}
+	return user, nil
+}
+
+// linkRequired remembers an identity provider account for POST /api/user/oidc/link.
+func (a *API) linkRequired(identity auth.OIDCIdentity) error {
+	linkCode := rand.Text()
+	a.oidcLinks.add(linkCode, identity)
+	return &oidcLinkRequiredError{linkCode: linkCode}
+}
+
+// linkIdentity links an identity provider account to a user. It returns the existing link
+// if the account is already linked.
+func (a *API) linkIdentity(ctx context.Context, identity auth.OIDCIdentity, userID int) (models.UserIdentity, error) {
+	link, err := a.store.LinkIdentity(ctx, models.UserIdentity{
+		Issuer:    identity.Issuer,
+		Subject:   identity.Subject,
+		UserID:    userID,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		return models.UserIdentity{}, err
+	}
+	if link.UserID == userID {
+		log.Printf("Linked identity provider account %s to user %d", identity.Subject, userID)
+	}
+	return link, nil
+}
+
+// provisionUser creates a user for single sign-on. Its random password is never shown,
+// so the user can only sign in through the identity provider.
+func (a *API) provisionUser(ctx context.Context, login string) (models.User, error) {
+	hashedPassword, err := auth.HashPassword(rand.Text())
+	if err != nil {
+		return models.User{}, err
+	}
+
+	return a.store.CreateUser(ctx, models.User{Login: login, Password: hashedPassword})
+}
+
+// isLoopbackURL reports whether rawURL is an http URL on the loopback interface, where
+// a CLI can listen for the end of a browser sign-in (RFC 8252, section 7.3).
+func isLoopbackURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "http" || u.User != nil {
+		return false
+	}
+	if u.Hostname() == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(u.Hostname())
+	return ip != nil && ip.IsLoopback()
+}
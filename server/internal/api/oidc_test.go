@@ -0,0 +1,355 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"gophkeeper/server/internal/apierror"
+	"gophkeeper/server/internal/auth"
+	"gophkeeper/server/internal/models"
+	"gophkeeper/server/internal/storage"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// testIdP is a minimal OpenID Connect provider that signs in a configurable account.
+type testIdP struct {
+	server *httptest.Server
+	key    ed25519.PrivateKey
+	kid    string
+
+	mu sync.Mutex
+	// claims are added to the ID tokens of the next sign-ins
+	claims jwt.MapClaims
+	// codes maps issued authorization codes to their code challenge and nonce
+	codes          map[string][2]string
+	deviceApproved bool
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	der, _ := x509.MarshalPKCS8PrivateKey(key)
+	signingKey, err := auth.ParseSigningKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	if err != nil {
+		t.Fatalf("Failed to parse key: %v", err)
+	}
+	idp := &testIdP{key: key, kid: signingKey.ID, codes: make(map[string][2]string)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                        idp.server.URL,
+			"authorization_endpoint":        idp.server.URL + "/authorize",
+			"token_endpoint":                idp.server.URL + "/token",
+			"device_authorization_endpoint": idp.server.URL + "/device",
+			"jwks_uri":                      idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(auth.JSONWebKeySet{Keys: []auth.JSONWebKey{signingKey.JWK()}})
+	})
+	mux.HandleFunc("GET /authorize", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("code_challenge_method") != "S256" {
+			http.Error(w, "PKCE required", http.StatusBadRequest)
+			return
+		}
+		code := rand.Text()
+		idp.mu.Lock()
+		idp.codes[code] = [2]string{query.Get("code_challenge"), query.Get("nonce")}
+		idp.mu.Unlock()
+
+		target, _ := url.Parse(query.Get("redirect_uri"))
+		target.RawQuery = url.Values{"code": {code}, "state": {query.Get("state")}}.Encode()
+		http.Redirect(w, r, target.String(), http.StatusFound)
+	})
+	mux.HandleFunc("POST /device", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(auth.DeviceAuthorization{
+			DeviceCode:      "device-code",
+			UserCode:        "WDJB-MJHT",
+			VerificationURI: idp.server.URL + "/activate",
+			ExpiresIn:       600,
+			Interval:        5,
+		})
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		idp.mu.Lock()
+		defer idp.mu.Unlock()
+
+		tokenError := func(code string) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(auth.OIDCError{Code: code})
+		}
+		nonce := ""
+		switch r.PostFormValue("grant_type") {
+		case "authorization_code":
+			issued, ok := idp.codes[r.PostFormValue("code")]
+			delete(idp.codes, r.PostFormValue("code"))
+			sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+			if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != issued[0] {
+				tokenError("invalid_grant")
+				return
+			}
+			nonce = issued[1]
+		case "urn:ietf:params:oauth:grant-type:device_code":
+			if r.PostFormValue("device_code") != "device-code" {
+				tokenError("invalid_grant")
+				return
+			}
+			if !idp.deviceApproved {
+				tokenError(auth.OIDCAuthorizationPending)
+				return
+			}
+		default:
+			tokenError("unsupported_grant_type")
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]string{"id_token": idp.idToken(t, nonce)})
+	})
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+// signIn sets the account that signs in next.
+func (idp *testIdP) signIn(claims jwt.MapClaims) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.claims = claims
+}
+
+func (idp *testIdP) idToken(t *testing.T, nonce string) string {
+	claims := jwt.MapClaims{
+		"iss": idp.server.URL,
+		"aud": "gophkeeper",
+		"iat": time.Now().Unix(),
+		"exp": time.Now().Add(time.Minute).Unix(),
+	}
+	if nonce != "" {
+		claims["nonce"] = nonce
+	}
+	for name, value := range idp.claims {
+		claims[name] = value
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	token.Header["kid"] = idp.kid
+	signed, err := token.SignedString(idp.key)
+	if err != nil {
+		t.Fatalf("Failed to sign ID token: %v", err)
+	}
+	return signed
+}
+
+// TestOIDC tests single sign-on through the browser and device flows
+func TestOIDC(t *testing.T) {
+	idp := newTestIdP(t)
+	store := storage.NewMemStore()
+	jwtManager := auth.NewJWTManager("test-secret")
+	jwtManager.SetRevocationList(auth.NewRevocationList(store))
+	api := New(store, jwtManager)
+
+	provider, err := auth.NewOIDCProvider(context.Background(), auth.OIDCConfig{
+		Issuer:      idp.server.URL,
+		ClientID:    "gophkeeper",
+		RedirectURL: "https://keeper.example/api/user/oidc/callback",
+	}, nil)
+	if err != nil {
+		t.Fatalf("Failed to discover identity provider: %v", err)
+	}
+	api.SetOIDC(provider, false)
+	router := NewRouter(api, jwtManager)
+
+	hashedPassword, _ := auth.HashPassword("correct horse battery")
+	existing, _ := store.CreateUser(context.Background(), models.User{Login: "alice@example.com", Password: hashedPassword})
+
+	doAuth := func(method, target, token string, body any) *httptest.ResponseRecorder {
+		var payload []byte
+		if body != nil {
+			payload, _ = json.Marshal(body)
+		}
+		req := httptest.NewRequest(method, target, bytes.NewReader(payload))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+	do := func(method, target string, body any) *httptest.ResponseRecorder {
+		return doAuth(method, target, "", body)
+	}
+	// browserSignIn follows the redirects of a browser sign-in up to the callback
+	browserSignIn := func(clientRedirect string) *httptest.ResponseRecorder {
+		login := "/api/user/oidc/login"
+		if clientRedirect != "" {
+			login += "?redirect_uri=" + url.QueryEscape(clientRedirect)
+		}
+		resp := do(http.MethodGet, login, nil)
+		if resp.Code != http.StatusFound {
+			t.Fatalf("Expected status %d for sign-in, got %d: %s", http.StatusFound, resp.Code, resp.Body)
+		}
+		noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+		idpResp, err := noRedirect.Get(resp.Header().Get("Location"))
+		if err != nil {
+			t.Fatalf("Failed to reach identity provider: %v", err)
+		}
+		idpResp.Body.Close()
+		callback, _ := url.Parse(idpResp.Header.Get("Location"))
+		return do(http.MethodGet, "/api/user/oidc/callback?"+callback.RawQuery, nil)
+	}
+	tokenUser := func(resp *httptest.ResponseRecorder) int {
+		if resp.Code != http.StatusOK {
+			t.Fatalf("Expected status %d with tokens, got %d: %s", http.StatusOK, resp.Code, resp.Body)
+		}
+		var tokens TokenResponse
+		json.NewDecoder(resp.Body).Decode(&tokens)
+		userID, err := jwtManager.ValidateJWT(tokens.Token)
+		if err != nil {
+			t.Fatalf("Expected a valid access token, got %v", err)
+		}
+		return userID
+	}
+
+	// An existing user with the same login is not linked by the sign-in alone
+	idp.signIn(jwt.MapClaims{"sub": "alice-sub", "email": "Alice@Example.com", "email_verified": true})
+	resp := browserSignIn("")
+	var linkErr apierror.Response
+	json.NewDecoder(resp.Body).Decode(&linkErr)
+	linkCode, _ := linkErr.Details["link_code"].(string)
+	if resp.Code != http.StatusConflict || linkErr.Code != apierror.CodeLinkRequired || linkCode == "" {
+		t.Fatalf("Expected %s with a link code, got %d: %+v", apierror.CodeLinkRequired, resp.Code, linkErr)
+	}
+	if _, err := store.GetUserByIdentity(context.Background(), idp.server.URL, "alice-sub"); err == nil {
+		t.Error("Expected the identity not to be linked before the user links it")
+	}
+
+	// The user links it after a login with the password
+	var tokens TokenResponse
+	json.NewDecoder(do(http.MethodPost, "/api/user/login", models.User{Login: "alice@example.com", Password: "correct horse battery"}).Body).Decode(&tokens)
+	if resp := do(http.MethodPost, "/api/user/oidc/link", OIDCLinkRequest{LinkCode: linkCode}); resp.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for an unauthenticated link, got %d", http.StatusUnauthorized, resp.Code)
+	}
+	if resp := doAuth(http.MethodPost, "/api/user/oidc/link", tokens.Token, OIDCLinkRequest{LinkCode: "forged"}); resp.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an unknown link code, got %d", http.StatusBadRequest, resp.Code)
+	}
+	if resp := doAuth(http.MethodPost, "/api/user/oidc/link", tokens.Token, OIDCLinkRequest{LinkCode: linkCode}); resp.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d for the link, got %d: %s", http.StatusNoContent, resp.Code, resp.Body)
+	}
+	if user, err := store.GetUserByIdentity(context.Background(), idp.server.URL, "alice-sub"); err != nil || user.ID != existing.ID {
+		t.Errorf("Expected identity linked to user %d, got %d, %v", existing.ID, user.ID, err)
+	}
+	if userID := tokenUser(browserSignIn("")); userID != existing.ID {
+		t.Errorf("Expected user %d, got %d", existing.ID, userID)
+	}
+
+	// Linked accounts keep signing in after the email changes, with the second factor of the user
+	totpSecret, _ := auth.GenerateTOTPSecret()
+	store.SaveTOTP(context.Background(), models.TOTP{UserID: existing.ID, Secret: totpSecret, Enabled: true, CreatedAt: time.Now()})
+	idp.signIn(jwt.MapClaims{"sub": "alice-sub", "email": "alice@new.example", "email_verified": true})
+	resp = browserSignIn("")
+	var challenge MFAChallengeResponse
+	json.NewDecoder(resp.Body).Decode(&challenge)
+	if resp.Code != http.StatusAccepted || challenge.Challenge == "" {
+		t.Fatalf("Expected status %d with an MFA challenge, got %d", http.StatusAccepted, resp.Code)
+	}
+	mfaLogin := MFALoginRequest{Challenge: challenge.Challenge, TOTPCodeRequest: TOTPCodeRequest{Code: auth.TOTPCode(totpSecret, time.Now())}}
+	if userID := tokenUser(do(http.MethodPost, "/api/user/login/totp", mfaLogin)); userID != existing.ID {
+		t.Errorf("Expected linked user %d, got %d", existing.ID, userID)
+	}
+	store.DeleteTOTP(context.Background(), existing.ID)
+
+	// Unverified emails and unknown accounts are rejected without provisioning
+	idp.signIn(jwt.MapClaims{"sub": "mallory-sub", "email": "alice@example.com", "email_verified": false})
+	if resp := browserSignIn(""); resp.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for an unverified email, got %d", http.StatusUnauthorized, resp.Code)
+	}
+	idp.signIn(jwt.MapClaims{"sub": "bob-sub", "email": "bob@example.com", "email_verified": true})
+	if resp := browserSignIn(""); resp.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d for an unknown account, got %d", http.StatusForbidden, resp.Code)
+	}
+
+	// A CLI receives a single-use login code on its loopback address
+	api.SetOIDC(provider, true)
+	if resp := do(http.MethodGet, "/api/user/oidc/login?redirect_uri="+url.QueryEscape("https://evil.example/cb"), nil); resp.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for a non-loopback redirect, got %d", http.StatusBadRequest, resp.Code)
+	}
+	resp = browserSignIn("http://127.0.0.1:8765/callback")
+	if resp.Code != http.StatusFound {
+		t.Fatalf("Expected status %d to the CLI, got %d: %s", http.StatusFound, resp.Code, resp.Body)
+	}
+	cliCallback, _ := url.Parse(resp.Header().Get("Location"))
+	if cliCallback.Host != "127.0.0.1:8765" {
+		t.Errorf("Expected redirect to the CLI, got %s", cliCallback)
+	}
+	code := OIDCCodeRequest{Code: cliCallback.Query().Get("code")}
+	bobID := tokenUser(do(http.MethodPost, "/api/user/oidc/token", code))
+	if bob, err := store.GetUserByLogin(context.Background(), "bob@example.com"); err != nil || bob.ID != bobID {
+		t.Errorf("Expected provisioned user %d, got %d, %v", bobID, bob.ID, err)
+	}
+	if resp := do(http.MethodPost, "/api/user/oidc/token", code); resp.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for a reused login code, got %d", http.StatusUnauthorized, resp.Code)
+	}
+
+	// Accounts with the login of an existing user are not provisioned, the CLI gets a link code
+	idp.signIn(jwt.MapClaims{"sub": "mallory-sub", "email": "alice@example.com", "email_verified": true})
+	resp = browserSignIn("http://127.0.0.1:8765/callback")
+	cliCallback, _ = url.Parse(resp.Header().Get("Location"))
+	if resp.Code != http.StatusFound || cliCallback.Query().Get("link_code") == "" || cliCallback.Query().Has("code") {
+		t.Errorf("Expected a redirect to the CLI with a link code, got %d: %s", resp.Code, cliCallback)
+	}
+
+	// Callbacks with an unknown state are rejected
+	if resp := do(http.MethodGet, "/api/user/oidc/callback?code=x&state=forged", nil); resp.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an unknown state, got %d", http.StatusBadRequest, resp.Code)
+	}
+
+	// Device flow: pending until the user approves
+	idp.signIn(jwt.MapClaims{"sub": "bob-sub", "email": "bob@example.com", "email_verified": true})
+	resp = do(http.MethodPost, "/api/user/oidc/device", nil)
+	var authorization auth.DeviceAuthorization
+	json.NewDecoder(resp.Body).Decode(&authorization)
+	if resp.Code != http.StatusOK || authorization.UserCode == "" {
+		t.Fatalf("Expected a device authorization, got %d: %+v", resp.Code, authorization)
+	}
+	poll := OIDCDeviceTokenRequest{DeviceCode: authorization.DeviceCode}
+	resp = do(http.MethodPost, "/api/user/oidc/device/token", poll)
+	var pending apierror.Response
+	json.NewDecoder(resp.Body).Decode(&pending)
+	if resp.Code != http.StatusBadRequest || pending.Code != auth.OIDCAuthorizationPending {
+		t.Errorf("Expected %s, got %d: %+v", auth.OIDCAuthorizationPending, resp.Code, pending)
+	}
+	idp.mu.Lock()
+	idp.deviceApproved = true
+	idp.mu.Unlock()
+	if userID := tokenUser(do(http.MethodPost, "/api/user/oidc/device/token", poll)); userID != bobID {
+		t.Errorf("Expected user %d from the device flow, got %d", bobID, userID)
+	}
+
+	// ID tokens for another client or sign-in are rejected
+	wrongAudience := idp.idToken(t, "")
+	claims := jwt.MapClaims{}
+	jwt.NewParser().ParseUnverified(wrongAudience, claims)
+	claims["aud"] = "other-client"
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	token.Header["kid"] = idp.kid
+	wrongAudience, _ = token.SignedString(idp.key)
+	if _, err := provider.VerifyIDToken(context.Background(), wrongAudience, ""); err == nil {
+		t.Error("Expected an ID token for another audience to be rejected")
+	}
+	if _, err := provider.VerifyIDToken(context.Background(), idp.idToken(t, "other"), "expected"); err == nil {
+		t.Error("Expected an ID token with another nonce to be rejected")
+	}
+}
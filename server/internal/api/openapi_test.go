@@ -0,0 +1,247 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/base32"
+	"encoding/json"
+	"fmt"
+	"gophkeeper/server/internal/apierror"
+	"gophkeeper/server/internal/auth"
+	"gophkeeper/server/internal/models"
+	"gophkeeper/server/internal/openapi"
+	"gophkeeper/server/internal/storage"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// TestOpenAPIContract tests that the handlers of /api/user, /api/secrets, /api/v2 and
+// /api/version behave as the OpenAPI document describes
+func TestOpenAPIContract(t *testing.T) {
+	spec, err := openapi.Load()
+	if err != nil {
+		t.Fatalf("Failed to load the OpenAPI document: %v", err)
+	}
+
+	store := storage.NewMemStore()
+	jwtManager := auth.NewJWTManager("test-secret")
+	jwtManager.SetRevocationList(auth.NewRevocationList(store))
+	api := New(store, jwtManager)
+	router := NewRouter(api, jwtManager)
+
+	// Every route is documented and every documented operation is routed
+	routed := make(map[string]bool)
+	chi.Walk(router.(chi.Routes), func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		route = strings.TrimSuffix(route, "/")
+		if strings.HasPrefix(route, "/api/user") || strings.HasPrefix(route, "/api/secrets") ||
+			strings.HasPrefix(route, "/api/v2") || route == "/api/version" {
+			routed[method+" "+route] = true
+			if op, _ := spec.FindOperation(method, route); op == nil {
+				t.Errorf("Route %s %s is not documented", method, route)
+			}
+		}
+		return nil
+	})
+	for path, item := range spec.Paths {
+		for method := range item {
+			// OIDC and LDAP routes exist only with an identity provider or a directory
+			if !strings.HasPrefix(path, "/api/user/oidc") && !strings.HasPrefix(path, "/api/user/ldap") && !routed[strings.ToUpper(method)+" "+path] {
+				t.Errorf("Operation %s %s is not routed", method, path)
+			}
+		}
+	}
+
+	// Request types of the server match the request bodies
+	requests := []struct {
+		method string
+		path   string
+		body   any
+	}{
+		{http.MethodPost, "/api/user/register", RegisterRequest{Invite: "code"}},
+		{http.MethodPost, "/api/user/login/totp", MFALoginRequest{TOTPCodeRequest: TOTPCodeRequest{Code: "1", RecoveryCode: "2"}}},
+		{http.MethodPost, "/api/user/refresh", RefreshRequest{}},
+		{http.MethodPost, "/api/user/recover", RecoverRequest{Password: "x", Salt: []byte{1}, Verifier: []byte{1}}},
+		{http.MethodPost, "/api/user/srp/register", SRPRegisterRequest{Login: "alice", Salt: []byte{1}, Verifier: []byte{1}, Invite: "code"}},
+		{http.MethodPut, "/api/user/srp", SRPEnableRequest{Salt: []byte{1}, Verifier: []byte{1}}},
+		{http.MethodPost, "/api/user/srp/login", SRPStartRequest{ClientPublic: []byte{1}}},
+		{http.MethodPost, "/api/user/srp/login/verify", SRPVerifyRequest{Proof: []byte{1}}},
+		{http.MethodPost, "/api/user/totp/confirm", TOTPCodeRequest{Code: "1", RecoveryCode: "2"}},
+		{http.MethodPost, "/api/user/oidc/token", OIDCCodeRequest{Code: "code"}},
+		{http.MethodPost, "/api/user/oidc/device/token", OIDCDeviceTokenRequest{DeviceCode: "code"}},
+		{http.MethodPost, "/api/user/oidc/link", OIDCLinkRequest{LinkCode: "code"}},
+		{http.MethodPost, "/api/user/ldap/link", LDAPLinkRequest{Login: "alice", Password: "x"}},
+		{http.MethodPut, "/api/secrets/1", models.Secret{Type: models.BankCardType, Data: []byte{1}}},
+		{http.MethodPost, "/api/v2/secrets", SecretV2Request{Type: "login", Metadata: "m", Payload: json.RawMessage(`{"login": "alice", "password": "x"}`)}},
+		{http.MethodPut, "/api/v2/secrets/1", SecretV2Request{Type: "bankcard", Payload: json.RawMessage(`{"number": "1", "holder": "A", "expiry": "12/30", "cvv": "1"}`), Revision: 1}},
+	}
+	for _, req := range requests {
+		op, _ := spec.FindOperation(req.method, req.path)
+		if err := op.BodySchema().ValidateStrict(decodeJSON(t, req.body)); err != nil {
+			t.Errorf("Body %T of %s %s does not match the document: %v", req.body, req.method, req.path, err)
+		}
+	}
+
+	// Responses match the document
+	do := func(method, path, token string, body any) *httptest.ResponseRecorder {
+		t.Helper()
+		payload, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, path, bytes.NewReader(payload))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		op, _ := spec.FindOperation(method, req.URL.Path)
+		schema, ok := op.ResponseSchema(resp.Code)
+		switch {
+		case !ok:
+			t.Errorf("Status %d of %s %s is not documented", resp.Code, method, path)
+		case schema == nil && resp.Body.Len() > 0:
+			t.Errorf("Expected no body for %s %s with status %d, got %s", method, path, resp.Code, resp.Body)
+		case schema != nil:
+			if contentType := resp.Header().Get("Content-Type"); contentType != "application/json" {
+				t.Errorf("Expected JSON for %s %s with status %d, got %s", method, path, resp.Code, contentType)
+			}
+			var value any
+			if err := json.Unmarshal(resp.Body.Bytes(), &value); err != nil {
+				t.Errorf("Invalid JSON for %s %s: %v", method, path, err)
+			} else if err := schema.ValidateStrict(value); err != nil {
+				t.Errorf("Response of %s %s with status %d does not match the document: %v", method, path, resp.Code, err)
+			}
+		}
+		return resp
+	}
+
+	do(http.MethodPost, "/api/user/register", "", RegisterRequest{Login: "alice", Password: "correct horse battery"})
+	do(http.MethodPost, "/api/user/register", "", RegisterRequest{Login: "alice", Password: "correct horse battery"})
+	do(http.MethodPost, "/api/user/login", "", models.User{Login: "alice", Password: "wrong password"})
+	var tokens TokenResponse
+	json.NewDecoder(do(http.MethodPost, "/api/user/login", "", models.User{Login: "alice", Password: "correct horse battery"}).Body).Decode(&tokens)
+	json.NewDecoder(do(http.MethodPost, "/api/user/refresh", "", RefreshRequest{RefreshToken: tokens.RefreshToken}).Body).Decode(&tokens)
+	do(http.MethodPost, "/api/user/refresh", "", RefreshRequest{RefreshToken: "unknown"})
+
+	do(http.MethodGet, "/api/user/sessions", tokens.Token, nil)
+	do(http.MethodDelete, "/api/user/sessions/unknown", tokens.Token, nil)
+	do(http.MethodGet, "/api/user/recovery-codes", tokens.Token, nil)
+	do(http.MethodPost, "/api/user/recovery-codes", tokens.Token, nil)
+	do(http.MethodPost, "/api/user/unlock", tokens.Token, nil)
+
+	var enrollment TOTPEnrollResponse
+	json.NewDecoder(do(http.MethodPost, "/api/user/totp", tokens.Token, nil).Body).Decode(&enrollment)
+	do(http.MethodPost, "/api/user/totp/confirm", tokens.Token, TOTPCodeRequest{Code: "000000"})
+	totpSecret, _ := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(enrollment.Secret)
+	do(http.MethodPost, "/api/user/totp/confirm", tokens.Token, TOTPCodeRequest{Code: auth.TOTPCode(totpSecret, time.Now())})
+	var challenge MFAChallengeResponse
+	json.NewDecoder(do(http.MethodPost, "/api/user/login", "", models.User{Login: "alice", Password: "correct horse battery"}).Body).Decode(&challenge)
+	do(http.MethodPost, "/api/user/login/totp", "", MFALoginRequest{Challenge: challenge.Challenge, TOTPCodeRequest: TOTPCodeRequest{Code: "000000"}})
+
+	resp := do(http.MethodGet, "/api/secrets", tokens.Token, nil)
+	var secret models.Secret
+	json.NewDecoder(do(http.MethodPost, "/api/secrets", tokens.Token, models.Secret{Type: models.TextDataType, Data: []byte("note"), Metadata: "Deploy notes"}).Body).Decode(&secret)
+	do(http.MethodPost, "/api/secrets", tokens.Token, models.Secret{Type: models.TextDataType, Metadata: "Empty note"})
+	do(http.MethodGet, "/api/secrets?keyword=deploy", tokens.Token, nil)
+	do(http.MethodGet, fmt.Sprintf("/api/secrets/%d", secret.ID), tokens.Token, nil)
+	do(http.MethodPut, fmt.Sprintf("/api/secrets/%d", secret.ID), tokens.Token, models.Secret{Type: models.TextDataType, Data: []byte("new note")})
+	do(http.MethodDelete, fmt.Sprintf("/api/secrets/%d", secret.ID), tokens.Token, nil)
+	do(http.MethodGet, fmt.Sprintf("/api/secrets/%d", secret.ID), tokens.Token, nil)
+	do(http.MethodGet, "/api/secrets", "", nil)
+
+	do(http.MethodGet, "/api/version", "", nil)
+	var secretV2 SecretV2
+	json.NewDecoder(do(http.MethodPost, "/api/v2/secrets", tokens.Token, SecretV2Request{Type: "login", Payload: json.RawMessage(`{"login": "alice", "password": "x"}`)}).Body).Decode(&secretV2)
+	do(http.MethodPost, "/api/v2/secrets", tokens.Token, SecretV2Request{Type: "binary", Payload: json.RawMessage(`{"data": null}`)})
+	do(http.MethodPost, "/api/secrets", tokens.Token, models.Secret{Type: models.BankCardType, Data: []byte("4111 1111 1111 1111")})
+	do(http.MethodGet, "/api/v2/secrets", tokens.Token, nil)
+	do(http.MethodPut, fmt.Sprintf("/api/v2/secrets/%d", secretV2.ID), tokens.Token, SecretV2Request{Type: "login", Payload: json.RawMessage(`{"login": "bob"}`), Revision: 1})
+	do(http.MethodPut, fmt.Sprintf("/api/v2/secrets/%d", secretV2.ID), tokens.Token, SecretV2Request{Type: "login", Payload: json.RawMessage(`{"login": "carol"}`), Revision: 1})
+	do(http.MethodGet, fmt.Sprintf("/api/v2/secrets/%d", secretV2.ID), tokens.Token, nil)
+	do(http.MethodDelete, fmt.Sprintf("/api/v2/secrets/%d", secretV2.ID), tokens.Token, nil)
+	do(http.MethodGet, fmt.Sprintf("/api/v2/secrets/%d", secretV2.ID), tokens.Token, nil)
+
+	do(http.MethodPost, "/api/user/logout", tokens.Token, nil)
+	do(http.MethodPost, "/api/user/recover", "", RecoverRequest{Login: "alice", RecoveryCode: "wrong", Password: "another good password"})
+
+	// Requests that do not match the document are rejected before the handlers, and after
+	// authentication for operations that require it
+	alice, _ := store.GetUserByLogin(context.Background(), "alice")
+	token, _ := jwtManager.GenerateJWT(alice.ID)
+	rejected := []struct {
+		method string
+		path   string
+		body   string
+		field  string
+	}{
+		{http.MethodPost, "/api/user/login", `{"login": 42, "password": "x"}`, "login"},
+		{http.MethodPost, "/api/user/register", `{"login": "bob"}`, "password"},
+		{http.MethodPost, "/api/secrets", `{"type": 7, "data": ""}`, "type"},
+		{http.MethodPost, "/api/user/srp/login", `{"login": "bob", "a": "not base64!"}`, "a"},
+		{http.MethodGet, "/api/secrets/abc", ``, "id"},
+		{http.MethodPost, "/api/v2/secrets", `{"type": "note", "payload": {"text": "x"}}`, "type"},
+		{http.MethodPost, "/api/v2/secrets", `{"type": "text", "payload": {"txt": "x"}}`, "payload"},
+	}
+	for _, tt := range rejected {
+		req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp = httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		var envelope apierror.Response
+		json.NewDecoder(resp.Body).Decode(&envelope)
+		if resp.Code != http.StatusBadRequest || envelope.Code != apierror.CodeInvalidRequest || envelope.Details["field"] != tt.field {
+			t.Errorf("Expected %s %s to be rejected for %s, got %d: %+v", tt.method, tt.path, tt.field, resp.Code, envelope)
+		}
+	}
+
+	// Anonymous clients cannot make the server read large bodies
+	large := &countingReader{Reader: strings.NewReader(`{"data": "` + strings.Repeat("x", 1<<20) + `"}`)}
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/api/secrets", large))
+	if resp.Code != http.StatusUnauthorized || large.n > 0 {
+		t.Errorf("Expected status %d without reading the body, got %d after %d bytes", http.StatusUnauthorized, resp.Code, large.n)
+	}
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/api/user/login", strings.NewReader(`{"login": "`+strings.Repeat("x", 1<<20)+`"}`)))
+	if resp.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status %d for a large login body, got %d", http.StatusRequestEntityTooLarge, resp.Code)
+	}
+
+	// The document is served
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil))
+	var served struct {
+		OpenAPI string `json:"openapi"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&served); err != nil || resp.Code != http.StatusOK || !strings.HasPrefix(served.OpenAPI, "3.") {
+		t.Errorf("Expected the OpenAPI document, got %d: %v", resp.Code, err)
+	}
+}
+
+// countingReader counts the bytes read from Reader.
+type countingReader struct {
+	io.Reader
+	n int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.n += n
+	return n, err
+}
+
+func decodeJSON(t *testing.T, value any) any {
+	t.Helper()
+	payload, err := json.Marshal(value)
+	if err != nil {
+		t.Fatalf("Failed to encode %T: %v", value, err)
+	}
+	var decoded any
+	json.Unmarshal(payload, &decoded)
+	return decoded
+}
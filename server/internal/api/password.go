@@ -0,0 +1,48 @@
+package api
+
+import (
+	"encoding/json"
+	"gophkeeper/server/internal/apierror"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// PasswordPolicyResponse describes the password policy in GET /api/version. The server
+// checks it on registrations with a password; clients registering with SRP check it
+// themselves, since the server never sees the password.
+type PasswordPolicyResponse struct {
+	MinLength int `json:"min_length"`
+	MaxLength int `json:"max_length,omitempty"`
+	// BreachCheck is set if passwords from GET /api/user/breached-passwords/{prefix} are refused
+	BreachCheck bool `json:"breach_check"`
+}
+
+// BreachedPasswordsResponse is the response of GET /api/user/breached-passwords/{prefix}.
+type BreachedPasswordsResponse struct {
+	// Suffixes are the remaining hex digits of the SHA-1 hashes with the prefix
+	Suffixes []string `json:"suffixes"`
+}
+
+// passwordPolicyResponse returns the password policy for clients.
+func (a *API) passwordPolicyResponse() PasswordPolicyResponse {
+	return PasswordPolicyResponse{
+		MinLength:   a.passwordPolicy.MinLength,
+		MaxLength:   a.passwordPolicy.MaxLength,
+		BreachCheck: a.passwordPolicy.Breached.Len() > 0,
+	}
+}
+
+// BreachedPasswords returns the hashes of breached passwords that start with a prefix of
+// auth.BreachRangePrefixLength hex digits, so that clients can check a password against
+// the breach list without revealing it.
+func (a *API) BreachedPasswords(w http.ResponseWriter, r *http.Request) {
+	suffixes, err := a.passwordPolicy.Breached.Range(chi.URLParam(r, "prefix"))
+	if err != nil {
+		apierror.Write(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(BreachedPasswordsResponse{Suffixes: suffixes})
+}
@@ -0,0 +1,139 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"gophkeeper/server/internal/auth"
+	"gophkeeper/server/internal/models"
+	"gophkeeper/server/internal/storage"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// TestPasswordHashing tests Argon2id hashes, rehashing on login and the password policy
+func TestPasswordHashing(t *testing.T) {
+	breachList := filepath.Join(t.TempDir(), "breached.txt")
+	// "password123" in plain text and "letmein2024" as an uppercase SHA-1 with a count
+	os.WriteFile(breachList, []byte("# top passwords\npassword123\n936FA92E3681CD1979871D76998D392BB9C1699A:42\n"), 0o600)
+	breached, err := auth.LoadBreachList(breachList)
+	if err != nil {
+		t.Fatalf("Failed to load breach list: %v", err)
+	}
+
+	store := storage.NewMemStore()
+	jwtManager := auth.NewJWTManager("test-secret")
+	api := New(store, jwtManager)
+	api.SetPasswordPolicy(auth.PasswordPolicy{MinLength: 10, MaxLength: 100, Breached: breached})
+	router := NewRouter(api, jwtManager)
+
+	post := func(path, login, password string) int {
+		body, _ := json.Marshal(models.User{Login: login, Password: password})
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body)))
+		return resp.Code
+	}
+	storedHash := func(login string) string {
+		user, err := store.GetUserByLogin(context.Background(), login)
+		if err != nil {
+			t.Fatalf("Failed to get user %s: %v", login, err)
+		}
+		return user.Password
+	}
+
+	rejected := map[string]string{
+		"Too short":     "short",
+		"Too long":      strings.Repeat("x", 101),
+		"Equals login":  "Policy-User",
+		"Breached":      "password123",
+		"Breached SHA1": "letmein2024",
+	}
+	for name, password := range rejected {
+		if code := post("/api/user/register", "policy-user", password); code != http.StatusBadRequest {
+			t.Errorf("%s: expected status %d, got %d", name, http.StatusBadRequest, code)
+		}
+	}
+
+	// SRP clients get the policy and look up passwords by the prefix of their SHA-1 hash
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/api/version", nil))
+	var version VersionResponse
+	json.NewDecoder(resp.Body).Decode(&version)
+	if want := (PasswordPolicyResponse{MinLength: 10, MaxLength: 100, BreachCheck: true}); version.PasswordPolicy != want {
+		t.Errorf("Expected password policy %+v, got %+v", want, version.PasswordPolicy)
+	}
+	hash := fmt.Sprintf("%X", sha1.Sum([]byte("password123")))
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/api/user/breached-passwords/"+strings.ToLower(hash[:5]), nil))
+	var breachedRange BreachedPasswordsResponse
+	json.NewDecoder(resp.Body).Decode(&breachedRange)
+	if resp.Code != http.StatusOK || !slices.Contains(breachedRange.Suffixes, hash[5:]) {
+		t.Errorf("Expected the suffix %s in the range, got %d: %+v", hash[5:], resp.Code, breachedRange)
+	}
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/api/user/breached-passwords/00000", nil))
+	if resp.Code != http.StatusOK || !strings.Contains(resp.Body.String(), `"suffixes":[]`) {
+		t.Errorf("Expected an empty range, got %d: %s", resp.Code, resp.Body)
+	}
+	for _, prefix := range []string{"ZZZZZ", "CBFD", "CBFDAC"} {
+		resp = httptest.NewRecorder()
+		router.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/api/user/breached-passwords/"+prefix, nil))
+		if resp.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d for prefix %q, got %d", http.StatusBadRequest, prefix, resp.Code)
+		}
+	}
+
+	// New users get Argon2id hashes, which do not truncate long passwords like bcrypt
+	long := strings.Repeat("a", 80)
+	if code := post("/api/user/register", "alice", long+"1"); code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d", http.StatusCreated, code)
+	}
+	if hash := storedHash("alice"); !strings.HasPrefix(hash, "$argon2id$v=19$m=65536,t=3,p=4$") {
+		t.Errorf("Expected an Argon2id PHC string, got %s", hash)
+	}
+	if code := post("/api/user/login", "alice", long+"2"); code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for a password differing after 72 bytes, got %d", http.StatusUnauthorized, code)
+	}
+
+	// Existing bcrypt hashes keep working and are upgraded on the first successful login
+	legacy, _ := bcrypt.GenerateFromPassword([]byte("bob-legacy-pass"), bcrypt.MinCost)
+	store.CreateUser(context.Background(), models.User{Login: "bob", Password: string(legacy)})
+	if code := post("/api/user/login", "bob", "wrong-password"); code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for a wrong password, got %d", http.StatusUnauthorized, code)
+	}
+	if storedHash("bob") != string(legacy) {
+		t.Error("Expected the hash to be kept after a failed login")
+	}
+	if code := post("/api/user/login", "bob", "bob-legacy-pass"); code != http.StatusOK {
+		t.Fatalf("Expected status %d for a bcrypt hash, got %d", http.StatusOK, code)
+	}
+	if hash := storedHash("bob"); !strings.HasPrefix(hash, "$argon2id$") {
+		t.Errorf("Expected the bcrypt hash to be replaced, got %s", hash)
+	}
+
+	// Changed parameters are applied on the next login
+	cheaper, _ := auth.NewArgon2idHasher(auth.Argon2idParams{Memory: 1024, Time: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32})
+	auth.SetPasswordHasher(cheaper)
+	t.Cleanup(func() {
+		defaultHasher, _ := auth.NewArgon2idHasher(auth.DefaultArgon2idParams)
+		auth.SetPasswordHasher(defaultHasher)
+	})
+	if code := post("/api/user/login", "bob", "bob-legacy-pass"); code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, code)
+	}
+	if hash := storedHash("bob"); !strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Errorf("Expected a rehash with the new parameters, got %s", hash)
+	}
+	if code := post("/api/user/login", "bob", "bob-legacy-pass"); code != http.StatusOK {
+		t.Errorf("Expected status %d after the rehash, got %d", http.StatusOK, code)
+	}
+}
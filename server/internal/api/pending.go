@@ -0,0 +1,161 @@
+package api
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// pendingLoginsSize bounds how many logins of one kind are pending, so that unauthenticated
+// requests cannot grow them without limit.
+const pendingLoginsSize = 10000
+
+// pendingLogins holds logins that span several requests, such as browser sign-ins and
+// SRP handshakes, by a random key. They are kept in memory, so every request of a login
+// must reach the server instance that started it. At most maxEntries logins are kept.
+type pendingLogins[T any] struct {
+	ttl        time.Duration
+	maxEntries int
+
+	mu      sync.Mutex
+	pending map[string]pendingLogin[T]
+	// owners counts the pending logins of each owner
+	owners map[string]int
+}
+
+type pendingLogin[T any] struct {
+	value     T
+	expiresAt time.Time
+	owners    []string
+}
+
+// pendingOwner is someone the pending logins are counted for, such as a login or a client
+// address, with the number of logins it may have pending.
+type pendingOwner struct {
+	key   string
+	limit int
+}
+
+func newPendingLogins[T any](ttl time.Duration) *pendingLogins[T] {
+	return &pendingLogins[T]{
+		ttl:        ttl,
+		maxEntries: pendingLoginsSize,
+		pending:    make(map[string]pendingLogin[T]),
+		owners:     make(map[string]int),
+	}
+}
+
+// allows reports whether none of the owners has its limit of pending logins.
+func (l *pendingLogins[T]) allows(owners ...pendingOwner) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.allowsLocked(owners)
+}
+
+func (l *pendingLogins[T]) allowsLocked(owners []pendingOwner) bool {
+	for _, owner := range owners {
+		if l.owners[owner.key] >= owner.limit {
+			return false
+		}
+	}
+	return true
+}
+
+// add stores a login until it is taken or expires. It reports false, without storing
+// the login, if one of the owners already has its limit of pending logins. If the logins
+// are full, expired ones are dropped first and then the one closest to expiry.
+func (l *pendingLogins[T]) add(key string, value T, owners ...pendingOwner) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.allowsLocked(owners) {
+		return false
+	}
+
+	now := time.Now()
+	if len(l.pending) >= l.maxEntries {
+		l.dropExpired(now)
+		if len(l.pending) >= l.maxEntries {
+			oldestKey := ""
+			var oldest time.Time
+			for k, login := range l.pending {
+				if oldestKey == "" || login.expiresAt.Before(oldest) {
+					oldestKey, oldest = k, login.expiresAt
+				}
+			}
+			l.remove(oldestKey)
+		}
+	}
+
+	login := pendingLogin[T]{value: value, expiresAt: now.Add(l.ttl)}
+	for _, owner := range owners {
+		login.owners = append(login.owners, owner.key)
+		l.owners[owner.key]++
+	}
+	l.pending[key] = login
+	return true
+}
+
+// take removes a login and returns it unless it has expired.
+func (l *pendingLogins[T]) take(key string) (T, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	login, ok := l.pending[key]
+	l.remove(key)
+	if !ok || time.Now().After(login.expiresAt) {
+		var zero T
+		return zero, false
+	}
+	return login.value, true
+}
+
+// remove deletes a login and its counts. l.mu must be held.
+func (l *pendingLogins[T]) remove(key string) {
+	login, ok := l.pending[key]
+	if !ok {
+		return
+	}
+	delete(l.pending, key)
+	for _, owner := range login.owners {
+		if l.owners[owner]--; l.owners[owner] <= 0 {
+			delete(l.owners, owner)
+		}
+	}
+}
+
+// dropExpired removes the logins that expired before now. l.mu must be held.
+func (l *pendingLogins[T]) dropExpired(now time.Time) {
+	for key, login := range l.pending {
+		if now.After(login.expiresAt) {
+			l.remove(key)
+		}
+	}
+}
+
+// cleanup removes expired logins. A nil pendingLogins has none.
+func (l *pendingLogins[T]) cleanup() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.dropExpired(time.Now())
+}
+
+// Run removes expired pending logins every interval until ctx is done.
+func (a *API) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.srpLogins.cleanup()
+			a.oidcLogins.cleanup()
+			a.oidcLinks.cleanup()
+		}
+	}
+}
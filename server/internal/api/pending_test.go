@@ -0,0 +1,50 @@
+package api
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// TestPendingLogins tests the bounds of pending logins
+func TestPendingLogins(t *testing.T) {
+	logins := newPendingLogins[int](time.Minute)
+	logins.maxEntries = 3
+
+	// Owners have a limit of pending logins, which taking a login frees
+	alice := pendingOwner{key: "login:alice", limit: 2}
+	if !logins.add("a1", 1, alice) || !logins.add("a2", 2, alice) {
+		t.Fatal("Expected the logins within the limit to be added")
+	}
+	if logins.allows(alice) || logins.add("a3", 3, alice) {
+		t.Error("Expected a login beyond the limit to be rejected")
+	}
+	if value, ok := logins.take("a1"); !ok || value != 1 {
+		t.Errorf("Expected login 1, got %d, %v", value, ok)
+	}
+	if !logins.add("a3", 3, alice) {
+		t.Error("Expected a login to be added after one was taken")
+	}
+
+	// When full, the login closest to expiry makes room
+	for i := range 3 {
+		logins.add(fmt.Sprintf("b%d", i), 10+i)
+	}
+	if len(logins.pending) != 3 {
+		t.Errorf("Expected 3 pending logins, got %d", len(logins.pending))
+	}
+	if _, ok := logins.take("a2"); ok {
+		t.Error("Expected the oldest login to be dropped")
+	}
+	if logins.owners[alice.key] != 0 {
+		t.Errorf("Expected the dropped logins not to count, got %d", logins.owners[alice.key])
+	}
+
+	// Expired logins are removed by cleanup
+	logins.ttl = -time.Second
+	logins.add("expired", 0, alice)
+	logins.cleanup()
+	if _, ok := logins.pending["expired"]; ok || logins.owners[alice.key] != 0 {
+		t.Error("Expected the expired login to be removed")
+	}
+}
@@ -0,0 +1,224 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"gophkeeper/server/internal/apierror"
+	"gophkeeper/server/internal/auth"
+	"gophkeeper/server/internal/models"
+	"gophkeeper/server/internal/storage"
+	"log"
+	"net/http"
+	"time"
+)
+
+// recentLoginWindow is how long after a login the session may regenerate recovery codes.
+const recentLoginWindow = 10 * time.Minute
+
+// RegisterResponse is returned on registration. The account recovery codes are shown only once.
+type RegisterResponse struct {
+	models.User
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+}
+
+// RecoverRequest is the body of POST /api/user/recover. It sets either a new password
+// or a new SRP verifier.
+type RecoverRequest struct {
+	Login        string `json:"login"`
+	RecoveryCode string `json:"recovery_code"`
+	Password     string `json:"password,omitempty"`
+	// Salt, Verifier and Params switch the account to SRP with a new password
+	Salt     []byte         `json:"salt,omitempty"`
+	Verifier []byte         `json:"verifier,omitempty"`
+	Params   auth.SRPParams `json:"params"`
+}
+
+// RecoveryCodesStatus is the response of GET /api/user/recovery-codes.
+type RecoveryCodesStatus struct {
+	Remaining int `json:"remaining"`
+}
+
+// respondRegistered completes a registration with new account recovery codes. The user
+// exists at this point, so a failure to store the codes is only logged; the user can
+// regenerate them after logging in.
+func (a *API) respondRegistered(w http.ResponseWriter, r *http.Request, user models.User) {
+	codes, err := a.issueRecoveryCodes(r.Context(), user.ID)
+	if err != nil {
+		log.Printf("Failed to issue recovery codes for user %d: %v", user.ID, err)
+	}
+
+	user.Password = ""
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(RegisterResponse{User: user, RecoveryCodes: codes})
+}
+
+// issueRecoveryCodes replaces the account recovery codes of a user and returns the new codes.
+func (a *API) issueRecoveryCodes(ctx context.Context, userID int) ([]string, error) {
+	codes, hashes, err := auth.GenerateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := a.store.SetAccountRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Recover resets the password of a user with an account recovery code and ends all
+// sessions of the user. Codes are single-use and wrong codes are throttled like logins.
+func (a *API) Recover(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req RecoverRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Login == "" || req.RecoveryCode == "" {
+		apierror.Write(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the new credentials first, so that a rejected password does not spend the code
+	var password string
+	switch {
+	case req.Password != "" && req.Verifier == nil:
+		if err := a.passwordPolicy.Check(req.Login, req.Password); err != nil {
+			apierror.WriteCode(w, err.Error(), http.StatusBadRequest, apierror.CodeWeakPassword, nil)
+			return
+		}
+	case req.Password == "" && req.Verifier != nil:
+		verifier := auth.SRPVerifier{Params: req.Params, Salt: req.Salt, Verifier: req.Verifier}
+		if err := verifier.Validate(); err != nil {
+			apierror.Write(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		password = verifier.Encode()
+	default:
+		apierror.Write(w, "Either a password or an SRP verifier is required", http.StatusBadRequest)
+		return
+	}
+
+	if !a.checkLoginThrottle(w, r, req.Login) {
+		return
+	}
+
+	user, err := a.store.GetUserByLogin(ctx, req.Login)
+	var userNotFoundErr storage.ErrUserNotFound
+	if err != nil && !errors.As(err, &userNotFoundErr) {
+		apierror.Write(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	used := false
+	if err == nil {
+		if used, err = a.store.UseAccountRecoveryCode(ctx, user.ID, auth.HashRecoveryCode(req.RecoveryCode)); err != nil {
+			apierror.Write(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+	}
+	if !used {
+		a.loginFailed(ctx, req.Login, clientIP(r))
+		apierror.WriteCode(w, "Invalid login or recovery code", http.StatusUnauthorized, apierror.CodeInvalidCode, nil)
+		return
+	}
+
+	if password == "" {
+		if password, err = auth.HashPassword(req.Password); err != nil {
+			apierror.Write(w, "Failed to hash password", http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := a.store.SetUserPassword(ctx, user.ID, password); err != nil {
+		apierror.Write(w, "Failed to reset password", http.StatusInternalServerError)
+		return
+	}
+	a.loginSucceeded(ctx, req.Login)
+	log.Printf("User %d reset the password with a recovery code", user.ID)
+
+	// Whoever knew the old password loses access, including through API tokens created
+	// with it
+	sessions, err := a.store.GetSessions(ctx, user.ID)
+	if err != nil {
+		apierror.Write(w, "Failed to end sessions", http.StatusInternalServerError)
+		return
+	}
+	for _, session := range sessions {
+		if err := a.endSession(ctx, user.ID, session.ID); err != nil {
+			apierror.Write(w, "Failed to end sessions", http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := a.revokeAPITokens(ctx, user.ID); err != nil {
+		apierror.Write(w, "Failed to revoke API tokens", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetRecoveryCodes returns the number of unused account recovery codes of the authenticated user.
+func (a *API) GetRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		apierror.Write(w, "User ID not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	remaining, err := a.store.CountAccountRecoveryCodes(ctx, userID)
+	if err != nil {
+		apierror.Write(w, "Failed to get recovery codes", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(RecoveryCodesStatus{Remaining: remaining})
+}
+
+// RegenerateRecoveryCodes replaces the account recovery codes of the authenticated user.
+// A recovery code resets the password, so only sessions that logged in within
+// recentLoginWindow may do this: a stolen access token of an older session is not enough.
+func (a *API) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	claims, ok := auth.GetClaimsFromContext(ctx)
+	if !ok {
+		apierror.Write(w, "User ID not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	recent, err := a.isRecentLogin(ctx, claims)
+	if err != nil {
+		apierror.Write(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	if !recent {
+		apierror.WriteCode(w, "Log in again to regenerate recovery codes", http.StatusForbidden, apierror.CodeRecentLoginNeeded, nil)
+		return
+	}
+
+	codes, err := a.issueRecoveryCodes(ctx, claims.UserID)
+	if err != nil {
+		apierror.Write(w, "Failed to generate recovery codes", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// isRecentLogin reports whether the session of the claims started within recentLoginWindow.
+func (a *API) isRecentLogin(ctx context.Context, claims *auth.Claims) (bool, error) {
+	if claims.SessionID == "" {
+		return false, nil
+	}
+	sessions, err := a.store.GetSessions(ctx, claims.UserID)
+	if err != nil {
+		return false, err
+	}
+	for _, session := range sessions {
+		if session.ID == claims.SessionID {
+			return time.Since(session.CreatedAt) < recentLoginWindow, nil
+		}
+	}
+	return false, nil
+}
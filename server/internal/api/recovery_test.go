@@ -0,0 +1,132 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"gophkeeper/server/internal/auth"
+	"gophkeeper/server/internal/models"
+	"gophkeeper/server/internal/storage"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestAccountRecovery tests recovery codes issued at registration, password reset and regeneration
+func TestAccountRecovery(t *testing.T) {
+	store := storage.NewMemStore()
+	jwtManager := auth.NewJWTManager("test-secret")
+	jwtManager.SetRevocationList(auth.NewRevocationList(store))
+	api := New(store, jwtManager)
+	jwtManager.SetAPITokenAuth(api.ResolveAPIToken)
+	router := NewRouter(api, jwtManager)
+
+	do := func(method, path, token string, body any) *httptest.ResponseRecorder {
+		payload, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, path, bytes.NewReader(payload))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+	login := func(password string) (TokenResponse, int) {
+		var tokens TokenResponse
+		resp := do(http.MethodPost, "/api/user/login", "", models.User{Login: "alice", Password: password})
+		json.NewDecoder(resp.Body).Decode(&tokens)
+		return tokens, resp.Code
+	}
+	remaining := func(token string) int {
+		var status RecoveryCodesStatus
+		json.NewDecoder(do(http.MethodGet, "/api/user/recovery-codes", token, nil).Body).Decode(&status)
+		return status.Remaining
+	}
+
+	// Registration returns the codes once, but not the password hash
+	resp := do(http.MethodPost, "/api/user/register", "", RegisterRequest{Login: "alice", Password: "old-password"})
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d", http.StatusCreated, resp.Code)
+	}
+	var registered RegisterResponse
+	json.NewDecoder(resp.Body).Decode(&registered)
+	if len(registered.RecoveryCodes) != auth.RecoveryCodeCount || registered.Password != "" {
+		t.Fatalf("Expected %d recovery codes and no password, got %+v", auth.RecoveryCodeCount, registered)
+	}
+	codes := registered.RecoveryCodes
+
+	session, _ := login("old-password")
+	if n := remaining(session.Token); n != auth.RecoveryCodeCount {
+		t.Errorf("Expected %d remaining codes, got %d", auth.RecoveryCodeCount, n)
+	}
+
+	// Rejected requests do not spend the code
+	if resp := do(http.MethodPost, "/api/user/recover", "", RecoverRequest{Login: "alice", RecoveryCode: "wrong-code", Password: "new-password"}); resp.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for a wrong code, got %d", http.StatusUnauthorized, resp.Code)
+	}
+	if resp := do(http.MethodPost, "/api/user/recover", "", RecoverRequest{Login: "nobody", RecoveryCode: codes[0], Password: "new-password"}); resp.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for an unknown login, got %d", http.StatusUnauthorized, resp.Code)
+	}
+	if resp := do(http.MethodPost, "/api/user/recover", "", RecoverRequest{Login: "alice", RecoveryCode: codes[0], Password: "short"}); resp.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for a weak password, got %d", http.StatusBadRequest, resp.Code)
+	}
+
+	var apiToken CreateAPITokenResponse
+	json.NewDecoder(do(http.MethodPost, "/api/tokens", session.Token, CreateAPITokenRequest{Name: "ci"}).Body).Decode(&apiToken)
+	if resp := do(http.MethodGet, "/api/secrets", apiToken.Token, nil); resp.Code != http.StatusOK {
+		t.Fatalf("Expected status %d for an API token, got %d: %s", http.StatusOK, resp.Code, resp.Body)
+	}
+
+	// Codes are typed loosely and reset the password once
+	if resp := do(http.MethodPost, "/api/user/recover", "", RecoverRequest{Login: "alice", RecoveryCode: " " + codes[0] + " ", Password: "new-password"}); resp.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d for recovery, got %d: %s", http.StatusNoContent, resp.Code, resp.Body)
+	}
+	if resp := do(http.MethodPost, "/api/user/recover", "", RecoverRequest{Login: "alice", RecoveryCode: codes[0], Password: "other-password"}); resp.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for a used code, got %d", http.StatusUnauthorized, resp.Code)
+	}
+	if _, code := login("old-password"); code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for the old password, got %d", http.StatusUnauthorized, code)
+	}
+	if resp := do(http.MethodGet, "/api/user/recovery-codes", session.Token, nil); resp.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for a session started before recovery, got %d", http.StatusUnauthorized, resp.Code)
+	}
+	if resp := do(http.MethodGet, "/api/secrets", apiToken.Token, nil); resp.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for an API token created before recovery, got %d", http.StatusUnauthorized, resp.Code)
+	}
+	session, code := login("new-password")
+	if code != http.StatusOK {
+		t.Fatalf("Expected status %d for the new password, got %d", http.StatusOK, code)
+	}
+	if n := remaining(session.Token); n != auth.RecoveryCodeCount-1 {
+		t.Errorf("Expected %d remaining codes, got %d", auth.RecoveryCodeCount-1, n)
+	}
+
+	// Regeneration needs a recent login and invalidates the old codes
+	user, _ := store.GetUserByLogin(context.Background(), "alice")
+	store.CreateSession(context.Background(), models.Session{ID: "old", UserID: user.ID, CreatedAt: time.Now().Add(-time.Hour)})
+	oldToken, _ := jwtManager.GenerateSessionJWT(user.ID, "old")
+	if resp := do(http.MethodPost, "/api/user/recovery-codes", oldToken, nil); resp.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d for an old session, got %d", http.StatusForbidden, resp.Code)
+	}
+	resp = do(http.MethodPost, "/api/user/recovery-codes", session.Token, nil)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Expected status %d for regeneration, got %d", http.StatusOK, resp.Code)
+	}
+	var regenerated RecoveryCodesResponse
+	json.NewDecoder(resp.Body).Decode(&regenerated)
+	if resp := do(http.MethodPost, "/api/user/recover", "", RecoverRequest{Login: "alice", RecoveryCode: codes[1], Password: "other-password"}); resp.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for a replaced code, got %d", http.StatusUnauthorized, resp.Code)
+	}
+
+	// Recovery can switch the account to SRP
+	verifier, _ := newTestSRPVerifier("alice", "srp-password", auth.MinSRPParams)
+	recovery := RecoverRequest{Login: "alice", RecoveryCode: regenerated.RecoveryCodes[0], Salt: verifier.Salt, Verifier: verifier.Verifier, Params: verifier.Params}
+	if resp := do(http.MethodPost, "/api/user/recover", "", recovery); resp.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d for recovery with SRP, got %d: %s", http.StatusNoContent, resp.Code, resp.Body)
+	}
+	user, _ = store.GetUserByLogin(context.Background(), "alice")
+	if !auth.IsSRPVerifier(user.Password) {
+		t.Errorf("Expected an SRP verifier after recovery, got %s", user.Password)
+	}
+}
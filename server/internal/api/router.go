@@ -1,26 +1,117 @@
 package api
 
 import (
+	"gophkeeper/server/internal/apierror"
 	"gophkeeper/server/internal/auth"
+	"gophkeeper/server/internal/openapi"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 )
 
-// NewRouter creates a new router with the given API handlers and JWT manager.
+// NewRouter creates a new router with the given API handlers and JWT manager. It panics if
+// the embedded OpenAPI document is invalid, so that the server does not start without request
+// validation.
 func NewRouter(api *API, jwtManager *auth.JWTManager) http.Handler {
 	r := chi.NewRouter()
 
+	r.Use(middleware.RequestID)
+	r.Use(exposeRequestID)
 	r.Use(middleware.Logger)
 
+	// Requests to documented operations must match the OpenAPI document. Operations that
+	// require authentication are validated after it, so that anonymous clients cannot make
+	// the server read large bodies.
+	spec := openapi.MustLoad()
+	authenticated := chi.Chain(jwtManager.AuthMiddleware, spec.ValidateRequests)
+
+	r.Get("/.well-known/jwks.json", api.JWKS)
+	r.Get("/api/openapi.json", openapi.Handler)
+	r.With(spec.ValidateRequests).Get("/api/version", api.Version)
+
 	r.Route("/api/user", func(r chi.Router) {
-		r.Post("/register", api.Register)
-		r.Post("/login", api.Login)
+		r.Group(func(r chi.Router) {
+			r.Use(spec.ValidateRequests)
+
+			r.Post("/register", api.Register)
+			r.Post("/login", api.Login)
+			r.Post("/login/totp", api.LoginTOTP)
+			r.Post("/refresh", api.Refresh)
+			r.Post("/recover", api.Recover)
+			r.Get("/breached-passwords/{prefix}", api.BreachedPasswords)
+			r.Post("/srp/register", api.SRPRegister)
+			r.Post("/srp/login", api.SRPLoginStart)
+			r.Post("/srp/login/verify", api.SRPLoginVerify)
+		})
+		r.With(authenticated...).Put("/srp", api.EnableSRP)
+		r.With(authenticated...).Post("/logout", api.Logout)
+		r.With(authenticated...).Post("/unlock", api.UnlockAccount)
+		r.With(authenticated...).Get("/recovery-codes", api.GetRecoveryCodes)
+		r.With(authenticated...).Post("/recovery-codes", api.RegenerateRecoveryCodes)
+		r.With(authenticated...).Get("/sessions", api.GetSessions)
+		r.With(authenticated...).Delete("/sessions/{id}", api.DeleteSession)
+		if len(api.externalAuthenticators()) > 0 {
+			r.With(authenticated...).Post("/ldap/link", api.LDAPLink)
+		}
+
+		if api.oidc != nil {
+			r.Route("/oidc", func(r chi.Router) {
+				r.Group(func(r chi.Router) {
+					r.Use(spec.ValidateRequests)
+
+					r.Get("/login", api.OIDCLogin)
+					r.Get("/callback", api.OIDCCallback)
+					r.Post("/token", api.OIDCToken)
+					r.Post("/device", api.OIDCDevice)
+					r.Post("/device/token", api.OIDCDeviceToken)
+				})
+				r.With(authenticated...).Post("/link", api.OIDCLink)
+			})
+		}
+
+		r.Route("/totp", func(r chi.Router) {
+			r.Use(authenticated...)
+			r.Use(api.RequireUnsealed)
+
+			r.Post("/", api.EnrollTOTP)
+			r.Post("/confirm", api.ConfirmTOTP)
+			r.Delete("/", api.DisableTOTP)
+		})
+	})
+
+	if api.seal != nil {
+		r.Route("/api/sys", func(r chi.Router) {
+			r.Use(spec.ValidateRequests)
+
+			r.Get("/seal-status", api.SealStatus)
+			r.Post("/init", api.InitSeal)
+			r.Post("/unseal", api.Unseal)
+		})
+	}
+
+	r.Route("/api/tokens", func(r chi.Router) {
+		r.Use(authenticated...)
+
+		r.Post("/", api.CreateAPIToken)
+		r.Get("/", api.GetAPITokens)
+		r.Delete("/{id}", api.DeleteAPIToken)
+	})
+
+	r.Route("/api/invites", func(r chi.Router) {
+		r.Use(authenticated...)
+		r.Use(api.RequireInviteIssuer)
+
+		r.Post("/", api.CreateInvite)
+		r.Get("/", api.GetInvites)
+		r.Delete("/{id}", api.DeleteInvite)
 	})
 
 	r.Route("/api/secrets", func(r chi.Router) {
-		r.Use(jwtManager.AuthMiddleware)
+		r.Use(jwtManager.APITokenMiddleware)
+		r.Use(spec.ValidateRequests)
+		r.Use(api.RequireWriteScope)
+		r.Use(api.RequireUnsealed)
 
 		r.Post("/", api.CreateSecret)
 		r.Get("/", api.GetSecrets)
@@ -29,5 +120,28 @@ func NewRouter(api *API, jwtManager *auth.JWTManager) http.Handler {
 		r.Delete("/{id}", api.DeleteSecret)
 	})
 
+	// API v2 shares the storage of /api/secrets with typed payloads and revisions
+	r.Route("/api/v2/secrets", func(r chi.Router) {
+		r.Use(jwtManager.APITokenMiddleware)
+		r.Use(spec.ValidateRequests)
+		r.Use(api.RequireWriteScope)
+		r.Use(api.RequireUnsealed)
+
+		r.Post("/", api.CreateSecretV2)
+		r.Get("/", api.GetSecretsV2)
+		r.Get("/{id}", api.GetSecretByIDV2)
+		r.Put("/{id}", api.UpdateSecretV2)
+		r.Delete("/{id}", api.DeleteSecret)
+	})
+
 	return r
 }
+
+// exposeRequestID returns the ID of every request in apierror.RequestIDHeader, which
+// error responses repeat in their body.
+func exposeRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(apierror.RequestIDHeader, middleware.GetReqID(r.Context()))
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,144 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gophkeeper/server/internal/apierror"
+	"gophkeeper/server/internal/auth"
+	"gophkeeper/server/internal/models"
+	"gophkeeper/server/internal/storage"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// DeviceNameHeader carries the name of the device a client logs in from.
+const DeviceNameHeader = "X-Device-Name"
+
+// maxSessionFieldLength bounds the client-supplied session fields.
+const maxSessionFieldLength = 255
+
+// GetSessions returns the login sessions of the authenticated user.
+// The session of the request is marked as current.
+func (a *API) GetSessions(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	claims, ok := auth.GetClaimsFromContext(ctx)
+	if !ok {
+		apierror.Write(w, "Token claims not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	sessions, err := a.store.GetSessions(ctx, claims.UserID)
+	if err != nil {
+		apierror.Write(w, "Failed to get sessions", http.StatusInternalServerError)
+		return
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == claims.SessionID
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sessions)
+}
+
+// DeleteSession revokes a login session of the authenticated user: its refresh tokens
+// are deleted and its access tokens are rejected from now on.
+func (a *API) DeleteSession(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		apierror.Write(w, "User ID not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	sessionID := chi.URLParam(r, "id")
+	if err := a.endSession(ctx, userID, sessionID); err != nil {
+		var notFoundErr storage.ErrSessionNotFound
+		if errors.As(err, &notFoundErr) {
+			apierror.Write(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		apierror.Write(w, "Failed to revoke session", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// startSession records a new login session for the client of the request.
+func (a *API) startSession(r *http.Request, userID int) (string, error) {
+	client := requestClient(r)
+	client.UserID = userID
+	return a.createSession(r.Context(), client)
+}
+
+// requestClient describes the client of a request as a session without IDs and times.
+func requestClient(r *http.Request) models.Session {
+	return models.Session{
+		DeviceName:    r.Header.Get(DeviceNameHeader),
+		ClientVersion: r.UserAgent(),
+		IP:            clientIP(r),
+	}
+}
+
+// createSession records a new login session. The ID and times of session are set here.
+func (a *API) createSession(ctx context.Context, session models.Session) (string, error) {
+	sessionID, err := auth.NewTokenFamilyID()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	session.ID = sessionID
+	session.DeviceName = truncate(session.DeviceName, maxSessionFieldLength)
+	session.ClientVersion = truncate(session.ClientVersion, maxSessionFieldLength)
+	session.CreatedAt = now
+	session.LastSeenAt = now
+	if err := a.store.CreateSession(ctx, session); err != nil {
+		return "", fmt.Errorf("failed to store session: %w", err)
+	}
+
+	return sessionID, nil
+}
+
+// touchSession records activity of a session from ip. Refresh tokens issued before
+// sessions were tracked have no session, which is not an error.
+func (a *API) touchSession(ctx context.Context, sessionID, ip string) error {
+	err := a.store.TouchSession(ctx, sessionID, ip, time.Now())
+	var notFoundErr storage.ErrSessionNotFound
+	if errors.As(err, &notFoundErr) {
+		return nil
+	}
+	return err
+}
+
+// endSession deletes a session with its refresh tokens and revokes its access tokens.
+func (a *API) endSession(ctx context.Context, userID int, sessionID string) error {
+	if err := a.store.DeleteSession(ctx, userID, sessionID); err != nil {
+		return err
+	}
+	return a.jwtManager.RevokeSession(ctx, sessionID)
+}
+
+// clientIP returns the IP address of the peer of the request.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
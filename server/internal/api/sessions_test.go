@@ -0,0 +1,108 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"gophkeeper/server/internal/auth"
+	"gophkeeper/server/internal/models"
+	"gophkeeper/server/internal/storage"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestSessions tests listing and revoking login sessions
+func TestSessions(t *testing.T) {
+	store := storage.NewMemStore()
+	jwtManager := auth.NewJWTManager("test-secret")
+	jwtManager.SetRevocationList(auth.NewRevocationList(store))
+	api := New(store, jwtManager)
+	router := NewRouter(api, jwtManager)
+
+	hashedPass, _ := auth.HashPassword("correctpass")
+	store.CreateUser(context.Background(), models.User{Login: "testuser", Password: hashedPass})
+	store.CreateUser(context.Background(), models.User{Login: "otheruser", Password: hashedPass})
+
+	do := func(method, path, token string, body any, header http.Header) *httptest.ResponseRecorder {
+		payload, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, path, bytes.NewReader(payload))
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+	login := func(user, device string) TokenResponse {
+		header := http.Header{}
+		header.Set(DeviceNameHeader, device)
+		header.Set("User-Agent", "gophkeeper-cli/1.2.3")
+
+		var tokens TokenResponse
+		resp := do(http.MethodPost, "/api/user/login", "", models.User{Login: user, Password: "correctpass"}, header)
+		json.NewDecoder(resp.Body).Decode(&tokens)
+		return tokens
+	}
+	list := func(token string) []models.Session {
+		var sessions []models.Session
+		resp := do(http.MethodGet, "/api/user/sessions", token, nil, nil)
+		if resp.Code != http.StatusOK {
+			t.Fatalf("Expected status %d for session list, got %d", http.StatusOK, resp.Code)
+		}
+		json.NewDecoder(resp.Body).Decode(&sessions)
+		return sessions
+	}
+
+	laptop := login("testuser", "laptop")
+	phone := login("testuser", "phone")
+	other := login("otheruser", "desktop")
+
+	sessions := list(phone.Token)
+	if len(sessions) != 2 {
+		t.Fatalf("Expected 2 sessions, got %d", len(sessions))
+	}
+
+	var laptopID string
+	for _, session := range sessions {
+		if session.ClientVersion != "gophkeeper-cli/1.2.3" || session.IP != "192.0.2.1" {
+			t.Errorf("Unexpected session details: %+v", session)
+		}
+		if session.Current != (session.DeviceName == "phone") {
+			t.Errorf("Expected only the phone session to be current, got %+v", session)
+		}
+		if session.DeviceName == "laptop" {
+			laptopID = session.ID
+		}
+	}
+
+	// Sessions of other users cannot be revoked
+	if resp := do(http.MethodDelete, "/api/user/sessions/"+laptopID, other.Token, nil, nil); resp.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for another user's session, got %d", http.StatusNotFound, resp.Code)
+	}
+
+	if resp := do(http.MethodDelete, "/api/user/sessions/"+laptopID, phone.Token, nil, nil); resp.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d, got %d", http.StatusNoContent, resp.Code)
+	}
+
+	// Both the access token and the refresh token of the revoked session stop working
+	if resp := do(http.MethodGet, "/api/secrets", laptop.Token, nil, nil); resp.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for a revoked session, got %d", http.StatusUnauthorized, resp.Code)
+	}
+	if resp := do(http.MethodPost, "/api/user/refresh", "", RefreshRequest{RefreshToken: laptop.RefreshToken}, nil); resp.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for a refresh token of a revoked session, got %d", http.StatusUnauthorized, resp.Code)
+	}
+	if resp := do(http.MethodGet, "/api/secrets", phone.Token, nil, nil); resp.Code != http.StatusOK {
+		t.Errorf("Expected status %d for the remaining session, got %d", http.StatusOK, resp.Code)
+	}
+
+	if sessions := list(phone.Token); len(sessions) != 1 || sessions[0].DeviceName != "phone" {
+		t.Errorf("Expected only the phone session to remain, got %+v", sessions)
+	}
+	if resp := do(http.MethodDelete, "/api/user/sessions/"+laptopID, phone.Token, nil, nil); resp.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for a revoked session, got %d", http.StatusNotFound, resp.Code)
+	}
+}
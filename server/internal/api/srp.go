@@ -0,0 +1,284 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"gophkeeper/server/internal/apierror"
+	"gophkeeper/server/internal/auth"
+	"gophkeeper/server/internal/models"
+	"gophkeeper/server/internal/storage"
+	"net/http"
+	"time"
+)
+
+// srpLoginTTL is the time between the two requests of an SRP login.
+const srpLoginTTL = time.Minute
+
+// srpKeyID is the name the key of fake SRP salts is stored under with the key salts.
+// Key IDs of encryption keys cannot contain a colon.
+const srpKeyID = "srp:fake-salts"
+
+// srpStartsPerLogin and srpStartsPerIP bound the unfinished SRP logins of one login and of
+// one client address. Every start costs the server a modular exponentiation.
+const (
+	srpStartsPerLogin = 5
+	srpStartsPerIP    = 50
+)
+
+// SRPServerProofHeader carries the proof M2 of the server, in base64, on a successful SRP login.
+const SRPServerProofHeader = "X-SRP-Server-Proof"
+
+// SRPRegisterRequest is the body of POST /api/user/srp/register.
+type SRPRegisterRequest struct {
+	Login    string         `json:"login"`
+	Salt     []byte         `json:"salt"`
+	Verifier []byte         `json:"verifier"`
+	Params   auth.SRPParams `json:"params"`
+	// Invite is the invite code required in invite-only registration mode
+	Invite string `json:"invite,omitempty"`
+}
+
+// SRPEnableRequest is the body of PUT /api/user/srp, which replaces the password hash of
+// the user with an SRP verifier. The current password proves that the caller owns the account,
+// and the login must be the one the verifier was computed with.
+type SRPEnableRequest struct {
+	Login    string         `json:"login"`
+	Password string         `json:"password"`
+	Salt     []byte         `json:"salt"`
+	Verifier []byte         `json:"verifier"`
+	Params   auth.SRPParams `json:"params"`
+}
+
+// SRPStartRequest is the body of POST /api/user/srp/login.
+type SRPStartRequest struct {
+	Login string `json:"login"`
+	// ClientPublic is the ephemeral public key A of the client
+	ClientPublic []byte `json:"a"`
+}
+
+// SRPStartResponse is the response of POST /api/user/srp/login.
+type SRPStartResponse struct {
+	Session string         `json:"session"`
+	Salt    []byte         `json:"salt"`
+	Params  auth.SRPParams `json:"params"`
+	// ServerPublic is the ephemeral public key B of the server
+	ServerPublic []byte `json:"b"`
+}
+
+// SRPVerifyRequest is the body of POST /api/user/srp/login/verify.
+type SRPVerifyRequest struct {
+	Session string `json:"session"`
+	// Proof is the proof M1 of the client that it knows the password
+	Proof []byte `json:"proof"`
+}
+
+// srpLogin is an SRP login between its two requests.
+type srpLogin struct {
+	session *auth.SRPSession
+	user    models.User
+	// known is false for logins without a user, which always fail
+	known bool
+}
+
+// SRPRegister registers a user with an SRP verifier, so that the server never sees the password.
+func (a *API) SRPRegister(w http.ResponseWriter, r *http.Request) {
+	var req SRPRegisterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Login == "" {
+		apierror.Write(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	verifier := auth.SRPVerifier{Params: req.Params, Salt: req.Salt, Verifier: req.Verifier}
+	if err := verifier.Validate(); err != nil {
+		apierror.Write(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !a.checkRegistration(w, req.Invite) {
+		return
+	}
+
+	createdUser, err := a.registerUser(r.Context(), models.User{Login: req.Login, Password: verifier.Encode()}, req.Invite)
+	if err != nil {
+		writeRegistrationError(w, err)
+		return
+	}
+
+	a.respondRegistered(w, r, createdUser)
+}
+
+// EnableSRP switches the authenticated user from a password hash to an SRP verifier.
+// Afterwards the account only accepts SRP logins.
+func (a *API) EnableSRP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		apierror.Write(w, "User ID not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	var req SRPEnableRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	user, err := a.store.GetUserByID(ctx, userID)
+	if err != nil {
+		apierror.Write(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	// The password is checked like at login, so a stolen access token cannot be used to
+	// guess it faster than logins can
+	if !a.checkLoginThrottle(w, r, user.Login) {
+		return
+	}
+	if !auth.CheckPasswordHash(req.Password, user.Password) {
+		a.loginFailed(ctx, user.Login, clientIP(r))
+		apierror.Write(w, "Invalid password", http.StatusForbidden)
+		return
+	}
+	a.loginSucceeded(ctx, user.Login)
+
+	if req.Login != user.Login {
+		apierror.Write(w, "Login does not match the account", http.StatusBadRequest)
+		return
+	}
+	verifier := auth.SRPVerifier{Params: req.Params, Salt: req.Salt, Verifier: req.Verifier}
+	if err := verifier.Validate(); err != nil {
+		apierror.Write(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := a.store.SetUserPassword(ctx, userID, verifier.Encode()); err != nil {
+		apierror.Write(w, "Failed to store verifier", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// errSRPStartsThrottled rejects SRP logins started faster than they are finished.
+var errSRPStartsThrottled = &requestError{Status: http.StatusTooManyRequests, Code: apierror.CodeLoginThrottled, Message: "Too many unfinished logins", RetryAfter: srpLoginTTL}
+
+// SRPLoginStart begins an SRP login. Unknown logins and accounts with a password hash get
+// a consistent fake salt, so they cannot be told apart from wrong passwords. Accounts with
+// a password hash log in with POST /api/user/login.
+func (a *API) SRPLoginStart(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req SRPStartRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Login == "" {
+		apierror.Write(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if !a.checkLoginThrottle(w, r, req.Login) {
+		return
+	}
+	owners := []pendingOwner{
+		{key: "login:" + req.Login, limit: srpStartsPerLogin},
+		{key: "ip:" + clientIP(r), limit: srpStartsPerIP},
+	}
+	if !a.srpLogins.allows(owners...) {
+		writeRequestError(w, errSRPStartsThrottled)
+		return
+	}
+
+	login := srpLogin{}
+	var verifier auth.SRPVerifier
+	user, err := a.store.GetUserByLogin(ctx, req.Login)
+	var userNotFoundErr storage.ErrUserNotFound
+	switch {
+	case errors.As(err, &userNotFoundErr) || err == nil && !auth.IsSRPVerifier(user.Password):
+		// Accounts that log in with a password look like unknown logins, so that the
+		// response does not tell which logins exist; they switch with PUT /api/user/srp
+		key, err := a.fakeSRPKey(ctx)
+		if err != nil {
+			apierror.Write(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		verifier = auth.FakeSRPVerifier(key, req.Login)
+	case err != nil:
+		apierror.Write(w, "Server error", http.StatusInternalServerError)
+		return
+	default:
+		if verifier, err = auth.ParseSRPVerifier(user.Password); err != nil {
+			apierror.Write(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		login.user, login.known = user, true
+	}
+
+	login.session, err = auth.NewSRPSession(req.Login, verifier, req.ClientPublic)
+	if err != nil {
+		apierror.Write(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sessionID := rand.Text()
+	if !a.srpLogins.add(sessionID, login, owners...) {
+		writeRequestError(w, errSRPStartsThrottled)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SRPStartResponse{
+		Session:      sessionID,
+		Salt:         verifier.Salt,
+		Params:       verifier.Params,
+		ServerPublic: login.session.ServerPublic(),
+	})
+}
+
+// SRPLoginVerify checks the proof of the client. On success the server proof is sent
+// in SRPServerProofHeader and the login completes like a password login.
+func (a *API) SRPLoginVerify(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req SRPVerifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	login, ok := a.srpLogins.take(req.Session)
+	if !ok {
+		apierror.Write(w, "Unknown or expired login", http.StatusUnauthorized)
+		return
+	}
+
+	serverProof, err := login.session.Verify(req.Proof)
+	if err != nil || !login.known {
+		a.loginFailed(ctx, login.session.Login(), clientIP(r))
+		apierror.WriteCode(w, "Invalid credentials", http.StatusUnauthorized, apierror.CodeInvalidCredentials, nil)
+		return
+	}
+
+	w.Header().Set(SRPServerProofHeader, base64.StdEncoding.EncodeToString(serverProof))
+	a.completeLogin(w, r, login.user)
+}
+
+// fakeSRPKey returns the key of fake SRP salts, creating it in the store if no server
+// instance has done so yet.
+func (a *API) fakeSRPKey(ctx context.Context) ([]byte, error) {
+	a.srpKeyMu.Lock()
+	defer a.srpKeyMu.Unlock()
+
+	if a.srpKey != nil {
+		return a.srpKey, nil
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	key, err := a.store.CreateKeySalt(ctx, srpKeyID, key)
+	if err != nil {
+		return nil, err
+	}
+	a.srpKey = key
+	return key, nil
+}
@@ -0,0 +1,274 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"gophkeeper/server/internal/auth"
+	"gophkeeper/server/internal/models"
+	"gophkeeper/server/internal/storage"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// TestSRP tests registration and login with SRP, where the password never reaches the server
+func TestSRP(t *testing.T) {
+	store := storage.NewMemStore()
+	jwtManager := auth.NewJWTManager("test-secret")
+	jwtManager.SetRevocationList(auth.NewRevocationList(store))
+	api := New(store, jwtManager)
+	router := NewRouter(api, jwtManager)
+
+	do := func(method, path, token string, body any) *httptest.ResponseRecorder {
+		payload, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, path, bytes.NewReader(payload))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+	start := func(client *testSRPClient, login string) (*httptest.ResponseRecorder, SRPStartResponse) {
+		resp := do(http.MethodPost, "/api/user/srp/login", "", SRPStartRequest{Login: login, ClientPublic: client.ClientPublic()})
+		var started SRPStartResponse
+		json.NewDecoder(bytes.NewReader(resp.Body.Bytes())).Decode(&started)
+		return resp, started
+	}
+	srpLogin := func(login, password string) *httptest.ResponseRecorder {
+		client, _ := newTestSRPClient(login, password)
+		resp, started := start(client, login)
+		if resp.Code != http.StatusOK {
+			return resp
+		}
+		proof, err := client.Proof(started.Salt, started.Params, started.ServerPublic)
+		if err != nil {
+			t.Fatalf("Failed to compute proof: %v", err)
+		}
+		resp = do(http.MethodPost, "/api/user/srp/login/verify", "", SRPVerifyRequest{Session: started.Session, Proof: proof})
+		if resp.Code == http.StatusOK {
+			serverProof, _ := base64.StdEncoding.DecodeString(resp.Header().Get(SRPServerProofHeader))
+			if !client.VerifyServer(serverProof) {
+				t.Error("Expected a valid server proof")
+			}
+		}
+		return resp
+	}
+
+	// Registration stores only the verifier
+	weak, _ := newTestSRPVerifier("alice", "alice-password", auth.SRPParams{Memory: 1024, Time: 1, Parallelism: 1})
+	if resp := do(http.MethodPost, "/api/user/srp/register", "", SRPRegisterRequest{Login: "alice", Salt: weak.Salt, Verifier: weak.Verifier, Params: weak.Params}); resp.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for weak parameters, got %d", http.StatusBadRequest, resp.Code)
+	}
+	verifier, _ := newTestSRPVerifier("alice", "alice-password", auth.MinSRPParams)
+	if resp := do(http.MethodPost, "/api/user/srp/register", "", SRPRegisterRequest{Login: "alice", Salt: verifier.Salt, Verifier: verifier.Verifier, Params: verifier.Params}); resp.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, resp.Code, resp.Body)
+	}
+	alice, _ := store.GetUserByLogin(context.Background(), "alice")
+	if !strings.HasPrefix(alice.Password, "$srp6a-argon2id$m=19456,t=2,p=1$") {
+		t.Errorf("Expected an SRP verifier, got %s", alice.Password)
+	}
+
+	resp := srpLogin("alice", "alice-password")
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Expected status %d for SRP login, got %d: %s", http.StatusOK, resp.Code, resp.Body)
+	}
+	var tokens TokenResponse
+	json.NewDecoder(resp.Body).Decode(&tokens)
+	if userID, err := jwtManager.ValidateJWT(tokens.Token); err != nil || userID != alice.ID {
+		t.Errorf("Expected a token of user %d, got %d, %v", alice.ID, userID, err)
+	}
+
+	if resp := srpLogin("alice", "wrong-password"); resp.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for a wrong password, got %d", http.StatusUnauthorized, resp.Code)
+	}
+	if resp := do(http.MethodPost, "/api/user/login", "", models.User{Login: "alice", Password: "alice-password"}); resp.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for a plaintext login to an SRP account, got %d", http.StatusUnauthorized, resp.Code)
+	}
+
+	// A session is used once, and the public key of the client must be valid
+	client, _ := newTestSRPClient("alice", "alice-password")
+	_, started := start(client, "alice")
+	proof, _ := client.Proof(started.Salt, started.Params, started.ServerPublic)
+	do(http.MethodPost, "/api/user/srp/login/verify", "", SRPVerifyRequest{Session: started.Session, Proof: proof})
+	if resp := do(http.MethodPost, "/api/user/srp/login/verify", "", SRPVerifyRequest{Session: started.Session, Proof: proof}); resp.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for a reused session, got %d", http.StatusUnauthorized, resp.Code)
+	}
+	if resp := do(http.MethodPost, "/api/user/srp/login", "", SRPStartRequest{Login: "alice", ClientPublic: []byte{0}}); resp.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for A = 0, got %d", http.StatusBadRequest, resp.Code)
+	}
+
+	// Unknown logins look like existing ones
+	_, first := start(client, "nobody")
+	_, second := start(client, "nobody")
+	if !bytes.Equal(first.Salt, second.Salt) || len(first.Salt) == 0 {
+		t.Error("Expected a stable salt for an unknown login")
+	}
+	restarted := httptest.NewRecorder()
+	NewRouter(New(store, jwtManager), jwtManager).ServeHTTP(restarted, httptest.NewRequest(http.MethodPost, "/api/user/srp/login",
+		strings.NewReader(`{"login":"nobody","a":"`+base64.StdEncoding.EncodeToString(client.ClientPublic())+`"}`)))
+	var third SRPStartResponse
+	json.NewDecoder(restarted.Body).Decode(&third)
+	if !bytes.Equal(first.Salt, third.Salt) {
+		t.Error("Expected the salt of an unknown login to survive a restart")
+	}
+	if resp := srpLogin("nobody", "x"); resp.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for an unknown login, got %d", http.StatusUnauthorized, resp.Code)
+	}
+
+	// Password accounts switch to SRP with their current password
+	hash, _ := auth.HashPassword("bob-password")
+	bob, _ := store.CreateUser(context.Background(), models.User{Login: "bob", Password: hash})
+	client, _ = newTestSRPClient("bob", "bob-password")
+	_, first = start(client, "bob")
+	_, second = start(client, "bob")
+	if !bytes.Equal(first.Salt, second.Salt) || len(first.Salt) == 0 {
+		t.Error("Expected a password account to look like an unknown login")
+	}
+	if resp := srpLogin("bob", "bob-password"); resp.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d before SRP is enabled, got %d", http.StatusUnauthorized, resp.Code)
+	}
+	bobToken, _ := jwtManager.GenerateJWT(bob.ID)
+	bobVerifier, _ := newTestSRPVerifier("bob", "bob-password", auth.MinSRPParams)
+	enable := SRPEnableRequest{Password: "wrong", Salt: bobVerifier.Salt, Verifier: bobVerifier.Verifier, Params: bobVerifier.Params}
+	if resp := do(http.MethodPut, "/api/user/srp", bobToken, enable); resp.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d with a wrong password, got %d", http.StatusForbidden, resp.Code)
+	}
+	enable.Password = "bob-password"
+	if resp := do(http.MethodPut, "/api/user/srp", bobToken, enable); resp.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d without the login, got %d", http.StatusBadRequest, resp.Code)
+	}
+	enable.Login = "bob"
+	if resp := do(http.MethodPut, "/api/user/srp", bobToken, enable); resp.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusNoContent, resp.Code, resp.Body)
+	}
+	if resp := srpLogin("bob", "bob-password"); resp.Code != http.StatusOK {
+		t.Errorf("Expected status %d after enabling SRP, got %d", http.StatusOK, resp.Code)
+	}
+	if resp := do(http.MethodPost, "/api/user/login", "", models.User{Login: "bob", Password: "bob-password"}); resp.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for a plaintext login after enabling SRP, got %d", http.StatusUnauthorized, resp.Code)
+	}
+	// Unfinished logins are limited per login
+	for range srpStartsPerLogin {
+		if resp, _ := start(client, "carol"); resp.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, resp.Code)
+		}
+	}
+	resp, _ = start(client, "carol")
+	if resp.Code != http.StatusTooManyRequests || resp.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected status %d with Retry-After for too many unfinished logins, got %d", http.StatusTooManyRequests, resp.Code)
+	}
+	if resp := srpLogin("bob", "bob-password"); resp.Code != http.StatusOK {
+		t.Errorf("Expected status %d for another login, got %d", http.StatusOK, resp.Code)
+	}
+}
+
+// testSRPN and testSRPG are the group of RFC 5054, appendix A, which the server uses.
+var (
+	testSRPN, _ = new(big.Int).SetString("AC6BDB41324A9A9BF166DE5E1389582FAF72B6651987EE07FC3192943DB56050"+
+		"A37329CBB4A099ED8193E0757767A13DD52312AB4B03310DCD7F48A9DA04FD50"+
+		"E8083969EDB767B0CF6095179A163AB3661A05FBD5FAAAE82918A9962F0B93B8"+
+		"55F97993EC975EEAA80D740ADBF4FF747359D041D5C33EA71D281E446B14773B"+
+		"CA97B43A23FB801676BD207A436C6481F1D2B9078717461A5B9D32E688F87748"+
+		"544523B524B0D57D5EA77A2775D2ECFA032CFBDBF52FB3786160279004E57AE6"+
+		"AF874E7303CE53299CCC041C7BC308D82A5698F3A8D0C38271AE35F8E9DBFBB6"+
+		"94B5C803D89F7AE435DE236D525F54759B65E372FCD68EF20FA7111F9E4AFF73", 16)
+	testSRPG = big.NewInt(2)
+)
+
+// newTestSRPVerifier computes the verifier of a password with a random salt, as a client
+// does on registration.
+func newTestSRPVerifier(login, password string, params auth.SRPParams) (auth.SRPVerifier, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return auth.SRPVerifier{}, err
+	}
+	x := testSRPPrivateKey(login, password, salt, params)
+	return auth.SRPVerifier{Params: params, Salt: salt, Verifier: new(big.Int).Exp(testSRPG, x, testSRPN).Bytes()}, nil
+}
+
+// testSRPClient is the client side of an SRP login.
+type testSRPClient struct {
+	login    string
+	password string
+	a        *big.Int // private key
+	aPublic  *big.Int
+	key      []byte
+	proof    []byte
+}
+
+// newTestSRPClient creates the ephemeral key pair of a login.
+func newTestSRPClient(login, password string) (*testSRPClient, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	a := new(big.Int).SetBytes(secret)
+	return &testSRPClient{login: login, password: password, a: a, aPublic: new(big.Int).Exp(testSRPG, a, testSRPN)}, nil
+}
+
+// ClientPublic returns the public key A to send to the server.
+func (c *testSRPClient) ClientPublic() []byte {
+	return testSRPPad(c.aPublic)
+}
+
+// Proof computes the proof M1 from the salt, parameters and public key B of the server.
+func (c *testSRPClient) Proof(salt []byte, params auth.SRPParams, serverPublic []byte) ([]byte, error) {
+	b := new(big.Int).SetBytes(serverPublic)
+	u := new(big.Int).SetBytes(testSRPHash(testSRPPad(c.aPublic), testSRPPad(b)))
+	if b.Sign() == 0 || b.Cmp(testSRPN) >= 0 || u.Sign() == 0 {
+		return nil, fmt.Errorf("invalid SRP server public key")
+	}
+
+	// S = (B - k * g^x) ^ (a + u * x) mod N
+	k := new(big.Int).SetBytes(testSRPHash(testSRPPad(testSRPN), testSRPPad(testSRPG)))
+	x := testSRPPrivateKey(c.login, c.password, salt, params)
+	base := new(big.Int).Exp(testSRPG, x, testSRPN)
+	base.Mul(base, k)
+	base.Sub(b, base)
+	base.Mod(base, testSRPN)
+	exponent := new(big.Int).Mul(u, x)
+	exponent.Add(exponent, c.a)
+	c.key = testSRPHash(testSRPPad(new(big.Int).Exp(base, exponent, testSRPN)))
+
+	// M1 = H(H(N) xor H(g) | H(I) | s | A | B | K)
+	hn, hg := testSRPHash(testSRPPad(testSRPN)), testSRPHash(testSRPPad(testSRPG))
+	for i := range hn {
+		hn[i] ^= hg[i]
+	}
+	c.proof = testSRPHash(hn, testSRPHash([]byte(c.login)), salt, testSRPPad(c.aPublic), testSRPPad(b), c.key)
+	return c.proof, nil
+}
+
+// VerifyServer checks the proof M2 of the server after Proof.
+func (c *testSRPClient) VerifyServer(serverProof []byte) bool {
+	return c.key != nil && hmac.Equal(serverProof, testSRPHash(testSRPPad(c.aPublic), c.proof, c.key))
+}
+
+// testSRPPrivateKey is x = H(salt | Argon2id(login ":" password, salt)).
+func testSRPPrivateKey(login, password string, salt []byte, params auth.SRPParams) *big.Int {
+	stretched := argon2.IDKey([]byte(login+":"+password), salt, params.Time, params.Memory, params.Parallelism, 32)
+	return new(big.Int).SetBytes(testSRPHash(salt, stretched))
+}
+
+func testSRPHash(values ...[]byte) []byte {
+	h := sha256.New()
+	for _, value := range values {
+		h.Write(value)
+	}
+	return h.Sum(nil)
+}
+
+func testSRPPad(n *big.Int) []byte {
+	return n.FillBytes(make([]byte, (testSRPN.BitLen()+7)/8))
+}
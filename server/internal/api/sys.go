@@ -0,0 +1,140 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"gophkeeper/server/internal/apierror"
+	"gophkeeper/server/internal/crypto"
+	"log"
+	"net/http"
+)
+
+// InitRequest is the body of POST /api/sys/init.
+type InitRequest struct {
+	Shares    int `json:"shares"`
+	Threshold int `json:"threshold"`
+}
+
+// InitResponse is the response of POST /api/sys/init.
+// The shares are base64-encoded and returned only once.
+type InitResponse struct {
+	Shares    []string `json:"shares"`
+	Threshold int      `json:"threshold"`
+}
+
+// UnsealRequest is the body of POST /api/sys/unseal.
+// Reset discards the shares submitted so far instead of submitting a new one.
+type UnsealRequest struct {
+	Share string `json:"share"`
+	Reset bool   `json:"reset"`
+}
+
+// SealStatus reports whether the server is initialized and sealed.
+func (a *API) SealStatus(w http.ResponseWriter, r *http.Request) {
+	status, err := a.seal.Status(r.Context())
+	if err != nil {
+		apierror.Write(w, "Failed to get seal status", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// InitSeal generates the master key and returns its unseal shares.
+func (a *API) InitSeal(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req InitRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	status, err := a.seal.Status(ctx)
+	if err != nil {
+		apierror.Write(w, "Failed to get seal status", http.StatusInternalServerError)
+		return
+	}
+	if status.Initialized {
+		apierror.Write(w, "Seal is already initialized", http.StatusConflict)
+		return
+	}
+
+	shares, err := a.seal.Initialize(ctx, req.Shares, req.Threshold)
+	if err != nil {
+		apierror.Write(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Printf("Seal initialized with %d shares, threshold %d", req.Shares, req.Threshold)
+
+	resp := InitResponse{Threshold: req.Threshold}
+	for _, share := range shares {
+		resp.Shares = append(resp.Shares, base64.StdEncoding.EncodeToString(share))
+		clear(share)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// errSealed is returned by operations that need the master key while the server is sealed.
+var errSealed = &requestError{Status: http.StatusServiceUnavailable, Code: apierror.CodeSealed, Message: "Server is sealed"}
+
+// Unseal submits an unseal share and reports the resulting seal status.
+//
+// Like the rest of /api/sys it is unauthenticated, because no user can be verified before
+// the server is unsealed: anyone who can reach it can reset the progress, explicitly or by
+// submitting an invalid share. Resets are logged with the client address; expose /api/sys
+// only to the operators.
+func (a *API) Unseal(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req UnsealRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Reset {
+		log.Printf("SECURITY: unseal progress reset from %s", clientIP(r))
+		a.seal.ResetUnseal()
+		a.SealStatus(w, r)
+		return
+	}
+
+	share, err := base64.StdEncoding.DecodeString(req.Share)
+	if err != nil {
+		apierror.Write(w, "Invalid share", http.StatusBadRequest)
+		return
+	}
+	defer clear(share)
+
+	wasSealed := a.seal.Sealed()
+	status, err := a.seal.Unseal(ctx, share)
+	if err != nil {
+		if errors.Is(err, crypto.ErrInvalidShares) {
+			log.Printf("SECURITY: unseal attempt with invalid shares from %s", clientIP(r))
+		}
+		apierror.Write(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if wasSealed && !status.Sealed {
+		log.Println("Server unsealed")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// RequireUnsealed rejects requests with 503 Service Unavailable while the server is sealed.
+func (a *API) RequireUnsealed(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.seal != nil && a.seal.Sealed() {
+			writeRequestError(w, errSealed)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
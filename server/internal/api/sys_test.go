@@ -0,0 +1,120 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"gophkeeper/server/internal/apierror"
+	"gophkeeper/server/internal/auth"
+	"gophkeeper/server/internal/crypto"
+	"gophkeeper/server/internal/models"
+	"gophkeeper/server/internal/pb"
+	"gophkeeper/server/internal/storage"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	grpcstatus "google.golang.org/grpc/status"
+)
+
+// TestSealedServer tests that secrets are unavailable until the server is unsealed
+func TestSealedServer(t *testing.T) {
+	ctx := context.Background()
+	mem := storage.NewMemStore()
+
+	keyring, err := crypto.ParseKeySpecs(ctx, []string{"sealed:shamir"}, crypto.KeySources{Seals: mem})
+	if err != nil {
+		t.Fatalf("Failed to create keyring: %v", err)
+	}
+	store, err := storage.NewEncryptedStore(mem, keyring)
+	if err != nil {
+		t.Fatalf("Failed to create encrypted store: %v", err)
+	}
+
+	jwtManager := auth.NewJWTManager("test-secret")
+	api := New(store, jwtManager)
+	api.SetSeal(keyring.Seal())
+	router := NewRouter(api, jwtManager)
+
+	token, _ := jwtManager.GenerateJWT(1)
+	do := func(method, path string, body any) *httptest.ResponseRecorder {
+		payload, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, path, bytes.NewReader(payload))
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+
+	secret := models.Secret{Type: models.LoginPasswordType, Data: []byte("secret data")}
+	if resp := do(http.MethodPost, "/api/secrets", secret); resp.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d while sealed, got %d", http.StatusServiceUnavailable, resp.Code)
+	}
+
+	// TOTP secrets are encrypted too, so two-factor logins wait for the unseal
+	for _, path := range []string{"/api/user/login/totp", "/api/user/totp"} {
+		resp := do(http.MethodPost, path, MFALoginRequest{Challenge: "challenge", TOTPCodeRequest: TOTPCodeRequest{Code: "123456"}})
+		var envelope apierror.Response
+		json.NewDecoder(resp.Body).Decode(&envelope)
+		if resp.Code != http.StatusServiceUnavailable || envelope.Code != apierror.CodeSealed {
+			t.Errorf("Expected %s for %s while sealed, got %d: %+v", apierror.CodeSealed, path, resp.Code, envelope)
+		}
+	}
+
+	resp := do(http.MethodPost, "/api/sys/init", InitRequest{Shares: 3, Threshold: 2})
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, resp.Code, resp.Body.String())
+	}
+	var initResp InitResponse
+	json.NewDecoder(resp.Body).Decode(&initResp)
+	if len(initResp.Shares) != 3 {
+		t.Fatalf("Expected 3 shares, got %d", len(initResp.Shares))
+	}
+
+	if resp := do(http.MethodPost, "/api/sys/init", InitRequest{Shares: 3, Threshold: 2}); resp.Code != http.StatusConflict {
+		t.Errorf("Expected status %d for a second init, got %d", http.StatusConflict, resp.Code)
+	}
+
+	if resp := do(http.MethodPost, "/api/sys/unseal", UnsealRequest{Share: "not base64!"}); resp.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for a malformed share, got %d", http.StatusBadRequest, resp.Code)
+	}
+
+	var status crypto.SealStatus
+	for _, share := range initResp.Shares[1:] {
+		resp := do(http.MethodPost, "/api/sys/unseal", UnsealRequest{Share: share})
+		if resp.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, resp.Code, resp.Body.String())
+		}
+		json.NewDecoder(resp.Body).Decode(&status)
+	}
+	if status.Sealed {
+		t.Fatalf("Expected server to be unsealed, got %+v", status)
+	}
+
+	if resp := do(http.MethodPost, "/api/secrets", secret); resp.Code != http.StatusCreated {
+		t.Errorf("Expected status %d after unseal, got %d: %s", http.StatusCreated, resp.Code, resp.Body.String())
+	}
+	// After a restart, logins of users with two-factor authentication wait for the unseal too
+	hash, _ := auth.HashPassword("correct horse battery")
+	user, _ := store.CreateUser(ctx, models.User{Login: "alice", Password: hash})
+	if err := store.SaveTOTP(ctx, models.TOTP{UserID: user.ID, Secret: []byte("totp secret"), Enabled: true}); err != nil {
+		t.Fatalf("Failed to save TOTP: %v", err)
+	}
+	restarted, _ := crypto.ParseKeySpecs(ctx, []string{"sealed:shamir"}, crypto.KeySources{Seals: mem})
+	restartedStore, _ := storage.NewEncryptedStore(mem, restarted)
+	restartedAPI := New(restartedStore, jwtManager)
+	restartedAPI.SetSeal(restarted.Seal())
+	body, _ := json.Marshal(models.User{Login: "alice", Password: "correct horse battery"})
+	resp = httptest.NewRecorder()
+	NewRouter(restartedAPI, jwtManager).ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/api/user/login", bytes.NewReader(body)))
+	var envelope apierror.Response
+	json.NewDecoder(resp.Body).Decode(&envelope)
+	if resp.Code != http.StatusServiceUnavailable || envelope.Code != apierror.CodeSealed {
+		t.Errorf("Expected %s for a two-factor login while sealed, got %d: %+v", apierror.CodeSealed, resp.Code, envelope)
+	}
+	_, err = (&userService{api: restartedAPI}).Login(ctx, &pb.LoginRequest{Login: "alice", Password: "correct horse battery"})
+	if grpcstatus.Code(err) != codes.Unavailable {
+		t.Errorf("Expected %s for a two-factor gRPC login while sealed, got %v", codes.Unavailable, err)
+	}
+}
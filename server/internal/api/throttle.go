@@ -0,0 +1,88 @@
+package api
+
+import (
+	"context"
+	"gophkeeper/server/internal/apierror"
+	"gophkeeper/server/internal/auth"
+	"log"
+	"net/http"
+)
+
+// SetLoginThrottle enables brute-force protection for Login and LoginTOTP.
+func (a *API) SetLoginThrottle(throttle *auth.LoginThrottle) {
+	a.throttle = throttle
+}
+
+// UnlockAccount lifts a lockout of the authenticated user's account, so that a user
+// whose password is being guessed can still log in on a new device once signed in elsewhere.
+func (a *API) UnlockAccount(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		apierror.Write(w, "User ID not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	if a.throttle != nil {
+		user, err := a.store.GetUserByID(ctx, userID)
+		if err != nil {
+			apierror.Write(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		if err := a.throttle.Unlock(ctx, user.Login); err != nil {
+			apierror.Write(w, "Failed to unlock account", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// checkLoginThrottle rejects the request with 429 if logins for the account or the
+// client are locked. It reports whether the login may proceed.
+func (a *API) checkLoginThrottle(w http.ResponseWriter, r *http.Request, login string) bool {
+	if err := a.loginThrottled(r.Context(), login, clientIP(r)); err != nil {
+		writeRequestError(w, err)
+		return false
+	}
+	return true
+}
+
+// loginThrottled returns a *requestError with 429 if logins for the account or the
+// client at ip are locked.
+func (a *API) loginThrottled(ctx context.Context, login, ip string) error {
+	if a.throttle == nil {
+		return nil
+	}
+
+	retryAfter, err := a.throttle.Check(ctx, login, ip)
+	if err != nil {
+		return err
+	}
+	if retryAfter > 0 {
+		return &requestError{Status: http.StatusTooManyRequests, Code: apierror.CodeLoginThrottled, Message: "Too many failed login attempts", RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+// loginFailed records a failed login. Errors are logged rather than returned so that
+// the client gets the same response whether or not recording succeeded.
+func (a *API) loginFailed(ctx context.Context, login, ip string) {
+	if a.throttle == nil {
+		return
+	}
+	if err := a.throttle.RecordFailure(ctx, login, ip); err != nil {
+		log.Printf("Failed to record failed login: %v", err)
+	}
+}
+
+// loginSucceeded forgets the failed logins of an account.
+func (a *API) loginSucceeded(ctx context.Context, login string) {
+	if a.throttle == nil {
+		return
+	}
+	if err := a.throttle.RecordSuccess(ctx, login); err != nil {
+		log.Printf("Failed to reset failed logins: %v", err)
+	}
+}
@@ -0,0 +1,110 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"gophkeeper/server/internal/auth"
+	"gophkeeper/server/internal/models"
+	"gophkeeper/server/internal/storage"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// TestLoginThrottle tests backoff, lockout and unlocking of logins
+func TestLoginThrottle(t *testing.T) {
+	store := storage.NewMemStore()
+	jwtManager := auth.NewJWTManager("test-secret")
+	jwtManager.SetRevocationList(auth.NewRevocationList(store))
+	api := New(store, jwtManager)
+	api.SetLoginThrottle(auth.NewLoginThrottle(store,
+		auth.ThrottlePolicy{FreeAttempts: 2, BaseDelay: time.Minute, MaxDelay: time.Hour, LockoutThreshold: 5, LockoutDuration: time.Hour, Window: time.Hour},
+		auth.ThrottlePolicy{FreeAttempts: 4, BaseDelay: time.Minute, MaxDelay: time.Hour, Window: time.Hour},
+	))
+	router := NewRouter(api, jwtManager)
+
+	hashedPass, _ := auth.HashPassword("correctpass")
+	store.CreateUser(context.Background(), models.User{Login: "testuser", Password: hashedPass})
+
+	login := func(user, password, ip string) *httptest.ResponseRecorder {
+		payload, _ := json.Marshal(models.User{Login: user, Password: password})
+		req := httptest.NewRequest(http.MethodPost, "/api/user/login", bytes.NewReader(payload))
+		req.RemoteAddr = ip + ":1234"
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+
+	// A session from before the lockout, used for self-service unlock
+	var tokens TokenResponse
+	json.NewDecoder(login("testuser", "correctpass", "192.0.2.1").Body).Decode(&tokens)
+
+	for i := range 3 {
+		if resp := login("testuser", "wrongpass", "192.0.2.2"); resp.Code != http.StatusUnauthorized {
+			t.Fatalf("Expected status %d for failure %d, got %d", http.StatusUnauthorized, i+1, resp.Code)
+		}
+	}
+
+	// The account is now delayed, even for the right password and from another address
+	resp := login("testuser", "correctpass", "192.0.2.3")
+	if resp.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status %d after repeated failures, got %d", http.StatusTooManyRequests, resp.Code)
+	}
+	retryAfter, err := strconv.Atoi(resp.Header().Get("Retry-After"))
+	if err != nil || retryAfter <= 0 || retryAfter > 60 {
+		t.Errorf("Expected Retry-After of at most 60 seconds, got %q", resp.Header().Get("Retry-After"))
+	}
+
+	// Self-service unlock from the existing session
+	req := httptest.NewRequest(http.MethodPost, "/api/user/unlock", nil)
+	req.Header.Set("Authorization", "Bearer "+tokens.Token)
+	unlock := httptest.NewRecorder()
+	router.ServeHTTP(unlock, req)
+	if unlock.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d for unlock, got %d", http.StatusNoContent, unlock.Code)
+	}
+	if resp := login("testuser", "correctpass", "192.0.2.3"); resp.Code != http.StatusOK {
+		t.Errorf("Expected status %d after unlock, got %d", http.StatusOK, resp.Code)
+	}
+
+	// Unknown logins are throttled per account and per address like existing ones
+	for range 3 {
+		login("nosuchuser", "wrongpass", "192.0.2.4")
+	}
+	if resp := login("nosuchuser", "wrongpass", "192.0.2.5"); resp.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected status %d for an unknown login, got %d", http.StatusTooManyRequests, resp.Code)
+	}
+	for i := range 2 {
+		login("other"+strconv.Itoa(i), "wrongpass", "192.0.2.4")
+	}
+	if resp := login("testuser", "correctpass", "192.0.2.4"); resp.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected status %d for a throttled address, got %d", http.StatusTooManyRequests, resp.Code)
+	}
+	if resp := login("testuser", "correctpass", "192.0.2.6"); resp.Code != http.StatusOK {
+		t.Errorf("Expected status %d from another address, got %d", http.StatusOK, resp.Code)
+	}
+
+	// Confirming the password to switch to SRP counts as a login
+	json.NewDecoder(login("testuser", "correctpass", "192.0.2.7").Body).Decode(&tokens)
+	verifier, _ := newTestSRPVerifier("testuser", "correctpass", auth.MinSRPParams)
+	enableSRP := func(password string) *httptest.ResponseRecorder {
+		payload, _ := json.Marshal(SRPEnableRequest{Login: "testuser", Password: password, Salt: verifier.Salt, Verifier: verifier.Verifier, Params: verifier.Params})
+		req := httptest.NewRequest(http.MethodPut, "/api/user/srp", bytes.NewReader(payload))
+		req.Header.Set("Authorization", "Bearer "+tokens.Token)
+		req.RemoteAddr = "192.0.2.7:1234"
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+	for i := range 3 {
+		if resp := enableSRP("wrongpass"); resp.Code != http.StatusForbidden {
+			t.Fatalf("Expected status %d for wrong password %d, got %d", http.StatusForbidden, i+1, resp.Code)
+		}
+	}
+	if resp := enableSRP("wrongpass"); resp.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected status %d for repeated wrong passwords when enabling SRP, got %d", http.StatusTooManyRequests, resp.Code)
+	}
+}
@@ -0,0 +1,171 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gophkeeper/server/internal/apierror"
+	"gophkeeper/server/internal/auth"
+	"gophkeeper/server/internal/models"
+	"gophkeeper/server/internal/storage"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+// TokenResponse is returned by Login and Refresh.
+type TokenResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	// ExpiresIn is the lifetime of Token in seconds
+	ExpiresIn int `json:"expires_in"`
+}
+
+// RefreshRequest is the body of POST /api/user/refresh.
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Refresh exchanges a refresh token for a new access token and a new refresh token.
+// Each refresh token can be used once; presenting a used token again means it was
+// stolen, so every token of its family is revoked and its session ends.
+func (a *API) Refresh(w http.ResponseWriter, r *http.Request) {
+	var req RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		apierror.Write(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	resp, err := a.rotateRefreshToken(r.Context(), req.RefreshToken, clientIP(r))
+	if err != nil {
+		writeRequestError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// rotateRefreshToken uses a refresh token presented from ip and issues new tokens in its family.
+func (a *API) rotateRefreshToken(ctx context.Context, refreshToken, ip string) (TokenResponse, error) {
+	token, err := a.store.UseRefreshToken(ctx, auth.HashRefreshToken(refreshToken))
+	if err != nil {
+		var notFoundErr storage.ErrRefreshTokenNotFound
+		if errors.As(err, &notFoundErr) {
+			return TokenResponse{}, &requestError{Status: http.StatusUnauthorized, Code: apierror.CodeInvalidToken, Message: "Invalid refresh token"}
+		}
+		return TokenResponse{}, err
+	}
+
+	if token.Used {
+		log.Printf("SECURITY: refresh token reuse detected for user %d; revoking token family", token.UserID)
+		if err := a.store.RevokeRefreshTokenFamily(ctx, token.FamilyID); err != nil {
+			return TokenResponse{}, err
+		}
+		var notFoundErr storage.ErrSessionNotFound
+		if err := a.endSession(ctx, token.UserID, token.FamilyID); err != nil && !errors.As(err, &notFoundErr) {
+			return TokenResponse{}, err
+		}
+		return TokenResponse{}, &requestError{Status: http.StatusUnauthorized, Code: apierror.CodeInvalidToken, Message: "Invalid refresh token"}
+	}
+
+	if time.Now().After(token.ExpiresAt) {
+		return TokenResponse{}, &requestError{Status: http.StatusUnauthorized, Code: apierror.CodeInvalidToken, Message: "Refresh token expired"}
+	}
+
+	if err := a.touchSession(ctx, token.FamilyID, ip); err != nil {
+		return TokenResponse{}, err
+	}
+
+	return a.issueTokens(ctx, token.UserID, token.FamilyID)
+}
+
+// Logout revokes the access token of the request and ends its session. A refresh token
+// given in the body is revoked with every token rotated from it, which also covers
+// refresh tokens issued before sessions were tracked.
+func (a *API) Logout(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	claims, ok := auth.GetClaimsFromContext(ctx)
+	if !ok {
+		apierror.Write(w, "Token claims not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	// The body is optional
+	var req RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		apierror.Write(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Requests authenticated with a client certificate have no token to revoke
+	if claims.ID != "" {
+		if err := a.jwtManager.RevokeJWT(ctx, claims); err != nil {
+			apierror.Write(w, "Failed to revoke token", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if claims.SessionID != "" {
+		var notFoundErr storage.ErrSessionNotFound
+		if err := a.endSession(ctx, claims.UserID, claims.SessionID); err != nil && !errors.As(err, &notFoundErr) {
+			apierror.Write(w, "Failed to end session", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if req.RefreshToken != "" {
+		// The token is only looked up: using a token of another user would make its
+		// owner's next refresh look like reuse and revoke the owner's session
+		token, err := a.store.GetRefreshToken(ctx, auth.HashRefreshToken(req.RefreshToken))
+		var notFoundErr storage.ErrRefreshTokenNotFound
+		switch {
+		case errors.As(err, &notFoundErr):
+		case err != nil:
+			apierror.Write(w, "Failed to revoke refresh token", http.StatusInternalServerError)
+			return
+		case token.UserID == claims.UserID:
+			if err := a.store.RevokeRefreshTokenFamily(ctx, token.FamilyID); err != nil {
+				apierror.Write(w, "Failed to revoke refresh token", http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// issueTokens generates an access token and a refresh token in the given family.
+// The family ID is the ID of the session the tokens belong to.
+func (a *API) issueTokens(ctx context.Context, userID int, familyID string) (TokenResponse, error) {
+	accessToken, err := a.jwtManager.GenerateSessionJWT(userID, familyID)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+
+	refreshToken, refreshHash, err := auth.GenerateRefreshToken()
+	if err != nil {
+		return TokenResponse{}, err
+	}
+
+	now := time.Now()
+	err = a.store.CreateRefreshToken(ctx, models.RefreshToken{
+		TokenHash: refreshHash,
+		FamilyID:  familyID,
+		UserID:    userID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(a.refreshTTL),
+	})
+	if err != nil {
+		return TokenResponse{}, fmt.Errorf("failed to store refresh token: %w", err)
+	}
+
+	return TokenResponse{
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(a.jwtManager.AccessTokenTTL().Seconds()),
+	}, nil
+}
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"gophkeeper/server/internal/auth"
+	"gophkeeper/server/internal/models"
+	"gophkeeper/server/internal/storage"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// TestRefresh tests refresh token rotation and reuse detection
+func TestRefresh(t *testing.T) {
+	store := storage.NewMemStore()
+	jwtManager := auth.NewJWTManager("test-secret")
+	jwtManager.SetRevocationList(auth.NewRevocationList(store))
+	api := New(store, jwtManager)
+
+	hashedPass, _ := auth.HashPassword("correctpass")
+	store.CreateUser(context.Background(), models.User{Login: "testuser", Password: hashedPass})
+
+	post := func(handler http.HandlerFunc, body any) (*httptest.ResponseRecorder, TokenResponse) {
+		payload, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(payload))
+		resp := httptest.NewRecorder()
+		handler(resp, req)
+
+		var tokens TokenResponse
+		if resp.Code == http.StatusOK {
+			json.NewDecoder(resp.Body).Decode(&tokens)
+		}
+		return resp, tokens
+	}
+
+	_, login := post(api.Login, models.User{Login: "testuser", Password: "correctpass"})
+	if login.RefreshToken == "" || login.ExpiresIn != int(auth.DefaultAccessTokenTTL.Seconds()) {
+		t.Fatalf("Unexpected login response: %+v", login)
+	}
+
+	resp, rotated := post(api.Refresh, RefreshRequest{RefreshToken: login.RefreshToken})
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, resp.Code)
+	}
+	if rotated.RefreshToken == login.RefreshToken {
+		t.Error("Expected a new refresh token")
+	}
+	if userID, err := jwtManager.ValidateJWT(rotated.Token); err != nil || userID != 1 {
+		t.Errorf("Expected valid access token for user 1, got %d, %v", userID, err)
+	}
+
+	// Reusing the first token revokes the whole family, including the rotated token
+	if resp, _ := post(api.Refresh, RefreshRequest{RefreshToken: login.RefreshToken}); resp.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for a reused token, got %d", http.StatusUnauthorized, resp.Code)
+	}
+	if resp, _ := post(api.Refresh, RefreshRequest{RefreshToken: rotated.RefreshToken}); resp.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for a token of a revoked family, got %d", http.StatusUnauthorized, resp.Code)
+	}
+
+	if resp, _ := post(api.Refresh, RefreshRequest{RefreshToken: "unknown"}); resp.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for an unknown token, got %d", http.StatusUnauthorized, resp.Code)
+	}
+
+	// Expired refresh tokens are rejected
+	api.SetRefreshTokenTTL(-time.Minute)
+	_, expired := post(api.Login, models.User{Login: "testuser", Password: "correctpass"})
+	if resp, _ := post(api.Refresh, RefreshRequest{RefreshToken: expired.RefreshToken}); resp.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for an expired token, got %d", http.StatusUnauthorized, resp.Code)
+	}
+}
+
+// TestLogout tests that logout revokes the access token and the refresh token family
+func TestLogout(t *testing.T) {
+	store := storage.NewMemStore()
+	jwtManager := auth.NewJWTManager("test-secret")
+	jwtManager.SetRevocationList(auth.NewRevocationList(store))
+	api := New(store, jwtManager)
+	router := NewRouter(api, jwtManager)
+
+	hashedPass, _ := auth.HashPassword("correctpass")
+	store.CreateUser(context.Background(), models.User{Login: "testuser", Password: hashedPass})
+
+	do := func(method, path, token string, body any) *httptest.ResponseRecorder {
+		payload, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, path, bytes.NewReader(payload))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+
+	var tokens TokenResponse
+	json.NewDecoder(do(http.MethodPost, "/api/user/login", "", models.User{Login: "testuser", Password: "correctpass"}).Body).Decode(&tokens)
+
+	if resp := do(http.MethodGet, "/api/secrets", tokens.Token, nil); resp.Code != http.StatusOK {
+		t.Fatalf("Expected status %d before logout, got %d", http.StatusOK, resp.Code)
+	}
+
+	if resp := do(http.MethodPost, "/api/user/logout", tokens.Token, RefreshRequest{RefreshToken: tokens.RefreshToken}); resp.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d, got %d", http.StatusNoContent, resp.Code)
+	}
+
+	if resp := do(http.MethodGet, "/api/secrets", tokens.Token, nil); resp.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d after logout, got %d", http.StatusUnauthorized, resp.Code)
+	}
+	if resp := do(http.MethodPost, "/api/user/refresh", "", RefreshRequest{RefreshToken: tokens.RefreshToken}); resp.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for a refresh token revoked by logout, got %d", http.StatusUnauthorized, resp.Code)
+	}
+	if resp := do(http.MethodPost, "/api/user/logout", "", nil); resp.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for logout without a token, got %d", http.StatusUnauthorized, resp.Code)
+	}
+
+	// A refresh token of another user is left alone
+	hashedPass, _ = auth.HashPassword("otherpass")
+	store.CreateUser(context.Background(), models.User{Login: "other", Password: hashedPass})
+	var other TokenResponse
+	json.NewDecoder(do(http.MethodPost, "/api/user/login", "", models.User{Login: "other", Password: "otherpass"}).Body).Decode(&other)
+	json.NewDecoder(do(http.MethodPost, "/api/user/login", "", models.User{Login: "testuser", Password: "correctpass"}).Body).Decode(&tokens)
+	if resp := do(http.MethodPost, "/api/user/logout", tokens.Token, RefreshRequest{RefreshToken: other.RefreshToken}); resp.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d, got %d", http.StatusNoContent, resp.Code)
+	}
+	if resp := do(http.MethodPost, "/api/user/refresh", "", RefreshRequest{RefreshToken: other.RefreshToken}); resp.Code != http.StatusOK {
+		t.Errorf("Expected status %d for a refresh token sent to logout by another user, got %d", http.StatusOK, resp.Code)
+	}
+
+	// Tokens without an ID cannot be revoked and are rejected
+	legacy, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, &auth.Claims{
+		UserID:           1,
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))},
+	}).SignedString([]byte("test-secret"))
+	if resp := do(http.MethodGet, "/api/secrets", legacy, nil); resp.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for a token without an ID, got %d", http.StatusUnauthorized, resp.Code)
+	}
+}
@@ -0,0 +1,322 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"gophkeeper/server/internal/apierror"
+	"gophkeeper/server/internal/auth"
+	"gophkeeper/server/internal/crypto"
+	"gophkeeper/server/internal/models"
+	"gophkeeper/server/internal/storage"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+// totpIssuer names the service in authenticator apps.
+const totpIssuer = "GophKeeper"
+
+// TOTPEnrollResponse is returned when a user starts enrolling in two-factor authentication.
+type TOTPEnrollResponse struct {
+	// Secret is the base32 key for manual entry in an authenticator app
+	Secret string `json:"secret"`
+	// URI is the otpauth:// form of the key, usually shown as a QR code
+	URI string `json:"uri"`
+}
+
+// TOTPCodeRequest carries a second factor: either a TOTP code or a recovery code.
+type TOTPCodeRequest struct {
+	Code         string `json:"code,omitempty"`
+	RecoveryCode string `json:"recovery_code,omitempty"`
+}
+
+// RecoveryCodesResponse lists the recovery codes issued when two-factor authentication is enabled.
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// MFAChallengeResponse is returned by Login with status 202 when the user has two-factor
+// authentication enabled. The challenge is exchanged for tokens at /api/user/login/totp.
+type MFAChallengeResponse struct {
+	MFARequired bool   `json:"mfa_required"`
+	Challenge   string `json:"challenge"`
+	// ExpiresIn is the lifetime of Challenge in seconds
+	ExpiresIn int `json:"expires_in"`
+}
+
+// MFALoginRequest is the body of POST /api/user/login/totp.
+type MFALoginRequest struct {
+	Challenge string `json:"challenge"`
+	TOTPCodeRequest
+}
+
+// EnrollTOTP starts two-factor enrollment: it generates a TOTP secret that stays inactive
+// until confirmed with ConfirmTOTP. Enrolling again replaces an unconfirmed secret.
+func (a *API) EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		apierror.Write(w, "User ID not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	existing, err := a.store.GetTOTP(ctx, userID)
+	var notFoundErr storage.ErrTOTPNotFound
+	if err != nil && !errors.As(err, &notFoundErr) {
+		apierror.Write(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	if err == nil && existing.Enabled {
+		apierror.Write(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+
+	user, err := a.store.GetUserByID(ctx, userID)
+	if err != nil {
+		apierror.Write(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		apierror.Write(w, "Failed to generate secret", http.StatusInternalServerError)
+		return
+	}
+
+	if err := a.store.SaveTOTP(ctx, models.TOTP{UserID: userID, Secret: secret, CreatedAt: time.Now()}); err != nil {
+		apierror.Write(w, "Failed to save secret", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(TOTPEnrollResponse{
+		Secret: auth.EncodeTOTPSecret(secret),
+		URI:    auth.TOTPURI(totpIssuer, user.Login, secret),
+	})
+}
+
+// ConfirmTOTP enables two-factor authentication once the user proves their authenticator
+// app produces valid codes, and returns one-time recovery codes.
+func (a *API) ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		apierror.Write(w, "User ID not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	var req TOTPCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		apierror.Write(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	totp, err := a.store.GetTOTP(ctx, userID)
+	if err != nil {
+		var notFoundErr storage.ErrTOTPNotFound
+		if errors.As(err, &notFoundErr) {
+			apierror.Write(w, "Two-factor enrollment has not been started", http.StatusNotFound)
+			return
+		}
+		apierror.Write(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	if totp.Enabled {
+		apierror.Write(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+
+	step, ok := auth.ValidateTOTP(totp.Secret, req.Code, time.Now())
+	if !ok {
+		apierror.WriteCode(w, "Invalid code", http.StatusForbidden, apierror.CodeInvalidCode, nil)
+		return
+	}
+
+	codes, hashes, err := auth.GenerateRecoveryCodes()
+	if err != nil {
+		apierror.Write(w, "Failed to generate recovery codes", http.StatusInternalServerError)
+		return
+	}
+
+	totp.Enabled = true
+	totp.LastUsedStep = step
+	totp.RecoveryCodes = hashes
+	if err := a.store.SaveTOTP(ctx, totp); err != nil {
+		apierror.Write(w, "Failed to enable two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// DisableTOTP turns off two-factor authentication. An enabled enrollment can only be
+// removed with a valid code or recovery code, so a stolen access token is not enough.
+func (a *API) DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		apierror.Write(w, "User ID not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	// The body is optional for unconfirmed enrollments
+	var req TOTPCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		apierror.Write(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	totp, err := a.store.GetTOTP(ctx, userID)
+	if err != nil {
+		var notFoundErr storage.ErrTOTPNotFound
+		if errors.As(err, &notFoundErr) {
+			apierror.Write(w, "Two-factor authentication is not enabled", http.StatusNotFound)
+			return
+		}
+		apierror.Write(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Wrong codes count as failed logins, so that a stolen access token cannot be used to
+	// guess the code
+	if totp.Enabled {
+		user, err := a.store.GetUserByID(ctx, userID)
+		if err != nil {
+			apierror.Write(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		if !a.checkLoginThrottle(w, r, user.Login) {
+			return
+		}
+		valid, err := a.verifySecondFactor(ctx, totp, req)
+		if err != nil {
+			apierror.Write(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		if !valid {
+			a.loginFailed(ctx, user.Login, clientIP(r))
+			apierror.WriteCode(w, "Invalid code", http.StatusForbidden, apierror.CodeInvalidCode, nil)
+			return
+		}
+		a.loginSucceeded(ctx, user.Login)
+	}
+
+	if err := a.store.DeleteTOTP(ctx, userID); err != nil {
+		apierror.Write(w, "Failed to disable two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// LoginTOTP completes a two-step login: it exchanges the challenge returned by Login
+// and a second factor for tokens. Each challenge allows a single attempt.
+func (a *API) LoginTOTP(w http.ResponseWriter, r *http.Request) {
+	var req MFALoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Challenge == "" {
+		apierror.Write(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	resp, err := a.loginTOTP(r.Context(), req, requestClient(r))
+	if err != nil {
+		writeRequestError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// loginTOTP verifies the second factor of a two-step login and starts a session for client.
+func (a *API) loginTOTP(ctx context.Context, req MFALoginRequest, client models.Session) (TokenResponse, error) {
+	// TOTP secrets cannot be unwrapped while sealed; the challenge is kept for a retry
+	if a.seal != nil && a.seal.Sealed() {
+		return TokenResponse{}, errSealed
+	}
+
+	claims, err := a.jwtManager.UseMFAChallenge(ctx, req.Challenge)
+	if err != nil {
+		return TokenResponse{}, &requestError{Status: http.StatusUnauthorized, Code: apierror.CodeInvalidToken, Message: "Invalid or expired challenge"}
+	}
+
+	user, err := a.store.GetUserByID(ctx, claims.UserID)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+
+	if err := a.loginThrottled(ctx, user.Login, client.IP); err != nil {
+		return TokenResponse{}, err
+	}
+
+	totp, err := a.store.GetTOTP(ctx, claims.UserID)
+	if err != nil {
+		var notFoundErr storage.ErrTOTPNotFound
+		if errors.As(err, &notFoundErr) {
+			return TokenResponse{}, &requestError{Status: http.StatusUnauthorized, Code: apierror.CodeInvalidToken, Message: "Invalid or expired challenge"}
+		}
+		return TokenResponse{}, err
+	}
+
+	valid := false
+	if totp.Enabled {
+		if valid, err = a.verifySecondFactor(ctx, totp, req.TOTPCodeRequest); err != nil {
+			return TokenResponse{}, err
+		}
+	}
+	if !valid {
+		a.loginFailed(ctx, user.Login, client.IP)
+		return TokenResponse{}, &requestError{Status: http.StatusUnauthorized, Code: apierror.CodeInvalidCode, Message: "Invalid code"}
+	}
+
+	a.loginSucceeded(ctx, user.Login)
+
+	if req.RecoveryCode != "" {
+		log.Printf("User %d logged in with a recovery code", claims.UserID)
+	}
+
+	client.UserID = claims.UserID
+	sessionID, err := a.createSession(ctx, client)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+
+	return a.issueTokens(ctx, claims.UserID, sessionID)
+}
+
+// requiresTOTP reports whether a user must pass a second factor to log in.
+func (a *API) requiresTOTP(ctx context.Context, userID int) (bool, error) {
+	totp, err := a.store.GetTOTP(ctx, userID)
+	if err != nil {
+		var notFoundErr storage.ErrTOTPNotFound
+		if errors.As(err, &notFoundErr) {
+			return false, nil
+		}
+		// The secret cannot be decrypted while sealed, and the login must not skip it
+		if errors.Is(err, crypto.ErrSealed) {
+			return false, errSealed
+		}
+		return false, err
+	}
+	return totp.Enabled, nil
+}
+
+// verifySecondFactor checks a TOTP code or consumes a recovery code.
+// Accepted codes cannot be used again.
+func (a *API) verifySecondFactor(ctx context.Context, totp models.TOTP, req TOTPCodeRequest) (bool, error) {
+	if req.RecoveryCode != "" {
+		return a.store.UseRecoveryCode(ctx, totp.UserID, auth.HashRecoveryCode(req.RecoveryCode))
+	}
+
+	step, ok := auth.ValidateTOTP(totp.Secret, req.Code, time.Now())
+	if !ok {
+		return false, nil
+	}
+	return a.store.UseTOTPStep(ctx, totp.UserID, step)
+}
@@ -0,0 +1,152 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/base32"
+	"encoding/json"
+	"gophkeeper/server/internal/auth"
+	"gophkeeper/server/internal/models"
+	"gophkeeper/server/internal/storage"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestTOTP tests two-factor enrollment and the two-step login
+func TestTOTP(t *testing.T) {
+	store := storage.NewMemStore()
+	jwtManager := auth.NewJWTManager("test-secret")
+	jwtManager.SetRevocationList(auth.NewRevocationList(store))
+	api := New(store, jwtManager)
+	router := NewRouter(api, jwtManager)
+
+	hashedPass, _ := auth.HashPassword("correctpass")
+	store.CreateUser(context.Background(), models.User{Login: "testuser", Password: hashedPass})
+
+	do := func(method, path, token string, body any) *httptest.ResponseRecorder {
+		payload, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, path, bytes.NewReader(payload))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+	credentials := models.User{Login: "testuser", Password: "correctpass"}
+	challenge := func() string {
+		resp := do(http.MethodPost, "/api/user/login", "", credentials)
+		if resp.Code != http.StatusAccepted {
+			t.Fatalf("Expected status %d for a login with 2FA, got %d", http.StatusAccepted, resp.Code)
+		}
+		var mfa MFAChallengeResponse
+		json.NewDecoder(resp.Body).Decode(&mfa)
+		if !mfa.MFARequired || mfa.Challenge == "" {
+			t.Fatalf("Expected an MFA challenge, got %+v", mfa)
+		}
+		return mfa.Challenge
+	}
+
+	var tokens TokenResponse
+	json.NewDecoder(do(http.MethodPost, "/api/user/login", "", credentials).Body).Decode(&tokens)
+
+	resp := do(http.MethodPost, "/api/user/totp", tokens.Token, nil)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Expected status %d for enrollment, got %d", http.StatusOK, resp.Code)
+	}
+	var enrollment TOTPEnrollResponse
+	json.NewDecoder(resp.Body).Decode(&enrollment)
+	if !strings.HasPrefix(enrollment.URI, "otpauth://totp/GophKeeper:testuser?") {
+		t.Errorf("Unexpected otpauth URI: %s", enrollment.URI)
+	}
+	secret, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(enrollment.Secret)
+	if err != nil {
+		t.Fatalf("Failed to decode secret: %v", err)
+	}
+
+	// Unconfirmed enrollments do not affect login
+	if resp := do(http.MethodPost, "/api/user/login", "", credentials); resp.Code != http.StatusOK {
+		t.Fatalf("Expected status %d before confirmation, got %d", http.StatusOK, resp.Code)
+	}
+
+	wrong := []byte(auth.TOTPCode(secret, time.Now()))
+	wrong[0] = '0' + (wrong[0]-'0'+5)%10
+	if resp := do(http.MethodPost, "/api/user/totp/confirm", tokens.Token, TOTPCodeRequest{Code: string(wrong)}); resp.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d for a wrong code, got %d", http.StatusForbidden, resp.Code)
+	}
+
+	now := time.Now()
+	resp = do(http.MethodPost, "/api/user/totp/confirm", tokens.Token, TOTPCodeRequest{Code: auth.TOTPCode(secret, now)})
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Expected status %d for confirmation, got %d", http.StatusOK, resp.Code)
+	}
+	var recovery RecoveryCodesResponse
+	json.NewDecoder(resp.Body).Decode(&recovery)
+	if len(recovery.RecoveryCodes) != auth.RecoveryCodeCount {
+		t.Fatalf("Expected %d recovery codes, got %d", auth.RecoveryCodeCount, len(recovery.RecoveryCodes))
+	}
+
+	// The challenge is not an access token
+	first := challenge()
+	if resp := do(http.MethodGet, "/api/secrets", first, nil); resp.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for a challenge used as access token, got %d", http.StatusUnauthorized, resp.Code)
+	}
+
+	// The code used for confirmation cannot be replayed, and a failed attempt uses up the challenge
+	if resp := do(http.MethodPost, "/api/user/login/totp", "", MFALoginRequest{Challenge: first, TOTPCodeRequest: TOTPCodeRequest{Code: auth.TOTPCode(secret, now)}}); resp.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for a replayed code, got %d", http.StatusUnauthorized, resp.Code)
+	}
+	next := auth.TOTPCode(secret, now.Add(30*time.Second))
+	if resp := do(http.MethodPost, "/api/user/login/totp", "", MFALoginRequest{Challenge: first, TOTPCodeRequest: TOTPCodeRequest{Code: next}}); resp.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for a used challenge, got %d", http.StatusUnauthorized, resp.Code)
+	}
+
+	resp = do(http.MethodPost, "/api/user/login/totp", "", MFALoginRequest{Challenge: challenge(), TOTPCodeRequest: TOTPCodeRequest{Code: next}})
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Expected status %d for a valid code, got %d", http.StatusOK, resp.Code)
+	}
+	json.NewDecoder(resp.Body).Decode(&tokens)
+	if resp := do(http.MethodGet, "/api/secrets", tokens.Token, nil); resp.Code != http.StatusOK {
+		t.Errorf("Expected status %d with the two-factor token, got %d", http.StatusOK, resp.Code)
+	}
+
+	// Recovery codes work once, in any case and with or without the dash
+	code := strings.ToUpper(strings.ReplaceAll(recovery.RecoveryCodes[0], "-", ""))
+	if resp := do(http.MethodPost, "/api/user/login/totp", "", MFALoginRequest{Challenge: challenge(), TOTPCodeRequest: TOTPCodeRequest{RecoveryCode: code}}); resp.Code != http.StatusOK {
+		t.Errorf("Expected status %d for a recovery code, got %d", http.StatusOK, resp.Code)
+	}
+	if resp := do(http.MethodPost, "/api/user/login/totp", "", MFALoginRequest{Challenge: challenge(), TOTPCodeRequest: TOTPCodeRequest{RecoveryCode: code}}); resp.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for a used recovery code, got %d", http.StatusUnauthorized, resp.Code)
+	}
+
+	if resp := do(http.MethodPost, "/api/user/totp", tokens.Token, nil); resp.Code != http.StatusConflict {
+		t.Errorf("Expected status %d for enrolling twice, got %d", http.StatusConflict, resp.Code)
+	}
+	if resp := do(http.MethodDelete, "/api/user/totp", tokens.Token, nil); resp.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d for disabling without a code, got %d", http.StatusForbidden, resp.Code)
+	}
+
+	// Wrong codes for disabling count as failed logins
+	api.SetLoginThrottle(auth.NewLoginThrottle(store,
+		auth.ThrottlePolicy{FreeAttempts: 2, BaseDelay: time.Minute, MaxDelay: time.Hour, Window: time.Hour},
+		auth.ThrottlePolicy{FreeAttempts: 100, BaseDelay: time.Minute, MaxDelay: time.Hour, Window: time.Hour},
+	))
+	for range 3 {
+		do(http.MethodDelete, "/api/user/totp", tokens.Token, TOTPCodeRequest{Code: string(wrong)})
+	}
+	if resp := do(http.MethodDelete, "/api/user/totp", tokens.Token, TOTPCodeRequest{RecoveryCode: recovery.RecoveryCodes[1]}); resp.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected status %d after repeated wrong codes, got %d", http.StatusTooManyRequests, resp.Code)
+	}
+	if resp := do(http.MethodPost, "/api/user/unlock", tokens.Token, nil); resp.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d for unlock, got %d", http.StatusNoContent, resp.Code)
+	}
+	if resp := do(http.MethodDelete, "/api/user/totp", tokens.Token, TOTPCodeRequest{RecoveryCode: recovery.RecoveryCodes[1]}); resp.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d for disabling, got %d", http.StatusNoContent, resp.Code)
+	}
+	if resp := do(http.MethodPost, "/api/user/login", "", credentials); resp.Code != http.StatusOK {
+		t.Errorf("Expected status %d after disabling 2FA, got %d", http.StatusOK, resp.Code)
+	}
+}
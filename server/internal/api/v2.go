@@ -0,0 +1,241 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gophkeeper/server/internal/apierror"
+	"gophkeeper/server/internal/models"
+	"net/http"
+	"time"
+)
+
+// SecretV2 is a secret in API v2: its type is a name and its data is a payload object
+// whose fields depend on the type.
+type SecretV2 struct {
+	ID       int    `json:"id"`
+	Type     string `json:"type"`
+	Metadata string `json:"metadata"`
+	// Payload is a LoginPayload, TextPayload, BinaryPayload or BankCardPayload
+	Payload   any       `json:"payload"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Revision  int       `json:"revision"`
+}
+
+// SecretV2Request is the body of POST /api/v2/secrets and PUT /api/v2/secrets/{id}.
+type SecretV2Request struct {
+	Type     string          `json:"type"`
+	Metadata string          `json:"metadata,omitempty"`
+	Payload  json.RawMessage `json:"payload"`
+	// Revision makes an update fail with 409 revision_conflict unless it is the current
+	// revision of the secret
+	Revision int `json:"revision,omitempty"`
+}
+
+// LoginPayload is the payload of login secrets.
+type LoginPayload struct {
+	Login    string `json:"login"`
+	Password string `json:"password"`
+	// Raw is data stored through API v1 in another format. It is returned instead of the
+	// other fields and stored as is when sent back.
+	Raw []byte `json:"raw,omitempty"`
+}
+
+// TextPayload is the payload of text secrets.
+type TextPayload struct {
+	Text string `json:"text"`
+}
+
+// BinaryPayload is the payload of binary secrets.
+type BinaryPayload struct {
+	Data []byte `json:"data"`
+}
+
+// BankCardPayload is the payload of bank card secrets.
+type BankCardPayload struct {
+	Number string `json:"number"`
+	Holder string `json:"holder,omitempty"`
+	Expiry string `json:"expiry,omitempty"`
+	CVV    string `json:"cvv,omitempty"`
+	// Raw is data stored through API v1 in another format, as in LoginPayload
+	Raw []byte `json:"raw,omitempty"`
+}
+
+// CreateSecretV2 is POST /api/v2/secrets.
+func (a *API) CreateSecretV2(w http.ResponseWriter, r *http.Request) {
+	secret, ok := decodeSecretV2(w, r)
+	if !ok {
+		return
+	}
+
+	createdSecret, ok := a.createSecret(w, r, secret)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(secretToV2(createdSecret))
+}
+
+// GetSecretsV2 is GET /api/v2/secrets.
+func (a *API) GetSecretsV2(w http.ResponseWriter, r *http.Request) {
+	secrets, ok := a.listSecrets(w, r)
+	if !ok {
+		return
+	}
+
+	resp := make([]SecretV2, 0, len(secrets))
+	for _, secret := range secrets {
+		resp = append(resp, secretToV2(secret))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// GetSecretByIDV2 is GET /api/v2/secrets/{id}.
+func (a *API) GetSecretByIDV2(w http.ResponseWriter, r *http.Request) {
+	secret, ok := a.getSecret(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(secretToV2(secret))
+}
+
+// UpdateSecretV2 is PUT /api/v2/secrets/{id}.
+func (a *API) UpdateSecretV2(w http.ResponseWriter, r *http.Request) {
+	secret, ok := decodeSecretV2(w, r)
+	if !ok {
+		return
+	}
+
+	updatedSecret, ok := a.updateSecret(w, r, secret)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(secretToV2(updatedSecret))
+}
+
+// decodeSecretV2 reads a SecretV2Request. On failure it writes the error response and
+// returns false.
+func decodeSecretV2(w http.ResponseWriter, r *http.Request) (models.Secret, bool) {
+	var req SecretV2Request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, "Invalid request body", http.StatusBadRequest)
+		return models.Secret{}, false
+	}
+
+	secretType, ok := models.ParseSecretType(req.Type)
+	if !ok {
+		apierror.WriteCode(w, fmt.Sprintf("Unknown secret type %q", req.Type), http.StatusBadRequest,
+			apierror.CodeInvalidRequest, map[string]any{"field": "type"})
+		return models.Secret{}, false
+	}
+
+	data, err := payloadToData(secretType, req.Payload)
+	if err != nil {
+		apierror.WriteCode(w, fmt.Sprintf("Invalid %s payload: %v", req.Type, err), http.StatusBadRequest,
+			apierror.CodeInvalidRequest, map[string]any{"field": "payload"})
+		return models.Secret{}, false
+	}
+
+	return models.Secret{Type: secretType, Data: data, Metadata: req.Metadata, Revision: req.Revision}, true
+}
+
+// secretToV2 converts a stored secret to its API v2 form.
+func secretToV2(secret models.Secret) SecretV2 {
+	return SecretV2{
+		ID:        secret.ID,
+		Type:      secret.Type.String(),
+		Metadata:  secret.Metadata,
+		Payload:   dataToPayload(secret.Type, secret.Data),
+		CreatedAt: secret.CreatedAt,
+		UpdatedAt: secret.UpdatedAt,
+		Revision:  secret.Revision,
+	}
+}
+
+// payloadToData converts a payload to the stored data of a secret. Text and binary payloads
+// are stored as the raw bytes API v1 clients store, other payloads as JSON.
+func payloadToData(secretType models.SecretType, payload json.RawMessage) ([]byte, error) {
+	switch secretType {
+	case models.LoginPasswordType:
+		var login LoginPayload
+		if err := decodeStrict(payload, &login); err != nil {
+			return nil, err
+		}
+		if login.Raw != nil {
+			if login.Login != "" || login.Password != "" {
+				return nil, errors.New("raw cannot be combined with other fields")
+			}
+			return login.Raw, nil
+		}
+		return json.Marshal(login)
+	case models.TextDataType:
+		var text TextPayload
+		if err := decodeStrict(payload, &text); err != nil {
+			return nil, err
+		}
+		return []byte(text.Text), nil
+	case models.BinaryDataType:
+		var binary BinaryPayload
+		if err := decodeStrict(payload, &binary); err != nil {
+			return nil, err
+		}
+		return binary.Data, nil
+	case models.BankCardType:
+		var card BankCardPayload
+		if err := decodeStrict(payload, &card); err != nil {
+			return nil, err
+		}
+		if card.Raw != nil {
+			if card.Number != "" || card.Holder != "" || card.Expiry != "" || card.CVV != "" {
+				return nil, errors.New("raw cannot be combined with other fields")
+			}
+			return card.Raw, nil
+		}
+		return json.Marshal(card)
+	default:
+		return nil, fmt.Errorf("unsupported secret type %s", secretType)
+	}
+}
+
+// dataToPayload converts the stored data of a secret to its payload. Login and bank card
+// data that is not a JSON payload was stored through API v1 and is returned as raw data.
+func dataToPayload(secretType models.SecretType, data []byte) any {
+	switch secretType {
+	case models.LoginPasswordType:
+		var login LoginPayload
+		if len(data) > 0 && (decodeStrict(data, &login) != nil || login.Raw != nil) {
+			return LoginPayload{Raw: data}
+		}
+		return login
+	case models.TextDataType:
+		return TextPayload{Text: string(data)}
+	case models.BankCardType:
+		var card BankCardPayload
+		if len(data) > 0 && (decodeStrict(data, &card) != nil || card.Raw != nil) {
+			return BankCardPayload{Raw: data}
+		}
+		return card
+	default:
+		return BinaryPayload{Data: data}
+	}
+}
+
+// decodeStrict decodes a JSON object into v, rejecting unknown fields.
+func decodeStrict(data []byte, v any) error {
+	if data := bytes.TrimSpace(data); len(data) == 0 || bytes.Equal(data, []byte("null")) {
+		return errors.New("payload is required")
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
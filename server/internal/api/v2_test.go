@@ -0,0 +1,159 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"gophkeeper/server/internal/apierror"
+	"gophkeeper/server/internal/auth"
+	"gophkeeper/server/internal/models"
+	"gophkeeper/server/internal/storage"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+// TestSecretsV2 tests typed payloads, revisions and the sharing of secrets with API v1
+func TestSecretsV2(t *testing.T) {
+	store := storage.NewMemStore()
+	jwtManager := auth.NewJWTManager("test-secret")
+	jwtManager.SetRevocationList(auth.NewRevocationList(store))
+	api := New(store, jwtManager)
+	jwtManager.SetAPITokenAuth(api.ResolveAPIToken)
+	router := NewRouter(api, jwtManager)
+
+	user, _ := store.CreateUser(context.Background(), models.User{Login: "alice", Password: "x"})
+	token, _ := jwtManager.GenerateJWT(user.ID)
+
+	do := func(method, path, token string, body any) *httptest.ResponseRecorder {
+		payload, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, path, bytes.NewReader(payload))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+	decode := func(resp *httptest.ResponseRecorder, status int) SecretV2 {
+		t.Helper()
+		if resp.Code != status {
+			t.Fatalf("Expected status %d, got %d: %s", status, resp.Code, resp.Body)
+		}
+		var secret SecretV2
+		json.NewDecoder(resp.Body).Decode(&secret)
+		return secret
+	}
+	path := func(id int) string { return fmt.Sprintf("/api/v2/secrets/%d", id) }
+
+	// Typed payloads
+	created := decode(do(http.MethodPost, "/api/v2/secrets", token, SecretV2Request{
+		Type:     "login",
+		Metadata: "Mail",
+		Payload:  json.RawMessage(`{"login": "alice", "password": "hunter2"}`),
+	}), http.StatusCreated)
+	if created.Type != "login" || created.Revision != 1 || created.CreatedAt.IsZero() || !created.UpdatedAt.Equal(created.CreatedAt) {
+		t.Errorf("Unexpected created secret: %+v", created)
+	}
+	if payload, _ := created.Payload.(map[string]any); payload["login"] != "alice" || payload["password"] != "hunter2" {
+		t.Errorf("Expected the login payload, got %v", created.Payload)
+	}
+
+	// Text secrets are the same data in both versions
+	note := decode(do(http.MethodPost, "/api/v2/secrets", token, SecretV2Request{Type: "text", Payload: json.RawMessage(`{"text": "note"}`)}), http.StatusCreated)
+	resp := do(http.MethodGet, fmt.Sprintf("/api/secrets/%d", note.ID), token, nil)
+	var v1 models.Secret
+	json.NewDecoder(resp.Body).Decode(&v1)
+	if v1.Type != models.TextDataType || string(v1.Data) != "note" {
+		t.Errorf("Expected the text through API v1, got %+v", v1)
+	}
+
+	// Login data stored through API v1 in another format is returned as raw data
+	var legacy models.Secret
+	json.NewDecoder(do(http.MethodPost, "/api/secrets", token, models.Secret{Type: models.LoginPasswordType, Data: []byte("alice:hunter2")}).Body).Decode(&legacy)
+	fetched := decode(do(http.MethodGet, path(legacy.ID), token, nil), http.StatusOK)
+	if payload, _ := fetched.Payload.(map[string]any); payload["raw"] != "YWxpY2U6aHVudGVyMg==" {
+		t.Errorf("Expected raw legacy data, got %v", fetched.Payload)
+	}
+	updated := decode(do(http.MethodPut, path(legacy.ID), token, SecretV2Request{Type: "login", Payload: json.RawMessage(`{"raw": "YWxpY2U6aHVudGVyMw=="}`)}), http.StatusOK)
+	json.NewDecoder(do(http.MethodGet, fmt.Sprintf("/api/secrets/%d", legacy.ID), token, nil).Body).Decode(&v1)
+	if updated.Revision != 2 || string(v1.Data) != "alice:hunter3" {
+		t.Errorf("Expected raw data to be stored as is, got revision %d and %q", updated.Revision, v1.Data)
+	}
+
+	// Updates from an old revision conflict
+	updated = decode(do(http.MethodPut, path(created.ID), token, SecretV2Request{
+		Type:     "login",
+		Metadata: "Mail",
+		Payload:  json.RawMessage(`{"login": "alice", "password": "correct horse"}`),
+		Revision: 1,
+	}), http.StatusOK)
+	if updated.Revision != 2 || !updated.CreatedAt.Equal(created.CreatedAt) || updated.UpdatedAt.Before(created.UpdatedAt) {
+		t.Errorf("Unexpected updated secret: %+v", updated)
+	}
+	resp = do(http.MethodPut, path(created.ID), token, SecretV2Request{Type: "login", Payload: json.RawMessage(`{}`), Revision: 1})
+	var envelope apierror.Response
+	json.NewDecoder(resp.Body).Decode(&envelope)
+	if resp.Code != http.StatusConflict || envelope.Code != apierror.CodeRevisionConflict || envelope.Details["revision"] != float64(2) {
+		t.Errorf("Expected a revision conflict at revision 2, got %d: %+v", resp.Code, envelope)
+	}
+
+	// Invalid payloads
+	invalid := []SecretV2Request{
+		{Type: "note", Payload: json.RawMessage(`{"text": "x"}`)},
+		{Type: "text", Payload: json.RawMessage(`{"password": "x"}`)},
+		{Type: "login", Payload: json.RawMessage(`{"login": "alice", "raw": "eA=="}`)},
+		{Type: "bankcard"},
+	}
+	for _, req := range invalid {
+		if resp := do(http.MethodPost, "/api/v2/secrets", token, req); resp.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d for %s, got %d", http.StatusBadRequest, req.Payload, resp.Code)
+		}
+	}
+
+	var secrets []SecretV2
+	json.NewDecoder(do(http.MethodGet, "/api/v2/secrets?keyword=mail", token, nil).Body).Decode(&secrets)
+	if len(secrets) != 1 || secrets[0].ID != created.ID {
+		t.Errorf("Expected the mail secret, got %+v", secrets)
+	}
+
+	// Read-only API tokens cannot write through API v2 either
+	var readOnly CreateAPITokenResponse
+	json.NewDecoder(do(http.MethodPost, "/api/tokens", token, CreateAPITokenRequest{Name: "backup", Scope: models.TokenScope{ReadOnly: true}}).Body).Decode(&readOnly)
+	if resp := do(http.MethodGet, path(created.ID), readOnly.Token, nil); resp.Code != http.StatusOK {
+		t.Errorf("Expected status %d for a read with a read-only token, got %d", http.StatusOK, resp.Code)
+	}
+	if resp := do(http.MethodDelete, path(created.ID), readOnly.Token, nil); resp.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d for deletion with a read-only token, got %d", http.StatusForbidden, resp.Code)
+	}
+
+	if resp := do(http.MethodDelete, path(created.ID), token, nil); resp.Code != http.StatusNoContent {
+		t.Errorf("Expected status %d for deletion, got %d", http.StatusNoContent, resp.Code)
+	}
+	if resp := do(http.MethodGet, path(created.ID), token, nil); resp.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for a deleted secret, got %d", http.StatusNotFound, resp.Code)
+	}
+}
+
+// TestVersion tests the version and capabilities endpoint
+func TestVersion(t *testing.T) {
+	store := storage.NewMemStore()
+	jwtManager := auth.NewJWTManager("test-secret")
+	api := New(store, jwtManager)
+	api.SetRegistrationMode(RegistrationInviteOnly, time.Hour)
+	router := NewRouter(api, jwtManager)
+
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/api/version", nil))
+	var version VersionResponse
+	json.NewDecoder(resp.Body).Decode(&version)
+	if resp.Code != http.StatusOK || !slices.Contains(version.APIVersions, "v2") || len(version.SecretTypes) != 4 {
+		t.Errorf("Unexpected version response %d: %+v", resp.Code, version)
+	}
+	if version.Registration != RegistrationInviteOnly || !slices.Contains(version.Capabilities, "srp") || slices.Contains(version.Capabilities, "oidc") {
+		t.Errorf("Unexpected capabilities: %+v", version)
+	}
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// APIVersions are the versions of the secrets API the server supports, oldest first.
+var APIVersions = []string{"v1", "v2"}
+
+// VersionResponse is the response of GET /api/version. Clients use it to choose the API
+// version and to find out which optional features the server offers.
+type VersionResponse struct {
+	APIVersions []string `json:"api_versions"`
+	// SecretTypes are the type names of API v2
+	SecretTypes []string `json:"secret_types"`
+	// Capabilities are the optional features that are enabled, e.g. "oidc" or "seal"
+	Capabilities []string `json:"capabilities"`
+	// Registration is the registration mode: open, invite-only or closed
+	Registration RegistrationMode `json:"registration"`
+	// PasswordPolicy is the policy for the passwords of new users
+	PasswordPolicy PasswordPolicyResponse `json:"password_policy"`
+}
+
+// Version describes the API versions and the capabilities of the server.
+func (a *API) Version(w http.ResponseWriter, r *http.Request) {
+	capabilities := []string{"srp", "totp", "recovery_codes", "api_tokens", "sessions"}
+	if a.oidc != nil {
+		if a.oidc.SupportsAuthCode() {
+			capabilities = append(capabilities, "oidc")
+		}
+		if a.oidc.SupportsDeviceFlow() {
+			capabilities = append(capabilities, "oidc_device")
+		}
+	}
+	if a.seal != nil {
+		capabilities = append(capabilities, "seal")
+	}
+	registration := a.registrationMode
+	if registration == "" {
+		registration = RegistrationOpen
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(VersionResponse{
+		APIVersions:    APIVersions,
+		SecretTypes:    []string{"login", "text", "binary", "bankcard"},
+		Capabilities:   capabilities,
+		Registration:   registration,
+		PasswordPolicy: a.passwordPolicyResponse(),
+	})
+}
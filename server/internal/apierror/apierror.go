@@ -0,0 +1,98 @@
+// Package apierror writes the JSON error responses of the REST API.
+package apierror
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// RequestIDHeader carries the ID of a request. The router sets it on every response so
+// that error responses and server logs can be matched.
+const RequestIDHeader = "X-Request-Id"
+
+// Error codes are stable identifiers of failures for programs; messages may change.
+const (
+	CodeInvalidRequest     = "invalid_request"
+	CodeUnauthenticated    = "unauthenticated"
+	CodeForbidden          = "forbidden"
+	CodeNotFound           = "not_found"
+	CodeConflict           = "conflict"
+	CodePreconditionFailed = "precondition_failed"
+	CodeTooManyRequests    = "too_many_requests"
+	CodeInternal           = "internal_error"
+	CodeUnavailable        = "unavailable"
+	CodeUnknown            = "error"
+
+	CodeInvalidCredentials = "invalid_credentials"
+	CodeInvalidToken       = "invalid_token"
+	CodeTokenRevoked       = "token_revoked"
+	CodeAPITokenNotAllowed = "api_token_not_allowed"
+	CodeReadOnlyToken      = "read_only_token"
+	CodeOutOfScope         = "out_of_scope"
+	CodeLoginThrottled     = "login_throttled"
+	CodeWeakPassword       = "weak_password"
+	CodeRegistrationClosed = "registration_closed"
+	CodeInviteRequired     = "invite_required"
+	CodeInvalidInvite      = "invalid_invite"
+	CodeUserExists         = "user_exists"
+	CodeInvalidCode        = "invalid_code"
+	CodeRecentLoginNeeded  = "recent_login_required"
+	CodeSealed             = "sealed"
+	CodeSecretIntegrity    = "secret_integrity"
+	CodeRevisionConflict   = "revision_conflict"
+	CodeLinkRequired       = "identity_link_required"
+)
+
+// Response is the body of every error response.
+type Response struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// Details holds data specific to the code, such as retry_after for login_throttled
+	Details   map[string]any `json:"details,omitempty"`
+	RequestID string         `json:"request_id,omitempty"`
+}
+
+// Write responds with an error whose code is derived from the status.
+// It is a drop-in replacement for http.Error.
+func Write(w http.ResponseWriter, message string, status int) {
+	WriteCode(w, message, status, CodeForStatus(status), nil)
+}
+
+// WriteCode responds with an error with an explicit code and optional details.
+func WriteCode(w http.ResponseWriter, message string, status int, code string, details map[string]any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(Response{
+		Code:      code,
+		Message:   message,
+		Details:   details,
+		RequestID: w.Header().Get(RequestIDHeader),
+	})
+}
+
+// CodeForStatus returns the generic code of an HTTP status.
+func CodeForStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeInvalidRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthenticated
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusPreconditionFailed:
+		return CodePreconditionFailed
+	case http.StatusTooManyRequests:
+		return CodeTooManyRequests
+	case http.StatusInternalServerError:
+		return CodeInternal
+	case http.StatusServiceUnavailable:
+		return CodeUnavailable
+	default:
+		return CodeUnknown
+	}
+}
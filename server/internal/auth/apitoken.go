@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// APITokenPrefix starts every API token. It tells API tokens apart from JWTs and lets
+// secret scanners recognize leaked tokens.
+const APITokenPrefix = "gkp_"
+
+// apiTokenSize is the number of random bytes in an API token.
+const apiTokenSize = 32
+
+// APITokenResolver returns the claims of an API token. It reports ok as false if the
+// token is unknown, revoked or expired.
+type APITokenResolver func(ctx context.Context, token string) (claims *Claims, ok bool, err error)
+
+// GenerateAPIToken creates a new API token and returns it with its hash.
+// Only the hash is stored on the server.
+func GenerateAPIToken() (string, []byte, error) {
+	raw := make([]byte, apiTokenSize)
+	if _, err := rand.Read(raw); err != nil {
+		return "", nil, fmt.Errorf("failed to generate API token: %w", err)
+	}
+
+	token := APITokenPrefix + base64.RawURLEncoding.EncodeToString(raw)
+	return token, HashAPIToken(token), nil
+}
+
+// HashAPIToken returns the hash under which an API token is stored.
+// API tokens are random, so a plain SHA-256 is sufficient.
+func HashAPIToken(token string) []byte {
+	return HashRefreshToken(token)
+}
+
+// IsAPIToken reports whether a bearer token is an API token rather than a JWT.
+func IsAPIToken(token string) bool {
+	return strings.HasPrefix(token, APITokenPrefix)
+}
+
+// NewAPITokenID creates the public ID of an API token, used to list and revoke it.
+func NewAPITokenID() (string, error) {
+	return newTokenID()
+}
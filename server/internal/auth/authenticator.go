@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+)
+
+// ErrInvalidCredentials is returned by an Authenticator that does not accept a login and password.
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// AuthenticatedUser is a user whose login and password an Authenticator accepted.
+type AuthenticatedUser struct {
+	Login string
+	// Issuer and Subject identify an external user, such as the URL of an LDAP directory
+	// and the DN of the entry. They are empty for local users.
+	Issuer  string
+	Subject string
+	// Roles are granted by an external directory; they are nil for local users.
+	Roles []string
+}
+
+// Authenticator checks the login and password of a user.
+type Authenticator interface {
+	// Name identifies the authenticator in logs, such as "local" or "ldap".
+	Name() string
+	// Authenticate returns ErrInvalidCredentials if the login or password is wrong,
+	// and other errors if the credentials could not be checked.
+	Authenticate(ctx context.Context, login, password string) (AuthenticatedUser, error)
+}
+
+// PasswordLookup returns the password hash of the user with the given login.
+// It reports found as false if there is no such user.
+type PasswordLookup func(ctx context.Context, login string) (hash string, found bool, err error)
+
+// PasswordUpdate replaces the password hash of the user with the given login.
+type PasswordUpdate func(ctx context.Context, login, hash string) error
+
+// LocalAuthenticator checks passwords against the hashes of local users.
+type LocalAuthenticator struct {
+	lookup PasswordLookup
+	update PasswordUpdate
+}
+
+// NewLocalAuthenticator creates an authenticator for users registered with a password.
+// Hashes made with an outdated hasher are replaced through update after a successful check.
+func NewLocalAuthenticator(lookup PasswordLookup, update PasswordUpdate) *LocalAuthenticator {
+	return &LocalAuthenticator{lookup: lookup, update: update}
+}
+
+// Name returns "local".
+func (l *LocalAuthenticator) Name() string {
+	return "local"
+}
+
+// Authenticate checks the password against the stored hash. Unknown logins cost as
+// much as wrong passwords.
+func (l *LocalAuthenticator) Authenticate(ctx context.Context, login, password string) (AuthenticatedUser, error) {
+	hash, found, err := l.lookup(ctx, login)
+	if err != nil {
+		return AuthenticatedUser{}, err
+	}
+	// Accounts with an SRP verifier never send their password, so a password is an attack
+	if !found || IsSRPVerifier(hash) {
+		SimulatePasswordCheck(password)
+		return AuthenticatedUser{}, ErrInvalidCredentials
+	}
+	match, rehash, err := VerifyPassword(password, hash)
+	if err != nil {
+		return AuthenticatedUser{}, fmt.Errorf("failed to verify password of %s: %w", login, err)
+	}
+	if !match {
+		return AuthenticatedUser{}, ErrInvalidCredentials
+	}
+
+	if rehash {
+		// The password is only known now, so this is the one chance to upgrade the hash
+		if newHash, err := HashPassword(password); err != nil {
+			log.Printf("Failed to rehash password of %s: %v", login, err)
+		} else if err := l.update(ctx, login, newHash); err != nil {
+			log.Printf("Failed to store rehashed password of %s: %v", login, err)
+		}
+	}
+	return AuthenticatedUser{Login: login}, nil
+}
@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"strings"
+)
+
+// Prefixes of client certificate identities in a ClientCertMapping.
+const (
+	certIdentityURI   = "URI="
+	certIdentityDNS   = "DNS="
+	certIdentityEmail = "EMAIL="
+	certIdentityCN    = "CN="
+)
+
+// ClientCertMapping maps identities of client certificates to user logins.
+// Identities are written as "URI=spiffe://...", "DNS=host.example.com",
+// "EMAIL=user@example.com" or "CN=common name".
+type ClientCertMapping map[string]string
+
+// UserResolver returns the ID of the user with the given login.
+// It reports found as false if there is no such user.
+type UserResolver func(ctx context.Context, login string) (id int, found bool, err error)
+
+// clientCertAuth authenticates requests without a bearer token by their client certificate.
+type clientCertAuth struct {
+	mapping ClientCertMapping
+	resolve UserResolver
+}
+
+// ParseClientCertMapping validates identities and normalizes their prefixes to upper case.
+func ParseClientCertMapping(identities map[string]string) (ClientCertMapping, error) {
+	mapping := make(ClientCertMapping, len(identities))
+	for identity, login := range identities {
+		kind, value, found := strings.Cut(identity, "=")
+		kind = strings.ToUpper(kind) + "="
+		if !found || value == "" || login == "" {
+			return nil, fmt.Errorf("invalid client certificate mapping %q: expected \"TYPE=value\" and a login", identity)
+		}
+		switch kind {
+		case certIdentityURI, certIdentityDNS, certIdentityCN:
+		case certIdentityEmail:
+			value = strings.ToLower(value)
+		default:
+			return nil, fmt.Errorf("invalid client certificate mapping %q: type must be URI, DNS, EMAIL or CN", identity)
+		}
+		if kind == certIdentityDNS {
+			value = strings.ToLower(value)
+		}
+		mapping[kind+value] = login
+	}
+	return mapping, nil
+}
+
+// ClientCertIdentities returns the identities of a certificate in the order they are
+// matched: URI, DNS and email SANs, then the subject common name.
+func ClientCertIdentities(cert *x509.Certificate) []string {
+	var identities []string
+	for _, uri := range cert.URIs {
+		identities = append(identities, certIdentityURI+uri.String())
+	}
+	for _, name := range cert.DNSNames {
+		identities = append(identities, certIdentityDNS+strings.ToLower(name))
+	}
+	for _, email := range cert.EmailAddresses {
+		identities = append(identities, certIdentityEmail+strings.ToLower(email))
+	}
+	if cert.Subject.CommonName != "" {
+		identities = append(identities, certIdentityCN+cert.Subject.CommonName)
+	}
+	return identities
+}
+
+// Login returns the login mapped to the first matching identity of a certificate.
+func (m ClientCertMapping) Login(cert *x509.Certificate) (string, bool) {
+	for _, identity := range ClientCertIdentities(cert) {
+		if login, ok := m[identity]; ok {
+			return login, true
+		}
+	}
+	return "", false
+}
+
+// authenticate returns the claims of the user a verified client certificate is mapped to.
+// The claims have no token ID, so there is nothing to revoke.
+func (c *clientCertAuth) authenticate(ctx context.Context, cert *x509.Certificate) (*Claims, bool, error) {
+	login, ok := c.mapping.Login(cert)
+	if !ok {
+		return nil, false, nil
+	}
+	userID, found, err := c.resolve(ctx, login)
+	if err != nil || !found {
+		return nil, false, err
+	}
+	return &Claims{UserID: userID}, true, nil
+}
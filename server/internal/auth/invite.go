@@ -0,0 +1,32 @@
+package auth
+
+import (
+	"crypto/rand"
+	"gophkeeper/server/internal/models"
+	"time"
+)
+
+// NewInvite creates an invite code valid for ttl and the invite under which its hash is
+// stored. createdBy is the issuing user, or nil for an operator.
+func NewInvite(createdBy *int, ttl time.Duration) (string, models.Invite, error) {
+	id, err := newTokenID()
+	if err != nil {
+		return "", models.Invite{}, err
+	}
+
+	code := rand.Text()
+	now := time.Now()
+	return code, models.Invite{
+		ID:        id,
+		CodeHash:  HashInviteCode(code),
+		CreatedBy: createdBy,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}, nil
+}
+
+// HashInviteCode returns the hash under which an invite code is stored.
+// Invite codes are random, so a plain SHA-256 is sufficient.
+func HashInviteCode(code string) []byte {
+	return HashRefreshToken(code)
+}
@@ -3,27 +3,144 @@ package auth
 
 import (
 	"context"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"gophkeeper/server/internal/apierror"
+	"gophkeeper/server/internal/models"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// DefaultAccessTokenTTL is the lifetime of access tokens unless configured otherwise.
+const DefaultAccessTokenTTL = 15 * time.Minute
+
+// MFAChallengeTTL is the time a user has to enter the second factor after the password.
+const MFAChallengeTTL = 5 * time.Minute
+
+// LoginCodeTTL is the time a client has to exchange a login code for tokens.
+const LoginCodeTTL = time.Minute
+
+// mfaChallengePurpose marks tokens that only prove the password was checked.
+const mfaChallengePurpose = "mfa"
+
+// loginCodePurpose marks tokens that hand a completed single sign-on to a client.
+const loginCodePurpose = "login"
+
 // JWTManager handles JWT token generation and validation.
+// Tokens are signed with HS256 and the shared secret unless an asymmetric signing key is set.
 type JWTManager struct {
-	jwtKey []byte
+	jwtKey      []byte
+	signingKey  *SigningKey
+	keys        map[string]*SigningKey
+	issuer      string
+	audience    string
+	accessTTL   time.Duration
+	revocations *RevocationList
+	clientCerts *clientCertAuth
+	apiTokens   APITokenResolver
 }
 
 // NewJWTManager creates a new JWTManager with the given secret key.
 func NewJWTManager(secret string) *JWTManager {
-	return &JWTManager{jwtKey: []byte(secret)}
+	return &JWTManager{jwtKey: []byte(secret), accessTTL: DefaultAccessTokenTTL}
+}
+
+// NewJWTManagerWithKeys creates a JWTManager that signs tokens with an asymmetric key.
+// Tokens signed by any of the verification keys, such as keys rotated out, are still accepted.
+// Tokens signed with a shared secret are not.
+func NewJWTManagerWithKeys(signing *SigningKey, verification ...*SigningKey) (*JWTManager, error) {
+	if signing == nil || !signing.CanSign() {
+		return nil, fmt.Errorf("signing key must include the private key")
+	}
+
+	j := &JWTManager{
+		signingKey: signing,
+		keys:       map[string]*SigningKey{signing.ID: signing},
+		accessTTL:  DefaultAccessTokenTTL,
+	}
+	for _, key := range verification {
+		if _, exists := j.keys[key.ID]; !exists {
+			j.keys[key.ID] = key
+		}
+	}
+	return j, nil
+}
+
+// SetIssuer sets the iss claim of generated tokens and requires it in validated ones.
+func (j *JWTManager) SetIssuer(issuer string) {
+	j.issuer = issuer
+}
+
+// SetAudience sets the aud claim of generated tokens and requires it in validated ones.
+func (j *JWTManager) SetAudience(audience string) {
+	j.audience = audience
+}
+
+// JWKS returns the public keys that verify tokens, for services that validate
+// tokens on their own. It is empty when tokens are signed with a shared secret.
+func (j *JWTManager) JWKS() JSONWebKeySet {
+	set := JSONWebKeySet{Keys: []JSONWebKey{}}
+	if j.signingKey == nil {
+		return set
+	}
+
+	// The signing key comes first, followed by the verification keys in a stable order
+	set.Keys = append(set.Keys, j.signingKey.JWK())
+	ids := make([]string, 0, len(j.keys))
+	for id := range j.keys {
+		if id != j.signingKey.ID {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	for _, id := range ids {
+		set.Keys = append(set.Keys, j.keys[id].JWK())
+	}
+	return set
+}
+
+// SetAccessTokenTTL sets the lifetime of generated access tokens.
+func (j *JWTManager) SetAccessTokenTTL(ttl time.Duration) {
+	j.accessTTL = ttl
+}
+
+// AccessTokenTTL returns the lifetime of generated access tokens.
+func (j *JWTManager) AccessTokenTTL() time.Duration {
+	return j.accessTTL
+}
+
+// SetRevocationList enables checking tokens against a revocation list in AuthMiddleware.
+// Tokens without an ID cannot be revoked and are rejected once it is set.
+func (j *JWTManager) SetRevocationList(revocations *RevocationList) {
+	j.revocations = revocations
+}
+
+// SetClientCertAuth lets AuthMiddleware accept requests without an Authorization header
+// that present a verified TLS client certificate mapped to a user.
+func (j *JWTManager) SetClientCertAuth(mapping ClientCertMapping, resolve UserResolver) {
+	j.clientCerts = &clientCertAuth{mapping: mapping, resolve: resolve}
+}
+
+// SetAPITokenAuth lets APITokenMiddleware accept API tokens resolved by resolve.
+func (j *JWTManager) SetAPITokenAuth(resolve APITokenResolver) {
+	j.apiTokens = resolve
 }
 
 // Claims contains the JWT claims.
 type Claims struct {
 	UserID int `json:"user_id"`
+	// SessionID is the login session the token was issued for, if any.
+	SessionID string `json:"sid,omitempty"`
+	// Purpose is set on tokens that are not access tokens, such as MFA challenges.
+	Purpose string `json:"purpose,omitempty"`
+	// APITokenID and Scope are set for requests authenticated with an API token.
+	APITokenID string             `json:"-"`
+	Scope      *models.TokenScope `json:"-"`
 	jwt.RegisteredClaims
 }
 
@@ -33,14 +150,107 @@ type ContextKey string
 // UserIDContextKey is the key for the user ID in the context.
 const UserIDContextKey ContextKey = "userID"
 
-// GenerateJWT creates a new JWT token for a given user ID.
+// ClaimsContextKey is the key for the validated token claims in the context.
+const ClaimsContextKey ContextKey = "claims"
+
+// GenerateJWT creates a new short-lived access token for a given user ID.
 func (j *JWTManager) GenerateJWT(userID int) (string, error) {
-	expirationTime := time.Now().Add(24 * time.Hour)
-	claims := &Claims{
-		UserID: userID,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-		},
+	return j.GenerateSessionJWT(userID, "")
+}
+
+// GenerateSessionJWT creates a new short-lived access token for a user's login session.
+// Revoking the session with RevokeSession revokes the token as well.
+func (j *JWTManager) GenerateSessionJWT(userID int, sessionID string) (string, error) {
+	return j.generate(&Claims{UserID: userID, SessionID: sessionID}, j.accessTTL)
+}
+
+// GenerateMFAChallenge creates a token proving that the user passed the password check.
+// It is exchanged for an access token together with the second factor and cannot be
+// used as an access token itself.
+func (j *JWTManager) GenerateMFAChallenge(userID int) (string, error) {
+	return j.generate(&Claims{UserID: userID, Purpose: mfaChallengePurpose}, MFAChallengeTTL)
+}
+
+// ParseMFAChallenge validates a token created by GenerateMFAChallenge and returns its claims.
+func (j *JWTManager) ParseMFAChallenge(tokenString string) (*Claims, error) {
+	return j.parsePurpose(tokenString, mfaChallengePurpose)
+}
+
+// UseMFAChallenge validates a challenge and revokes it, so that every challenge allows
+// a single attempt at the second factor.
+func (j *JWTManager) UseMFAChallenge(ctx context.Context, tokenString string) (*Claims, error) {
+	return j.useOnce(ctx, tokenString, mfaChallengePurpose)
+}
+
+// GenerateLoginCode creates a short-lived code that a client exchanges for tokens once
+// the user has signed in elsewhere, such as in a browser.
+func (j *JWTManager) GenerateLoginCode(userID int) (string, error) {
+	return j.generate(&Claims{UserID: userID, Purpose: loginCodePurpose}, LoginCodeTTL)
+}
+
+// UseLoginCode validates a login code and revokes it, so that it can be exchanged only once.
+func (j *JWTManager) UseLoginCode(ctx context.Context, tokenString string) (*Claims, error) {
+	return j.useOnce(ctx, tokenString, loginCodePurpose)
+}
+
+// parsePurpose validates a token generated for a purpose and returns its claims.
+func (j *JWTManager) parsePurpose(tokenString, purpose string) (*Claims, error) {
+	claims, err := j.ParseJWT(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Purpose != purpose {
+		return nil, fmt.Errorf("not a %s token", purpose)
+	}
+	return claims, nil
+}
+
+// useOnce validates a token generated for a purpose and revokes it. The token is checked
+// and revoked in one step, so that concurrent requests cannot use it more than once.
+func (j *JWTManager) useOnce(ctx context.Context, tokenString, purpose string) (*Claims, error) {
+	claims, err := j.parsePurpose(tokenString, purpose)
+	if err != nil {
+		return nil, err
+	}
+	if j.revocations == nil {
+		return nil, fmt.Errorf("token revocation is not enabled")
+	}
+	if claims.ID == "" || claims.ExpiresAt == nil {
+		return nil, fmt.Errorf("token cannot be revoked")
+	}
+
+	revoked, err := j.revocations.RevokeOnce(ctx, claims.ID, claims.ExpiresAt.Time)
+	if err != nil {
+		return nil, err
+	}
+	if !revoked {
+		return nil, fmt.Errorf("%s token already used", purpose)
+	}
+	return claims, nil
+}
+
+// generate signs claims with a new token ID that expire after ttl.
+func (j *JWTManager) generate(claims *Claims, ttl time.Duration) (string, error) {
+	tokenID, err := newTokenID()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ID:        tokenID,
+		Issuer:    j.issuer,
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+	}
+	if j.audience != "" {
+		claims.Audience = jwt.ClaimStrings{j.audience}
+	}
+
+	if j.signingKey != nil {
+		token := jwt.NewWithClaims(j.signingKey.method, claims)
+		token.Header["kid"] = j.signingKey.ID
+		return token.SignedString(j.signingKey.private)
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
@@ -49,49 +259,208 @@ func (j *JWTManager) GenerateJWT(userID int) (string, error) {
 	return tokenString, err
 }
 
+// verificationKey selects the key for a token by its kid header and checks that the
+// token's algorithm matches the key, so that a public key is never used as an HMAC secret.
+func (j *JWTManager) verificationKey(token *jwt.Token) (interface{}, error) {
+	if j.signingKey == nil {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+		}
+		return j.jwtKey, nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	key, exists := j.keys[kid]
+	if !exists {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s for key %q", token.Method.Alg(), kid)
+	}
+	return key.public, nil
+}
+
 // ValidateJWT validates a JWT token and returns the user ID from the claims if valid.
 func (j *JWTManager) ValidateJWT(tokenString string) (int, error) {
+	claims, err := j.ParseJWT(tokenString)
+	if err != nil {
+		return 0, err
+	}
+	return claims.UserID, nil
+}
+
+// RevokeJWT revokes a validated token until it expires.
+func (j *JWTManager) RevokeJWT(ctx context.Context, claims *Claims) error {
+	if j.revocations == nil {
+		return fmt.Errorf("token revocation is not enabled")
+	}
+	if claims.ID == "" || claims.ExpiresAt == nil {
+		return fmt.Errorf("token cannot be revoked")
+	}
+	return j.revocations.Revoke(ctx, claims.ID, claims.ExpiresAt.Time)
+}
+
+// RevokeSession revokes every access token issued for a session.
+// Tokens issued before the call expire within the access token TTL, so the
+// revocation is kept that long.
+func (j *JWTManager) RevokeSession(ctx context.Context, sessionID string) error {
+	if j.revocations == nil {
+		return fmt.Errorf("token revocation is not enabled")
+	}
+	return j.revocations.Revoke(ctx, sessionRevocationID(sessionID), time.Now().Add(j.accessTTL))
+}
+
+// sessionRevocationID is the revocation list entry of a session.
+// The prefix keeps session IDs apart from token IDs.
+func sessionRevocationID(sessionID string) string {
+	return "sid:" + sessionID
+}
+
+// ParseJWT validates a JWT token and returns its claims.
+// It checks the signature and expiry but not the revocation list.
+func (j *JWTManager) ParseJWT(tokenString string) (*Claims, error) {
 	claims := &Claims{}
 
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return j.jwtKey, nil
-	})
+	var options []jwt.ParserOption
+	if j.issuer != "" {
+		options = append(options, jwt.WithIssuer(j.issuer))
+	}
+	if j.audience != "" {
+		options = append(options, jwt.WithAudience(j.audience))
+	}
+
+	token, err := jwt.ParseWithClaims(tokenString, claims, j.verificationKey, options...)
 
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
 	if !token.Valid {
-		return 0, fmt.Errorf("invalid token")
+		return nil, fmt.Errorf("invalid token")
 	}
 
-	return claims.UserID, nil
+	return claims, nil
 }
 
 // AuthMiddleware is a middleware that validates the JWT token and sets the UserID in the context.
+// Without an Authorization header, a client certificate is accepted if SetClientCertAuth was called.
+// API tokens are rejected.
 func (j *JWTManager) AuthMiddleware(next http.Handler) http.Handler {
+	return j.authenticate(next, false)
+}
+
+// APITokenMiddleware is AuthMiddleware that also accepts API tokens.
+// Handlers behind it must enforce the Scope of the claims.
+func (j *JWTManager) APITokenMiddleware(next http.Handler) http.Handler {
+	return j.authenticate(next, true)
+}
+
+// authenticate validates the credentials of a request and stores its claims in the context.
+func (j *JWTManager) authenticate(next http.Handler, allowAPITokens bool) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			http.Error(w, "Authorization header required", http.StatusUnauthorized)
-			return
+		var cert *x509.Certificate
+		if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+			cert = r.TLS.VerifiedChains[0][0]
 		}
 
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-		if tokenString == authHeader {
-			http.Error(w, "Invalid authorization header format", http.StatusUnauthorized)
+		claims, err := j.Authenticate(r.Context(), r.Header.Get("Authorization"), cert, allowAPITokens)
+		if err != nil {
+			var authErr *AuthError
+			switch {
+			case errors.As(err, &authErr) && authErr.Forbidden:
+				apierror.WriteCode(w, authErr.Message, http.StatusForbidden, authErr.Code, nil)
+			case errors.As(err, &authErr):
+				apierror.WriteCode(w, authErr.Message, http.StatusUnauthorized, authErr.Code, nil)
+			default:
+				apierror.Write(w, "Server error", http.StatusInternalServerError)
+			}
 			return
 		}
 
-		userID, err := j.ValidateJWT(tokenString)
+		next.ServeHTTP(w, r.WithContext(ContextWithClaims(r.Context(), claims)))
+	})
+}
+
+// AuthError rejects the credentials of a request. Forbidden is set for valid credentials
+// that cannot be used for the request, such as API tokens outside /api/secrets.
+type AuthError struct {
+	// Code is one of the apierror codes
+	Code      string
+	Message   string
+	Forbidden bool
+}
+
+func (e *AuthError) Error() string {
+	return e.Message
+}
+
+// Authenticate validates an Authorization value ("Bearer <token>") and returns its claims.
+// Without one, the verified client certificate cert is accepted if SetClientCertAuth was
+// called. Rejected credentials return an *AuthError; other errors are server errors.
+// It is shared by the HTTP middleware and the gRPC interceptors.
+func (j *JWTManager) Authenticate(ctx context.Context, authorization string, cert *x509.Certificate, allowAPITokens bool) (*Claims, error) {
+	if authorization == "" && j.clientCerts != nil && cert != nil {
+		claims, ok, err := j.clientCerts.authenticate(ctx, cert)
 		if err != nil {
-			http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
-			return
+			return nil, err
+		}
+		if !ok {
+			return nil, &AuthError{Code: apierror.CodeUnauthenticated, Message: "Client certificate is not mapped to a user"}
 		}
+		return claims, nil
+	}
+	if authorization == "" {
+		return nil, &AuthError{Code: apierror.CodeUnauthenticated, Message: "Authorization header required"}
+	}
 
-		ctx := context.WithValue(r.Context(), UserIDContextKey, userID)
-		next.ServeHTTP(w, r.WithContext(ctx))
-	})
+	tokenString := strings.TrimPrefix(authorization, "Bearer ")
+	if tokenString == authorization {
+		return nil, &AuthError{Code: apierror.CodeInvalidToken, Message: "Invalid authorization header format"}
+	}
+
+	if IsAPIToken(tokenString) {
+		if !allowAPITokens || j.apiTokens == nil {
+			return nil, &AuthError{Code: apierror.CodeAPITokenNotAllowed, Message: "API tokens cannot be used for this endpoint", Forbidden: true}
+		}
+		claims, ok, err := j.apiTokens(ctx, tokenString)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, &AuthError{Code: apierror.CodeInvalidToken, Message: "Invalid or expired token"}
+		}
+		return claims, nil
+	}
+
+	claims, err := j.ParseJWT(tokenString)
+	if err != nil || claims.Purpose != "" {
+		return nil, &AuthError{Code: apierror.CodeInvalidToken, Message: "Invalid or expired token"}
+	}
+
+	if j.revocations != nil {
+		if claims.ID == "" {
+			return nil, &AuthError{Code: apierror.CodeInvalidToken, Message: "Invalid or expired token"}
+		}
+
+		revoked, err := j.revocations.IsRevoked(ctx, claims.ID)
+		if err == nil && !revoked && claims.SessionID != "" {
+			revoked, err = j.revocations.IsRevoked(ctx, sessionRevocationID(claims.SessionID))
+		}
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			return nil, &AuthError{Code: apierror.CodeTokenRevoked, Message: "Token has been revoked"}
+		}
+	}
+
+	return claims, nil
+}
+
+// ContextWithClaims stores the claims of an authenticated request and its user ID in the context.
+func ContextWithClaims(ctx context.Context, claims *Claims) context.Context {
+	ctx = context.WithValue(ctx, UserIDContextKey, claims.UserID)
+	return context.WithValue(ctx, ClaimsContextKey, claims)
 }
 
 // GetUserIDFromContext retrieves the UserID from the request context.
@@ -99,3 +468,9 @@ func GetUserIDFromContext(ctx context.Context) (int, bool) {
 	userID, ok := ctx.Value(UserIDContextKey).(int)
 	return userID, ok
 }
+
+// GetClaimsFromContext retrieves the validated token claims from the request context.
+func GetClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(ClaimsContextKey).(*Claims)
+	return claims, ok
+}
@@ -0,0 +1,264 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// minRSAKeyBits is the smallest RSA modulus accepted for signing keys.
+const minRSAKeyBits = 2048
+
+// SigningKey is an asymmetric key that signs or verifies tokens.
+// Verification-only keys keep accepting tokens signed by a retired key.
+type SigningKey struct {
+	// ID is the RFC 7638 thumbprint of the public key, sent as the kid token header.
+	ID      string
+	method  jwt.SigningMethod
+	private crypto.Signer
+	public  crypto.PublicKey
+}
+
+// JSONWebKey is the public part of a SigningKey in JWK format (RFC 7517).
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+// JSONWebKeySet is served at /.well-known/jwks.json.
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// GenerateSigningKey creates a new Ed25519 signing key.
+func GenerateSigningKey() (*SigningKey, error) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate signing key: %w", err)
+	}
+	return newSigningKey(private.Public(), private)
+}
+
+// ParseSigningKey parses a PEM-encoded Ed25519, ECDSA P-256 or RSA private key.
+// The signing algorithm (EdDSA, ES256 or RS256) follows from the key type.
+func ParseSigningKey(pemData []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found")
+	}
+
+	private, err := parsePrivateKey(block)
+	if err != nil {
+		return nil, err
+	}
+	return newSigningKey(private.Public(), private)
+}
+
+// ParseVerificationKey parses a PEM-encoded public key, or a private key whose public
+// part is used, of a key that no longer signs tokens but whose tokens are still accepted.
+func ParseVerificationKey(pemData []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found")
+	}
+
+	if block.Type != "PUBLIC KEY" {
+		private, err := parsePrivateKey(block)
+		if err != nil {
+			return nil, err
+		}
+		return newSigningKey(private.Public(), nil)
+	}
+
+	public, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %w", err)
+	}
+	return newSigningKey(public, nil)
+}
+
+// ParseJSONWebKey parses the public key of a JWK, such as one published by an identity provider.
+// The key ID of the result is the RFC 7638 thumbprint, not the kid of the JWK.
+func ParseJSONWebKey(jwk JSONWebKey) (*SigningKey, error) {
+	decode := func(name, value string) ([]byte, error) {
+		data, err := base64.RawURLEncoding.DecodeString(value)
+		if err != nil || len(data) == 0 {
+			return nil, fmt.Errorf("invalid JWK member %q", name)
+		}
+		return data, nil
+	}
+
+	switch jwk.Kty {
+	case "OKP":
+		if jwk.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported OKP curve %q", jwk.Crv)
+		}
+		x, err := decode("x", jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 key size %d", len(x))
+		}
+		return newSigningKey(ed25519.PublicKey(x), nil)
+	case "EC":
+		if jwk.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported EC curve %q", jwk.Crv)
+		}
+		x, err := decode("x", jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode("y", jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		public := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if _, err := public.ECDH(); err != nil {
+			return nil, fmt.Errorf("invalid EC public key: %w", err)
+		}
+		return newSigningKey(public, nil)
+	case "RSA":
+		n, err := decode("n", jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode("e", jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 || exponent.Int64() < 3 {
+			return nil, fmt.Errorf("invalid RSA exponent")
+		}
+		return newSigningKey(&rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil)
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", jwk.Kty)
+	}
+}
+
+func parsePrivateKey(block *pem.Block) (crypto.Signer, error) {
+	var key any
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+	return signer, nil
+}
+
+func newSigningKey(public crypto.PublicKey, private crypto.Signer) (*SigningKey, error) {
+	key := &SigningKey{public: public, private: private}
+
+	switch pub := public.(type) {
+	case ed25519.PublicKey:
+		key.method = jwt.SigningMethodEdDSA
+	case *ecdsa.PublicKey:
+		if pub.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("unsupported ECDSA curve %s: only P-256 is supported", pub.Curve.Params().Name)
+		}
+		key.method = jwt.SigningMethodES256
+	case *rsa.PublicKey:
+		if pub.N.BitLen() < minRSAKeyBits {
+			return nil, fmt.Errorf("RSA key too short: %d bits (min %d)", pub.N.BitLen(), minRSAKeyBits)
+		}
+		key.method = jwt.SigningMethodRS256
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", public)
+	}
+
+	jwk := key.JWK()
+	id, err := thumbprint(jwk)
+	if err != nil {
+		return nil, err
+	}
+	key.ID = id
+	return key, nil
+}
+
+// Algorithm returns the JWS algorithm of the key.
+func (k *SigningKey) Algorithm() string {
+	return k.method.Alg()
+}
+
+// CanSign reports whether the key has a private part.
+func (k *SigningKey) CanSign() bool {
+	return k.private != nil
+}
+
+// JWK returns the public key in JWK format.
+func (k *SigningKey) JWK() JSONWebKey {
+	jwk := JSONWebKey{Kid: k.ID, Use: "sig", Alg: k.method.Alg()}
+
+	switch pub := k.public.(type) {
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		jwk.Kty = "EC"
+		jwk.Crv = pub.Curve.Params().Name
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub.X.FillBytes(make([]byte, size)))
+		jwk.Y = base64.RawURLEncoding.EncodeToString(pub.Y.FillBytes(make([]byte, size)))
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	}
+	return jwk
+}
+
+// thumbprint computes the RFC 7638 thumbprint of a JWK: the SHA-256 of its required
+// members in lexicographic order. encoding/json sorts map keys, which gives that order.
+func thumbprint(jwk JSONWebKey) (string, error) {
+	members := map[string]string{"kty": jwk.Kty}
+	switch jwk.Kty {
+	case "OKP":
+		members["crv"], members["x"] = jwk.Crv, jwk.X
+	case "EC":
+		members["crv"], members["x"], members["y"] = jwk.Crv, jwk.X, jwk.Y
+	case "RSA":
+		members["n"], members["e"] = jwk.N, jwk.E
+	}
+
+	data, err := json.Marshal(members)
+	if err != nil {
+		return "", fmt.Errorf("failed to compute key ID: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,194 @@
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// ldapTimeout bounds the connection to the directory and every operation on it.
+const ldapTimeout = 10 * time.Second
+
+// LDAPConfig configures authentication against an LDAP directory.
+type LDAPConfig struct {
+	// URL is the address of the directory, such as ldap://host:389 or ldaps://host:636.
+	URL string
+	// StartTLS upgrades an ldap:// connection to TLS before any credentials are sent.
+	StartTLS  bool
+	TLSConfig *tls.Config
+	// BindDN and BindPassword authenticate the search for users. The search is
+	// anonymous without them.
+	BindDN       string
+	BindPassword string
+	BaseDN       string
+	// UserFilter finds the entry of a user; %s is replaced with the escaped login.
+	UserFilter string
+	// GroupAttribute lists the groups of a user entry, such as memberOf.
+	GroupAttribute string
+	// GroupRoles maps group DNs to roles. If it is set, only members of a mapped group
+	// can sign in.
+	GroupRoles map[string]string
+}
+
+// LDAPAuthenticator authenticates users with a bind as their directory entry.
+type LDAPAuthenticator struct {
+	config     LDAPConfig
+	groupRoles []ldapGroupRole
+}
+
+type ldapGroupRole struct {
+	group *ldap.DN
+	role  string
+}
+
+// NewLDAPAuthenticator validates the configuration of a directory.
+func NewLDAPAuthenticator(config LDAPConfig) (*LDAPAuthenticator, error) {
+	if config.URL == "" || config.BaseDN == "" {
+		return nil, fmt.Errorf("LDAP URL and base DN are required")
+	}
+	if strings.Count(config.UserFilter, "%s") != 1 {
+		return nil, fmt.Errorf("LDAP user filter %q must contain %%s exactly once", config.UserFilter)
+	}
+	if config.StartTLS && strings.HasPrefix(strings.ToLower(config.URL), "ldaps:") {
+		return nil, fmt.Errorf("StartTLS cannot be used with an ldaps:// URL")
+	}
+	u, err := url.Parse(config.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid LDAP URL: %w", err)
+	}
+	// StartTLS needs the server name to verify the certificate
+	if config.TLSConfig == nil {
+		config.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	if config.TLSConfig.ServerName == "" {
+		config.TLSConfig = config.TLSConfig.Clone()
+		config.TLSConfig.ServerName = u.Hostname()
+	}
+	if config.GroupAttribute == "" {
+		config.GroupAttribute = "memberOf"
+	}
+
+	l := &LDAPAuthenticator{config: config}
+	for group, role := range config.GroupRoles {
+		dn, err := ldap.ParseDN(group)
+		if err != nil {
+			return nil, fmt.Errorf("invalid LDAP group DN %q: %w", group, err)
+		}
+		if role == "" {
+			return nil, fmt.Errorf("LDAP group %q is mapped to an empty role", group)
+		}
+		l.groupRoles = append(l.groupRoles, ldapGroupRole{group: dn, role: role})
+	}
+	return l, nil
+}
+
+// Name returns "ldap".
+func (l *LDAPAuthenticator) Name() string {
+	return "ldap"
+}
+
+// Authenticate finds the entry of the user and binds as it with the password.
+func (l *LDAPAuthenticator) Authenticate(ctx context.Context, login, password string) (AuthenticatedUser, error) {
+	// An empty password makes an unauthenticated bind, which succeeds for any DN
+	if login == "" || password == "" {
+		return AuthenticatedUser{}, ErrInvalidCredentials
+	}
+
+	conn, err := l.connect(ctx)
+	if err != nil {
+		return AuthenticatedUser{}, err
+	}
+	defer conn.Close()
+
+	entry, err := l.findUser(conn, login)
+	if err != nil {
+		return AuthenticatedUser{}, err
+	}
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return AuthenticatedUser{}, ErrInvalidCredentials
+		}
+		return AuthenticatedUser{}, fmt.Errorf("failed to bind as user: %w", err)
+	}
+
+	roles := l.roles(entry.GetEqualFoldAttributeValues(l.config.GroupAttribute))
+	if len(l.groupRoles) > 0 && len(roles) == 0 {
+		return AuthenticatedUser{}, fmt.Errorf("%w: %s is not a member of a mapped group", ErrInvalidCredentials, login)
+	}
+	// Users are linked by their DN; the login only names provisioned users, in lower case
+	// since directories match logins case-insensitively
+	return AuthenticatedUser{Login: strings.ToLower(login), Issuer: l.config.URL, Subject: entry.DN, Roles: roles}, nil
+}
+
+// connect opens a connection to the directory and binds with the search credentials.
+// The connection is closed when ctx is done.
+func (l *LDAPAuthenticator) connect(ctx context.Context) (*ldap.Conn, error) {
+	conn, err := ldap.DialURL(l.config.URL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: ldapTimeout}),
+		ldap.DialWithTLSConfig(l.config.TLSConfig))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to LDAP server: %w", err)
+	}
+	conn.SetTimeout(ldapTimeout)
+	context.AfterFunc(ctx, func() { conn.Close() })
+
+	if l.config.StartTLS {
+		if err := conn.StartTLS(l.config.TLSConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to start TLS with LDAP server: %w", err)
+		}
+	}
+	if l.config.BindDN != "" {
+		if err := conn.Bind(l.config.BindDN, l.config.BindPassword); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to bind as %s: %w", l.config.BindDN, err)
+		}
+	}
+	return conn, nil
+}
+
+// findUser returns the only entry that matches the user filter.
+func (l *LDAPAuthenticator) findUser(conn *ldap.Conn, login string) (*ldap.Entry, error) {
+	result, err := conn.Search(ldap.NewSearchRequest(
+		l.config.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		2, int(ldapTimeout.Seconds()), false,
+		fmt.Sprintf(l.config.UserFilter, ldap.EscapeFilter(login)),
+		[]string{l.config.GroupAttribute},
+		nil,
+	))
+	if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return nil, fmt.Errorf("failed to search for user: %w", err)
+	}
+	if result == nil || len(result.Entries) != 1 {
+		// Ambiguous logins are rejected rather than guessed
+		return nil, ErrInvalidCredentials
+	}
+	return result.Entries[0], nil
+}
+
+// roles maps the group DNs of a user to roles.
+func (l *LDAPAuthenticator) roles(groups []string) []string {
+	var roles []string
+	for _, group := range groups {
+		dn, err := ldap.ParseDN(group)
+		if err != nil {
+			continue
+		}
+		for _, mapping := range l.groupRoles {
+			if mapping.group.EqualFold(dn) && !slices.Contains(roles, mapping.role) {
+				roles = append(roles, mapping.role)
+			}
+		}
+	}
+	slices.Sort(roles)
+	return roles
+}
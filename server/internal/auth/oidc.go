@@ -0,0 +1,355 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// DefaultOIDCScopes are requested from the identity provider unless configured otherwise.
+var DefaultOIDCScopes = []string{"openid", "email", "profile"}
+
+// Device authorization errors returned by the identity provider while the user has not
+// finished signing in (RFC 8628, section 3.5).
+const (
+	OIDCAuthorizationPending = "authorization_pending"
+	OIDCSlowDown             = "slow_down"
+)
+
+// oidcRequestTimeout bounds every request to the identity provider.
+const oidcRequestTimeout = 10 * time.Second
+
+// maxOIDCResponseSize bounds the responses read from the identity provider.
+const maxOIDCResponseSize = 1 << 20
+
+// OIDCConfig configures an OpenID Connect identity provider.
+type OIDCConfig struct {
+	// Issuer is the issuer URL; the provider metadata is discovered below it.
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the callback of the authorization code flow. The flow is disabled without it.
+	RedirectURL string
+	Scopes      []string
+	// LoginClaim is the ID token claim that names the local user, such as "email",
+	// "preferred_username" or "sub". Emails are only accepted if email_verified is true.
+	LoginClaim string
+}
+
+// OIDCProvider signs users in with an OpenID Connect identity provider using the
+// authorization code flow with PKCE or the device authorization flow.
+type OIDCProvider struct {
+	config     OIDCConfig
+	metadata   oidcMetadata
+	httpClient *http.Client
+
+	mu   sync.Mutex
+	keys map[string]*SigningKey // map[kid]key of the provider
+}
+
+// oidcMetadata is the part of the provider metadata (OpenID Connect Discovery 1.0) that is used.
+type oidcMetadata struct {
+	Issuer                      string `json:"issuer"`
+	AuthorizationEndpoint       string `json:"authorization_endpoint"`
+	TokenEndpoint               string `json:"token_endpoint"`
+	DeviceAuthorizationEndpoint string `json:"device_authorization_endpoint"`
+	JWKSURI                     string `json:"jwks_uri"`
+}
+
+// OIDCIdentity is the verified identity of a user from an ID token.
+type OIDCIdentity struct {
+	Issuer  string
+	Subject string
+	// Login is the value of the configured login claim
+	Login string
+}
+
+// DeviceAuthorization is the response of the provider's device authorization endpoint (RFC 8628).
+type DeviceAuthorization struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete,omitempty"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval,omitempty"`
+}
+
+// OIDCError is an OAuth 2.0 error response of the identity provider.
+type OIDCError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (e *OIDCError) Error() string {
+	if e.Description != "" {
+		return fmt.Sprintf("identity provider error %s: %s", e.Code, e.Description)
+	}
+	return "identity provider error " + e.Code
+}
+
+// NewOIDCProvider discovers the metadata of an identity provider.
+func NewOIDCProvider(ctx context.Context, config OIDCConfig, httpClient *http.Client) (*OIDCProvider, error) {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: oidcRequestTimeout}
+	}
+	if len(config.Scopes) == 0 {
+		config.Scopes = DefaultOIDCScopes
+	}
+	if !slices.Contains(config.Scopes, "openid") {
+		config.Scopes = append([]string{"openid"}, config.Scopes...)
+	}
+	if config.LoginClaim == "" {
+		config.LoginClaim = "email"
+	}
+
+	p := &OIDCProvider{config: config, httpClient: httpClient}
+	discoveryURL := strings.TrimSuffix(config.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := p.getJSON(ctx, discoveryURL, &p.metadata); err != nil {
+		return nil, fmt.Errorf("failed to discover identity provider: %w", err)
+	}
+	if p.metadata.Issuer != config.Issuer {
+		return nil, fmt.Errorf("identity provider issuer %q does not match %q", p.metadata.Issuer, config.Issuer)
+	}
+	if p.metadata.TokenEndpoint == "" || p.metadata.JWKSURI == "" {
+		return nil, fmt.Errorf("identity provider metadata lacks token_endpoint or jwks_uri")
+	}
+	return p, nil
+}
+
+// SupportsAuthCode reports whether the authorization code flow is available.
+func (p *OIDCProvider) SupportsAuthCode() bool {
+	return p.config.RedirectURL != "" && p.metadata.AuthorizationEndpoint != ""
+}
+
+// SupportsDeviceFlow reports whether the provider offers the device authorization flow.
+func (p *OIDCProvider) SupportsDeviceFlow() bool {
+	return p.metadata.DeviceAuthorizationEndpoint != ""
+}
+
+// NewPKCE creates a PKCE code verifier and its S256 code challenge (RFC 7636).
+func NewPKCE() (verifier, challenge string, err error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", fmt.Errorf("failed to generate code verifier: %w", err)
+	}
+	verifier = base64.RawURLEncoding.EncodeToString(raw)
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// NewOIDCState creates a random value for the state or nonce parameter.
+func NewOIDCState() (string, error) {
+	return newTokenID()
+}
+
+// AuthCodeURL returns the URL that sends the user to the provider to sign in.
+func (p *OIDCProvider) AuthCodeURL(state, nonce, codeChallenge string) string {
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.config.ClientID},
+		"redirect_uri":          {p.config.RedirectURL},
+		"scope":                 {strings.Join(p.config.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {codeChallenge},
+		"code_challenge_method": {"S256"},
+	}
+	separator := "?"
+	if strings.Contains(p.metadata.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return p.metadata.AuthorizationEndpoint + separator + query.Encode()
+}
+
+// Exchange redeems an authorization code and returns the verified identity of the user.
+func (p *OIDCProvider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (OIDCIdentity, error) {
+	return p.requestIdentity(ctx, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.config.RedirectURL},
+		"code_verifier": {codeVerifier},
+	}, nonce)
+}
+
+// StartDeviceAuthorization asks the provider for a user code to sign in on another device.
+func (p *OIDCProvider) StartDeviceAuthorization(ctx context.Context) (DeviceAuthorization, error) {
+	var authorization DeviceAuthorization
+	if !p.SupportsDeviceFlow() {
+		return authorization, fmt.Errorf("identity provider does not support the device flow")
+	}
+	err := p.postForm(ctx, p.metadata.DeviceAuthorizationEndpoint, url.Values{
+		"scope": {strings.Join(p.config.Scopes, " ")},
+	}, &authorization)
+	if err == nil && (authorization.DeviceCode == "" || authorization.UserCode == "") {
+		err = fmt.Errorf("identity provider returned no device code")
+	}
+	return authorization, err
+}
+
+// PollDeviceToken checks whether the user has signed in for a device code. While the
+// user has not, it returns an *OIDCError with the code OIDCAuthorizationPending or OIDCSlowDown.
+func (p *OIDCProvider) PollDeviceToken(ctx context.Context, deviceCode string) (OIDCIdentity, error) {
+	return p.requestIdentity(ctx, url.Values{
+		"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+		"device_code": {deviceCode},
+	}, "")
+}
+
+// requestIdentity calls the token endpoint and verifies the returned ID token.
+func (p *OIDCProvider) requestIdentity(ctx context.Context, form url.Values, nonce string) (OIDCIdentity, error) {
+	var resp struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := p.postForm(ctx, p.metadata.TokenEndpoint, form, &resp); err != nil {
+		return OIDCIdentity{}, err
+	}
+	if resp.IDToken == "" {
+		return OIDCIdentity{}, fmt.Errorf("identity provider returned no ID token")
+	}
+	return p.VerifyIDToken(ctx, resp.IDToken, nonce)
+}
+
+// VerifyIDToken checks the signature, issuer, audience, expiry and nonce of an ID token
+// and extracts the identity of the user.
+func (p *OIDCProvider) VerifyIDToken(ctx context.Context, rawToken, nonce string) (OIDCIdentity, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(rawToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, err := p.key(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+		if token.Method.Alg() != key.Algorithm() {
+			return nil, fmt.Errorf("unexpected signing method %s for key %q", token.Method.Alg(), kid)
+		}
+		return key.public, nil
+	},
+		jwt.WithValidMethods([]string{"EdDSA", "ES256", "RS256"}),
+		jwt.WithIssuer(p.config.Issuer),
+		jwt.WithAudience(p.config.ClientID),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return OIDCIdentity{}, fmt.Errorf("invalid ID token: %w", err)
+	}
+
+	if tokenNonce, _ := claims["nonce"].(string); nonce != "" && tokenNonce != nonce {
+		return OIDCIdentity{}, fmt.Errorf("invalid ID token: nonce mismatch")
+	}
+	if audience, _ := claims.GetAudience(); len(audience) > 1 {
+		if azp, _ := claims["azp"].(string); azp != p.config.ClientID {
+			return OIDCIdentity{}, fmt.Errorf("invalid ID token: azp %q is not this client", azp)
+		}
+	}
+
+	subject, _ := claims.GetSubject()
+	if subject == "" {
+		return OIDCIdentity{}, fmt.Errorf("invalid ID token: no subject")
+	}
+
+	login, _ := claims[p.config.LoginClaim].(string)
+	if p.config.LoginClaim == "email" {
+		if verified, _ := claims["email_verified"].(bool); !verified {
+			return OIDCIdentity{}, fmt.Errorf("email address of the user is not verified")
+		}
+		login = strings.ToLower(login)
+	}
+	if login == "" {
+		return OIDCIdentity{}, fmt.Errorf("ID token has no %s claim", p.config.LoginClaim)
+	}
+
+	return OIDCIdentity{Issuer: p.config.Issuer, Subject: subject, Login: login}, nil
+}
+
+// key returns a signing key of the provider by kid. The key set is fetched again when
+// an unknown kid appears, which happens after the provider rotates its keys.
+func (p *OIDCProvider) key(ctx context.Context, kid string) (*SigningKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+
+	var set JSONWebKeySet
+	if err := p.getJSON(ctx, p.metadata.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("failed to fetch identity provider keys: %w", err)
+	}
+	keys := make(map[string]*SigningKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		// Keys of unsupported types cannot have signed a token accepted here
+		if key, err := ParseJSONWebKey(jwk); err == nil {
+			keys[jwk.Kid] = key
+		}
+	}
+	p.keys = keys
+
+	key, ok := p.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown identity provider key %q", kid)
+	}
+	return key, nil
+}
+
+// postForm sends a form to an endpoint of the provider with the client credentials.
+func (p *OIDCProvider) postForm(ctx context.Context, endpoint string, form url.Values, result any) error {
+	form.Set("client_id", p.config.ClientID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if p.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+	return p.do(req, result)
+}
+
+// getJSON fetches a JSON document from the provider.
+func (p *OIDCProvider) getJSON(ctx context.Context, endpoint string, result any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	return p.do(req, result)
+}
+
+func (p *OIDCProvider) do(req *http.Request, result any) error {
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxOIDCResponseSize))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		oidcErr := &OIDCError{}
+		if json.Unmarshal(body, oidcErr) == nil && oidcErr.Code != "" {
+			return oidcErr
+		}
+		return fmt.Errorf("identity provider returned status %d", resp.StatusCode)
+	}
+	if err := json.Unmarshal(body, result); err != nil {
+		return fmt.Errorf("invalid identity provider response: %w", err)
+	}
+	return nil
+}
@@ -1,15 +1,194 @@
 package auth
 
-import "golang.org/x/crypto/bcrypt"
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
 
-// HashPassword creates a bcrypt hash of the password.
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrUnknownPasswordHash is returned for a stored hash in a format no hasher understands.
+var ErrUnknownPasswordHash = errors.New("unknown password hash format")
+
+// PasswordHasher creates and verifies password hashes. Every hasher verifies hashes of
+// all supported formats, so that users keep logging in after the hasher is changed.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	// Verify reports whether password matches hash, and whether hash was made with another
+	// algorithm or parameters and should be replaced with a new Hash of the password.
+	Verify(password, hash string) (match, rehash bool, err error)
+}
+
+// Argon2idParams are the cost parameters of Argon2id (RFC 9106).
+type Argon2idParams struct {
+	// Memory is the memory used by one hash in KiB.
+	Memory      uint32
+	Time        uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2idParams is the second recommended option of RFC 9106, section 4.
+var DefaultArgon2idParams = Argon2idParams{Memory: 64 * 1024, Time: 3, Parallelism: 4, SaltLength: 16, KeyLength: 32}
+
+// Argon2idHasher hashes passwords with Argon2id in the PHC string format,
+// e.g. $argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>.
+type Argon2idHasher struct {
+	params Argon2idParams
+}
+
+// NewArgon2idHasher validates the parameters of an Argon2id hasher.
+func NewArgon2idHasher(params Argon2idParams) (*Argon2idHasher, error) {
+	if params.Time < 1 || params.Parallelism < 1 || params.Memory < 8*uint32(params.Parallelism) {
+		return nil, fmt.Errorf("invalid Argon2id parameters: need t >= 1, p >= 1 and m >= 8*p KiB")
+	}
+	if params.SaltLength < 8 || params.KeyLength < 16 {
+		return nil, fmt.Errorf("invalid Argon2id parameters: need a salt of 8 and a key of 16 bytes at least")
+	}
+	return &Argon2idHasher{params: params}, nil
+}
+
+// Hash creates an Argon2id hash of the password with a random salt.
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+	key := argon2.IDKey([]byte(password), salt, h.params.Time, h.params.Memory, h.params.Parallelism, h.params.KeyLength)
+	return encodeArgon2id(h.params, salt, key), nil
+}
+
+// Verify checks Argon2id and bcrypt hashes. Hashes with other parameters are reported for rehashing.
+func (h *Argon2idHasher) Verify(password, hash string) (bool, bool, error) {
+	match, err := verifyPassword(password, hash)
+	if !match || err != nil {
+		return match, false, err
+	}
+	params, _, _, err := decodeArgon2id(hash)
+	if err != nil {
+		return true, true, nil
+	}
+	current := params.Memory == h.params.Memory && params.Time == h.params.Time &&
+		params.Parallelism == h.params.Parallelism && params.KeyLength == h.params.KeyLength
+	return true, !current, nil
+}
+
+// BcryptHasher hashes passwords with bcrypt. Passwords longer than 72 bytes are rejected.
+type BcryptHasher struct {
+	cost int
+}
+
+// NewBcryptHasher validates the cost of a bcrypt hasher.
+func NewBcryptHasher(cost int) (*BcryptHasher, error) {
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		return nil, fmt.Errorf("invalid bcrypt cost %d", cost)
+	}
+	return &BcryptHasher{cost: cost}, nil
+}
+
+// Hash creates a bcrypt hash of the password.
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.cost)
+	return string(hash), err
+}
+
+// Verify checks bcrypt and Argon2id hashes. Hashes of another cost or algorithm are reported for rehashing.
+func (h *BcryptHasher) Verify(password, hash string) (bool, bool, error) {
+	match, err := verifyPassword(password, hash)
+	if !match || err != nil {
+		return match, false, err
+	}
+	cost, err := bcrypt.Cost([]byte(hash))
+	return true, err != nil || cost != h.cost, nil
+}
+
+// verifyPassword checks a password against a hash of any supported format.
+func verifyPassword(password, hash string) (bool, error) {
+	switch {
+	case strings.HasPrefix(hash, "$argon2id$"):
+		params, salt, key, err := decodeArgon2id(hash)
+		if err != nil {
+			return false, err
+		}
+		computed := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Parallelism, params.KeyLength)
+		return subtle.ConstantTimeCompare(computed, key) == 1, nil
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		return err == nil, err
+	default:
+		return false, ErrUnknownPasswordHash
+	}
+}
+
+func encodeArgon2id(params Argon2idParams, salt, key []byte) string {
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version,
+		params.Memory, params.Time, params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+}
+
+func decodeArgon2id(hash string) (Argon2idParams, []byte, []byte, error) {
+	var params Argon2idParams
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, ErrUnknownPasswordHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("unsupported Argon2id version %q", parts[2])
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Parallelism); err != nil {
+		return params, nil, nil, fmt.Errorf("invalid Argon2id parameters %q", parts[3])
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("invalid Argon2id salt: %w", err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, fmt.Errorf("invalid Argon2id hash")
+	}
+	params.SaltLength, params.KeyLength = uint32(len(salt)), uint32(len(key))
+	return params, salt, key, nil
+}
+
+// passwordHasher is used by HashPassword and VerifyPassword.
+var passwordHasher PasswordHasher = &Argon2idHasher{params: DefaultArgon2idParams}
+
+// SetPasswordHasher changes the hasher of new passwords. Call it at startup, before
+// any password is hashed.
+func SetPasswordHasher(hasher PasswordHasher) {
+	passwordHasher = hasher
+}
+
+// HashPassword creates a hash of the password with the configured hasher.
 func HashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	return string(bytes), err
+	return passwordHasher.Hash(password)
+}
+
+// VerifyPassword reports whether password matches hash, and whether hash should be
+// replaced because the hasher or its parameters have changed.
+func VerifyPassword(password, hash string) (match, rehash bool, err error) {
+	return passwordHasher.Verify(password, hash)
 }
 
 // CheckPasswordHash compares a password with a hash.
 func CheckPasswordHash(password, hash string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-	return err == nil
+	match, _, _ := VerifyPassword(password, hash)
+	return match
+}
+
+// SimulatePasswordCheck spends the time of a password check without a real hash.
+// Call it when the user does not exist to avoid revealing that through response time.
+func SimulatePasswordCheck(password string) {
+	HashPassword(password)
 }
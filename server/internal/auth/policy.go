@@ -0,0 +1,149 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// BreachRangePrefixLength is the number of hex digits of the SHA-1 prefix of a breach list
+// range. Clients look up a password by the prefix of its hash, so that the server does not
+// learn the hash itself (k-anonymity, as in the Have I Been Pwned range API).
+const BreachRangePrefixLength = 5
+
+// DefaultPasswordPolicy is enforced on registration unless configured otherwise.
+var DefaultPasswordPolicy = PasswordPolicy{MinLength: 8, MaxLength: 1024}
+
+// PasswordPolicyError describes why a password was rejected.
+type PasswordPolicyError struct {
+	Reason string
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return "password rejected: " + e.Reason
+}
+
+// PasswordPolicy is the set of rules a new password must satisfy.
+type PasswordPolicy struct {
+	// MinLength and MaxLength are counted in characters.
+	MinLength int
+	MaxLength int
+	// Breached holds the SHA-1 hashes of passwords known from breaches.
+	Breached *BreachList
+}
+
+// Check returns a *PasswordPolicyError if the password of the user breaks the policy.
+func (p PasswordPolicy) Check(login, password string) error {
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		return &PasswordPolicyError{Reason: fmt.Sprintf("must be at least %d characters long", p.MinLength)}
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		return &PasswordPolicyError{Reason: fmt.Sprintf("must be at most %d characters long", p.MaxLength)}
+	}
+	if login != "" && strings.EqualFold(password, login) {
+		return &PasswordPolicyError{Reason: "must differ from the login"}
+	}
+	if p.Breached.Contains(sha1.Sum([]byte(password))) {
+		return &PasswordPolicyError{Reason: "appears in a list of breached passwords"}
+	}
+	return nil
+}
+
+// BreachList is a sorted list of the SHA-1 hashes of breached passwords.
+type BreachList struct {
+	hashes [][sha1.Size]byte
+}
+
+// Len returns the number of hashes in the list.
+func (l *BreachList) Len() int {
+	if l == nil {
+		return 0
+	}
+	return len(l.hashes)
+}
+
+// Contains reports whether the list contains the hash. A nil list contains nothing.
+func (l *BreachList) Contains(hash [sha1.Size]byte) bool {
+	if l == nil {
+		return false
+	}
+	_, found := slices.BinarySearchFunc(l.hashes, hash, compareHashes)
+	return found
+}
+
+// Range returns the remaining hex digits, in upper case, of the hashes that start with
+// the hex digits of prefix. The prefix must have BreachRangePrefixLength digits.
+func (l *BreachList) Range(prefix string) ([]string, error) {
+	if len(prefix) != BreachRangePrefixLength {
+		return nil, fmt.Errorf("prefix must have %d hex digits", BreachRangePrefixLength)
+	}
+	prefix = strings.ToUpper(prefix)
+	// The first hash of the range starts with the prefix padded with zeros
+	var first [sha1.Size]byte
+	if _, err := hex.Decode(first[:], []byte(prefix+strings.Repeat("0", 2*sha1.Size-len(prefix)))); err != nil {
+		return nil, fmt.Errorf("prefix must have %d hex digits", BreachRangePrefixLength)
+	}
+
+	suffixes := []string{}
+	if l == nil {
+		return suffixes, nil
+	}
+	i, _ := slices.BinarySearchFunc(l.hashes, first, compareHashes)
+	for ; i < len(l.hashes); i++ {
+		hash := strings.ToUpper(hex.EncodeToString(l.hashes[i][:]))
+		if !strings.HasPrefix(hash, prefix) {
+			break
+		}
+		suffixes = append(suffixes, hash[len(prefix):])
+	}
+	return suffixes, nil
+}
+
+func compareHashes(a, b [sha1.Size]byte) int {
+	return bytes.Compare(a[:], b[:])
+}
+
+// LoadBreachList reads a list of breached passwords, one per line. A line is either
+// the password itself or its SHA-1 hash in hex, optionally followed by ":count" as in
+// the Have I Been Pwned downloads. Empty lines and lines starting with # are skipped.
+func LoadBreachList(path string) (*BreachList, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open breach list: %w", err)
+	}
+	defer file.Close()
+
+	var hashes [][sha1.Size]byte
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		hashes = append(hashes, breachListEntry(line))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read breach list: %w", err)
+	}
+
+	slices.SortFunc(hashes, compareHashes)
+	return &BreachList{hashes: slices.Compact(hashes)}, nil
+}
+
+func breachListEntry(line string) [sha1.Size]byte {
+	hash, _, _ := strings.Cut(line, ":")
+	var sum [sha1.Size]byte
+	if len(hash) == 2*sha1.Size {
+		if _, err := hex.Decode(sum[:], []byte(hash)); err == nil {
+			return sum
+		}
+	}
+	return sha1.Sum([]byte(line))
+}
@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"time"
+)
+
+// DefaultRefreshTokenTTL is the lifetime of refresh tokens unless configured otherwise.
+const DefaultRefreshTokenTTL = 30 * 24 * time.Hour
+
+// refreshTokenSize is the number of random bytes in a refresh token.
+const refreshTokenSize = 32
+
+// GenerateRefreshToken creates a new opaque refresh token and returns it with its hash.
+// Only the hash is stored on the server.
+func GenerateRefreshToken() (string, []byte, error) {
+	raw := make([]byte, refreshTokenSize)
+	if _, err := rand.Read(raw); err != nil {
+		return "", nil, fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	return token, HashRefreshToken(token), nil
+}
+
+// HashRefreshToken returns the hash under which a refresh token is stored.
+// Refresh tokens are random, so a plain SHA-256 is sufficient.
+func HashRefreshToken(token string) []byte {
+	hash := sha256.Sum256([]byte(token))
+	return hash[:]
+}
+
+// NewTokenFamilyID creates the ID shared by refresh tokens rotated from one login.
+func NewTokenFamilyID() (string, error) {
+	return newTokenID()
+}
+
+// newTokenID creates a random 128-bit identifier.
+func newTokenID() (string, error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate token ID: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
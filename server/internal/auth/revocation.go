@@ -0,0 +1,155 @@
+package auth
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// negativeCacheTTL bounds how long a token is considered not revoked without asking the store,
+// so that revocations made by other server instances take effect quickly.
+const negativeCacheTTL = 30 * time.Second
+
+// revocationCacheSize bounds how many check results are cached, so that a burst of
+// revocations cannot grow the cache without limit. The store stays the source of truth.
+const revocationCacheSize = 10000
+
+// RevocationStore persists the IDs of revoked tokens until the tokens expire.
+type RevocationStore interface {
+	// RevokeToken records a token ID as revoked until expiresAt.
+	RevokeToken(ctx context.Context, tokenID string, expiresAt time.Time) error
+	// RevokeTokenOnce records a token ID as revoked until expiresAt and reports false if
+	// it was revoked already.
+	RevokeTokenOnce(ctx context.Context, tokenID string, expiresAt time.Time) (bool, error)
+	// IsTokenRevoked reports whether a token ID has been revoked.
+	IsTokenRevoked(ctx context.Context, tokenID string) (bool, error)
+	// DeleteExpiredRevokedTokens removes entries of tokens that expired before now.
+	DeleteExpiredRevokedTokens(ctx context.Context, now time.Time) error
+}
+
+// revocationEntry is a cached revocation check result.
+type revocationEntry struct {
+	revoked bool
+	until   time.Time
+}
+
+// RevocationList checks token IDs against the persisted revocation list.
+// Results are cached in memory: revocations until the token expires,
+// non-revocations for a short time. At most maxEntries results are cached.
+type RevocationList struct {
+	store      RevocationStore
+	mu         sync.Mutex
+	cache      map[string]revocationEntry
+	maxEntries int
+}
+
+// NewRevocationList creates a RevocationList backed by store.
+func NewRevocationList(store RevocationStore) *RevocationList {
+	return &RevocationList{store: store, cache: make(map[string]revocationEntry), maxEntries: revocationCacheSize}
+}
+
+// Revoke revokes a token until it expires.
+func (l *RevocationList) Revoke(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	if err := l.store.RevokeToken(ctx, tokenID, expiresAt); err != nil {
+		return err
+	}
+
+	l.put(tokenID, revocationEntry{revoked: true, until: expiresAt}, time.Now())
+	return nil
+}
+
+// RevokeOnce revokes a token until it expires and reports false if it was revoked already.
+// Of concurrent calls for a token, on any server instance, only one reports true.
+func (l *RevocationList) RevokeOnce(ctx context.Context, tokenID string, expiresAt time.Time) (bool, error) {
+	revoked, err := l.store.RevokeTokenOnce(ctx, tokenID, expiresAt)
+	if err != nil {
+		return false, err
+	}
+
+	l.put(tokenID, revocationEntry{revoked: true, until: expiresAt}, time.Now())
+	return revoked, nil
+}
+
+// IsRevoked reports whether a token has been revoked.
+func (l *RevocationList) IsRevoked(ctx context.Context, tokenID string) (bool, error) {
+	now := time.Now()
+
+	l.mu.Lock()
+	entry, ok := l.cache[tokenID]
+	l.mu.Unlock()
+	if ok && now.Before(entry.until) {
+		return entry.revoked, nil
+	}
+
+	revoked, err := l.store.IsTokenRevoked(ctx, tokenID)
+	if err != nil {
+		return false, err
+	}
+
+	// A revoked token is rejected by its expiry afterwards, so caching it
+	// for the negative TTL as well is enough
+	l.put(tokenID, revocationEntry{revoked: revoked, until: now.Add(negativeCacheTTL)}, now)
+
+	return revoked, nil
+}
+
+// put caches a check result. If the cache is full, expired entries are dropped first
+// and then the entry closest to expiry.
+func (l *RevocationList) put(tokenID string, entry revocationEntry, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, exists := l.cache[tokenID]; !exists && len(l.cache) >= l.maxEntries {
+		l.dropExpired(now)
+		if len(l.cache) >= l.maxEntries {
+			oldestID := ""
+			var oldest time.Time
+			for id, cached := range l.cache {
+				if oldestID == "" || cached.until.Before(oldest) {
+					oldestID, oldest = id, cached.until
+				}
+			}
+			delete(l.cache, oldestID)
+		}
+	}
+	l.cache[tokenID] = entry
+}
+
+// dropExpired removes the cache entries that expired before now. l.mu must be held.
+func (l *RevocationList) dropExpired(now time.Time) {
+	for tokenID, entry := range l.cache {
+		if !now.Before(entry.until) {
+			delete(l.cache, tokenID)
+		}
+	}
+}
+
+// Cleanup drops cache entries that are no longer needed and deletes revocations
+// of expired tokens from the store.
+func (l *RevocationList) Cleanup(ctx context.Context) error {
+	now := time.Now()
+
+	l.mu.Lock()
+	l.dropExpired(now)
+	l.mu.Unlock()
+
+	return l.store.DeleteExpiredRevokedTokens(ctx, now)
+}
+
+// Run calls Cleanup every interval until ctx is done.
+func (l *RevocationList) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := l.Cleanup(ctx); err != nil {
+				log.Printf("Failed to clean up revoked tokens: %v", err)
+			}
+		}
+	}
+}
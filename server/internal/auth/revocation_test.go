@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memRevocationStore is an in-memory RevocationStore
+type memRevocationStore struct {
+	mu      sync.Mutex
+	revoked map[string]time.Time
+	// latency delays every call, like a round trip to a database
+	latency time.Duration
+}
+
+func (s *memRevocationStore) RevokeToken(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	time.Sleep(s.latency)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.revoked[tokenID] = expiresAt
+	return nil
+}
+
+func (s *memRevocationStore) RevokeTokenOnce(ctx context.Context, tokenID string, expiresAt time.Time) (bool, error) {
+	time.Sleep(s.latency)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.revoked[tokenID]; ok {
+		return false, nil
+	}
+	s.revoked[tokenID] = expiresAt
+	return true, nil
+}
+
+func (s *memRevocationStore) IsTokenRevoked(ctx context.Context, tokenID string) (bool, error) {
+	time.Sleep(s.latency)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.revoked[tokenID]
+	return ok, nil
+}
+
+func (s *memRevocationStore) DeleteExpiredRevokedTokens(ctx context.Context, now time.Time) error {
+	return nil
+}
+
+// TestRevocationListCacheLimit tests that the cache stays bounded during a burst of
+// revocations and that evicted revocations are still found in the store
+func TestRevocationListCacheLimit(t *testing.T) {
+	ctx := context.Background()
+	list := NewRevocationList(&memRevocationStore{revoked: make(map[string]time.Time)})
+	list.maxEntries = 10
+
+	expiresAt := time.Now().Add(time.Hour)
+	for i := range 100 {
+		if err := list.Revoke(ctx, fmt.Sprintf("token-%d", i), expiresAt.Add(time.Duration(i)*time.Second)); err != nil {
+			t.Fatalf("Failed to revoke token: %v", err)
+		}
+	}
+	if len(list.cache) != 10 {
+		t.Errorf("Expected 10 cached entries, got %d", len(list.cache))
+	}
+
+	for _, tokenID := range []string{"token-0", "token-99"} {
+		if revoked, err := list.IsRevoked(ctx, tokenID); err != nil || !revoked {
+			t.Errorf("Expected %s to be revoked, got %v, %v", tokenID, revoked, err)
+		}
+	}
+	if revoked, _ := list.IsRevoked(ctx, "unknown"); revoked || len(list.cache) > 10 {
+		t.Errorf("Expected an unknown token not to be revoked with a bounded cache, got %v and %d entries", revoked, len(list.cache))
+	}
+}
+
+// TestRevokeOnce tests that of concurrent uses of a token only one succeeds
+func TestRevokeOnce(t *testing.T) {
+	ctx := context.Background()
+	jwtManager := NewJWTManager("test-secret")
+	jwtManager.SetRevocationList(NewRevocationList(&memRevocationStore{revoked: make(map[string]time.Time), latency: 10 * time.Millisecond}))
+	challenge, err := jwtManager.GenerateMFAChallenge(1)
+	if err != nil {
+		t.Fatalf("Failed to generate challenge: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	used := 0
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := jwtManager.UseMFAChallenge(ctx, challenge); err == nil {
+				mu.Lock()
+				used++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if used != 1 {
+		t.Errorf("Expected the challenge to be used once, got %d", used)
+	}
+}
@@ -0,0 +1,202 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// srpN and srpG are the 2048-bit group of RFC 5054, appendix A.
+var (
+	srpN, _ = new(big.Int).SetString("AC6BDB41324A9A9BF166DE5E1389582FAF72B6651987EE07FC3192943DB56050"+
+		"A37329CBB4A099ED8193E0757767A13DD52312AB4B03310DCD7F48A9DA04FD50"+
+		"E8083969EDB767B0CF6095179A163AB3661A05FBD5FAAAE82918A9962F0B93B8"+
+		"55F97993EC975EEAA80D740ADBF4FF747359D041D5C33EA71D281E446B14773B"+
+		"CA97B43A23FB801676BD207A436C6481F1D2B9078717461A5B9D32E688F87748"+
+		"544523B524B0D57D5EA77A2775D2ECFA032CFBDBF52FB3786160279004E57AE6"+
+		"AF874E7303CE53299CCC041C7BC308D82A5698F3A8D0C38271AE35F8E9DBFBB6"+
+		"94B5C803D89F7AE435DE236D525F54759B65E372FCD68EF20FA7111F9E4AFF73", 16)
+	srpG = big.NewInt(2)
+	srpK = new(big.Int).SetBytes(srpHash(srpPad(srpN), srpPad(srpG)))
+)
+
+// srpVerifierPrefix starts a stored SRP verifier, which takes the place of a password hash.
+const srpVerifierPrefix = "$srp6a-argon2id$"
+
+// ErrSRPProof is returned when the proof of the client does not match.
+var ErrSRPProof = errors.New("invalid SRP proof")
+
+// SRPParams are the Argon2id parameters that derive the SRP private key from the password.
+type SRPParams struct {
+	Memory      uint32 `json:"m"`
+	Time        uint32 `json:"t"`
+	Parallelism uint8  `json:"p"`
+}
+
+// DefaultSRPParams are the parameters clients use for new verifiers (RFC 9106, section 4).
+var DefaultSRPParams = SRPParams{Memory: 64 * 1024, Time: 3, Parallelism: 4}
+
+// MinSRPParams are the weakest parameters accepted from clients (OWASP's minimum for Argon2id).
+var MinSRPParams = SRPParams{Memory: 19 * 1024, Time: 2, Parallelism: 1}
+
+// SRPVerifier is what the server stores for a user of SRP-6a (RFC 2945, RFC 5054):
+// v = g^x mod N with x = H(salt | Argon2id(login ":" password, salt)). The password
+// cannot be recovered from it without a dictionary attack through Argon2id.
+type SRPVerifier struct {
+	Params   SRPParams
+	Salt     []byte
+	Verifier []byte
+}
+
+// IsSRPVerifier reports whether a stored password hash is an SRP verifier.
+func IsSRPVerifier(hash string) bool {
+	return strings.HasPrefix(hash, srpVerifierPrefix)
+}
+
+// Validate checks a verifier sent by a client.
+func (v SRPVerifier) Validate() error {
+	if v.Params.Memory < MinSRPParams.Memory || v.Params.Time < MinSRPParams.Time || v.Params.Parallelism < MinSRPParams.Parallelism {
+		return fmt.Errorf("SRP key derivation parameters are weaker than m=%d,t=%d,p=%d",
+			MinSRPParams.Memory, MinSRPParams.Time, MinSRPParams.Parallelism)
+	}
+	if len(v.Salt) < 16 {
+		return fmt.Errorf("SRP salt must be at least 16 bytes")
+	}
+	verifier := new(big.Int).SetBytes(v.Verifier)
+	if verifier.Sign() == 0 || verifier.Cmp(srpN) >= 0 {
+		return fmt.Errorf("SRP verifier is not an element of the group")
+	}
+	return nil
+}
+
+// Encode returns the verifier in the format stored in place of a password hash,
+// $srp6a-argon2id$m=65536,t=3,p=4$<salt>$<verifier>.
+func (v SRPVerifier) Encode() string {
+	return fmt.Sprintf("%sm=%d,t=%d,p=%d$%s$%s", srpVerifierPrefix, v.Params.Memory, v.Params.Time, v.Params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(v.Salt), base64.RawStdEncoding.EncodeToString(v.Verifier))
+}
+
+// ParseSRPVerifier decodes a verifier stored by Encode.
+func ParseSRPVerifier(hash string) (SRPVerifier, error) {
+	var v SRPVerifier
+	parts := strings.Split(strings.TrimPrefix(hash, srpVerifierPrefix), "$")
+	if !IsSRPVerifier(hash) || len(parts) != 3 {
+		return v, fmt.Errorf("not an SRP verifier")
+	}
+	if _, err := fmt.Sscanf(parts[0], "m=%d,t=%d,p=%d", &v.Params.Memory, &v.Params.Time, &v.Params.Parallelism); err != nil {
+		return v, fmt.Errorf("invalid SRP parameters %q", parts[0])
+	}
+	var err error
+	if v.Salt, err = base64.RawStdEncoding.DecodeString(parts[1]); err != nil {
+		return v, fmt.Errorf("invalid SRP salt: %w", err)
+	}
+	if v.Verifier, err = base64.RawStdEncoding.DecodeString(parts[2]); err != nil {
+		return v, fmt.Errorf("invalid SRP verifier: %w", err)
+	}
+	return v, nil
+}
+
+// FakeSRPVerifier returns a verifier for a login that has none. It is derived from the
+// login with a server key, so repeated logins see the same salt and cannot tell that
+// the user does not exist.
+func FakeSRPVerifier(key []byte, login string) SRPVerifier {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(login))
+	seed := mac.Sum(nil)
+	x := new(big.Int).SetBytes(srpHash([]byte("verifier"), seed))
+	return SRPVerifier{
+		Params:   DefaultSRPParams,
+		Salt:     seed[:16],
+		Verifier: new(big.Int).Exp(srpG, x, srpN).Bytes(),
+	}
+}
+
+// SRPSession is the server side of one SRP login.
+type SRPSession struct {
+	login    string
+	verifier SRPVerifier
+	a, b     *big.Int // public key A of the client and private key b of the server
+	bPublic  *big.Int
+}
+
+// NewSRPSession starts a login with the public key A of the client.
+func NewSRPSession(login string, verifier SRPVerifier, clientPublic []byte) (*SRPSession, error) {
+	a := new(big.Int).SetBytes(clientPublic)
+	// A mod N = 0 would make the shared key independent of the password
+	if a.Sign() == 0 || a.Cmp(srpN) >= 0 {
+		return nil, fmt.Errorf("invalid SRP client public key")
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate SRP key: %w", err)
+	}
+	b := new(big.Int).SetBytes(secret)
+
+	// B = k*v + g^b mod N
+	v := new(big.Int).SetBytes(verifier.Verifier)
+	bPublic := new(big.Int).Mul(srpK, v)
+	bPublic.Add(bPublic, new(big.Int).Exp(srpG, b, srpN))
+	bPublic.Mod(bPublic, srpN)
+
+	return &SRPSession{login: login, verifier: verifier, a: a, b: b, bPublic: bPublic}, nil
+}
+
+// Login returns the login the session was started for.
+func (s *SRPSession) Login() string {
+	return s.login
+}
+
+// ServerPublic returns the public key B of the server.
+func (s *SRPSession) ServerPublic() []byte {
+	return srpPad(s.bPublic)
+}
+
+// Verify checks the proof M1 of the client and returns the proof M2 of the server,
+// which shows the client that the server knows the verifier.
+func (s *SRPSession) Verify(clientProof []byte) ([]byte, error) {
+	u := new(big.Int).SetBytes(srpHash(srpPad(s.a), srpPad(s.bPublic)))
+	if u.Sign() == 0 {
+		return nil, ErrSRPProof
+	}
+
+	// S = (A * v^u) ^ b mod N
+	v := new(big.Int).SetBytes(s.verifier.Verifier)
+	premaster := new(big.Int).Exp(v, u, srpN)
+	premaster.Mul(premaster, s.a)
+	premaster.Exp(premaster, s.b, srpN)
+	key := srpHash(srpPad(premaster))
+
+	expected := srpClientProof(s.login, s.verifier.Salt, s.a, s.bPublic, key)
+	if !hmac.Equal(expected, clientProof) {
+		return nil, ErrSRPProof
+	}
+	return srpHash(srpPad(s.a), expected, key), nil
+}
+
+// srpClientProof is M1 = H(H(N) xor H(g) | H(I) | s | A | B | K).
+func srpClientProof(login string, salt []byte, a, b *big.Int, key []byte) []byte {
+	hn, hg := srpHash(srpPad(srpN)), srpHash(srpPad(srpG))
+	for i := range hn {
+		hn[i] ^= hg[i]
+	}
+	return srpHash(hn, srpHash([]byte(login)), salt, srpPad(a), srpPad(b), key)
+}
+
+func srpHash(values ...[]byte) []byte {
+	h := sha256.New()
+	for _, value := range values {
+		h.Write(value)
+	}
+	return h.Sum(nil)
+}
+
+// srpPad encodes a number with the length of N, as RFC 5054 requires for hashing.
+func srpPad(n *big.Int) []byte {
+	return n.FillBytes(make([]byte, (srpN.BitLen()+7)/8))
+}
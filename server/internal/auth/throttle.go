@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"context"
+	"gophkeeper/server/internal/models"
+	"log"
+	"time"
+)
+
+// ThrottlePolicy describes how failed logins slow down further attempts.
+type ThrottlePolicy struct {
+	// FreeAttempts is the number of failures allowed without delay.
+	FreeAttempts int
+	// BaseDelay is the delay after the first failure beyond FreeAttempts;
+	// it doubles with every further failure up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// LockoutThreshold is the number of failures that locks logins for LockoutDuration.
+	LockoutThreshold int
+	LockoutDuration  time.Duration
+	// Window is how long failures are remembered after the last one.
+	Window time.Duration
+}
+
+// DefaultAccountThrottlePolicy throttles guessing the password of one account.
+var DefaultAccountThrottlePolicy = ThrottlePolicy{
+	FreeAttempts:     3,
+	BaseDelay:        time.Second,
+	MaxDelay:         time.Minute,
+	LockoutThreshold: 10,
+	LockoutDuration:  15 * time.Minute,
+	Window:           time.Hour,
+}
+
+// DefaultIPThrottlePolicy throttles a client trying many accounts. It is more lenient
+// than the account policy because many users can share an address behind NAT.
+var DefaultIPThrottlePolicy = ThrottlePolicy{
+	FreeAttempts:     10,
+	BaseDelay:        time.Second,
+	MaxDelay:         time.Minute,
+	LockoutThreshold: 50,
+	LockoutDuration:  15 * time.Minute,
+	Window:           time.Hour,
+}
+
+// delay returns how long logins are rejected after the given number of failures.
+func (p ThrottlePolicy) delay(failures int) time.Duration {
+	if p.LockoutThreshold > 0 && failures >= p.LockoutThreshold {
+		return p.LockoutDuration
+	}
+	if failures <= p.FreeAttempts {
+		return 0
+	}
+
+	delay := p.BaseDelay
+	for range failures - p.FreeAttempts - 1 {
+		delay *= 2
+		if delay >= p.MaxDelay {
+			return p.MaxDelay
+		}
+	}
+	return min(delay, p.MaxDelay)
+}
+
+// LoginAttemptStore persists failed login attempts so that throttling is shared by
+// all server instances and survives restarts.
+type LoginAttemptStore interface {
+	GetLoginAttempts(ctx context.Context, key string) (models.LoginAttempts, error)
+	RecordLoginFailure(ctx context.Context, key string, now, resetBefore time.Time) (models.LoginAttempts, error)
+	LockLogin(ctx context.Context, key string, until time.Time) error
+	ResetLoginAttempts(ctx context.Context, key string) error
+	DeleteStaleLoginAttempts(ctx context.Context, before, now time.Time) error
+}
+
+// LoginThrottle tracks failed logins per account and per client IP address and
+// rejects attempts with exponential backoff and temporary lockout.
+// Failures for unknown logins are tracked like any other, so lockouts do not
+// reveal which accounts exist.
+type LoginThrottle struct {
+	store   LoginAttemptStore
+	account ThrottlePolicy
+	ip      ThrottlePolicy
+}
+
+// NewLoginThrottle creates a LoginThrottle backed by store.
+func NewLoginThrottle(store LoginAttemptStore, account, ip ThrottlePolicy) *LoginThrottle {
+	return &LoginThrottle{store: store, account: account, ip: ip}
+}
+
+// Check returns how long logins for the account from the IP address are rejected,
+// or zero if an attempt is allowed.
+func (t *LoginThrottle) Check(ctx context.Context, login, ip string) (time.Duration, error) {
+	now := time.Now()
+
+	var retryAfter time.Duration
+	for _, key := range []string{accountKey(login), ipKey(ip)} {
+		attempts, err := t.store.GetLoginAttempts(ctx, key)
+		if err != nil {
+			return 0, err
+		}
+		retryAfter = max(retryAfter, attempts.LockedUntil.Sub(now))
+	}
+	return retryAfter, nil
+}
+
+// RecordFailure counts a failed login for the account and the IP address and locks
+// them according to their policies.
+func (t *LoginThrottle) RecordFailure(ctx context.Context, login, ip string) error {
+	if err := t.recordFailure(ctx, accountKey(login), t.account); err != nil {
+		return err
+	}
+	return t.recordFailure(ctx, ipKey(ip), t.ip)
+}
+
+// RecordSuccess forgets the failures of the account. Failures of the IP address are
+// kept, so that a client cannot reset them with an account it controls.
+func (t *LoginThrottle) RecordSuccess(ctx context.Context, login string) error {
+	return t.store.ResetLoginAttempts(ctx, accountKey(login))
+}
+
+// Unlock lifts the lock of an account.
+func (t *LoginThrottle) Unlock(ctx context.Context, login string) error {
+	return t.store.ResetLoginAttempts(ctx, accountKey(login))
+}
+
+// UnlockIP lifts the lock of a client IP address.
+func (t *LoginThrottle) UnlockIP(ctx context.Context, ip string) error {
+	return t.store.ResetLoginAttempts(ctx, ipKey(ip))
+}
+
+// Cleanup deletes entries whose failures are outside both windows and that are not locked.
+func (t *LoginThrottle) Cleanup(ctx context.Context) error {
+	now := time.Now()
+	return t.store.DeleteStaleLoginAttempts(ctx, now.Add(-max(t.account.Window, t.ip.Window)), now)
+}
+
+// Run calls Cleanup every interval until ctx is done.
+func (t *LoginThrottle) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := t.Cleanup(ctx); err != nil {
+				log.Printf("Failed to clean up login attempts: %v", err)
+			}
+		}
+	}
+}
+
+func (t *LoginThrottle) recordFailure(ctx context.Context, key string, policy ThrottlePolicy) error {
+	now := time.Now()
+	attempts, err := t.store.RecordLoginFailure(ctx, key, now, now.Add(-policy.Window))
+	if err != nil {
+		return err
+	}
+
+	delay := policy.delay(attempts.Failures)
+	if delay == 0 {
+		return nil
+	}
+	if attempts.Failures == policy.LockoutThreshold {
+		log.Printf("SECURITY: %s locked for %s after %d failed logins", key, delay, attempts.Failures)
+	}
+	return t.store.LockLogin(ctx, key, now.Add(delay))
+}
+
+func accountKey(login string) string {
+	return "login:" + login
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
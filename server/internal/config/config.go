@@ -5,6 +5,8 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/ilyakaznacheev/cleanenv"
 )
@@ -17,16 +19,119 @@ const (
 	StoragePostgres StorageType = "postgres"
 )
 
+// Client certificate modes of tls_client_auth
+const (
+	TLSClientAuthNone     = "none"
+	TLSClientAuthOptional = "optional"
+	TLSClientAuthRequire  = "require"
+)
+
+// Hashers of password_hasher
+const (
+	PasswordHasherArgon2id = "argon2id"
+	PasswordHasherBcrypt   = "bcrypt"
+)
+
+// Modes of registration_mode
+const (
+	RegistrationOpen       = "open"
+	RegistrationInviteOnly = "invite-only"
+	RegistrationClosed     = "closed"
+)
+
 // Config holds the server configuration
 type Config struct {
-	ServerAddress string      `json:"server_address" env:"SERVER_ADDRESS" env-default:":8080"`
-	DatabaseDSN   string      `json:"database_dsn" env:"DATABASE_DSN" env-default:""`
-	JWTSecret     string      `json:"jwt_secret" env:"JWT_SECRET" env-default:"your-secret-key"`
-	StorageType   StorageType `json:"storage_type" env:"STORAGE_TYPE" env-default:"memory"`
-	EnableTLS     bool        `json:"enable_tls" env:"ENABLE_TLS" env-default:"false"`
-	TLSCertFile   string      `json:"tls_cert_file" env:"TLS_CERT_FILE" env-default:""`
-	TLSKeyFile    string      `json:"tls_key_file" env:"TLS_KEY_FILE" env-default:""`
-	EncryptionKey string      `json:"encryption_key" env:"ENCRYPTION_KEY" env-default:""`
+	ServerAddress string `json:"server_address" env:"SERVER_ADDRESS" env-default:":8080"`
+	DatabaseDSN   string `json:"database_dsn" env:"DATABASE_DSN" env-default:""`
+	JWTSecret     string `json:"jwt_secret" env:"JWT_SECRET" env-default:""`
+	// JWTSigningKeyFile is a PEM private key (Ed25519, ECDSA P-256 or RSA) that signs tokens instead of jwt_secret
+	JWTSigningKeyFile string `json:"jwt_signing_key_file" env:"JWT_SIGNING_KEY_FILE" env-default:""`
+	// JWTVerificationKeyFiles are PEM keys of retired signing keys whose tokens are still accepted
+	JWTVerificationKeyFiles []string    `json:"jwt_verification_key_files" env:"JWT_VERIFICATION_KEY_FILES" env-separator:","`
+	JWTIssuer               string      `json:"jwt_issuer" env:"JWT_ISSUER" env-default:"gophkeeper"`
+	JWTAudience             string      `json:"jwt_audience" env:"JWT_AUDIENCE" env-default:"gophkeeper"`
+	StorageType             StorageType `json:"storage_type" env:"STORAGE_TYPE" env-default:"memory"`
+	EnableTLS               bool        `json:"enable_tls" env:"ENABLE_TLS" env-default:"false"`
+	TLSCertFile             string      `json:"tls_cert_file" env:"TLS_CERT_FILE" env-default:""`
+	TLSKeyFile              string      `json:"tls_key_file" env:"TLS_KEY_FILE" env-default:""`
+	EncryptionKey           string      `json:"encryption_key" env:"ENCRYPTION_KEY" env-default:""`
+	EncryptionKeyFile       string      `json:"encryption_key_file" env:"ENCRYPTION_KEY_FILE" env-default:""`
+	EncryptionKeys          []string    `json:"encryption_keys" env:"ENCRYPTION_KEYS" env-separator:","`
+	StrictBinding           bool        `json:"strict_secret_binding" env:"STRICT_SECRET_BINDING" env-default:"false"`
+	BlindIndex              bool        `json:"blind_index" env:"BLIND_INDEX" env-default:"false"`
+	KMSAddress              string      `json:"kms_address" env:"KMS_ADDRESS" env-default:""`
+	KMSTokenFile            string      `json:"kms_token_file" env:"KMS_TOKEN_FILE" env-default:""`
+	AccessTokenTTL          Duration    `json:"access_token_ttl" env:"ACCESS_TOKEN_TTL" env-default:"15m"`
+	RefreshTokenTTL         Duration    `json:"refresh_token_ttl" env:"REFRESH_TOKEN_TTL" env-default:"720h"`
+	// LoginLockoutThreshold is the number of failed logins that locks an account for LoginLockoutDuration
+	LoginLockoutThreshold int      `json:"login_lockout_threshold" env:"LOGIN_LOCKOUT_THRESHOLD" env-default:"10"`
+	LoginLockoutDuration  Duration `json:"login_lockout_duration" env:"LOGIN_LOCKOUT_DURATION" env-default:"15m"`
+	// TLSClientCAFile is a PEM bundle of CAs whose client certificates are accepted
+	TLSClientCAFile string `json:"tls_client_ca_file" env:"TLS_CLIENT_CA_FILE" env-default:""`
+	// TLSClientAuth is "none", "optional" (verify certificates that are presented) or "require"
+	TLSClientAuth string `json:"tls_client_auth" env:"TLS_CLIENT_AUTH" env-default:"none"`
+	// TLSClientCertUsers maps client certificate identities such as "CN=backup-host" to user logins
+	TLSClientCertUsers map[string]string `json:"tls_client_cert_users" env:"TLS_CLIENT_CERT_USERS"`
+	// OIDCIssuer enables single sign-on with this OpenID Connect identity provider
+	OIDCIssuer       string `json:"oidc_issuer" env:"OIDC_ISSUER" env-default:""`
+	OIDCClientID     string `json:"oidc_client_id" env:"OIDC_CLIENT_ID" env-default:""`
+	OIDCClientSecret string `json:"oidc_client_secret" env:"OIDC_CLIENT_SECRET" env-default:""`
+	// OIDCRedirectURL is the public URL of /api/user/oidc/callback; browser sign-in is disabled without it
+	OIDCRedirectURL string   `json:"oidc_redirect_url" env:"OIDC_REDIRECT_URL" env-default:""`
+	OIDCScopes      []string `json:"oidc_scopes" env:"OIDC_SCOPES" env-separator:","`
+	// OIDCLoginClaim is the ID token claim matched against user logins
+	OIDCLoginClaim string `json:"oidc_login_claim" env:"OIDC_LOGIN_CLAIM" env-default:"email"`
+	// OIDCAutoProvision creates users on their first sign-in. Boolean options default to
+	// false: a zero value read from the JSON file cannot be told apart from a missing one
+	OIDCAutoProvision bool `json:"oidc_auto_provision" env:"OIDC_AUTO_PROVISION" env-default:"false"`
+	// LDAPURL enables login with directory credentials, e.g. ldap://ldap.example.com:389
+	LDAPURL      string `json:"ldap_url" env:"LDAP_URL" env-default:""`
+	LDAPStartTLS bool   `json:"ldap_start_tls" env:"LDAP_START_TLS" env-default:"false"`
+	// LDAPCAFile is a PEM bundle of CAs for the directory; the system pool is used without it
+	LDAPCAFile       string `json:"ldap_ca_file" env:"LDAP_CA_FILE" env-default:""`
+	LDAPBindDN       string `json:"ldap_bind_dn" env:"LDAP_BIND_DN" env-default:""`
+	LDAPBindPassword string `json:"ldap_bind_password" env:"LDAP_BIND_PASSWORD" env-default:""`
+	LDAPBaseDN       string `json:"ldap_base_dn" env:"LDAP_BASE_DN" env-default:""`
+	// LDAPUserFilter finds the entry of a user; %s is replaced with the login
+	LDAPUserFilter     string `json:"ldap_user_filter" env:"LDAP_USER_FILTER" env-default:"(uid=%s)"`
+	LDAPGroupAttribute string `json:"ldap_group_attribute" env:"LDAP_GROUP_ATTRIBUTE" env-default:"memberOf"`
+	// LDAPGroupRoles maps group DNs to roles; if set, only members of these groups can log in
+	LDAPGroupRoles map[string]string `json:"ldap_group_roles" env:"LDAP_GROUP_ROLES"`
+	// LDAPAutoProvision creates users on their first login
+	LDAPAutoProvision bool `json:"ldap_auto_provision" env:"LDAP_AUTO_PROVISION" env-default:"false"`
+	// PasswordHasher is "argon2id" or "bcrypt"; existing hashes of both are verified and upgraded on login
+	PasswordHasher    string `json:"password_hasher" env:"PASSWORD_HASHER" env-default:"argon2id"`
+	Argon2Memory      uint32 `json:"argon2_memory" env:"ARGON2_MEMORY" env-default:"65536"`
+	Argon2Time        uint32 `json:"argon2_time" env:"ARGON2_TIME" env-default:"3"`
+	Argon2Parallelism uint8  `json:"argon2_parallelism" env:"ARGON2_PARALLELISM" env-default:"4"`
+	BcryptCost        int    `json:"bcrypt_cost" env:"BCRYPT_COST" env-default:"10"`
+	PasswordMinLength int    `json:"password_min_length" env:"PASSWORD_MIN_LENGTH" env-default:"8"`
+	// PasswordBreachListFile lists breached passwords or their SHA-1 hashes that are refused on registration
+	PasswordBreachListFile string `json:"password_breach_list_file" env:"PASSWORD_BREACH_LIST_FILE" env-default:""`
+	// RegistrationMode is "open", "invite-only" (registration requires an invite code) or "closed"
+	RegistrationMode string `json:"registration_mode" env:"REGISTRATION_MODE" env-default:"open"`
+	// InviteTTL is the lifetime of invites issued without an explicit expiry
+	InviteTTL Duration `json:"invite_ttl" env:"INVITE_TTL" env-default:"168h"`
+	// GRPCAddress enables the gRPC API on this address, e.g. :9090; it uses the TLS settings of the REST API
+	GRPCAddress string `json:"grpc_address" env:"GRPC_ADDRESS" env-default:""`
+}
+
+// Duration is a time.Duration written as a string such as "15m" in JSON and environment variables
+type Duration time.Duration
+
+// UnmarshalText parses a duration such as "15m" or "720h"
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalText formats the duration like time.Duration.String
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
 }
 
 // Load loads configuration from environment variables, JSON file, and command-line flags
@@ -39,24 +144,48 @@ func Load() (*Config, error) {
 	serverAddr := flag.String("server-address", "", "Server address (e.g., :8080)")
 	dbDSN := flag.String("database-dsn", "", "Database DSN connection string")
 	jwtSecret := flag.String("jwt-secret", "", "JWT secret key")
+	jwtSigningKeyFile := flag.String("jwt-signing-key-file", "", "Path to a PEM private key (Ed25519, ECDSA P-256 or RSA) for signing tokens")
+	jwtVerificationKeyFiles := flag.String("jwt-verification-key-files", "", "Comma-separated paths to PEM keys of retired signing keys")
+	jwtIssuer := flag.String("jwt-issuer", "", "Issuer (iss) of tokens")
+	jwtAudience := flag.String("jwt-audience", "", "Audience (aud) of tokens")
 	storageType := flag.String("storage-type", "", "Storage type: memory or postgres")
 	enableTLS := flag.Bool("enable-tls", false, "Enable HTTPS/TLS")
 	tlsCertFile := flag.String("tls-cert", "", "Path to TLS certificate file")
 	tlsKeyFile := flag.String("tls-key", "", "Path to TLS private key file")
-	encryptionKey := flag.String("encryption-key", "", "Master encryption key for secrets (32 bytes)")
+	tlsClientCAFile := flag.String("tls-client-ca", "", "Path to a PEM bundle of CAs for client certificates")
+	tlsClientAuth := flag.String("tls-client-auth", "", "Client certificate mode: none, optional or require")
+	encryptionKey := flag.String("encryption-key", "", "Master encryption key for secrets as format:value (base64, hex, passphrase, file, env, transit, shamir, legacy)")
+	encryptionKeyFile := flag.String("encryption-key-file", "", "Path to a file with the master encryption key")
+	encryptionKeys := flag.String("encryption-keys", "", "Comma-separated master keys as id:format:value, oldest first")
+	strictBinding := flag.Bool("strict-secret-binding", false, "Reject secrets not bound to their owner and record (run rekey first)")
+	blindIndex := flag.Bool("blind-index", false, "Maintain HMAC blind indexes for searching encrypted metadata (run rekey after enabling)")
+	kmsAddress := flag.String("kms-address", "", "Transit key management service address including the mount path (e.g., https://vault:8200/v1/transit)")
+	kmsTokenFile := flag.String("kms-token-file", "", "Path to a file with the transit key management service token")
+	accessTokenTTL := flag.Duration("access-token-ttl", 0, "Lifetime of access tokens (e.g., 15m)")
+	refreshTokenTTL := flag.Duration("refresh-token-ttl", 0, "Lifetime of refresh tokens (e.g., 720h)")
+	loginLockoutThreshold := flag.Int("login-lockout-threshold", 0, "Number of failed logins that temporarily locks an account")
+	loginLockoutDuration := flag.Duration("login-lockout-duration", 0, "How long an account stays locked (e.g., 15m)")
+	oidcIssuer := flag.String("oidc-issuer", "", "OpenID Connect issuer URL for single sign-on")
+	oidcClientID := flag.String("oidc-client-id", "", "OpenID Connect client ID")
+	oidcRedirectURL := flag.String("oidc-redirect-url", "", "Public URL of /api/user/oidc/callback")
+	oidcLoginClaim := flag.String("oidc-login-claim", "", "ID token claim matched against user logins (e.g., email)")
+	oidcAutoProvision := flag.Bool("oidc-auto-provision", false, "Create users on their first sign-in with the identity provider")
+	ldapURL := flag.String("ldap-url", "", "LDAP server URL for login with directory credentials (e.g., ldaps://ldap.example.com)")
+	ldapStartTLS := flag.Bool("ldap-start-tls", false, "Upgrade the ldap:// connection with StartTLS")
+	ldapAutoProvision := flag.Bool("ldap-auto-provision", false, "Create users on their first login with directory credentials")
+	ldapBaseDN := flag.String("ldap-base-dn", "", "Base DN of the search for users")
+	ldapBindDN := flag.String("ldap-bind-dn", "", "DN of the account that searches for users")
+	ldapUserFilter := flag.String("ldap-user-filter", "", "LDAP filter of user entries, %s is the login (e.g., (uid=%s))")
+	passwordHasher := flag.String("password-hasher", "", "Hash of new passwords: argon2id or bcrypt")
+	passwordMinLength := flag.Int("password-min-length", 0, "Minimum length of new passwords")
+	passwordBreachListFile := flag.String("password-breach-list-file", "", "Path to a list of breached passwords refused on registration")
+	registrationMode := flag.String("registration-mode", "", "Who can register: open, invite-only or closed")
+	grpcAddr := flag.String("grpc-address", "", "gRPC API address (e.g., :9090); disabled if empty")
 
 	flag.Parse()
 
-	// Load from JSON file if specified
-	if *configFile != "" {
-		if err := loadFromJSON(cfg, *configFile); err != nil {
-			return nil, fmt.Errorf("failed to load config from JSON: %w", err)
-		}
-	}
-
-	// Load from environment variables (overrides JSON)
-	if err := cleanenv.ReadEnv(cfg); err != nil {
-		return nil, fmt.Errorf("failed to read environment variables: %w", err)
+	if err := readConfig(cfg, *configFile); err != nil {
+		return nil, err
 	}
 
 	// Override with command-line flags (highest priority)
@@ -69,6 +198,18 @@ func Load() (*Config, error) {
 	if *jwtSecret != "" {
 		cfg.JWTSecret = *jwtSecret
 	}
+	if *jwtSigningKeyFile != "" {
+		cfg.JWTSigningKeyFile = *jwtSigningKeyFile
+	}
+	if *jwtVerificationKeyFiles != "" {
+		cfg.JWTVerificationKeyFiles = strings.Split(*jwtVerificationKeyFiles, ",")
+	}
+	if *jwtIssuer != "" {
+		cfg.JWTIssuer = *jwtIssuer
+	}
+	if *jwtAudience != "" {
+		cfg.JWTAudience = *jwtAudience
+	}
 	if *storageType != "" {
 		cfg.StorageType = StorageType(*storageType)
 	}
@@ -81,9 +222,93 @@ func Load() (*Config, error) {
 	if *tlsKeyFile != "" {
 		cfg.TLSKeyFile = *tlsKeyFile
 	}
+	if *tlsClientCAFile != "" {
+		cfg.TLSClientCAFile = *tlsClientCAFile
+	}
+	if *tlsClientAuth != "" {
+		cfg.TLSClientAuth = *tlsClientAuth
+	}
 	if *encryptionKey != "" {
 		cfg.EncryptionKey = *encryptionKey
 	}
+	if *encryptionKeyFile != "" {
+		cfg.EncryptionKeyFile = *encryptionKeyFile
+	}
+	if *encryptionKeys != "" {
+		cfg.EncryptionKeys = strings.Split(*encryptionKeys, ",")
+	}
+	if flag.Lookup("strict-secret-binding").Value.String() == "true" {
+		cfg.StrictBinding = *strictBinding
+	}
+	if flag.Lookup("blind-index").Value.String() == "true" {
+		cfg.BlindIndex = *blindIndex
+	}
+	if *kmsAddress != "" {
+		cfg.KMSAddress = *kmsAddress
+	}
+	if *kmsTokenFile != "" {
+		cfg.KMSTokenFile = *kmsTokenFile
+	}
+	if *accessTokenTTL != 0 {
+		cfg.AccessTokenTTL = Duration(*accessTokenTTL)
+	}
+	if *refreshTokenTTL != 0 {
+		cfg.RefreshTokenTTL = Duration(*refreshTokenTTL)
+	}
+	if *loginLockoutThreshold != 0 {
+		cfg.LoginLockoutThreshold = *loginLockoutThreshold
+	}
+	if *loginLockoutDuration != 0 {
+		cfg.LoginLockoutDuration = Duration(*loginLockoutDuration)
+	}
+	if *oidcIssuer != "" {
+		cfg.OIDCIssuer = *oidcIssuer
+	}
+	if *oidcClientID != "" {
+		cfg.OIDCClientID = *oidcClientID
+	}
+	if *oidcRedirectURL != "" {
+		cfg.OIDCRedirectURL = *oidcRedirectURL
+	}
+	if *oidcLoginClaim != "" {
+		cfg.OIDCLoginClaim = *oidcLoginClaim
+	}
+	if flag.Lookup("oidc-auto-provision").Value.String() == "true" {
+		cfg.OIDCAutoProvision = *oidcAutoProvision
+	}
+	if *ldapURL != "" {
+		cfg.LDAPURL = *ldapURL
+	}
+	if flag.Lookup("ldap-start-tls").Value.String() == "true" {
+		cfg.LDAPStartTLS = *ldapStartTLS
+	}
+	if flag.Lookup("ldap-auto-provision").Value.String() == "true" {
+		cfg.LDAPAutoProvision = *ldapAutoProvision
+	}
+	if *ldapBaseDN != "" {
+		cfg.LDAPBaseDN = *ldapBaseDN
+	}
+	if *ldapBindDN != "" {
+		cfg.LDAPBindDN = *ldapBindDN
+	}
+	if *ldapUserFilter != "" {
+		cfg.LDAPUserFilter = *ldapUserFilter
+	}
+	if *passwordHasher != "" {
+		cfg.PasswordHasher = *passwordHasher
+	}
+	if *passwordMinLength != 0 {
+		cfg.PasswordMinLength = *passwordMinLength
+	}
+	if *passwordBreachListFile != "" {
+		cfg.PasswordBreachListFile = *passwordBreachListFile
+	}
+	if *registrationMode != "" {
+		cfg.RegistrationMode = *registrationMode
+	}
+	if *grpcAddr != "" {
+		cfg.GRPCAddress = *grpcAddr
+	}
 
 	// Validate configuration
 	if err := cfg.Validate(); err != nil {
@@ -93,6 +318,21 @@ func Load() (*Config, error) {
 	return cfg, nil
 }
 
+// readConfig loads the JSON file, if any, and then the environment variables, which
+// override it; defaults are applied to the fields that are still zero
+func readConfig(cfg *Config, configFile string) error {
+	if configFile != "" {
+		if err := loadFromJSON(cfg, configFile); err != nil {
+			return fmt.Errorf("failed to load config from JSON: %w", err)
+		}
+	}
+
+	if err := cleanenv.ReadEnv(cfg); err != nil {
+		return fmt.Errorf("failed to read environment variables: %w", err)
+	}
+	return nil
+}
+
 // loadFromJSON loads configuration from a JSON file
 func loadFromJSON(cfg *Config, filename string) error {
 	file, err := os.Open(filename)
@@ -119,8 +359,45 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("database_dsn is required when storage_type is 'postgres'")
 	}
 
-	if c.JWTSecret == "" {
-		return fmt.Errorf("jwt_secret is required")
+	if c.JWTSecret != "" && c.JWTSigningKeyFile != "" {
+		return fmt.Errorf("only one of jwt_secret and jwt_signing_key_file can be set")
+	}
+	if len(c.JWTVerificationKeyFiles) > 0 && c.JWTSigningKeyFile == "" {
+		return fmt.Errorf("jwt_verification_key_files requires jwt_signing_key_file")
+	}
+
+	keySources := 0
+	for _, set := range []bool{c.EncryptionKey != "", c.EncryptionKeyFile != "", len(c.EncryptionKeys) > 0} {
+		if set {
+			keySources++
+		}
+	}
+	if keySources > 1 {
+		return fmt.Errorf("only one of encryption_key, encryption_key_file and encryption_keys can be set")
+	}
+
+	for _, spec := range c.EncryptionKeys {
+		if keyID, key, found := strings.Cut(spec, ":"); !found || keyID == "" || key == "" {
+			return fmt.Errorf("invalid encryption_keys entry: expected \"id:format:value\"")
+		}
+	}
+
+	for _, spec := range c.EncryptionKeySpecs() {
+		_, key, _ := strings.Cut(spec, ":")
+		if strings.HasPrefix(key, "transit:") && c.KMSAddress == "" {
+			return fmt.Errorf("kms_address is required for transit encryption keys")
+		}
+	}
+
+	if c.AccessTokenTTL <= 0 || c.RefreshTokenTTL <= 0 {
+		return fmt.Errorf("access_token_ttl and refresh_token_ttl must be positive")
+	}
+	if c.RefreshTokenTTL <= c.AccessTokenTTL {
+		return fmt.Errorf("refresh_token_ttl must be longer than access_token_ttl")
+	}
+
+	if c.LoginLockoutThreshold <= 0 || c.LoginLockoutDuration <= 0 {
+		return fmt.Errorf("login_lockout_threshold and login_lockout_duration must be positive")
 	}
 
 	if c.EnableTLS {
@@ -132,6 +409,73 @@ func (c *Config) Validate() error {
 		}
 	}
 
+	switch c.TLSClientAuth {
+	case TLSClientAuthNone:
+		if len(c.TLSClientCertUsers) > 0 {
+			return fmt.Errorf("tls_client_cert_users requires tls_client_auth to be optional or require")
+		}
+	case TLSClientAuthOptional, TLSClientAuthRequire:
+		if !c.EnableTLS || c.TLSClientCAFile == "" {
+			return fmt.Errorf("tls_client_auth requires enable_tls and tls_client_ca_file")
+		}
+	default:
+		return fmt.Errorf("tls_client_auth must be none, optional or require")
+	}
+
+	if c.OIDCIssuer != "" {
+		if c.OIDCClientID == "" {
+			return fmt.Errorf("oidc_client_id is required when oidc_issuer is set")
+		}
+		if c.OIDCLoginClaim == "" {
+			return fmt.Errorf("oidc_login_claim must not be empty")
+		}
+	}
+
+	if c.LDAPURL != "" {
+		if c.LDAPBaseDN == "" {
+			return fmt.Errorf("ldap_base_dn is required when ldap_url is set")
+		}
+		if strings.Count(c.LDAPUserFilter, "%s") != 1 {
+			return fmt.Errorf("ldap_user_filter must contain %%s exactly once")
+		}
+	}
+
+	if c.PasswordHasher != PasswordHasherArgon2id && c.PasswordHasher != PasswordHasherBcrypt {
+		return fmt.Errorf("password_hasher must be argon2id or bcrypt")
+	}
+	if c.PasswordMinLength < 1 {
+		return fmt.Errorf("password_min_length must be positive")
+	}
+
+	switch c.RegistrationMode {
+	case RegistrationOpen, RegistrationInviteOnly, RegistrationClosed:
+	default:
+		return fmt.Errorf("registration_mode must be open, invite-only or closed")
+	}
+	if c.InviteTTL <= 0 {
+		return fmt.Errorf("invite_ttl must be positive")
+	}
+
+	return nil
+}
+
+// EncryptionEnabled returns true if at least one master encryption key is configured
+func (c *Config) EncryptionEnabled() bool {
+	return c.EncryptionKey != "" || c.EncryptionKeyFile != "" || len(c.EncryptionKeys) > 0
+}
+
+// EncryptionKeySpecs returns the configured master keys as "id:format:value" specifications, oldest first
+// A key set via encryption_key or encryption_key_file gets the ID "default"
+func (c *Config) EncryptionKeySpecs() []string {
+	if len(c.EncryptionKeys) > 0 {
+		return c.EncryptionKeys
+	}
+	if c.EncryptionKey != "" {
+		return []string{"default:" + c.EncryptionKey}
+	}
+	if c.EncryptionKeyFile != "" {
+		return []string{"default:file:" + c.EncryptionKeyFile}
+	}
 	return nil
 }
 
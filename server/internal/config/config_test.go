@@ -0,0 +1,38 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestReadConfigBooleans tests that boolean options read from the JSON file are not
+// replaced by their defaults
+func TestReadConfigBooleans(t *testing.T) {
+	tests := []struct {
+		name     string
+		json     string
+		expected bool
+	}{
+		{name: "disabled", json: `{"oidc_auto_provision": false, "ldap_auto_provision": false}`, expected: false},
+		{name: "enabled", json: `{"oidc_auto_provision": true, "ldap_auto_provision": true}`, expected: true},
+		{name: "default", json: `{}`, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.json")
+			if err := os.WriteFile(path, []byte(tt.json), 0o600); err != nil {
+				t.Fatalf("Failed to write config file: %v", err)
+			}
+
+			cfg := &Config{}
+			if err := readConfig(cfg, path); err != nil {
+				t.Fatalf("Failed to read config: %v", err)
+			}
+			if cfg.OIDCAutoProvision != tt.expected || cfg.LDAPAutoProvision != tt.expected {
+				t.Errorf("Expected auto-provisioning %v, got OIDC %v and LDAP %v", tt.expected, cfg.OIDCAutoProvision, cfg.LDAPAutoProvision)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package crypto
+
+import (
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+)
+
+// blindIndexInfo separates the blind index key from other keys derived from the same key
+const blindIndexInfo = "gophkeeper/blind-index/v1"
+
+// BlindIndex computes HMAC-SHA256 terms that allow exact-match lookups of encrypted
+// values without revealing them. Equal values produce equal terms under the same key
+type BlindIndex struct {
+	key []byte
+}
+
+// BlindIndex returns a BlindIndex keyed with a subkey derived from the Encryptor's key via HKDF
+func (e *Encryptor) BlindIndex() (*BlindIndex, error) {
+	key, err := hkdf.Key(sha256.New, e.key, nil, blindIndexInfo, KeySize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive blind index key: %w", err)
+	}
+	return &BlindIndex{key: key}, nil
+}
+
+// Term returns the blind index term for a value of the given kind
+// The kind is part of the MAC so equal values of different kinds do not collide
+func (b *BlindIndex) Term(kind, value string) []byte {
+	mac := hmac.New(sha256.New, b.key)
+	mac.Write([]byte(kind))
+	mac.Write([]byte{0})
+	mac.Write([]byte(value))
+	return mac.Sum(nil)
+}
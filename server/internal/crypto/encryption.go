@@ -1,6 +1,7 @@
 package crypto
 
 import (
+	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
@@ -9,49 +10,77 @@ import (
 	"io"
 )
 
+// KeySize is the size in bytes of AES-256 keys
+const KeySize = 32
+
+// DefaultKeyID is the key ID of a master key configured without an explicit ID
+const DefaultKeyID = "default"
+
 // Encryptor handles encryption and decryption of data using AES-256-GCM
 type Encryptor struct {
-	key []byte
+	keyID string
+	key   []byte
 }
 
-// NewEncryptor creates a new Encryptor with the provided key
-// The key should be 32 bytes for AES-256
+// NewEncryptor creates a new Encryptor with the provided key and DefaultKeyID
+// The key must be exactly 32 bytes for AES-256; use ParseKey for encoded keys and passphrases
 func NewEncryptor(key string) (*Encryptor, error) {
 	if key == "" {
 		return nil, fmt.Errorf("encryption key cannot be empty")
 	}
 
-	// Decode the key from base64 or use it directly
-	keyBytes := []byte(key)
+	return NewEncryptorFromKey(DefaultKeyID, []byte(key))
+}
+
+// NewEncryptorFromKey creates a new Encryptor from raw key bytes
+// The key must be exactly KeySize bytes long
+func NewEncryptorFromKey(keyID string, key []byte) (*Encryptor, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("invalid key length: got %d bytes, want %d", len(key), KeySize)
+	}
 
-	// If the key is not 32 bytes, we need to derive it properly
-	if len(keyBytes) != 32 {
-		// For simplicity, we'll pad or truncate to 32 bytes
-		// In production, use a proper key derivation function (KDF)
-		derivedKey := make([]byte, 32)
-		copy(derivedKey, keyBytes)
-		keyBytes = derivedKey
+	if len(keyID) > maxKeyIDLength {
+		return nil, fmt.Errorf("key ID too long: %d bytes (max %d)", len(keyID), maxKeyIDLength)
 	}
 
-	return &Encryptor{key: keyBytes}, nil
+	keyBytes := make([]byte, KeySize)
+	copy(keyBytes, key)
+
+	return &Encryptor{keyID: keyID, key: keyBytes}, nil
+}
+
+// KeyID returns the ID of the key used by the Encryptor
+func (e *Encryptor) KeyID() string {
+	return e.keyID
 }
 
 // Encrypt encrypts plaintext data using AES-256-GCM
-// Returns the encrypted data with the nonce prepended
+// Returns the versioned header followed by the nonce and the encrypted data
+// The header is authenticated as additional data
 func (e *Encryptor) Encrypt(plaintext []byte) ([]byte, error) {
+	return e.seal(plaintext, FormatVersion, nil)
+}
+
+// EncryptWithContext encrypts plaintext like Encrypt and additionally authenticates
+// associatedData, which must be passed unchanged to DecryptWithContext
+func (e *Encryptor) EncryptWithContext(plaintext, associatedData []byte) ([]byte, error) {
+	if len(associatedData) == 0 {
+		return nil, fmt.Errorf("associated data cannot be empty")
+	}
+	return e.seal(plaintext, FormatVersionBound, associatedData)
+}
+
+func (e *Encryptor) seal(plaintext []byte, version byte, associatedData []byte) ([]byte, error) {
 	if len(plaintext) == 0 {
 		return nil, fmt.Errorf("plaintext cannot be empty")
 	}
 
-	block, err := aes.NewCipher(e.key)
+	gcm, err := e.newGCM()
 	if err != nil {
-		return nil, fmt.Errorf("failed to create cipher: %w", err)
+		return nil, err
 	}
 
-	gcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create GCM: %w", err)
-	}
+	header := Header{Version: version, Algorithm: AlgorithmAES256GCM, KeyID: e.keyID}.marshal()
 
 	// Create a nonce
 	nonce := make([]byte, gcm.NonceSize())
@@ -60,37 +89,80 @@ func (e *Encryptor) Encrypt(plaintext []byte) ([]byte, error) {
 	}
 
 	// Encrypt the data
-	ciphertext := gcm.Seal(nonce, nonce, plaintext, nil)
-	return ciphertext, nil
+	out := make([]byte, 0, len(header)+len(nonce)+len(plaintext)+gcm.Overhead())
+	out = append(out, header...)
+	out = append(out, nonce...)
+	return gcm.Seal(out, nonce, plaintext, append(header, associatedData...)), nil
 }
 
 // Decrypt decrypts ciphertext data using AES-256-GCM
-// Expects the nonce to be prepended to the ciphertext
+// Accepts both the versioned format produced by Encrypt and the legacy
+// headerless format where the nonce is prepended to the ciphertext
 func (e *Encryptor) Decrypt(ciphertext []byte) ([]byte, error) {
+	return e.DecryptWithContext(ciphertext, nil)
+}
+
+// DecryptWithContext decrypts a ciphertext produced by EncryptWithContext with the same
+// associated data; it fails if the ciphertext was moved to a different context
+// Ciphertexts without associated data are decrypted as by Decrypt
+func (e *Encryptor) DecryptWithContext(ciphertext, associatedData []byte) ([]byte, error) {
 	if len(ciphertext) == 0 {
 		return nil, fmt.Errorf("ciphertext cannot be empty")
 	}
 
-	block, err := aes.NewCipher(e.key)
+	header, body, ok := ParseHeader(ciphertext)
+	if !ok {
+		return e.decryptLegacy(ciphertext)
+	}
+
+	if header.KeyID != e.keyID || header.Algorithm != AlgorithmAES256GCM {
+		// A legacy nonce may look like a header by chance
+		if plaintext, err := e.decryptLegacy(ciphertext); err == nil {
+			return plaintext, nil
+		}
+		if header.Algorithm != AlgorithmAES256GCM {
+			return nil, fmt.Errorf("unsupported ciphertext algorithm %d", header.Algorithm)
+		}
+		return nil, fmt.Errorf("ciphertext was encrypted with key %q, not %q", header.KeyID, e.keyID)
+	}
+
+	additionalData := bytes.Clone(ciphertext[:len(ciphertext)-len(body)])
+	if header.Version == FormatVersionBound {
+		additionalData = append(additionalData, associatedData...)
+	}
+
+	plaintext, err := e.open(body, additionalData)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create cipher: %w", err)
+		if legacy, legacyErr := e.decryptLegacy(ciphertext); legacyErr == nil {
+			return legacy, nil
+		}
+		return nil, err
 	}
+	return plaintext, nil
+}
 
-	gcm, err := cipher.NewGCM(block)
+// decryptLegacy decrypts the headerless nonce||ciphertext format
+func (e *Encryptor) decryptLegacy(ciphertext []byte) ([]byte, error) {
+	return e.open(ciphertext, nil)
+}
+
+// open decrypts nonce||ciphertext authenticating the given additional data
+func (e *Encryptor) open(data, additionalData []byte) ([]byte, error) {
+	gcm, err := e.newGCM()
 	if err != nil {
-		return nil, fmt.Errorf("failed to create GCM: %w", err)
+		return nil, err
 	}
 
 	nonceSize := gcm.NonceSize()
-	if len(ciphertext) < nonceSize {
+	if len(data) < nonceSize {
 		return nil, fmt.Errorf("ciphertext too short")
 	}
 
 	// Extract nonce and ciphertext
-	nonce, ciphertext := ciphertext[:nonceSize], ciphertext[nonceSize:]
+	nonce, ciphertext := data[:nonceSize], data[nonceSize:]
 
 	// Decrypt the data
-	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, additionalData)
 	if err != nil {
 		return nil, fmt.Errorf("failed to decrypt: %w", err)
 	}
@@ -98,6 +170,20 @@ func (e *Encryptor) Decrypt(ciphertext []byte) ([]byte, error) {
 	return plaintext, nil
 }
 
+func (e *Encryptor) newGCM() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(e.key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+
+	return gcm, nil
+}
+
 // GenerateKey generates a random 32-byte key suitable for AES-256
 // Returns the key as a base64-encoded string
 func GenerateKey() (string, error) {
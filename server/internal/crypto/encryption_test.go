@@ -0,0 +1,225 @@
+package crypto
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+var (
+	oldKeyHex    = hex.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+	newKeyBase64 = base64.StdEncoding.EncodeToString([]byte("fedcba9876543210fedcba9876543210"))
+)
+
+// TestEncryptVersionedFormat tests that ciphertexts carry a header naming the key
+func TestEncryptVersionedFormat(t *testing.T) {
+	encryptor, err := NewEncryptorFromKey("k1", []byte("0123456789abcdef0123456789abcdef"))
+	if err != nil {
+		t.Fatalf("Failed to create encryptor: %v", err)
+	}
+
+	ciphertext, err := encryptor.Encrypt([]byte("secret"))
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %v", err)
+	}
+
+	header, _, ok := ParseHeader(ciphertext)
+	if !ok {
+		t.Fatal("Expected versioned header")
+	}
+	if header.Version != FormatVersion || header.Algorithm != AlgorithmAES256GCM || header.KeyID != "k1" {
+		t.Errorf("Unexpected header: %+v", header)
+	}
+
+	// The header is authenticated
+	tampered := bytes.Clone(ciphertext)
+	tampered[3] = 0
+	if _, err := encryptor.Decrypt(tampered); err == nil {
+		t.Error("Expected tampered header to fail decryption")
+	}
+}
+
+// TestKeyringRotation tests that the newest key encrypts and all keys decrypt
+func TestKeyringRotation(t *testing.T) {
+	ctx := context.Background()
+	oldKeyring, err := ParseKeySpecs(ctx, []string{"old:hex:" + oldKeyHex}, KeySources{})
+	if err != nil {
+		t.Fatalf("Failed to create keyring: %v", err)
+	}
+	oldCiphertext, _ := oldKeyring.Encrypt(ctx, []byte("old secret"))
+
+	// Headerless nonce||ciphertext produced before the versioned format existed
+	legacyKey, _ := ParseKey(ctx, "old", "hex:"+oldKeyHex, nil)
+	gcm, _ := legacyKey.newGCM()
+	nonce := make([]byte, gcm.NonceSize())
+	legacyCiphertext := gcm.Seal(nonce, nonce, []byte("legacy secret"), nil)
+
+	keyring, err := ParseKeySpecs(ctx, []string{
+		"old:hex:" + oldKeyHex,
+		"new:base64:" + newKeyBase64,
+	}, KeySources{})
+	if err != nil {
+		t.Fatalf("Failed to create keyring: %v", err)
+	}
+	if keyring.Primary().KeyID() != "new" {
+		t.Errorf("Expected newest key to be primary, got %s", keyring.Primary().KeyID())
+	}
+
+	for name, ciphertext := range map[string][]byte{"old secret": oldCiphertext, "legacy secret": legacyCiphertext} {
+		plaintext, err := keyring.Decrypt(ctx, ciphertext)
+		if err != nil {
+			t.Fatalf("Failed to decrypt %s: %v", name, err)
+		}
+		if string(plaintext) != name {
+			t.Errorf("Expected %q, got %q", name, plaintext)
+		}
+		if !keyring.NeedsRotation(ciphertext) {
+			t.Errorf("Expected %s to need rotation", name)
+		}
+	}
+
+	newCiphertext, _ := keyring.Encrypt(ctx, []byte("new secret"))
+	if keyring.NeedsRotation(newCiphertext) {
+		t.Error("Expected ciphertext from the primary key not to need rotation")
+	}
+	if _, err := oldKeyring.Decrypt(ctx, newCiphertext); err == nil {
+		t.Error("Expected keyring without the new key to fail")
+	}
+}
+
+// memSaltStore is an in-memory SaltStore for tests
+type memSaltStore map[string][]byte
+
+func (m memSaltStore) CreateKeySalt(_ context.Context, keyID string, salt []byte) ([]byte, error) {
+	if existing, ok := m[keyID]; ok {
+		return existing, nil
+	}
+	m[keyID] = salt
+	return salt, nil
+}
+
+// TestParseKey tests the supported key formats and the rejection of weak or malformed keys
+func TestParseKey(t *testing.T) {
+	ctx := context.Background()
+	salts := memSaltStore{}
+
+	tests := []struct {
+		name      string
+		value     string
+		expectErr bool
+	}{
+		{name: "base64 key", value: "base64:" + newKeyBase64},
+		{name: "hex key", value: "hex:" + oldKeyHex},
+		{name: "passphrase", value: "passphrase:correct horse battery staple"},
+		{name: "legacy key", value: "legacy:short"},
+		{name: "missing format", value: newKeyBase64, expectErr: true},
+		{name: "unknown format", value: "rot13:abc", expectErr: true},
+		{name: "malformed base64", value: "base64:not base64!", expectErr: true},
+		{name: "short base64 key", value: "base64:" + base64.StdEncoding.EncodeToString([]byte("short")), expectErr: true},
+		{name: "low entropy key", value: "hex:" + hex.EncodeToString(make([]byte, KeySize)), expectErr: true},
+		{name: "short passphrase", value: "passphrase:password", expectErr: true},
+		{name: "repetitive passphrase", value: "passphrase:aaaaaaaaaaaaaaaaaaaaaaaa", expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseKey(ctx, "k", tt.value, salts)
+			if tt.expectErr && err == nil {
+				t.Error("Expected error but got none")
+			}
+			if !tt.expectErr && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+// TestParseKeyPassphraseSalt tests that passphrase keys are stable for a stored salt
+func TestParseKeyPassphraseSalt(t *testing.T) {
+	ctx := context.Background()
+	salts := memSaltStore{}
+	passphrase := "passphrase:correct horse battery staple"
+
+	first, err := ParseKey(ctx, "k", passphrase, salts)
+	if err != nil {
+		t.Fatalf("Failed to parse key: %v", err)
+	}
+	second, _ := ParseKey(ctx, "k", passphrase, salts)
+	if !bytes.Equal(first.key, second.key) {
+		t.Error("Expected the same key for the same stored salt")
+	}
+
+	other, _ := ParseKey(ctx, "k", passphrase, memSaltStore{})
+	if bytes.Equal(first.key, other.key) {
+		t.Error("Expected a different key for a different salt")
+	}
+
+	if _, err := ParseKey(ctx, "k", passphrase, nil); err == nil {
+		t.Error("Expected error without a salt store")
+	}
+}
+
+// TestParseKeyFile tests loading keys from files and the permission check
+func TestParseKeyFile(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	keyPath := filepath.Join(dir, "master.key")
+	if err := os.WriteFile(keyPath, []byte(newKeyBase64+"\n"), 0o600); err != nil {
+		t.Fatalf("Failed to write key file: %v", err)
+	}
+
+	fromFile, err := ParseKey(ctx, "k", "file:"+keyPath, nil)
+	if err != nil {
+		t.Fatalf("Failed to load key file: %v", err)
+	}
+	inline, _ := ParseKey(ctx, "k", "base64:"+newKeyBase64, nil)
+	if !bytes.Equal(fromFile.key, inline.key) {
+		t.Error("Expected key file to hold the same key as the inline value")
+	}
+
+	if runtime.GOOS != "windows" {
+		if err := os.Chmod(keyPath, 0o644); err != nil {
+			t.Fatalf("Failed to chmod key file: %v", err)
+		}
+		if _, err := ParseKey(ctx, "k", "file:"+keyPath, nil); err == nil {
+			t.Error("Expected error for a world-readable key file")
+		}
+	}
+
+	if _, err := ParseKey(ctx, "k", "file:"+filepath.Join(dir, "missing.key"), nil); err == nil {
+		t.Error("Expected error for a missing key file")
+	}
+}
+
+// TestParseKeyEnv tests loading keys from environment variables
+func TestParseKeyEnv(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("GOPHKEEPER_TEST_KEY", newKeyBase64)
+
+	fromEnv, err := ParseKey(ctx, "k", "env:GOPHKEEPER_TEST_KEY", nil)
+	if err != nil {
+		t.Fatalf("Failed to load key from environment: %v", err)
+	}
+	inline, _ := ParseKey(ctx, "k", "base64:"+newKeyBase64, nil)
+	if !bytes.Equal(fromEnv.key, inline.key) {
+		t.Error("Expected environment variable to hold the same key as the inline value")
+	}
+
+	if _, ok := os.LookupEnv("GOPHKEEPER_TEST_KEY"); ok {
+		t.Error("Expected environment variable to be removed after reading")
+	}
+	if _, err := ParseKey(ctx, "k", "env:GOPHKEEPER_TEST_KEY", nil); err == nil {
+		t.Error("Expected error for an unset environment variable")
+	}
+
+	t.Setenv("GOPHKEEPER_TEST_KEY", "file:/etc/passwd")
+	if _, err := ParseKey(ctx, "k", "env:GOPHKEEPER_TEST_KEY", nil); err == nil {
+		t.Error("Expected error for an environment variable referring to a key file")
+	}
+}
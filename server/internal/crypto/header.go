@@ -0,0 +1,64 @@
+package crypto
+
+// Ciphertext format produced by Encryptor.Encrypt:
+//
+//	magic "GK" | version (1 byte) | algorithm (1 byte) | key ID length (1 byte) | key ID | nonce | ciphertext
+//
+// The header (everything before the nonce) is authenticated as GCM additional data.
+// Version 2 ciphertexts additionally authenticate caller-supplied associated data that
+// binds them to their context (e.g. owner and record); it is not stored in the ciphertext.
+
+const (
+	// FormatVersion is the format of ciphertexts without associated data
+	FormatVersion byte = 1
+
+	// FormatVersionBound is the format of ciphertexts bound to associated data
+	FormatVersionBound byte = 2
+
+	// AlgorithmAES256GCM identifies AES-256 in Galois/Counter Mode
+	AlgorithmAES256GCM byte = 1
+
+	// AlgorithmTransit identifies an opaque ciphertext produced by a transit key
+	// management service; the body is the service's ciphertext
+	AlgorithmTransit byte = 2
+
+	maxKeyIDLength = 255
+)
+
+var headerMagic = [2]byte{'G', 'K'}
+
+// Header describes how a ciphertext was produced
+type Header struct {
+	Version   byte
+	Algorithm byte
+	KeyID     string
+}
+
+// marshal encodes the header into its binary form
+func (h Header) marshal() []byte {
+	out := make([]byte, 0, 5+len(h.KeyID))
+	out = append(out, headerMagic[0], headerMagic[1], h.Version, h.Algorithm, byte(len(h.KeyID)))
+	return append(out, h.KeyID...)
+}
+
+// ParseHeader parses the header of a versioned ciphertext and returns it
+// together with the remaining nonce||ciphertext bytes
+// ok is false for legacy headerless ciphertexts and unsupported versions
+func ParseHeader(ciphertext []byte) (header Header, body []byte, ok bool) {
+	if len(ciphertext) < 5 || ciphertext[0] != headerMagic[0] || ciphertext[1] != headerMagic[1] {
+		return Header{}, nil, false
+	}
+
+	version, algorithm, keyIDLen := ciphertext[2], ciphertext[3], int(ciphertext[4])
+	if (version != FormatVersion && version != FormatVersionBound) ||
+		(algorithm != AlgorithmAES256GCM && algorithm != AlgorithmTransit) || len(ciphertext) < 5+keyIDLen {
+		return Header{}, nil, false
+	}
+
+	header = Header{
+		Version:   version,
+		Algorithm: algorithm,
+		KeyID:     string(ciphertext[5 : 5+keyIDLen]),
+	}
+	return header, ciphertext[5+keyIDLen:], true
+}
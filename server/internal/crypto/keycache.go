@@ -0,0 +1,124 @@
+package crypto
+
+import (
+	"sync"
+	"time"
+)
+
+// KeyCache keeps unwrapped data keys in memory for a bounded lifetime so that
+// the key encryption key is not needed on every request
+type KeyCache struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	maxEntries int
+	entries    map[int]cachedKey
+	now        func() time.Time
+}
+
+type cachedKey struct {
+	key       []byte
+	expiresAt time.Time
+}
+
+// NewKeyCache creates a new KeyCache
+// Keys expire after ttl; at most maxEntries keys are held at the same time
+func NewKeyCache(ttl time.Duration, maxEntries int) *KeyCache {
+	return &KeyCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[int]cachedKey),
+		now:        time.Now,
+	}
+}
+
+// Get returns a copy of the cached key for the given owner if it has not expired
+func (c *KeyCache) Get(id int) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[id]
+	if !ok {
+		return nil, false
+	}
+
+	if !c.now().Before(entry.expiresAt) {
+		c.evict(id)
+		return nil, false
+	}
+
+	key := make([]byte, len(entry.key))
+	copy(key, entry.key)
+	return key, true
+}
+
+// Put stores a copy of the key for the given owner
+// Expired entries are purged first; if the cache is still full the entry
+// closest to expiry is evicted
+func (c *KeyCache) Put(id int, key []byte) {
+	if c.ttl <= 0 || c.maxEntries <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, exists := c.entries[id]; !exists && len(c.entries) >= c.maxEntries {
+		c.purgeExpired()
+		if len(c.entries) >= c.maxEntries {
+			c.evictOldest()
+		}
+	}
+
+	stored := make([]byte, len(key))
+	copy(stored, key)
+	c.entries[id] = cachedKey{key: stored, expiresAt: c.now().Add(c.ttl)}
+}
+
+// Delete removes the key for the given owner from the cache
+func (c *KeyCache) Delete(id int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.evict(id)
+}
+
+// Purge removes all keys from the cache
+func (c *KeyCache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for id := range c.entries {
+		c.evict(id)
+	}
+}
+
+func (c *KeyCache) purgeExpired() {
+	now := c.now()
+	for id, entry := range c.entries {
+		if !now.Before(entry.expiresAt) {
+			c.evict(id)
+		}
+	}
+}
+
+func (c *KeyCache) evictOldest() {
+	oldestID := 0
+	var oldest time.Time
+	first := true
+	for id, entry := range c.entries {
+		if first || entry.expiresAt.Before(oldest) {
+			oldestID, oldest, first = id, entry.expiresAt, false
+		}
+	}
+	if !first {
+		c.evict(oldestID)
+	}
+}
+
+// evict removes an entry and zeroes its key material
+func (c *KeyCache) evict(id int) {
+	if entry, ok := c.entries[id]; ok {
+		clear(entry.key)
+		delete(c.entries, id)
+	}
+}
@@ -0,0 +1,326 @@
+package crypto
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Master key value formats, written as "<format>:<value>"
+const (
+	// FormatBase64 is a raw 32-byte key in standard base64 (e.g. from `openssl rand -base64 32`)
+	FormatBase64 = "base64"
+	// FormatHex is a raw 32-byte key as 64 hexadecimal characters
+	FormatHex = "hex"
+	// FormatPassphrase is a passphrase stretched with Argon2id and a stored per-key salt
+	FormatPassphrase = "passphrase"
+	// FormatFile is a path to a file holding a key in one of the other formats
+	// (a bare base64 or hex key is accepted as well)
+	FormatFile = "file"
+	// FormatEnv is the name of an environment variable holding a key like a key file does.
+	// The variable is removed from the environment once it is read
+	FormatEnv = "env"
+	// FormatTransit is the name of a key in a transit key management service;
+	// the key never leaves the service
+	FormatTransit = "transit"
+	// FormatShamir is a master key generated by the server and split into Shamir shares
+	// held by operators; it has no value and the server starts sealed
+	FormatShamir = "shamir"
+	// FormatLegacy is the pre-versioning behaviour where the text is zero-padded or
+	// truncated to 32 bytes. It only exists to decrypt old data until it is re-encrypted
+	FormatLegacy = "legacy"
+)
+
+// Argon2id parameters for passphrase keys. Changing them changes the derived key,
+// so new parameters require a new key ID
+const (
+	argon2Time    = 3
+	argon2Memory  = 64 * 1024
+	argon2Threads = 4
+	saltSize      = 16
+
+	minPassphraseLength   = 16
+	minPassphraseDistinct = 8
+	minKeyDistinctBytes   = 16
+)
+
+// SaltStore persists the salts of passphrase-derived keys
+type SaltStore interface {
+	// CreateKeySalt stores salt for the key ID unless one already exists
+	// and returns the salt that is persisted
+	CreateKeySalt(ctx context.Context, keyID string, salt []byte) ([]byte, error)
+}
+
+// KeySources holds what is needed to resolve keys that are not given inline
+type KeySources struct {
+	// Salts stores the salts of passphrase keys
+	Salts SaltStore
+	// Transit is the key management service of transit keys
+	Transit *TransitClient
+	// Seals stores the configuration of Shamir-sealed keys
+	Seals SealStore
+}
+
+// ParseKeySpecs creates a Keyring from "id:format:value" specifications ordered from oldest to newest
+func ParseKeySpecs(ctx context.Context, specs []string, sources KeySources) (*Keyring, error) {
+	keys := make([]KeyProvider, 0, len(specs))
+	sealed := false
+	for _, spec := range specs {
+		keyID, value, found := strings.Cut(spec, ":")
+		if !found || keyID == "" {
+			return nil, fmt.Errorf("invalid key specification: expected \"id:format:value\"")
+		}
+
+		if SpecFormat(spec) == FormatShamir {
+			if sealed {
+				return nil, fmt.Errorf("only one %s key can be configured", FormatShamir)
+			}
+			sealed = true
+		}
+
+		provider, err := ParseKeyProvider(ctx, keyID, value, sources)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %q: %w", keyID, err)
+		}
+		keys = append(keys, provider)
+	}
+
+	return NewKeyring(keys...)
+}
+
+// ParseKeyProvider creates a KeyProvider from a "format:value" key
+// Transit keys are checked with a test encryption so that a misconfigured
+// service is reported at startup
+func ParseKeyProvider(ctx context.Context, keyID, value string, sources KeySources) (KeyProvider, error) {
+	format, keyName, _ := strings.Cut(value, ":")
+	switch format {
+	case FormatTransit:
+		return parseTransitKey(ctx, keyID, keyName, sources.Transit)
+	case FormatShamir:
+		return NewSeal(keyID, sources.Seals)
+	}
+
+	encryptor, err := ParseKey(ctx, keyID, value, sources.Salts)
+	if err != nil {
+		return nil, err
+	}
+	return NewLocalKeyProvider(encryptor), nil
+}
+
+// parseTransitKey creates a KeyProvider for a key held by the transit service
+func parseTransitKey(ctx context.Context, keyID, keyName string, transit *TransitClient) (KeyProvider, error) {
+	if transit == nil {
+		return nil, fmt.Errorf("transit keys require a transit service address")
+	}
+
+	provider, err := transit.Key(keyID, keyName)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkProvider(ctx, provider); err != nil {
+		return nil, fmt.Errorf("transit key %q: %w", keyName, err)
+	}
+	return provider, nil
+}
+
+// ParseKey creates an Encryptor from a "format:value" key held in process memory
+func ParseKey(ctx context.Context, keyID, value string, salts SaltStore) (*Encryptor, error) {
+	format, data, found := strings.Cut(value, ":")
+	if !found {
+		return nil, fmt.Errorf("key has no format prefix (expected one of %s:, %s:, %s:, %s:, %s:); "+
+			"a key used before key formats were introduced must be configured as %s:<key> and re-encrypted with rekey",
+			FormatBase64, FormatHex, FormatPassphrase, FormatFile, FormatEnv, FormatLegacy)
+	}
+
+	var key []byte
+	var err error
+
+	switch format {
+	case FormatBase64:
+		key, err = decodeBase64Key(data)
+	case FormatHex:
+		key, err = decodeHexKey(data)
+	case FormatPassphrase:
+		key, err = derivePassphraseKey(ctx, keyID, data, salts)
+	case FormatFile:
+		key, err = loadKeyFile(ctx, keyID, data, salts)
+	case FormatEnv:
+		key, err = loadKeyEnv(ctx, keyID, data, salts)
+	case FormatTransit, FormatShamir:
+		err = fmt.Errorf("%s keys are not configured in process memory", format)
+	case FormatLegacy:
+		key, err = legacyKey(data)
+	default:
+		return nil, fmt.Errorf("unknown key format %q", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer clear(key)
+
+	return NewEncryptorFromKey(keyID, key)
+}
+
+// SpecFormat returns the format of an "id:format:value" key specification
+func SpecFormat(spec string) string {
+	_, value, _ := strings.Cut(spec, ":")
+	format, _, _ := strings.Cut(value, ":")
+	return format
+}
+
+func decodeBase64Key(data string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(data))
+	if err != nil {
+		return nil, fmt.Errorf("malformed base64 key: %w", err)
+	}
+	return key, checkRawKey(key)
+}
+
+func decodeHexKey(data string) ([]byte, error) {
+	key, err := hex.DecodeString(strings.TrimSpace(data))
+	if err != nil {
+		return nil, fmt.Errorf("malformed hex key: %w", err)
+	}
+	return key, checkRawKey(key)
+}
+
+// checkRawKey rejects keys of the wrong size and keys that are obviously not random
+func checkRawKey(key []byte) error {
+	if len(key) != KeySize {
+		return fmt.Errorf("key must be %d bytes, got %d", KeySize, len(key))
+	}
+
+	distinct := make(map[byte]struct{}, len(key))
+	for _, b := range key {
+		distinct[b] = struct{}{}
+	}
+	if len(distinct) < minKeyDistinctBytes {
+		return fmt.Errorf("key has too little entropy; generate it with `openssl rand -base64 32`")
+	}
+
+	return nil
+}
+
+// derivePassphraseKey stretches a passphrase with Argon2id using the key's stored salt
+func derivePassphraseKey(ctx context.Context, keyID, passphrase string, salts SaltStore) ([]byte, error) {
+	if len(passphrase) < minPassphraseLength {
+		return nil, fmt.Errorf("passphrase must be at least %d characters", minPassphraseLength)
+	}
+
+	distinct := make(map[rune]struct{})
+	for _, r := range passphrase {
+		distinct[r] = struct{}{}
+	}
+	if len(distinct) < minPassphraseDistinct {
+		return nil, fmt.Errorf("passphrase has too little entropy")
+	}
+
+	if salts == nil {
+		return nil, fmt.Errorf("passphrase keys require a salt store")
+	}
+
+	salt := make([]byte, saltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	salt, err := salts.CreateKeySalt(ctx, keyID, salt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load salt: %w", err)
+	}
+
+	return argon2.IDKey([]byte(passphrase), salt, argon2Time, argon2Memory, argon2Threads, KeySize), nil
+}
+
+// loadKeyFile reads a key from a file that must not be accessible by other users
+func loadKeyFile(ctx context.Context, keyID, path string, salts SaltStore) ([]byte, error) {
+	content, err := ReadPrivateFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	defer clear(content)
+
+	key, err := parseStoredKey(ctx, keyID, string(content), salts)
+	if err != nil {
+		return nil, fmt.Errorf("key file %s: %w", path, err)
+	}
+	return key, nil
+}
+
+// ReadPrivateFile reads a file holding key material or credentials
+// It fails if the file is accessible by group or others
+func ReadPrivateFile(path string) ([]byte, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Windows does not report Unix permission bits
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0o077 != 0 {
+		return nil, fmt.Errorf("%s has permissions %04o; it must not be accessible by group or others (chmod 600)",
+			path, info.Mode().Perm())
+	}
+
+	return os.ReadFile(path)
+}
+
+// loadKeyEnv reads a key from an environment variable and removes the variable
+// so that it is not inherited by child processes
+func loadKeyEnv(ctx context.Context, keyID, name string, salts SaltStore) ([]byte, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok || value == "" {
+		return nil, fmt.Errorf("environment variable %s is not set", name)
+	}
+	if err := os.Unsetenv(name); err != nil {
+		return nil, fmt.Errorf("failed to unset environment variable %s: %w", name, err)
+	}
+
+	key, err := parseStoredKey(ctx, keyID, value, salts)
+	if err != nil {
+		return nil, fmt.Errorf("environment variable %s: %w", name, err)
+	}
+	return key, nil
+}
+
+// parseStoredKey parses a key read from a key file or an environment variable:
+// a "format:value" key or a bare base64 or hex key
+func parseStoredKey(ctx context.Context, keyID, text string, salts SaltStore) ([]byte, error) {
+	value := strings.TrimSpace(text)
+	format, data, found := strings.Cut(value, ":")
+
+	switch {
+	case found && (format == FormatFile || format == FormatEnv || format == FormatTransit || format == FormatShamir):
+		return nil, fmt.Errorf("key cannot refer to another %s key", format)
+	case found && format == FormatPassphrase:
+		return derivePassphraseKey(ctx, keyID, data, salts)
+	case found && format == FormatHex:
+		return decodeHexKey(data)
+	case found && format == FormatBase64:
+		return decodeBase64Key(data)
+	case found && format == FormatLegacy:
+		return legacyKey(data)
+	case len(value) == 2*KeySize:
+		return decodeHexKey(value)
+	default:
+		return decodeBase64Key(value)
+	}
+}
+
+// legacyKey zero-pads or truncates text to KeySize bytes as NewEncryptor used to do
+func legacyKey(text string) ([]byte, error) {
+	if text == "" {
+		return nil, fmt.Errorf("legacy key cannot be empty")
+	}
+
+	key := make([]byte, KeySize)
+	copy(key, text)
+	return key, nil
+}
@@ -0,0 +1,121 @@
+package crypto
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Keyring holds the configured master keys
+// The newest (last) key encrypts; every key can decrypt
+type Keyring struct {
+	keys    map[string]KeyProvider
+	ordered []KeyProvider
+}
+
+// NewKeyring creates a new Keyring from keys ordered from oldest to newest
+func NewKeyring(keys ...KeyProvider) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("keyring requires at least one key")
+	}
+
+	kr := &Keyring{keys: make(map[string]KeyProvider, len(keys))}
+	for _, key := range keys {
+		if _, exists := kr.keys[key.KeyID()]; exists {
+			return nil, fmt.Errorf("duplicate key ID %q", key.KeyID())
+		}
+		kr.keys[key.KeyID()] = key
+		kr.ordered = append(kr.ordered, key)
+	}
+
+	return kr, nil
+}
+
+// Primary returns the key used for new encryptions
+func (kr *Keyring) Primary() KeyProvider {
+	return kr.ordered[len(kr.ordered)-1]
+}
+
+// Seal returns the Shamir-sealed key of the keyring, or nil if there is none
+func (kr *Keyring) Seal() *Seal {
+	for _, key := range kr.ordered {
+		if seal, ok := key.(*Seal); ok {
+			return seal
+		}
+	}
+	return nil
+}
+
+// Encrypt encrypts plaintext with the primary key
+func (kr *Keyring) Encrypt(ctx context.Context, plaintext []byte) ([]byte, error) {
+	return kr.Primary().Encrypt(ctx, plaintext)
+}
+
+// Decrypt decrypts ciphertext with the key named in its header
+// Legacy headerless ciphertexts are tried against every local key, newest first
+func (kr *Keyring) Decrypt(ctx context.Context, ciphertext []byte) ([]byte, error) {
+	if header, _, ok := ParseHeader(ciphertext); ok {
+		if key, exists := kr.keys[header.KeyID]; exists {
+			plaintext, err := key.Decrypt(ctx, ciphertext)
+			if err == nil || header.Algorithm == AlgorithmTransit || errors.Is(err, ErrSealed) {
+				return plaintext, err
+			}
+		}
+	}
+
+	var errs []error
+	for i := len(kr.ordered) - 1; i >= 0; i-- {
+		key, ok := kr.ordered[i].(legacyDecrypter)
+		if !ok {
+			continue
+		}
+		plaintext, err := key.decryptLegacy(ciphertext)
+		if err == nil {
+			return plaintext, nil
+		}
+		errs = append(errs, err)
+	}
+
+	if header, _, ok := ParseHeader(ciphertext); ok {
+		if _, exists := kr.keys[header.KeyID]; !exists {
+			return nil, fmt.Errorf("unknown key ID %q", header.KeyID)
+		}
+	}
+	if len(errs) == 0 {
+		return nil, fmt.Errorf("no key can decrypt headerless ciphertexts")
+	}
+	return nil, errors.Join(errs...)
+}
+
+// WrapKey wraps a data key with the primary key
+func (kr *Keyring) WrapKey(ctx context.Context, dataKey []byte) ([]byte, error) {
+	if len(dataKey) != KeySize {
+		return nil, fmt.Errorf("invalid data key length: got %d bytes, want %d", len(dataKey), KeySize)
+	}
+
+	wrapped, err := kr.Encrypt(ctx, dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap data key: %w", err)
+	}
+	return wrapped, nil
+}
+
+// UnwrapKey unwraps a data key with whichever key wrapped it
+func (kr *Keyring) UnwrapKey(ctx context.Context, wrappedKey []byte) ([]byte, error) {
+	dataKey, err := kr.Decrypt(ctx, wrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+
+	if len(dataKey) != KeySize {
+		return nil, fmt.Errorf("invalid unwrapped data key length: %d", len(dataKey))
+	}
+	return dataKey, nil
+}
+
+// NeedsRotation reports whether ciphertext was not produced by the primary key
+// in the current format
+func (kr *Keyring) NeedsRotation(ciphertext []byte) bool {
+	header, _, ok := ParseHeader(ciphertext)
+	return !ok || header.KeyID != kr.Primary().KeyID()
+}
@@ -0,0 +1,74 @@
+package crypto
+
+import (
+	"context"
+	"fmt"
+)
+
+// KeyProvider performs encryption with a master key (KEK)
+// Implementations may hold the key in process memory or delegate to an external
+// key management service, in which case the key never leaves that service
+type KeyProvider interface {
+	// KeyID returns the ID recorded in ciphertexts produced by the provider
+	KeyID() string
+	// Encrypt encrypts plaintext and returns a versioned ciphertext
+	Encrypt(ctx context.Context, plaintext []byte) ([]byte, error)
+	// Decrypt decrypts a ciphertext produced by Encrypt
+	Decrypt(ctx context.Context, ciphertext []byte) ([]byte, error)
+}
+
+// legacyDecrypter is implemented by providers able to decrypt headerless ciphertexts
+// written before the versioned format was introduced
+type legacyDecrypter interface {
+	decryptLegacy(ciphertext []byte) ([]byte, error)
+}
+
+// LocalKeyProvider is a KeyProvider holding the master key in process memory
+type LocalKeyProvider struct {
+	encryptor *Encryptor
+}
+
+// NewLocalKeyProvider creates a KeyProvider that encrypts with the Encryptor's key
+func NewLocalKeyProvider(encryptor *Encryptor) *LocalKeyProvider {
+	return &LocalKeyProvider{encryptor: encryptor}
+}
+
+// KeyID returns the ID of the underlying key
+func (p *LocalKeyProvider) KeyID() string {
+	return p.encryptor.KeyID()
+}
+
+// Encrypt encrypts plaintext with the underlying key
+func (p *LocalKeyProvider) Encrypt(_ context.Context, plaintext []byte) ([]byte, error) {
+	return p.encryptor.Encrypt(plaintext)
+}
+
+// Decrypt decrypts ciphertext with the underlying key
+func (p *LocalKeyProvider) Decrypt(_ context.Context, ciphertext []byte) ([]byte, error) {
+	return p.encryptor.Decrypt(ciphertext)
+}
+
+func (p *LocalKeyProvider) decryptLegacy(ciphertext []byte) ([]byte, error) {
+	return p.encryptor.decryptLegacy(ciphertext)
+}
+
+// checkProvider verifies that the provider can decrypt what it encrypts
+// It catches misconfigured remote keys at startup rather than on the first request
+func checkProvider(ctx context.Context, provider KeyProvider) error {
+	probe := []byte("gophkeeper key provider check")
+
+	ciphertext, err := provider.Encrypt(ctx, probe)
+	if err != nil {
+		return fmt.Errorf("test encryption failed: %w", err)
+	}
+
+	plaintext, err := provider.Decrypt(ctx, ciphertext)
+	if err != nil {
+		return fmt.Errorf("test decryption failed: %w", err)
+	}
+	if string(plaintext) != string(probe) {
+		return fmt.Errorf("test decryption returned different data")
+	}
+
+	return nil
+}
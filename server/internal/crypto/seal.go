@@ -0,0 +1,272 @@
+package crypto
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrSealed is returned by a Seal that has not been unsealed yet
+var ErrSealed = errors.New("server is sealed")
+
+// ErrInvalidShares is returned when the submitted unseal shares do not recover the master key
+// Unseal progress is reset so that the operators can start over
+var ErrInvalidShares = errors.New("unseal shares do not recover the master key")
+
+// sealCheckPlaintext is encrypted with the master key at initialization
+// so that a recovered key can be verified
+const sealCheckPlaintext = "gophkeeper seal check"
+
+// SealStore persists the configuration of Shamir-sealed master keys
+type SealStore interface {
+	// GetSealConfig returns the stored configuration of the key, or nil if it has not been initialized
+	GetSealConfig(ctx context.Context, keyID string) ([]byte, error)
+	// CreateSealConfig stores the configuration of the key unless one already exists
+	// and returns the configuration that is persisted
+	CreateSealConfig(ctx context.Context, keyID string, config []byte) ([]byte, error)
+}
+
+// SealConfig is the persisted configuration of a sealed master key
+// The key itself is never stored; Check is a ciphertext of a known value under the key
+type SealConfig struct {
+	Shares    int    `json:"shares"`
+	Threshold int    `json:"threshold"`
+	Check     []byte `json:"check"`
+}
+
+// SealStatus reports the state of a Seal
+type SealStatus struct {
+	Initialized bool `json:"initialized"`
+	Sealed      bool `json:"sealed"`
+	Shares      int  `json:"shares"`
+	Threshold   int  `json:"threshold"`
+	// Progress is the number of shares submitted since the last reset
+	Progress int `json:"progress"`
+}
+
+// Seal is a KeyProvider whose master key is split into Shamir shares held by operators
+// It starts sealed and rejects every operation with ErrSealed until enough shares
+// are submitted with Unseal
+type Seal struct {
+	mu     sync.Mutex
+	keyID  string
+	store  SealStore
+	shares [][]byte
+	key    *Encryptor
+}
+
+// NewSeal creates a sealed KeyProvider for the key ID whose configuration is kept in store
+func NewSeal(keyID string, store SealStore) (*Seal, error) {
+	if store == nil {
+		return nil, fmt.Errorf("sealed keys require a seal store")
+	}
+	if len(keyID) > maxKeyIDLength {
+		return nil, fmt.Errorf("key ID too long: %d bytes (max %d)", len(keyID), maxKeyIDLength)
+	}
+	return &Seal{keyID: keyID, store: store}, nil
+}
+
+// KeyID returns the ID recorded in ciphertexts produced by the Seal
+func (s *Seal) KeyID() string {
+	return s.keyID
+}
+
+// Encrypt encrypts plaintext with the master key once the Seal is unsealed
+func (s *Seal) Encrypt(_ context.Context, plaintext []byte) ([]byte, error) {
+	key, err := s.unsealedKey()
+	if err != nil {
+		return nil, err
+	}
+	return key.Encrypt(plaintext)
+}
+
+// Decrypt decrypts ciphertext with the master key once the Seal is unsealed
+func (s *Seal) Decrypt(_ context.Context, ciphertext []byte) ([]byte, error) {
+	key, err := s.unsealedKey()
+	if err != nil {
+		return nil, err
+	}
+	return key.Decrypt(ciphertext)
+}
+
+// Sealed reports whether the master key is not available yet
+func (s *Seal) Sealed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.key == nil
+}
+
+// Status returns the current state of the Seal
+func (s *Seal) Status(ctx context.Context) (SealStatus, error) {
+	config, err := s.loadConfig(ctx)
+	if err != nil {
+		return SealStatus{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status(config), nil
+}
+
+// Initialize generates a new master key, splits it into shares of which threshold
+// are needed to unseal, and stores the seal configuration
+// The shares are returned once and never stored; the Seal remains sealed
+func (s *Seal) Initialize(ctx context.Context, shares, threshold int) ([][]byte, error) {
+	existing, err := s.loadConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, fmt.Errorf("seal is already initialized")
+	}
+
+	masterKey, err := GenerateDataKey()
+	if err != nil {
+		return nil, err
+	}
+	defer clear(masterKey)
+
+	keyShares, err := SplitSecret(masterKey, shares, threshold)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := NewEncryptorFromKey(s.keyID, masterKey)
+	if err != nil {
+		return nil, err
+	}
+	check, err := key.Encrypt([]byte(sealCheckPlaintext))
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := json.Marshal(SealConfig{Shares: shares, Threshold: threshold, Check: check})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode seal configuration: %w", err)
+	}
+
+	persisted, err := s.store.CreateSealConfig(ctx, s.keyID, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store seal configuration: %w", err)
+	}
+	if string(persisted) != string(config) {
+		return nil, fmt.Errorf("seal is already initialized")
+	}
+
+	return keyShares, nil
+}
+
+// Unseal submits one share; once threshold distinct shares are submitted the master key
+// is recovered and verified. Submitting shares to an unsealed Seal has no effect
+func (s *Seal) Unseal(ctx context.Context, share []byte) (SealStatus, error) {
+	config, err := s.loadConfig(ctx)
+	if err != nil {
+		return SealStatus{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if config == nil {
+		return s.status(config), fmt.Errorf("seal is not initialized")
+	}
+	if s.key != nil {
+		return s.status(config), nil
+	}
+
+	if len(share) < 2 {
+		return s.status(config), fmt.Errorf("invalid share")
+	}
+	for _, submitted := range s.shares {
+		if string(submitted) == string(share) {
+			return s.status(config), nil
+		}
+	}
+	s.shares = append(s.shares, append([]byte(nil), share...))
+
+	if len(s.shares) < config.Threshold {
+		return s.status(config), nil
+	}
+
+	key, err := s.recoverKey(config)
+	s.resetLocked()
+	if err != nil {
+		return s.status(config), err
+	}
+
+	s.key = key
+	return s.status(config), nil
+}
+
+// ResetUnseal discards the shares submitted so far
+func (s *Seal) ResetUnseal() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.resetLocked()
+}
+
+// recoverKey combines the submitted shares and verifies the result against the check value
+func (s *Seal) recoverKey(config *SealConfig) (*Encryptor, error) {
+	masterKey, err := CombineShares(s.shares)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidShares, err)
+	}
+	defer clear(masterKey)
+
+	key, err := NewEncryptorFromKey(s.keyID, masterKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidShares, err)
+	}
+
+	check, err := key.Decrypt(config.Check)
+	if err != nil || string(check) != sealCheckPlaintext {
+		return nil, ErrInvalidShares
+	}
+
+	return key, nil
+}
+
+func (s *Seal) resetLocked() {
+	for _, share := range s.shares {
+		clear(share)
+	}
+	s.shares = nil
+}
+
+func (s *Seal) status(config *SealConfig) SealStatus {
+	status := SealStatus{Sealed: s.key == nil, Progress: len(s.shares)}
+	if config != nil {
+		status.Initialized = true
+		status.Shares = config.Shares
+		status.Threshold = config.Threshold
+	}
+	return status
+}
+
+func (s *Seal) unsealedKey() (*Encryptor, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.key == nil {
+		return nil, ErrSealed
+	}
+	return s.key, nil
+}
+
+// loadConfig returns the stored seal configuration, or nil if the seal is not initialized
+func (s *Seal) loadConfig(ctx context.Context) (*SealConfig, error) {
+	data, err := s.store.GetSealConfig(ctx, s.keyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load seal configuration: %w", err)
+	}
+	if data == nil {
+		return nil, nil
+	}
+
+	var config SealConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("malformed seal configuration: %w", err)
+	}
+	return &config, nil
+}
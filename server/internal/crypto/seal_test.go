@@ -0,0 +1,124 @@
+package crypto
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+)
+
+// memSealStore is an in-memory SealStore for tests
+type memSealStore map[string][]byte
+
+func (m memSealStore) GetSealConfig(_ context.Context, keyID string) ([]byte, error) {
+	return m[keyID], nil
+}
+
+func (m memSealStore) CreateSealConfig(_ context.Context, keyID string, config []byte) ([]byte, error) {
+	if existing, ok := m[keyID]; ok {
+		return existing, nil
+	}
+	m[keyID] = config
+	return config, nil
+}
+
+// TestShamirSplitCombine tests that any threshold shares recover the secret
+func TestShamirSplitCombine(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+
+	shares, err := SplitSecret(secret, 5, 3)
+	if err != nil {
+		t.Fatalf("Failed to split secret: %v", err)
+	}
+
+	for _, subset := range [][]int{{0, 1, 2}, {4, 2, 0}, {1, 3, 4}, {0, 1, 2, 3, 4}} {
+		var selected [][]byte
+		for _, i := range subset {
+			selected = append(selected, shares[i])
+		}
+		recovered, err := CombineShares(selected)
+		if err != nil {
+			t.Fatalf("Failed to combine shares %v: %v", subset, err)
+		}
+		if !bytes.Equal(recovered, secret) {
+			t.Errorf("Shares %v recovered a different secret", subset)
+		}
+	}
+
+	recovered, _ := CombineShares(shares[:2])
+	if bytes.Equal(recovered, secret) {
+		t.Error("Expected fewer shares than the threshold not to recover the secret")
+	}
+
+	if _, err := CombineShares([][]byte{shares[0], shares[0]}); err == nil {
+		t.Error("Expected error for duplicate shares")
+	}
+	if _, err := SplitSecret(secret, 2, 3); err == nil {
+		t.Error("Expected error for a threshold above the number of shares")
+	}
+}
+
+// TestSealUnseal tests that a Seal rejects operations until enough valid shares are submitted
+func TestSealUnseal(t *testing.T) {
+	ctx := context.Background()
+	store := memSealStore{}
+
+	keyring, err := ParseKeySpecs(ctx, []string{"sealed:shamir"}, KeySources{Seals: store})
+	if err != nil {
+		t.Fatalf("Failed to create keyring: %v", err)
+	}
+	seal := keyring.Seal()
+	if seal == nil {
+		t.Fatal("Expected keyring to have a seal")
+	}
+
+	if _, err := seal.Unseal(ctx, []byte("share")); err == nil {
+		t.Error("Expected error for an uninitialized seal")
+	}
+
+	shares, err := seal.Initialize(ctx, 3, 2)
+	if err != nil {
+		t.Fatalf("Failed to initialize seal: %v", err)
+	}
+	if _, err := seal.Initialize(ctx, 3, 2); err == nil {
+		t.Error("Expected error for a second initialization")
+	}
+
+	dataKey, _ := GenerateDataKey()
+	if _, err := keyring.WrapKey(ctx, dataKey); !errors.Is(err, ErrSealed) {
+		t.Errorf("Expected ErrSealed, got %v", err)
+	}
+
+	// A share from another initialization does not recover the key
+	otherShares, _ := SplitSecret(dataKey, 3, 2)
+	seal.Unseal(ctx, shares[0])
+	if _, err := seal.Unseal(ctx, otherShares[1]); !errors.Is(err, ErrInvalidShares) {
+		t.Errorf("Expected ErrInvalidShares, got %v", err)
+	}
+	if status, _ := seal.Status(ctx); !status.Sealed || status.Progress != 0 {
+		t.Errorf("Expected progress to be reset, got %+v", status)
+	}
+
+	status, err := seal.Unseal(ctx, shares[2])
+	if err != nil || !status.Sealed || status.Progress != 1 {
+		t.Errorf("Expected progress 1, got %+v, %v", status, err)
+	}
+	status, err = seal.Unseal(ctx, shares[0])
+	if err != nil || status.Sealed {
+		t.Fatalf("Expected seal to be unsealed, got %+v, %v", status, err)
+	}
+
+	wrapped, err := keyring.WrapKey(ctx, dataKey)
+	if err != nil {
+		t.Fatalf("Failed to wrap data key: %v", err)
+	}
+
+	// A restarted server recovers the same key from the same shares
+	restarted, _ := NewSeal("sealed", store)
+	restarted.Unseal(ctx, shares[1])
+	restarted.Unseal(ctx, shares[2])
+	unwrapped, err := restarted.Decrypt(ctx, wrapped)
+	if err != nil || !bytes.Equal(unwrapped, dataKey) {
+		t.Errorf("Expected restarted seal to unwrap the data key, got %v", err)
+	}
+}
@@ -0,0 +1,123 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+)
+
+// Shamir's secret sharing over GF(2^8) with the AES polynomial x^8 + x^4 + x^3 + x + 1
+// Each share holds one polynomial value per secret byte followed by its x coordinate
+
+// maxShares is the number of distinct non-zero x coordinates in GF(2^8)
+const maxShares = 255
+
+// SplitSecret splits secret into parts shares, any threshold of which recover it
+func SplitSecret(secret []byte, parts, threshold int) ([][]byte, error) {
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("secret cannot be empty")
+	}
+	if threshold < 2 || threshold > parts || parts > maxShares {
+		return nil, fmt.Errorf("invalid shares/threshold %d/%d: need 2 <= threshold <= shares <= %d",
+			parts, threshold, maxShares)
+	}
+
+	shares := make([][]byte, parts)
+	for i := range shares {
+		shares[i] = make([]byte, len(secret)+1)
+		shares[i][len(secret)] = byte(i + 1)
+	}
+
+	// Random coefficients of degree 1..threshold-1; the constant term is the secret byte
+	coefficients := make([]byte, threshold-1)
+	defer clear(coefficients)
+
+	for b, s := range secret {
+		if _, err := io.ReadFull(rand.Reader, coefficients); err != nil {
+			return nil, fmt.Errorf("failed to generate polynomial: %w", err)
+		}
+
+		for _, share := range shares {
+			x := share[len(secret)]
+			// Horner's method
+			var y byte
+			for c := len(coefficients) - 1; c >= 0; c-- {
+				y = gfMul(y, x) ^ coefficients[c]
+			}
+			share[b] = gfMul(y, x) ^ s
+		}
+	}
+
+	return shares, nil
+}
+
+// CombineShares recovers a secret from shares produced by SplitSecret
+// Fewer shares than the threshold yield a wrong secret rather than an error,
+// so callers must verify the result
+func CombineShares(shares [][]byte) ([]byte, error) {
+	if len(shares) < 2 {
+		return nil, fmt.Errorf("at least 2 shares are required")
+	}
+
+	size := len(shares[0])
+	if size < 2 {
+		return nil, fmt.Errorf("share is too short")
+	}
+
+	seen := make(map[byte]struct{}, len(shares))
+	for _, share := range shares {
+		if len(share) != size {
+			return nil, fmt.Errorf("shares have different lengths")
+		}
+		x := share[size-1]
+		if x == 0 {
+			return nil, fmt.Errorf("invalid share")
+		}
+		if _, dup := seen[x]; dup {
+			return nil, fmt.Errorf("duplicate share")
+		}
+		seen[x] = struct{}{}
+	}
+
+	// Lagrange interpolation at x = 0
+	secret := make([]byte, size-1)
+	for i, share := range shares {
+		xi := share[size-1]
+
+		basis := byte(1)
+		for j, other := range shares {
+			if i == j {
+				continue
+			}
+			xj := other[size-1]
+			basis = gfMul(basis, gfMul(xj, gfInverse(xj^xi)))
+		}
+
+		for b := range secret {
+			secret[b] ^= gfMul(share[b], basis)
+		}
+	}
+
+	return secret, nil
+}
+
+// gfMul multiplies in GF(2^8) without data-dependent branches
+func gfMul(a, b byte) byte {
+	var p byte
+	for range 8 {
+		p ^= a & -(b & 1)
+		a = a<<1 ^ (0x1b & -(a >> 7))
+		b >>= 1
+	}
+	return p
+}
+
+// gfInverse returns the multiplicative inverse as a^254
+func gfInverse(a byte) byte {
+	result := a
+	for range 6 {
+		a = gfMul(a, a)
+		result = gfMul(result, a)
+	}
+	return gfMul(result, result)
+}
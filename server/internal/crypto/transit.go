@@ -0,0 +1,172 @@
+package crypto
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// transitTimeout bounds a single request to the transit service
+const transitTimeout = 10 * time.Second
+
+// maxTransitResponseSize bounds the size of a transit service response
+const maxTransitResponseSize = 1 << 20
+
+// TransitClient talks to a transit-style key management service over HTTP
+// The protocol is compatible with the HashiCorp Vault transit secrets engine:
+//
+//	POST <address>/encrypt/<key> {"plaintext": "<base64>"}   -> {"data": {"ciphertext": "..."}}
+//	POST <address>/decrypt/<key> {"ciphertext": "..."}       -> {"data": {"plaintext": "<base64>"}}
+//
+// where address includes the mount path, e.g. https://vault:8200/v1/transit
+type TransitClient struct {
+	address    string
+	token      string
+	httpClient *http.Client
+}
+
+// NewTransitClient creates a new TransitClient
+// token is sent in the X-Vault-Token header; httpClient may be nil
+func NewTransitClient(address, token string, httpClient *http.Client) (*TransitClient, error) {
+	u, err := url.Parse(address)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid transit address %q", address)
+	}
+
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: transitTimeout}
+	}
+
+	return &TransitClient{
+		address:    strings.TrimSuffix(address, "/"),
+		token:      token,
+		httpClient: httpClient,
+	}, nil
+}
+
+// Key returns a KeyProvider for the named transit key
+// keyID is recorded in ciphertexts and identifies the key in the keyring
+func (c *TransitClient) Key(keyID, keyName string) (*TransitKeyProvider, error) {
+	if keyName == "" || strings.ContainsAny(keyName, "/?#") {
+		return nil, fmt.Errorf("invalid transit key name %q", keyName)
+	}
+	if len(keyID) > maxKeyIDLength {
+		return nil, fmt.Errorf("key ID too long: %d bytes (max %d)", len(keyID), maxKeyIDLength)
+	}
+
+	return &TransitKeyProvider{client: c, keyID: keyID, keyName: keyName}, nil
+}
+
+// TransitKeyProvider is a KeyProvider backed by a key held in a transit service
+// The master key never leaves the service
+type TransitKeyProvider struct {
+	client  *TransitClient
+	keyID   string
+	keyName string
+}
+
+type transitRequest struct {
+	Plaintext  string `json:"plaintext,omitempty"`
+	Ciphertext string `json:"ciphertext,omitempty"`
+}
+
+type transitResponse struct {
+	Data struct {
+		Plaintext  string `json:"plaintext"`
+		Ciphertext string `json:"ciphertext"`
+	} `json:"data"`
+	Errors []string `json:"errors"`
+}
+
+// KeyID returns the ID recorded in ciphertexts produced by the provider
+func (p *TransitKeyProvider) KeyID() string {
+	return p.keyID
+}
+
+// Encrypt encrypts plaintext with the transit key
+// The service's ciphertext is stored after a header with AlgorithmTransit
+func (p *TransitKeyProvider) Encrypt(ctx context.Context, plaintext []byte) ([]byte, error) {
+	if len(plaintext) == 0 {
+		return nil, fmt.Errorf("plaintext cannot be empty")
+	}
+
+	resp, err := p.client.do(ctx, "encrypt", p.keyName, transitRequest{
+		Plaintext: base64.StdEncoding.EncodeToString(plaintext),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Data.Ciphertext == "" {
+		return nil, fmt.Errorf("transit service returned no ciphertext")
+	}
+
+	header := Header{Version: FormatVersion, Algorithm: AlgorithmTransit, KeyID: p.keyID}.marshal()
+	return append(header, resp.Data.Ciphertext...), nil
+}
+
+// Decrypt decrypts a ciphertext produced by Encrypt
+func (p *TransitKeyProvider) Decrypt(ctx context.Context, ciphertext []byte) ([]byte, error) {
+	header, body, ok := ParseHeader(ciphertext)
+	if !ok || header.Algorithm != AlgorithmTransit {
+		return nil, fmt.Errorf("ciphertext was not produced by a transit key")
+	}
+	if header.KeyID != p.keyID {
+		return nil, fmt.Errorf("ciphertext was encrypted with key %q, not %q", header.KeyID, p.keyID)
+	}
+
+	resp, err := p.client.do(ctx, "decrypt", p.keyName, transitRequest{Ciphertext: string(body)})
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := base64.StdEncoding.DecodeString(resp.Data.Plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("transit service returned malformed plaintext: %w", err)
+	}
+	return plaintext, nil
+}
+
+// do sends a transit operation for the named key and decodes the response
+func (c *TransitClient) do(ctx context.Context, operation, keyName string, body transitRequest) (*transitResponse, error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode transit request: %w", err)
+	}
+
+	endpoint := c.address + "/" + operation + "/" + url.PathEscape(keyName)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create transit request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.token != "" {
+		req.Header.Set("X-Vault-Token", c.token)
+	}
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("transit %s failed: %w", operation, err)
+	}
+	defer res.Body.Close()
+
+	var resp transitResponse
+	if err := json.NewDecoder(io.LimitReader(res.Body, maxTransitResponseSize)).Decode(&resp); err != nil && res.StatusCode == http.StatusOK {
+		return nil, fmt.Errorf("failed to decode transit response: %w", err)
+	}
+
+	if res.StatusCode != http.StatusOK {
+		if len(resp.Errors) > 0 {
+			return nil, fmt.Errorf("transit %s failed: %s: %s", operation, res.Status, strings.Join(resp.Errors, "; "))
+		}
+		return nil, fmt.Errorf("transit %s failed: %s", operation, res.Status)
+	}
+
+	return &resp, nil
+}
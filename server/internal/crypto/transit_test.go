@@ -0,0 +1,152 @@
+package crypto
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testTransitToken = "test-token"
+
+// newTransitStandIn starts a local stand-in for a transit key management service
+// that holds a single key named "gophkeeper"
+func newTransitStandIn(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	key, err := NewEncryptorFromKey("transit", []byte("0123456789abcdef0123456789abcdef"))
+	if err != nil {
+		t.Fatalf("Failed to create encryptor: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	handle := func(operation string, fn func(req transitRequest) (any, error)) {
+		mux.HandleFunc("POST /v1/transit/"+operation+"/gophkeeper", func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("X-Vault-Token") != testTransitToken {
+				w.WriteHeader(http.StatusForbidden)
+				json.NewEncoder(w).Encode(map[string]any{"errors": []string{"permission denied"}})
+				return
+			}
+
+			var req transitRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			data, err := fn(req)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]any{"errors": []string{err.Error()}})
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]any{"data": data})
+		})
+	}
+
+	handle("encrypt", func(req transitRequest) (any, error) {
+		plaintext, err := base64.StdEncoding.DecodeString(req.Plaintext)
+		if err != nil {
+			return nil, err
+		}
+		ciphertext, err := key.Encrypt(plaintext)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]string{"ciphertext": "vault:v1:" + base64.StdEncoding.EncodeToString(ciphertext)}, nil
+	})
+	handle("decrypt", func(req transitRequest) (any, error) {
+		ciphertext, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(req.Ciphertext, "vault:v1:"))
+		if err != nil {
+			return nil, err
+		}
+		plaintext, err := key.Decrypt(ciphertext)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]string{"plaintext": base64.StdEncoding.EncodeToString(plaintext)}, nil
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// TestTransitKeyProvider tests wrapping data keys with a key held by a transit service
+func TestTransitKeyProvider(t *testing.T) {
+	ctx := context.Background()
+	server := newTransitStandIn(t)
+
+	client, err := NewTransitClient(server.URL+"/v1/transit", testTransitToken, server.Client())
+	if err != nil {
+		t.Fatalf("Failed to create transit client: %v", err)
+	}
+
+	keyring, err := ParseKeySpecs(ctx, []string{
+		"old:hex:" + oldKeyHex,
+		"kms:transit:gophkeeper",
+	}, KeySources{Transit: client})
+	if err != nil {
+		t.Fatalf("Failed to create keyring: %v", err)
+	}
+	if keyring.Primary().KeyID() != "kms" {
+		t.Errorf("Expected transit key to be primary, got %s", keyring.Primary().KeyID())
+	}
+
+	dataKey, _ := GenerateDataKey()
+	wrapped, err := keyring.WrapKey(ctx, dataKey)
+	if err != nil {
+		t.Fatalf("Failed to wrap data key: %v", err)
+	}
+
+	header, _, ok := ParseHeader(wrapped)
+	if !ok || header.Algorithm != AlgorithmTransit || header.KeyID != "kms" {
+		t.Errorf("Unexpected header: %+v", header)
+	}
+	if keyring.NeedsRotation(wrapped) {
+		t.Error("Expected key wrapped by the primary key not to need rotation")
+	}
+
+	unwrapped, err := keyring.UnwrapKey(ctx, wrapped)
+	if err != nil {
+		t.Fatalf("Failed to unwrap data key: %v", err)
+	}
+	if string(unwrapped) != string(dataKey) {
+		t.Error("Expected unwrapped key to match the original")
+	}
+
+	// Keys wrapped by a local key before moving to the service still unwrap
+	oldKey, _ := ParseKey(ctx, "old", "hex:"+oldKeyHex, nil)
+	oldWrapped, _ := oldKey.Encrypt(dataKey)
+	if _, err := keyring.UnwrapKey(ctx, oldWrapped); err != nil {
+		t.Errorf("Failed to unwrap key wrapped by the old key: %v", err)
+	}
+}
+
+// TestTransitKeyProviderErrors tests that service errors are reported at startup
+func TestTransitKeyProviderErrors(t *testing.T) {
+	ctx := context.Background()
+	server := newTransitStandIn(t)
+
+	unauthorized, _ := NewTransitClient(server.URL+"/v1/transit", "wrong-token", server.Client())
+	if _, err := ParseKeySpecs(ctx, []string{"kms:transit:gophkeeper"}, KeySources{Transit: unauthorized}); err == nil ||
+		!strings.Contains(err.Error(), "permission denied") {
+		t.Errorf("Expected permission error, got %v", err)
+	}
+
+	client, _ := NewTransitClient(server.URL+"/v1/transit", testTransitToken, server.Client())
+	if _, err := ParseKeySpecs(ctx, []string{"kms:transit:missing"}, KeySources{Transit: client}); err == nil {
+		t.Error("Expected error for an unknown transit key")
+	}
+
+	if _, err := ParseKeySpecs(ctx, []string{"kms:transit:gophkeeper"}, KeySources{}); err == nil {
+		t.Error("Expected error without a transit service")
+	}
+
+	if _, err := NewTransitClient("vault:8200", "", nil); err == nil {
+		t.Error("Expected error for an address without a scheme")
+	}
+}
@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// APIToken is a long-lived token for automation that acts on the secrets of its owner
+// within a scope. Only the hash of the token is stored.
+type APIToken struct {
+	ID     string `json:"id"`
+	UserID int    `json:"-"`
+	Name   string `json:"name"`
+	// ServiceAccount names the non-human identity the token is issued to; it is empty for personal tokens
+	ServiceAccount string     `json:"service_account,omitempty"`
+	TokenHash      []byte     `json:"-"`
+	Scope          TokenScope `json:"scope"`
+	CreatedAt      time.Time  `json:"created_at"`
+	// ExpiresAt is nil for tokens that do not expire
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// TokenScope limits what an API token may do with the secrets of its owner.
+type TokenScope struct {
+	ReadOnly bool `json:"read_only"`
+	// SecretIDs and Keywords restrict the token to the listed secrets and to secrets whose
+	// metadata contains one of the keywords. If both are empty, every secret is allowed.
+	SecretIDs []int    `json:"secret_ids,omitempty"`
+	Keywords  []string `json:"keywords,omitempty"`
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// UserIdentity links a user to an account at an external identity provider.
+type UserIdentity struct {
+	Issuer    string
+	Subject   string
+	UserID    int
+	CreatedAt time.Time
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// Invite allows one registration while registration is invite-only. Only the hash of
+// the invite code is stored.
+type Invite struct {
+	ID       string `json:"id"`
+	CodeHash []byte `json:"-"`
+	// CreatedBy is the user who issued the invite; it is nil for invites issued by an operator
+	CreatedBy *int      `json:"created_by,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	// UsedBy is the login registered with the invite
+	UsedBy string     `json:"used_by,omitempty"`
+	UsedAt *time.Time `json:"used_at,omitempty"`
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// LoginAttempts tracks recent failed logins for an account or a client IP address.
+type LoginAttempts struct {
+	// Key identifies what is throttled, e.g. "login:alice" or "ip:192.0.2.1"
+	Key         string
+	Failures    int
+	LastFailure time.Time
+	// LockedUntil is the time before which logins are rejected without checking the password
+	LockedUntil time.Time
+}
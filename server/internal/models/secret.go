@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 type SecretType int
 
 const (
@@ -9,6 +11,16 @@ const (
 	BankCardType
 )
 
+// ParseSecretType returns the type with the given name, as returned by String.
+func ParseSecretType(name string) (SecretType, bool) {
+	for _, st := range []SecretType{LoginPasswordType, TextDataType, BinaryDataType, BankCardType} {
+		if st.String() == name {
+			return st, true
+		}
+	}
+	return 0, false
+}
+
 func (st SecretType) String() string {
 	switch st {
 	case LoginPasswordType:
@@ -30,4 +42,17 @@ type Secret struct {
 	Type     SecretType `json:"type"`
 	Data     []byte     `json:"data"`
 	Metadata string     `json:"metadata"`
+	// CreatedAt, UpdatedAt and Revision are maintained by the store and exposed by API v2.
+	// Revision is 1 for a new secret and grows with every update.
+	CreatedAt time.Time `json:"-"`
+	UpdatedAt time.Time `json:"-"`
+	Revision  int       `json:"-"`
+}
+
+// SecretQuery filters secrets. Empty fields match any secret.
+type SecretQuery struct {
+	// Metadata matches secrets whose metadata is exactly equal to it
+	Metadata string
+	// Keyword matches secrets whose metadata contains it as a word (case-insensitive)
+	Keyword string
 }
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// Session is a login of a user on a device.
+// Its ID is shared by the refresh tokens rotated from the login.
+type Session struct {
+	ID            string    `json:"id"`
+	UserID        int       `json:"-"`
+	DeviceName    string    `json:"device_name"`
+	ClientVersion string    `json:"client_version"`
+	IP            string    `json:"ip"`
+	CreatedAt     time.Time `json:"created_at"`
+	LastSeenAt    time.Time `json:"last_seen_at"`
+	// Current is set in responses for the session of the request
+	Current bool `json:"current"`
+}
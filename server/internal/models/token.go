@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// RefreshToken is the server-side record of an opaque refresh token.
+// Only a hash of the token is stored.
+type RefreshToken struct {
+	TokenHash []byte
+	// FamilyID is shared by all tokens rotated from the same login
+	FamilyID  string
+	UserID    int
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	// Used is set once the token has been exchanged for a new one
+	Used bool
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// TOTP is the two-factor authentication enrollment of a user.
+type TOTP struct {
+	UserID int
+	// Secret is the shared TOTP key; EncryptedStore encrypts it at rest
+	Secret []byte
+	// Enabled is false until the enrollment is confirmed with a valid code
+	Enabled bool
+	// LastUsedStep is the time step of the last accepted code, so that a code
+	// cannot be replayed within its validity window
+	LastUsedStep int64
+	// RecoveryCodes holds the hashes of unused recovery codes
+	RecoveryCodes [][]byte
+	CreatedAt     time.Time
+}
@@ -4,4 +4,6 @@ type User struct {
 	ID       int    `json:"id"`
 	Login    string `json:"login"`
 	Password string `json:"password"`
+	// Roles are granted by the directory of externally authenticated users.
+	Roles []string `json:"roles,omitempty"`
 }
@@ -0,0 +1,115 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"gophkeeper/server/internal/apierror"
+	"io"
+	"net/http"
+)
+
+// maxBodySize limits the request bodies the validator reads into memory. It is well above
+// the size of secrets the CLI stores.
+const maxBodySize = 32 << 20
+
+// maxPublicBodySize limits the bodies of operations without authentication, such as logins,
+// which are small.
+const maxPublicBodySize = 64 << 10
+
+// ValidateRequests rejects requests to documented operations whose parameters or JSON body
+// do not match the document with 400 invalid_request. Undocumented paths pass through.
+// Operations that require authentication must be validated after it, so that only users
+// can make the server read bodies of up to maxBodySize.
+func (d *Document) ValidateRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		op, pathParams := d.FindOperation(r.Method, r.URL.Path)
+		if op == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if err := op.validateParameters(pathParams, r); err != nil {
+			writeInvalid(w, "Invalid request parameter", err)
+			return
+		}
+
+		if schema := op.BodySchema(); schema != nil {
+			limit := int64(maxBodySize)
+			if len(op.Security) == 0 {
+				limit = maxPublicBodySize
+			}
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, limit))
+			if err != nil {
+				var tooLarge *http.MaxBytesError
+				if errors.As(err, &tooLarge) {
+					apierror.WriteCode(w, "Request body too large", http.StatusRequestEntityTooLarge, apierror.CodeInvalidRequest, nil)
+					return
+				}
+				apierror.Write(w, "Failed to read request body", http.StatusBadRequest)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			var value any
+			if len(bytes.TrimSpace(body)) > 0 {
+				if err := json.Unmarshal(body, &value); err != nil {
+					apierror.Write(w, "Invalid request body", http.StatusBadRequest)
+					return
+				}
+			}
+			// A null body is decoded like a missing one
+			if value == nil {
+				if op.RequestBody.Required {
+					apierror.Write(w, "Request body is required", http.StatusBadRequest)
+					return
+				}
+			} else if err := schema.Validate(value); err != nil {
+				writeInvalid(w, "Invalid request body", err)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (o *Operation) validateParameters(pathParams map[string]string, r *http.Request) error {
+	query := r.URL.Query()
+	for _, param := range o.Parameters {
+		var text string
+		var present bool
+		switch param.In {
+		case "path":
+			text, present = pathParams[param.Name]
+		case "query":
+			present = query.Has(param.Name)
+			text = query.Get(param.Name)
+		default:
+			continue
+		}
+		if !present {
+			if param.Required {
+				return &ValidationError{Field: param.Name, Reason: "is required"}
+			}
+			continue
+		}
+		if err := param.Schema.ValidateParameter(text); err != nil {
+			var validationErr *ValidationError
+			if errors.As(err, &validationErr) {
+				validationErr.Field = param.Name
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func writeInvalid(w http.ResponseWriter, message string, err error) {
+	var details map[string]any
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) && validationErr.Field != "" {
+		details = map[string]any{"field": validationErr.Field}
+	}
+	apierror.WriteCode(w, message+": "+err.Error(), http.StatusBadRequest, apierror.CodeInvalidRequest, details)
+}
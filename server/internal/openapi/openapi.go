@@ -0,0 +1,176 @@
+// Package openapi serves the OpenAPI 3 document of the REST API and validates requests against it.
+package openapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+//go:embed openapi.json
+var document []byte
+
+// Document is the part of an OpenAPI 3 document used for validation.
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components struct {
+		Schemas map[string]*Schema `json:"schemas"`
+	} `json:"components"`
+}
+
+// PathItem maps lower-case HTTP methods to the operations of a path.
+type PathItem map[string]*Operation
+
+// Operation is an operation of a path.
+type Operation struct {
+	OperationID string              `json:"operationId"`
+	Parameters  []Parameter         `json:"parameters"`
+	RequestBody *RequestBody        `json:"requestBody"`
+	Responses   map[string]Response `json:"responses"`
+	// Security lists the credentials the operation accepts; it is empty for public operations
+	Security []map[string][]string `json:"security"`
+}
+
+// Parameter is a path or query parameter of an operation.
+type Parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *Schema `json:"schema"`
+}
+
+// RequestBody is the JSON body of an operation.
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+// Response is a response of an operation. Responses without content have no body.
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content"`
+}
+
+// MediaType holds the schema of a body.
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Load parses the embedded document and resolves its schema references.
+func Load() (*Document, error) {
+	var doc Document
+	if err := json.Unmarshal(document, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse OpenAPI document: %w", err)
+	}
+
+	resolve := func(schema *Schema) error { return schema.resolve(doc.Components.Schemas, 0) }
+	for _, schema := range doc.Components.Schemas {
+		if err := resolve(schema); err != nil {
+			return nil, err
+		}
+	}
+	for path, item := range doc.Paths {
+		for method, op := range item {
+			for _, param := range op.Parameters {
+				if err := resolve(param.Schema); err != nil {
+					return nil, fmt.Errorf("%s %s: %w", method, path, err)
+				}
+			}
+			if body := op.RequestBody.schema(); body != nil {
+				if err := resolve(body); err != nil {
+					return nil, fmt.Errorf("%s %s: %w", method, path, err)
+				}
+			}
+			for status, resp := range op.Responses {
+				if err := resolve(resp.schema()); err != nil {
+					return nil, fmt.Errorf("%s %s %s: %w", method, path, status, err)
+				}
+			}
+		}
+	}
+	return &doc, nil
+}
+
+// MustLoad is Load that panics if the embedded document is invalid, which is a bug of the build.
+func MustLoad() *Document {
+	doc, err := Load()
+	if err != nil {
+		panic(err)
+	}
+	return doc
+}
+
+// Handler serves the OpenAPI document.
+func Handler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(document)
+}
+
+// FindOperation returns the operation for a request path and its path parameters. A path
+// that is not documented returns nil.
+func (d *Document) FindOperation(method, path string) (*Operation, map[string]string) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	var found *Operation
+	var foundParams map[string]string
+	for template, item := range d.Paths {
+		params, ok := matchPath(strings.Split(strings.Trim(template, "/"), "/"), segments)
+		if !ok {
+			continue
+		}
+		// Static segments take precedence over parameters
+		if op := item[strings.ToLower(method)]; op != nil && (found == nil || len(params) < len(foundParams)) {
+			found, foundParams = op, params
+		}
+	}
+	return found, foundParams
+}
+
+// matchPath matches path segments against the segments of a path template.
+func matchPath(template, segments []string) (map[string]string, bool) {
+	if len(template) != len(segments) {
+		return nil, false
+	}
+	params := make(map[string]string)
+	for i, part := range template {
+		if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+			if segments[i] == "" {
+				return nil, false
+			}
+			params[part[1:len(part)-1]] = segments[i]
+			continue
+		}
+		if part != segments[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// BodySchema returns the schema of the JSON request body, or nil if the operation has none.
+func (o *Operation) BodySchema() *Schema {
+	return o.RequestBody.schema()
+}
+
+// ResponseSchema returns the schema of the response with the given status, falling back to
+// the default response. It reports false if the status is not documented.
+func (o *Operation) ResponseSchema(status int) (*Schema, bool) {
+	resp, ok := o.Responses[fmt.Sprint(status)]
+	if !ok {
+		resp, ok = o.Responses["default"]
+	}
+	return resp.schema(), ok
+}
+
+func (b *RequestBody) schema() *Schema {
+	if b == nil {
+		return nil
+	}
+	return b.Content["application/json"].Schema
+}
+
+func (r Response) schema() *Schema {
+	return r.Content["application/json"].Schema
+}
@@ -0,0 +1,225 @@
+package openapi
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxRefDepth limits nested schema references.
+const maxRefDepth = 32
+
+// Schema is the subset of JSON Schema the document uses.
+type Schema struct {
+	Ref        string             `json:"$ref,omitempty"`
+	Type       string             `json:"type,omitempty"`
+	Format     string             `json:"format,omitempty"`
+	Properties map[string]*Schema `json:"properties,omitempty"`
+	Required   []string           `json:"required,omitempty"`
+	Items      *Schema            `json:"items,omitempty"`
+	Enum       []any              `json:"enum,omitempty"`
+	OneOf      []*Schema          `json:"oneOf,omitempty"`
+	Minimum    *float64           `json:"minimum,omitempty"`
+	Maximum    *float64           `json:"maximum,omitempty"`
+	MinLength  int                `json:"minLength,omitempty"`
+	Nullable   bool               `json:"nullable,omitempty"`
+	// AdditionalProperties false rejects undocumented properties of an object
+	AdditionalProperties *bool `json:"additionalProperties,omitempty"`
+	// ReadOnly properties are set by the server and ignored in requests
+	ReadOnly bool `json:"readOnly,omitempty"`
+
+	// resolved is the component schema a reference points to
+	resolved *Schema
+}
+
+// ValidationError describes the first part of a value that does not match its schema.
+type ValidationError struct {
+	// Field is the path to the value, e.g. "params.m"; empty for the value itself
+	Field  string
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	if e.Field == "" {
+		return e.Reason
+	}
+	return e.Field + ": " + e.Reason
+}
+
+func (s *Schema) resolve(components map[string]*Schema, depth int) error {
+	if s == nil {
+		return nil
+	}
+	if depth > maxRefDepth {
+		return fmt.Errorf("schema references are nested too deeply")
+	}
+	if s.Ref != "" {
+		target := components[strings.TrimPrefix(s.Ref, "#/components/schemas/")]
+		if target == nil || !strings.HasPrefix(s.Ref, "#/components/schemas/") {
+			return fmt.Errorf("unknown schema reference %s", s.Ref)
+		}
+		s.resolved = target
+		return nil
+	}
+	for _, property := range s.Properties {
+		if err := property.resolve(components, depth+1); err != nil {
+			return err
+		}
+	}
+	for _, option := range s.OneOf {
+		if err := option.resolve(components, depth+1); err != nil {
+			return err
+		}
+	}
+	return s.Items.resolve(components, depth+1)
+}
+
+// Validate checks a decoded JSON value against the schema. Undocumented object properties
+// are allowed unless the schema sets additionalProperties to false.
+func (s *Schema) Validate(value any) error {
+	return s.validate(value, "", false)
+}
+
+// ValidateStrict is Validate that also rejects undocumented object properties, so that
+// tests notice fields missing from the document. Objects that set additionalProperties to
+// true, like the details of errors, may still have undocumented properties.
+func (s *Schema) ValidateStrict(value any) error {
+	return s.validate(value, "", true)
+}
+
+func (s *Schema) validate(value any, field string, strict bool) error {
+	if s == nil {
+		return nil
+	}
+	if s.resolved != nil {
+		return s.resolved.validate(value, field, strict)
+	}
+	fail := func(format string, args ...any) error {
+		return &ValidationError{Field: field, Reason: fmt.Sprintf(format, args...)}
+	}
+
+	if value == nil {
+		if s.Nullable || s.Type == "" {
+			return nil
+		}
+		return fail("must not be null")
+	}
+
+	if len(s.OneOf) > 0 {
+		for _, option := range s.OneOf {
+			if option.validate(value, field, strict) == nil {
+				return nil
+			}
+		}
+		return fail("does not match any of the allowed schemas")
+	}
+
+	if len(s.Enum) > 0 && !slices.ContainsFunc(s.Enum, func(allowed any) bool { return allowed == value }) {
+		return fail("must be one of %v", s.Enum)
+	}
+
+	switch s.Type {
+	case "object":
+		object, ok := value.(map[string]any)
+		if !ok {
+			return fail("must be an object")
+		}
+		for _, name := range s.Required {
+			if _, ok := object[name]; !ok {
+				return &ValidationError{Field: join(field, name), Reason: "is required"}
+			}
+		}
+		for name, property := range object {
+			schema, documented := s.Properties[name]
+			if !documented {
+				if s.AdditionalProperties == nil && strict || s.AdditionalProperties != nil && !*s.AdditionalProperties {
+					return &ValidationError{Field: join(field, name), Reason: "is not a known property"}
+				}
+				continue
+			}
+			if err := schema.validate(property, join(field, name), strict); err != nil {
+				return err
+			}
+		}
+	case "array":
+		array, ok := value.([]any)
+		if !ok {
+			return fail("must be an array")
+		}
+		for i, item := range array {
+			if err := s.Items.validate(item, fmt.Sprintf("%s[%d]", field, i), strict); err != nil {
+				return err
+			}
+		}
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return fail("must be a string")
+		}
+		if len(str) < s.MinLength {
+			return fail("must be at least %d characters long", s.MinLength)
+		}
+		switch s.Format {
+		case "byte":
+			if _, err := base64.StdEncoding.DecodeString(str); err != nil {
+				return fail("must be base64-encoded")
+			}
+		case "date-time":
+			if _, err := time.Parse(time.RFC3339Nano, str); err != nil {
+				return fail("must be an RFC 3339 date-time")
+			}
+		}
+	case "integer", "number":
+		number, ok := value.(float64)
+		if !ok {
+			return fail("must be a number")
+		}
+		if s.Type == "integer" && number != math.Trunc(number) {
+			return fail("must be an integer")
+		}
+		if s.Minimum != nil && number < *s.Minimum {
+			return fail("must be at least %v", *s.Minimum)
+		}
+		if s.Maximum != nil && number > *s.Maximum {
+			return fail("must be at most %v", *s.Maximum)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fail("must be a boolean")
+		}
+	}
+	return nil
+}
+
+// ValidateParameter checks the text of a path or query parameter.
+func (s *Schema) ValidateParameter(text string) error {
+	if s.resolved != nil {
+		return s.resolved.ValidateParameter(text)
+	}
+	switch s.Type {
+	case "integer", "number":
+		number, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return &ValidationError{Reason: "must be a number"}
+		}
+		return s.Validate(number)
+	case "boolean":
+		value, err := strconv.ParseBool(text)
+		if err != nil {
+			return &ValidationError{Reason: "must be a boolean"}
+		}
+		return s.Validate(value)
+	}
+	return s.Validate(text)
+}
+
+func join(field, name string) string {
+	if field == "" {
+		return name
+	}
+	return field + "." + name
+}
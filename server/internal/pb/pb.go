@@ -0,0 +1,4 @@
+// Package pb contains the gRPC services and messages generated from proto/gophkeeper/v1.
+package pb
+
+//go:generate protoc -I ../../proto --go_out=. --go_opt=module=gophkeeper/server/internal/pb --go-grpc_out=. --go-grpc_opt=module=gophkeeper/server/internal/pb gophkeeper/v1/users.proto gophkeeper/v1/secrets.proto gophkeeper/v1/sync.proto
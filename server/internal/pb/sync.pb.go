@@ -0,0 +1,247 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.10
+// 	protoc        v6.31.1
+// source: gophkeeper/v1/sync.proto
+
+package pb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type SecretChange_Kind int32
+
+const (
+	SecretChange_KIND_UNSPECIFIED SecretChange_Kind = 0
+	SecretChange_KIND_CREATED     SecretChange_Kind = 1
+	SecretChange_KIND_UPDATED     SecretChange_Kind = 2
+	SecretChange_KIND_DELETED     SecretChange_Kind = 3
+)
+
+// Enum value maps for SecretChange_Kind.
+var (
+	SecretChange_Kind_name = map[int32]string{
+		0: "KIND_UNSPECIFIED",
+		1: "KIND_CREATED",
+		2: "KIND_UPDATED",
+		3: "KIND_DELETED",
+	}
+	SecretChange_Kind_value = map[string]int32{
+		"KIND_UNSPECIFIED": 0,
+		"KIND_CREATED":     1,
+		"KIND_UPDATED":     2,
+		"KIND_DELETED":     3,
+	}
+)
+
+func (x SecretChange_Kind) Enum() *SecretChange_Kind {
+	p := new(SecretChange_Kind)
+	*p = x
+	return p
+}
+
+func (x SecretChange_Kind) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (SecretChange_Kind) Descriptor() protoreflect.EnumDescriptor {
+	return file_gophkeeper_v1_sync_proto_enumTypes[0].Descriptor()
+}
+
+func (SecretChange_Kind) Type() protoreflect.EnumType {
+	return &file_gophkeeper_v1_sync_proto_enumTypes[0]
+}
+
+func (x SecretChange_Kind) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use SecretChange_Kind.Descriptor instead.
+func (SecretChange_Kind) EnumDescriptor() ([]byte, []int) {
+	return file_gophkeeper_v1_sync_proto_rawDescGZIP(), []int{1, 0}
+}
+
+type WatchRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchRequest) Reset() {
+	*x = WatchRequest{}
+	mi := &file_gophkeeper_v1_sync_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchRequest) ProtoMessage() {}
+
+func (x *WatchRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_gophkeeper_v1_sync_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchRequest.ProtoReflect.Descriptor instead.
+func (*WatchRequest) Descriptor() ([]byte, []int) {
+	return file_gophkeeper_v1_sync_proto_rawDescGZIP(), []int{0}
+}
+
+type SecretChange struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Kind     SecretChange_Kind      `protobuf:"varint,1,opt,name=kind,proto3,enum=gophkeeper.v1.SecretChange_Kind" json:"kind,omitempty"`
+	SecretId int64                  `protobuf:"varint,2,opt,name=secret_id,json=secretId,proto3" json:"secret_id,omitempty"`
+	// secret is the new state of the secret; it is empty for deletions.
+	Secret        *Secret `protobuf:"bytes,3,opt,name=secret,proto3" json:"secret,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SecretChange) Reset() {
+	*x = SecretChange{}
+	mi := &file_gophkeeper_v1_sync_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SecretChange) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SecretChange) ProtoMessage() {}
+
+func (x *SecretChange) ProtoReflect() protoreflect.Message {
+	mi := &file_gophkeeper_v1_sync_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SecretChange.ProtoReflect.Descriptor instead.
+func (*SecretChange) Descriptor() ([]byte, []int) {
+	return file_gophkeeper_v1_sync_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *SecretChange) GetKind() SecretChange_Kind {
+	if x != nil {
+		return x.Kind
+	}
+	return SecretChange_KIND_UNSPECIFIED
+}
+
+func (x *SecretChange) GetSecretId() int64 {
+	if x != nil {
+		return x.SecretId
+	}
+	return 0
+}
+
+func (x *SecretChange) GetSecret() *Secret {
+	if x != nil {
+		return x.Secret
+	}
+	return nil
+}
+
+var File_gophkeeper_v1_sync_proto protoreflect.FileDescriptor
+
+const file_gophkeeper_v1_sync_proto_rawDesc = "" +
+	"\n" +
+	"\x18gophkeeper/v1/sync.proto\x12\rgophkeeper.v1\x1a\x1bgophkeeper/v1/secrets.proto\"\x0e\n" +
+	"\fWatchRequest\"\xe4\x01\n" +
+	"\fSecretChange\x124\n" +
+	"\x04kind\x18\x01 \x01(\x0e2 .gophkeeper.v1.SecretChange.KindR\x04kind\x12\x1b\n" +
+	"\tsecret_id\x18\x02 \x01(\x03R\bsecretId\x12-\n" +
+	"\x06secret\x18\x03 \x01(\v2\x15.gophkeeper.v1.SecretR\x06secret\"R\n" +
+	"\x04Kind\x12\x14\n" +
+	"\x10KIND_UNSPECIFIED\x10\x00\x12\x10\n" +
+	"\fKIND_CREATED\x10\x01\x12\x10\n" +
+	"\fKIND_UPDATED\x10\x02\x12\x10\n" +
+	"\fKIND_DELETED\x10\x032R\n" +
+	"\vSyncService\x12C\n" +
+	"\x05Watch\x12\x1b.gophkeeper.v1.WatchRequest\x1a\x1b.gophkeeper.v1.SecretChange0\x01B\x1fZ\x1dgophkeeper/server/internal/pbb\x06proto3"
+
+var (
+	file_gophkeeper_v1_sync_proto_rawDescOnce sync.Once
+	file_gophkeeper_v1_sync_proto_rawDescData []byte
+)
+
+func file_gophkeeper_v1_sync_proto_rawDescGZIP() []byte {
+	file_gophkeeper_v1_sync_proto_rawDescOnce.Do(func() {
+		file_gophkeeper_v1_sync_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_gophkeeper_v1_sync_proto_rawDesc), len(file_gophkeeper_v1_sync_proto_rawDesc)))
+	})
+	return file_gophkeeper_v1_sync_proto_rawDescData
+}
+
+var file_gophkeeper_v1_sync_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_gophkeeper_v1_sync_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_gophkeeper_v1_sync_proto_goTypes = []any{
+	(SecretChange_Kind)(0), // 0: gophkeeper.v1.SecretChange.Kind
+	(*WatchRequest)(nil),   // 1: gophkeeper.v1.WatchRequest
+	(*SecretChange)(nil),   // 2: gophkeeper.v1.SecretChange
+	(*Secret)(nil),         // 3: gophkeeper.v1.Secret
+}
+var file_gophkeeper_v1_sync_proto_depIdxs = []int32{
+	0, // 0: gophkeeper.v1.SecretChange.kind:type_name -> gophkeeper.v1.SecretChange.Kind
+	3, // 1: gophkeeper.v1.SecretChange.secret:type_name -> gophkeeper.v1.Secret
+	1, // 2: gophkeeper.v1.SyncService.Watch:input_type -> gophkeeper.v1.WatchRequest
+	2, // 3: gophkeeper.v1.SyncService.Watch:output_type -> gophkeeper.v1.SecretChange
+	3, // [3:4] is the sub-list for method output_type
+	2, // [2:3] is the sub-list for method input_type
+	2, // [2:2] is the sub-list for extension type_name
+	2, // [2:2] is the sub-list for extension extendee
+	0, // [0:2] is the sub-list for field type_name
+}
+
+func init() { file_gophkeeper_v1_sync_proto_init() }
+func file_gophkeeper_v1_sync_proto_init() {
+	if File_gophkeeper_v1_sync_proto != nil {
+		return
+	}
+	file_gophkeeper_v1_secrets_proto_init()
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_gophkeeper_v1_sync_proto_rawDesc), len(file_gophkeeper_v1_sync_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   2,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_gophkeeper_v1_sync_proto_goTypes,
+		DependencyIndexes: file_gophkeeper_v1_sync_proto_depIdxs,
+		EnumInfos:         file_gophkeeper_v1_sync_proto_enumTypes,
+		MessageInfos:      file_gophkeeper_v1_sync_proto_msgTypes,
+	}.Build()
+	File_gophkeeper_v1_sync_proto = out.File
+	file_gophkeeper_v1_sync_proto_goTypes = nil
+	file_gophkeeper_v1_sync_proto_depIdxs = nil
+}
@@ -2,36 +2,70 @@ package storage
 
 import (
 	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"gophkeeper/server/internal/crypto"
 	"gophkeeper/server/internal/models"
+	"slices"
+	"strings"
+	"time"
+)
+
+// encryptedMetadataPrefix marks metadata stored as base64-encoded ciphertext
+const encryptedMetadataPrefix = "enc:v1:"
+
+// errConcurrentModification is returned when a secret changed between reading and replacing it
+var errConcurrentModification = errors.New("secret was modified concurrently")
+
+const (
+	// dataKeyCacheTTL bounds how long an unwrapped data key stays in memory
+	dataKeyCacheTTL = 5 * time.Minute
+	// dataKeyCacheSize bounds how many unwrapped data keys are held at once
+	dataKeyCacheSize = 1024
 )
 
 // EncryptedStore wraps a Store and provides transparent encryption/decryption of secret data
+// and metadata using envelope encryption: every user's secrets are encrypted with a random
+// per-user data key, and only the data key wrapped with a master key (KEK) is persisted in the
+// underlying store
+//
+// Secret ciphertexts are bound to the owner, secret ID and type via AEAD associated data,
+// so a ciphertext copied into another row fails to decrypt with ErrSecretIntegrity
+//
+// With blind indexing enabled, HMAC terms of the metadata are stored alongside each secret,
+// so exact-match and keyword searches run in the underlying store without revealing metadata
 type EncryptedStore struct {
-	store     Store
-	encryptor *crypto.Encryptor
+	store         Store
+	keyring       *crypto.Keyring
+	keyCache      *crypto.KeyCache
+	strictBinding bool
+	blindIndex    bool
 }
 
 // NewEncryptedStore creates a new EncryptedStore that wraps the provided store
-// If encryptionKey is empty, encryption is disabled and data passes through unchanged
-func NewEncryptedStore(store Store, encryptionKey string) (*EncryptedStore, error) {
-	var encryptor *crypto.Encryptor
-	var err error
-
-	if encryptionKey != "" {
-		encryptor, err = crypto.NewEncryptor(encryptionKey)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create encryptor: %w", err)
-		}
-	}
-
+// If keyring is nil, encryption is disabled and data passes through unchanged
+func NewEncryptedStore(store Store, keyring *crypto.Keyring) (*EncryptedStore, error) {
 	return &EncryptedStore{
-		store:     store,
-		encryptor: encryptor,
+		store:    store,
+		keyring:  keyring,
+		keyCache: crypto.NewKeyCache(dataKeyCacheTTL, dataKeyCacheSize),
 	}, nil
 }
 
+// SetStrictBinding controls whether secrets encrypted before they were bound to their
+// owner and record are rejected. Enable it once Rekey has migrated all existing rows
+func (es *EncryptedStore) SetStrictBinding(strict bool) {
+	es.strictBinding = strict
+}
+
+// SetBlindIndex controls whether blind index terms are written and used for searches
+// Without it searches decrypt and filter all secrets of the user. Run Rekey after
+// enabling it to index existing secrets
+func (es *EncryptedStore) SetBlindIndex(enabled bool) {
+	es.blindIndex = enabled
+}
+
 // CreateUser delegates to the underlying store (no encryption needed for users)
 func (es *EncryptedStore) CreateUser(ctx context.Context, user models.User) (models.User, error) {
 
@@ -44,17 +78,70 @@ func (es *EncryptedStore) GetUserByLogin(ctx context.Context, login string) (mod
 	return es.store.GetUserByLogin(ctx, login)
 }
 
-// CreateSecret encrypts the secret data before storing
+// GetUserByID delegates to the underlying store (no encryption needed for users)
+func (es *EncryptedStore) GetUserByID(ctx context.Context, id int) (models.User, error) {
+	return es.store.GetUserByID(ctx, id)
+}
+
+// SetUserPassword delegates to the underlying store
+func (es *EncryptedStore) SetUserPassword(ctx context.Context, userID int, password string) error {
+	return es.store.SetUserPassword(ctx, userID, password)
+}
+
+// SetUserRoles delegates to the underlying store
+func (es *EncryptedStore) SetUserRoles(ctx context.Context, userID int, roles []string) error {
+	return es.store.SetUserRoles(ctx, userID, roles)
+}
+
+// GetUserByIdentity delegates to the underlying store
+func (es *EncryptedStore) GetUserByIdentity(ctx context.Context, issuer, subject string) (models.User, error) {
+	return es.store.GetUserByIdentity(ctx, issuer, subject)
+}
+
+// LinkIdentity delegates to the underlying store
+func (es *EncryptedStore) LinkIdentity(ctx context.Context, identity models.UserIdentity) (models.UserIdentity, error) {
+	return es.store.LinkIdentity(ctx, identity)
+}
+
+// GetUserIDs delegates to the underlying store
+func (es *EncryptedStore) GetUserIDs(ctx context.Context) ([]int, error) {
+	return es.store.GetUserIDs(ctx)
+}
+
+// CreateSecret encrypts the secret data and metadata before storing
+// The ciphertexts are bound to the secret ID, so the ID is reserved first and the secret
+// is inserted with its ciphertexts at once; a failed creation leaves no row behind
 func (es *EncryptedStore) CreateSecret(ctx context.Context, secret models.Secret) (models.Secret, error) {
-	if es.encryptor != nil && len(secret.Data) > 0 {
-		encryptedData, err := es.encryptor.Encrypt(secret.Data)
-		if err != nil {
-			return models.Secret{}, fmt.Errorf("failed to encrypt secret data: %w", err)
-		}
-		secret.Data = encryptedData
+	if es.keyring == nil {
+		return es.store.CreateSecret(ctx, secret)
+	}
+
+	secretID, err := es.store.NextSecretID(ctx)
+	if err != nil {
+		return models.Secret{}, err
+	}
+	secret.ID = secretID
+
+	encrypted, err := es.encryptSecret(ctx, secret)
+	if err != nil {
+		return models.Secret{}, fmt.Errorf("failed to encrypt secret: %w", err)
+	}
+
+	createdSecret, err := es.store.CreateSecret(ctx, encrypted)
+	if err != nil {
+		return models.Secret{}, err
+	}
+	secret.CreatedAt = createdSecret.CreatedAt
+	secret.UpdatedAt = createdSecret.UpdatedAt
+	secret.Revision = createdSecret.Revision
+
+	// A secret missing from the index would not be found by searches
+	if err := es.updateIndex(ctx, secret); err != nil {
+		es.store.DeleteSecret(ctx, secret.UserID, secret.ID)
+		return models.Secret{}, err
 	}
 
-	return es.store.CreateSecret(ctx, secret)
+	return secret, nil
 }
 
 // GetSecrets retrieves and decrypts all secrets for a user
@@ -64,14 +151,15 @@ func (es *EncryptedStore) GetSecrets(ctx context.Context, userID int) ([]models.
 		return nil, err
 	}
 
+	if es.keyring == nil {
+		return secrets, nil
+	}
+
 	// Decrypt each secret
 	for i := range secrets {
-		if es.encryptor != nil && len(secrets[i].Data) > 0 {
-			decryptedData, err := es.encryptor.Decrypt(secrets[i].Data)
-			if err != nil {
-				return nil, fmt.Errorf("failed to decrypt secret %d: %w", secrets[i].ID, err)
-			}
-			secrets[i].Data = decryptedData
+		secrets[i], err = es.decryptSecret(ctx, secrets[i])
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt secret %d: %w", secrets[i].ID, err)
 		}
 	}
 
@@ -85,32 +173,622 @@ func (es *EncryptedStore) GetSecretByID(ctx context.Context, userID, secretID in
 		return models.Secret{}, err
 	}
 
-	// Decrypt the secret data
-	if es.encryptor != nil && len(secret.Data) > 0 {
-		decryptedData, err := es.encryptor.Decrypt(secret.Data)
-		if err != nil {
-			return models.Secret{}, fmt.Errorf("failed to decrypt secret: %w", err)
-		}
-		secret.Data = decryptedData
+	if es.keyring == nil {
+		return secret, nil
+	}
+
+	// Decrypt the secret data and metadata
+	secret, err = es.decryptSecret(ctx, secret)
+	if err != nil {
+		return models.Secret{}, fmt.Errorf("failed to decrypt secret: %w", err)
 	}
 
 	return secret, nil
 }
 
-// UpdateSecret encrypts the secret data before updating
+// UpdateSecret encrypts the secret data and metadata before updating
 func (es *EncryptedStore) UpdateSecret(ctx context.Context, secret models.Secret) (models.Secret, error) {
-	if es.encryptor != nil && len(secret.Data) > 0 {
-		encryptedData, err := es.encryptor.Encrypt(secret.Data)
+	if es.keyring == nil {
+		return es.store.UpdateSecret(ctx, secret)
+	}
+
+	encrypted, err := es.encryptSecret(ctx, secret)
+	if err != nil {
+		return models.Secret{}, fmt.Errorf("failed to encrypt secret: %w", err)
+	}
+
+	updated, err := es.store.UpdateSecret(ctx, encrypted)
+	if err != nil {
+		return models.Secret{}, err
+	}
+	secret.CreatedAt = updated.CreatedAt
+	secret.UpdatedAt = updated.UpdatedAt
+	secret.Revision = updated.Revision
+
+	if err := es.updateIndex(ctx, secret); err != nil {
+		return models.Secret{}, err
+	}
+
+	return secret, nil
+}
+
+// SearchSecrets retrieves the secrets of a user that satisfy the query
+// With blind indexing the candidates are looked up by index terms; otherwise all secrets
+// are decrypted and filtered. Candidates are always checked against the decrypted metadata
+func (es *EncryptedStore) SearchSecrets(ctx context.Context, userID int, query models.SecretQuery) ([]models.Secret, error) {
+	if es.keyring == nil {
+		return es.store.SearchSecrets(ctx, userID, query)
+	}
+
+	if !es.blindIndex || query == (models.SecretQuery{}) {
+		secrets, err := es.GetSecrets(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		return filterSecrets(secrets, query), nil
+	}
+
+	candidateIDs, err := es.lookupIndex(ctx, userID, query)
+	if err != nil {
+		return nil, err
+	}
+
+	secrets := make([]models.Secret, 0, len(candidateIDs))
+	for _, secretID := range candidateIDs {
+		secret, err := es.GetSecretByID(ctx, userID, secretID)
 		if err != nil {
-			return models.Secret{}, fmt.Errorf("failed to encrypt secret data: %w", err)
+			var secretNotFoundErr ErrSecretNotFound
+			if errors.As(err, &secretNotFoundErr) {
+				continue
+			}
+			return nil, err
+		}
+		if matchesQuery(secret, query) {
+			secrets = append(secrets, secret)
 		}
-		secret.Data = encryptedData
 	}
 
-	return es.store.UpdateSecret(ctx, secret)
+	return secrets, nil
+}
+
+// NextSecretID delegates to the underlying store
+func (es *EncryptedStore) NextSecretID(ctx context.Context) (int, error) {
+	return es.store.NextSecretID(ctx)
 }
 
 // DeleteSecret delegates to the underlying store
 func (es *EncryptedStore) DeleteSecret(ctx context.Context, userID, secretID int) error {
 	return es.store.DeleteSecret(ctx, userID, secretID)
 }
+
+// ReplaceSecret delegates to the underlying store (data and metadata are expected to be encrypted already)
+func (es *EncryptedStore) ReplaceSecret(ctx context.Context, old, new models.Secret) (bool, error) {
+	return es.store.ReplaceSecret(ctx, old, new)
+}
+
+// SetSecretIndex delegates to the underlying store (terms are already blinded)
+func (es *EncryptedStore) SetSecretIndex(ctx context.Context, userID, secretID int, terms [][]byte) error {
+	return es.store.SetSecretIndex(ctx, userID, secretID, terms)
+}
+
+// GetSecretIDsByIndex delegates to the underlying store (terms are already blinded)
+func (es *EncryptedStore) GetSecretIDsByIndex(ctx context.Context, userID int, term []byte) ([]int, error) {
+	return es.store.GetSecretIDsByIndex(ctx, userID, term)
+}
+
+// GetDataKey delegates to the underlying store (data keys are already wrapped)
+func (es *EncryptedStore) GetDataKey(ctx context.Context, userID int) ([]byte, error) {
+	return es.store.GetDataKey(ctx, userID)
+}
+
+// CreateDataKey delegates to the underlying store (data keys are already wrapped)
+func (es *EncryptedStore) CreateDataKey(ctx context.Context, userID int, wrappedKey []byte) ([]byte, error) {
+	return es.store.CreateDataKey(ctx, userID, wrappedKey)
+}
+
+// ReplaceDataKey delegates to the underlying store (data keys are already wrapped)
+func (es *EncryptedStore) ReplaceDataKey(ctx context.Context, userID int, oldKey, newKey []byte) (bool, error) {
+	return es.store.ReplaceDataKey(ctx, userID, oldKey, newKey)
+}
+
+// CreateKeySalt delegates to the underlying store
+func (es *EncryptedStore) CreateKeySalt(ctx context.Context, keyID string, salt []byte) ([]byte, error) {
+	return es.store.CreateKeySalt(ctx, keyID, salt)
+}
+
+// GetSealConfig delegates to the underlying store
+func (es *EncryptedStore) GetSealConfig(ctx context.Context, keyID string) ([]byte, error) {
+	return es.store.GetSealConfig(ctx, keyID)
+}
+
+// CreateSealConfig delegates to the underlying store
+func (es *EncryptedStore) CreateSealConfig(ctx context.Context, keyID string, config []byte) ([]byte, error) {
+	return es.store.CreateSealConfig(ctx, keyID, config)
+}
+
+// CreateRefreshToken delegates to the underlying store (only token hashes are stored)
+func (es *EncryptedStore) CreateRefreshToken(ctx context.Context, token models.RefreshToken) error {
+	return es.store.CreateRefreshToken(ctx, token)
+}
+
+// GetRefreshToken delegates to the underlying store
+func (es *EncryptedStore) GetRefreshToken(ctx context.Context, tokenHash []byte) (models.RefreshToken, error) {
+	return es.store.GetRefreshToken(ctx, tokenHash)
+}
+
+// UseRefreshToken delegates to the underlying store
+func (es *EncryptedStore) UseRefreshToken(ctx context.Context, tokenHash []byte) (models.RefreshToken, error) {
+	return es.store.UseRefreshToken(ctx, tokenHash)
+}
+
+// RevokeRefreshTokenFamily delegates to the underlying store
+func (es *EncryptedStore) RevokeRefreshTokenFamily(ctx context.Context, familyID string) error {
+	return es.store.RevokeRefreshTokenFamily(ctx, familyID)
+}
+
+// RevokeToken delegates to the underlying store
+func (es *EncryptedStore) RevokeToken(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	return es.store.RevokeToken(ctx, tokenID, expiresAt)
+}
+
+// RevokeTokenOnce delegates to the underlying store
+func (es *EncryptedStore) RevokeTokenOnce(ctx context.Context, tokenID string, expiresAt time.Time) (bool, error) {
+	return es.store.RevokeTokenOnce(ctx, tokenID, expiresAt)
+}
+
+// IsTokenRevoked delegates to the underlying store
+func (es *EncryptedStore) IsTokenRevoked(ctx context.Context, tokenID string) (bool, error) {
+	return es.store.IsTokenRevoked(ctx, tokenID)
+}
+
+// DeleteExpiredRevokedTokens delegates to the underlying store
+func (es *EncryptedStore) DeleteExpiredRevokedTokens(ctx context.Context, now time.Time) error {
+	return es.store.DeleteExpiredRevokedTokens(ctx, now)
+}
+
+// CreateSession delegates to the underlying store
+func (es *EncryptedStore) CreateSession(ctx context.Context, session models.Session) error {
+	return es.store.CreateSession(ctx, session)
+}
+
+// GetSessions delegates to the underlying store
+func (es *EncryptedStore) GetSessions(ctx context.Context, userID int) ([]models.Session, error) {
+	return es.store.GetSessions(ctx, userID)
+}
+
+// TouchSession delegates to the underlying store
+func (es *EncryptedStore) TouchSession(ctx context.Context, sessionID, ip string, seenAt time.Time) error {
+	return es.store.TouchSession(ctx, sessionID, ip, seenAt)
+}
+
+// DeleteSession delegates to the underlying store
+func (es *EncryptedStore) DeleteSession(ctx context.Context, userID int, sessionID string) error {
+	return es.store.DeleteSession(ctx, userID, sessionID)
+}
+
+// CreateAPIToken delegates to the underlying store
+func (es *EncryptedStore) CreateAPIToken(ctx context.Context, token models.APIToken) error {
+	return es.store.CreateAPIToken(ctx, token)
+}
+
+// GetAPITokens delegates to the underlying store
+func (es *EncryptedStore) GetAPITokens(ctx context.Context, userID int) ([]models.APIToken, error) {
+	return es.store.GetAPITokens(ctx, userID)
+}
+
+// GetAPITokenByHash delegates to the underlying store
+func (es *EncryptedStore) GetAPITokenByHash(ctx context.Context, tokenHash []byte) (models.APIToken, error) {
+	return es.store.GetAPITokenByHash(ctx, tokenHash)
+}
+
+// TouchAPIToken delegates to the underlying store
+func (es *EncryptedStore) TouchAPIToken(ctx context.Context, tokenID string, usedAt time.Time) error {
+	return es.store.TouchAPIToken(ctx, tokenID, usedAt)
+}
+
+// DeleteAPIToken delegates to the underlying store
+func (es *EncryptedStore) DeleteAPIToken(ctx context.Context, userID int, tokenID string) error {
+	return es.store.DeleteAPIToken(ctx, userID, tokenID)
+}
+
+// CreateInvite delegates to the underlying store
+func (es *EncryptedStore) CreateInvite(ctx context.Context, invite models.Invite) error {
+	return es.store.CreateInvite(ctx, invite)
+}
+
+// GetInvites delegates to the underlying store
+func (es *EncryptedStore) GetInvites(ctx context.Context) ([]models.Invite, error) {
+	return es.store.GetInvites(ctx)
+}
+
+// CreateUserWithInvite delegates to the underlying store
+func (es *EncryptedStore) CreateUserWithInvite(ctx context.Context, user models.User, codeHash []byte, now time.Time) (models.User, error) {
+	return es.store.CreateUserWithInvite(ctx, user, codeHash, now)
+}
+
+// DeleteInvite delegates to the underlying store
+func (es *EncryptedStore) DeleteInvite(ctx context.Context, inviteID string) error {
+	return es.store.DeleteInvite(ctx, inviteID)
+}
+
+// SaveTOTP encrypts the TOTP secret with the user's data key before storing
+func (es *EncryptedStore) SaveTOTP(ctx context.Context, totp models.TOTP) error {
+	if es.keyring == nil {
+		return es.store.SaveTOTP(ctx, totp)
+	}
+
+	dataKey, err := es.dataKeyEncryptor(ctx, totp.UserID, true)
+	if err != nil {
+		return err
+	}
+
+	totp.Secret, err = dataKey.EncryptWithContext(totp.Secret, totpAssociatedData(totp.UserID))
+	if err != nil {
+		return fmt.Errorf("failed to encrypt TOTP secret: %w", err)
+	}
+	return es.store.SaveTOTP(ctx, totp)
+}
+
+// GetTOTP retrieves the enrollment and decrypts the TOTP secret
+func (es *EncryptedStore) GetTOTP(ctx context.Context, userID int) (models.TOTP, error) {
+	totp, err := es.store.GetTOTP(ctx, userID)
+	if err != nil || es.keyring == nil {
+		return totp, err
+	}
+
+	dataKey, err := es.dataKeyEncryptor(ctx, userID, false)
+	if err != nil {
+		return models.TOTP{}, err
+	}
+
+	totp.Secret, err = dataKey.DecryptWithContext(totp.Secret, totpAssociatedData(userID))
+	if err != nil {
+		return models.TOTP{}, fmt.Errorf("failed to decrypt TOTP secret: %w", err)
+	}
+	return totp, nil
+}
+
+// DeleteTOTP delegates to the underlying store
+func (es *EncryptedStore) DeleteTOTP(ctx context.Context, userID int) error {
+	return es.store.DeleteTOTP(ctx, userID)
+}
+
+// UseTOTPStep delegates to the underlying store
+func (es *EncryptedStore) UseTOTPStep(ctx context.Context, userID int, step int64) (bool, error) {
+	return es.store.UseTOTPStep(ctx, userID, step)
+}
+
+// UseRecoveryCode delegates to the underlying store
+func (es *EncryptedStore) UseRecoveryCode(ctx context.Context, userID int, codeHash []byte) (bool, error) {
+	return es.store.UseRecoveryCode(ctx, userID, codeHash)
+}
+
+// SetAccountRecoveryCodes delegates to the underlying store
+func (es *EncryptedStore) SetAccountRecoveryCodes(ctx context.Context, userID int, codeHashes [][]byte) error {
+	return es.store.SetAccountRecoveryCodes(ctx, userID, codeHashes)
+}
+
+// CountAccountRecoveryCodes delegates to the underlying store
+func (es *EncryptedStore) CountAccountRecoveryCodes(ctx context.Context, userID int) (int, error) {
+	return es.store.CountAccountRecoveryCodes(ctx, userID)
+}
+
+// UseAccountRecoveryCode delegates to the underlying store
+func (es *EncryptedStore) UseAccountRecoveryCode(ctx context.Context, userID int, codeHash []byte) (bool, error) {
+	return es.store.UseAccountRecoveryCode(ctx, userID, codeHash)
+}
+
+// GetLoginAttempts delegates to the underlying store
+func (es *EncryptedStore) GetLoginAttempts(ctx context.Context, key string) (models.LoginAttempts, error) {
+	return es.store.GetLoginAttempts(ctx, key)
+}
+
+// RecordLoginFailure delegates to the underlying store
+func (es *EncryptedStore) RecordLoginFailure(ctx context.Context, key string, now, resetBefore time.Time) (models.LoginAttempts, error) {
+	return es.store.RecordLoginFailure(ctx, key, now, resetBefore)
+}
+
+// LockLogin delegates to the underlying store
+func (es *EncryptedStore) LockLogin(ctx context.Context, key string, until time.Time) error {
+	return es.store.LockLogin(ctx, key, until)
+}
+
+// ResetLoginAttempts delegates to the underlying store
+func (es *EncryptedStore) ResetLoginAttempts(ctx context.Context, key string) error {
+	return es.store.ResetLoginAttempts(ctx, key)
+}
+
+// DeleteStaleLoginAttempts delegates to the underlying store
+func (es *EncryptedStore) DeleteStaleLoginAttempts(ctx context.Context, before, now time.Time) error {
+	return es.store.DeleteStaleLoginAttempts(ctx, before, now)
+}
+
+// storeEncrypted encrypts the data and metadata of secret and writes them over those of stored,
+// which must be the row as currently persisted, then updates the blind index
+func (es *EncryptedStore) storeEncrypted(ctx context.Context, stored, secret models.Secret) error {
+	encrypted, err := es.encryptSecret(ctx, secret)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt secret: %w", err)
+	}
+
+	replaced, err := es.store.ReplaceSecret(ctx, stored, encrypted)
+	if err != nil {
+		return fmt.Errorf("failed to store encrypted secret: %w", err)
+	}
+	if !replaced {
+		return fmt.Errorf("secret %d: %w", secret.ID, errConcurrentModification)
+	}
+
+	return es.updateIndex(ctx, secret)
+}
+
+// encryptSecret encrypts the secret data and metadata with the owner's data key, creating the
+// key on first use, and binds the ciphertexts to the secret
+func (es *EncryptedStore) encryptSecret(ctx context.Context, secret models.Secret) (models.Secret, error) {
+	if len(secret.Data) == 0 && secret.Metadata == "" {
+		return secret, nil
+	}
+
+	dataKey, err := es.dataKeyEncryptor(ctx, secret.UserID, true)
+	if err != nil {
+		return models.Secret{}, err
+	}
+
+	if len(secret.Data) > 0 {
+		secret.Data, err = dataKey.EncryptWithContext(secret.Data, secretAssociatedData(secret))
+		if err != nil {
+			return models.Secret{}, err
+		}
+	}
+
+	if secret.Metadata != "" {
+		encryptedMetadata, err := dataKey.EncryptWithContext([]byte(secret.Metadata), metadataAssociatedData(secret))
+		if err != nil {
+			return models.Secret{}, err
+		}
+		secret.Metadata = encryptedMetadataPrefix + base64.StdEncoding.EncodeToString(encryptedMetadata)
+	}
+
+	return secret, nil
+}
+
+// decryptSecret decrypts the secret data and metadata and verifies that the ciphertexts belong to the secret
+func (es *EncryptedStore) decryptSecret(ctx context.Context, secret models.Secret) (models.Secret, error) {
+	return es.decryptSecretWith(ctx, secret, es.strictBinding)
+}
+
+// decryptSecretWith is decryptSecret with an explicit choice of whether unbound ciphertexts are rejected
+func (es *EncryptedStore) decryptSecretWith(ctx context.Context, secret models.Secret, strict bool) (models.Secret, error) {
+	if len(secret.Data) > 0 {
+		data, err := es.decryptField(ctx, secret, secret.Data, secretAssociatedData(secret), strict)
+		if err != nil {
+			return models.Secret{}, err
+		}
+		secret.Data = data
+	}
+
+	if encoded, ok := strings.CutPrefix(secret.Metadata, encryptedMetadataPrefix); ok {
+		ciphertext, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return models.Secret{}, NewErrSecretIntegrity(secret.ID)
+		}
+
+		metadata, err := es.decryptBound(ctx, secret, ciphertext, metadataAssociatedData(secret))
+		if err != nil {
+			return models.Secret{}, err
+		}
+		secret.Metadata = string(metadata)
+	} else if secret.Metadata != "" && strict {
+		return models.Secret{}, NewErrSecretIntegrity(secret.ID)
+	}
+
+	return secret, nil
+}
+
+// decryptField decrypts a bound ciphertext, or an unbound one written before binding was introduced
+func (es *EncryptedStore) decryptField(ctx context.Context, secret models.Secret, ciphertext, associatedData []byte, strict bool) ([]byte, error) {
+	if header, _, ok := crypto.ParseHeader(ciphertext); ok && header.Version == crypto.FormatVersionBound {
+		return es.decryptBound(ctx, secret, ciphertext, associatedData)
+	}
+
+	if strict {
+		return nil, NewErrSecretIntegrity(secret.ID)
+	}
+	return es.decryptUnbound(ctx, secret.UserID, ciphertext)
+}
+
+// decryptBound decrypts a ciphertext bound to the secret with the owner's data key
+func (es *EncryptedStore) decryptBound(ctx context.Context, secret models.Secret, ciphertext, associatedData []byte) ([]byte, error) {
+	header, _, ok := crypto.ParseHeader(ciphertext)
+	if !ok || header.Version != crypto.FormatVersionBound || header.KeyID != dataKeyID(secret.UserID) {
+		return nil, NewErrSecretIntegrity(secret.ID)
+	}
+
+	dataKey, err := es.dataKeyEncryptor(ctx, secret.UserID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := dataKey.DecryptWithContext(ciphertext, associatedData)
+	if err != nil {
+		return nil, NewErrSecretIntegrity(secret.ID)
+	}
+	return plaintext, nil
+}
+
+// isMigrated reports whether the stored secret is fully encrypted and bound to its record
+func isMigrated(secret models.Secret) bool {
+	if len(secret.Data) > 0 {
+		header, _, ok := crypto.ParseHeader(secret.Data)
+		if !ok || header.Version != crypto.FormatVersionBound {
+			return false
+		}
+	}
+	return secret.Metadata == "" || strings.HasPrefix(secret.Metadata, encryptedMetadataPrefix)
+}
+
+// updateIndex replaces the blind index terms of a plaintext secret if blind indexing is enabled
+func (es *EncryptedStore) updateIndex(ctx context.Context, secret models.Secret) error {
+	if !es.blindIndex {
+		return nil
+	}
+
+	index, err := es.blindIndexFor(ctx, secret.UserID)
+	if err != nil {
+		return err
+	}
+
+	var terms [][]byte
+	if secret.Metadata != "" {
+		terms = append(terms, index.Term(indexKindMetadata, secret.Metadata))
+	}
+	for _, keyword := range metadataKeywords(secret.Metadata) {
+		terms = append(terms, index.Term(indexKindKeyword, keyword))
+	}
+
+	if err := es.store.SetSecretIndex(ctx, secret.UserID, secret.ID, terms); err != nil {
+		return fmt.Errorf("failed to update search index: %w", err)
+	}
+	return nil
+}
+
+// lookupIndex returns the IDs of the user's secrets indexed with all terms of the query
+func (es *EncryptedStore) lookupIndex(ctx context.Context, userID int, query models.SecretQuery) ([]int, error) {
+	index, err := es.blindIndexFor(ctx, userID)
+	if err != nil {
+		var dataKeyNotFoundErr ErrDataKeyNotFound
+		if errors.As(err, &dataKeyNotFoundErr) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var terms [][]byte
+	if query.Metadata != "" {
+		terms = append(terms, index.Term(indexKindMetadata, query.Metadata))
+	}
+	if query.Keyword != "" {
+		terms = append(terms, index.Term(indexKindKeyword, normalizeKeyword(query.Keyword)))
+	}
+
+	var candidateIDs []int
+	for i, term := range terms {
+		secretIDs, err := es.store.GetSecretIDsByIndex(ctx, userID, term)
+		if err != nil {
+			return nil, fmt.Errorf("failed to search index: %w", err)
+		}
+		if i == 0 {
+			candidateIDs = secretIDs
+			continue
+		}
+		candidateIDs = slices.DeleteFunc(candidateIDs, func(id int) bool {
+			return !slices.Contains(secretIDs, id)
+		})
+	}
+
+	return candidateIDs, nil
+}
+
+// blindIndexFor returns the blind index keyed for the user
+// The index key is derived from the user's data key, so terms are not comparable across users
+func (es *EncryptedStore) blindIndexFor(ctx context.Context, userID int) (*crypto.BlindIndex, error) {
+	dataKey, err := es.dataKeyEncryptor(ctx, userID, false)
+	if err != nil {
+		return nil, err
+	}
+	return dataKey.BlindIndex()
+}
+
+// decryptUnbound decrypts data written before ciphertexts were bound to their secret
+// Secrets written before envelope encryption was introduced are encrypted directly
+// with a master key, so decryption falls back to the keyring when the data key does not match
+func (es *EncryptedStore) decryptUnbound(ctx context.Context, userID int, ciphertext []byte) ([]byte, error) {
+	dataKey, err := es.dataKeyEncryptor(ctx, userID, false)
+	if err != nil {
+		var dataKeyNotFoundErr ErrDataKeyNotFound
+		if !errors.As(err, &dataKeyNotFoundErr) {
+			return nil, err
+		}
+		return es.keyring.Decrypt(ctx, ciphertext)
+	}
+
+	plaintext, err := dataKey.Decrypt(ciphertext)
+	if err != nil {
+		if legacy, legacyErr := es.keyring.Decrypt(ctx, ciphertext); legacyErr == nil {
+			return legacy, nil
+		}
+		return nil, err
+	}
+	return plaintext, nil
+}
+
+// dataKeyEncryptor returns an Encryptor for the user's unwrapped data key
+// If the user has no data key yet and create is true, a new one is generated and persisted
+func (es *EncryptedStore) dataKeyEncryptor(ctx context.Context, userID int, create bool) (*crypto.Encryptor, error) {
+	if dataKey, ok := es.keyCache.Get(userID); ok {
+		defer clear(dataKey)
+		return crypto.NewEncryptorFromKey(dataKeyID(userID), dataKey)
+	}
+
+	wrappedKey, err := es.store.GetDataKey(ctx, userID)
+	if err != nil {
+		var dataKeyNotFoundErr ErrDataKeyNotFound
+		if !create || !errors.As(err, &dataKeyNotFoundErr) {
+			return nil, err
+		}
+
+		wrappedKey, err = es.newDataKey(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	dataKey, err := es.keyring.UnwrapKey(ctx, wrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key for user %d: %w", userID, err)
+	}
+	defer clear(dataKey)
+
+	es.keyCache.Put(userID, dataKey)
+	return crypto.NewEncryptorFromKey(dataKeyID(userID), dataKey)
+}
+
+// newDataKey generates a data key for the user, wraps it with the primary master key and persists it
+func (es *EncryptedStore) newDataKey(ctx context.Context, userID int) ([]byte, error) {
+	dataKey, err := crypto.GenerateDataKey()
+	if err != nil {
+		return nil, err
+	}
+	defer clear(dataKey)
+
+	wrappedKey, err := es.keyring.WrapKey(ctx, dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	wrappedKey, err = es.store.CreateDataKey(ctx, userID, wrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store data key for user %d: %w", userID, err)
+	}
+	return wrappedKey, nil
+}
+
+// dataKeyID returns the key ID recorded in ciphertexts encrypted with the user's data key
+func dataKeyID(userID int) string {
+	return fmt.Sprintf("user:%d", userID)
+}
+
+// secretAssociatedData returns the context a secret's data ciphertext is bound to
+func secretAssociatedData(secret models.Secret) []byte {
+	return fmt.Appendf(nil, "gophkeeper/secret|user=%d|secret=%d|type=%d", secret.UserID, secret.ID, secret.Type)
+}
+
+// metadataAssociatedData returns the context a secret's metadata ciphertext is bound to
+func metadataAssociatedData(secret models.Secret) []byte {
+	return append(secretAssociatedData(secret), "|field=metadata"...)
+}
+
+// totpAssociatedData returns the context a user's TOTP secret ciphertext is bound to
+func totpAssociatedData(userID int) []byte {
+	return fmt.Appendf(nil, "gophkeeper/totp|user=%d", userID)
+}
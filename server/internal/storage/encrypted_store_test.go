@@ -0,0 +1,467 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"gophkeeper/server/internal/crypto"
+	"gophkeeper/server/internal/models"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const testEncryptionKey = "0123456789abcdef0123456789abcdef"
+
+var (
+	testKeySpec    = "default:hex:" + hex.EncodeToString([]byte(testEncryptionKey))
+	rotatedKeySpec = "2:hex:" + hex.EncodeToString([]byte("fedcba9876543210fedcba9876543210"))
+)
+
+// TestEncryptedStorePerUserDataKeys tests that every user gets their own data key
+func TestEncryptedStorePerUserDataKeys(t *testing.T) {
+	ctx := context.Background()
+	mem := NewMemStore()
+	store, err := NewEncryptedStore(mem, testKeyring(t, testKeySpec))
+	if err != nil {
+		t.Fatalf("Failed to create encrypted store: %v", err)
+	}
+
+	for _, userID := range []int{1, 2} {
+		if _, err := store.CreateSecret(ctx, models.Secret{UserID: userID, Data: []byte("same data")}); err != nil {
+			t.Fatalf("Failed to create secret: %v", err)
+		}
+	}
+
+	key1, err := mem.GetDataKey(ctx, 1)
+	if err != nil {
+		t.Fatalf("Expected data key for user 1: %v", err)
+	}
+	key2, err := mem.GetDataKey(ctx, 2)
+	if err != nil {
+		t.Fatalf("Expected data key for user 2: %v", err)
+	}
+	if bytes.Equal(key1, key2) {
+		t.Error("Expected different wrapped data keys for different users")
+	}
+
+	raw, _ := mem.GetSecretByID(ctx, 1, 1)
+	if bytes.Contains(raw.Data, []byte("same data")) {
+		t.Error("Expected secret data to be encrypted in the underlying store")
+	}
+
+	master, _ := crypto.NewEncryptor(testEncryptionKey)
+	if _, err := master.Decrypt(raw.Data); err == nil {
+		t.Error("Expected secret data not to be decryptable with the master key directly")
+	}
+
+	// A fresh store has an empty cache and must unwrap the persisted key
+	reopened, _ := NewEncryptedStore(mem, testKeyring(t, testKeySpec))
+	secret, err := reopened.GetSecretByID(ctx, 1, 1)
+	if err != nil {
+		t.Fatalf("Failed to get secret: %v", err)
+	}
+	if string(secret.Data) != "same data" {
+		t.Errorf("Expected 'same data', got '%s'", string(secret.Data))
+	}
+}
+
+// TestEncryptedStoreLegacySecrets tests that secrets encrypted with the master key still decrypt
+func TestEncryptedStoreLegacySecrets(t *testing.T) {
+	ctx := context.Background()
+	mem := NewMemStore()
+	master, _ := crypto.NewEncryptor(testEncryptionKey)
+
+	legacyData, err := master.Encrypt([]byte("legacy data"))
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %v", err)
+	}
+	mem.CreateSecret(ctx, models.Secret{UserID: 1, Data: legacyData})
+
+	store, _ := NewEncryptedStore(mem, testKeyring(t, testKeySpec))
+
+	// Creating a new secret generates a data key; the legacy one must remain readable
+	if _, err := store.CreateSecret(ctx, models.Secret{UserID: 1, Data: []byte("new data")}); err != nil {
+		t.Fatalf("Failed to create secret: %v", err)
+	}
+
+	secrets, err := store.GetSecrets(ctx, 1)
+	if err != nil {
+		t.Fatalf("Failed to get secrets: %v", err)
+	}
+	if len(secrets) != 2 {
+		t.Fatalf("Expected 2 secrets, got %d", len(secrets))
+	}
+	if string(secrets[0].Data) != "legacy data" || string(secrets[1].Data) != "new data" {
+		t.Errorf("Unexpected secret data: %q, %q", secrets[0].Data, secrets[1].Data)
+	}
+}
+
+// TestEncryptedStoreRekey tests that rotating the master key migrates data keys and legacy secrets
+func TestEncryptedStoreRekey(t *testing.T) {
+	ctx := context.Background()
+	mem := NewMemStore()
+	mem.CreateUser(ctx, models.User{Login: "user"})
+
+	master, _ := crypto.NewEncryptor(testEncryptionKey)
+	legacyData, _ := master.Encrypt([]byte("legacy data"))
+	mem.CreateSecret(ctx, models.Secret{UserID: 1, Data: legacyData, Metadata: "legacy metadata"})
+
+	oldStore, _ := NewEncryptedStore(mem, testKeyring(t, testKeySpec))
+	if _, err := oldStore.CreateSecret(ctx, models.Secret{UserID: 1, Data: []byte("new data")}); err != nil {
+		t.Fatalf("Failed to create secret: %v", err)
+	}
+
+	rotated, _ := NewEncryptedStore(mem, testKeyring(t, testKeySpec, rotatedKeySpec))
+
+	var reports int
+	result, err := rotated.Rekey(ctx, func(RekeyProgress) { reports++ })
+	if err != nil {
+		t.Fatalf("Rekey failed: %v", err)
+	}
+	if reports != 1 || result.UsersDone != 1 {
+		t.Errorf("Expected progress for 1 user, got %d reports and %d users", reports, result.UsersDone)
+	}
+	if result.DataKeysRewrapped != 1 || result.SecretsReencrypted != 1 {
+		t.Errorf("Expected 1 rewrapped key and 1 re-encrypted secret, got %+v", result)
+	}
+
+	raw, _ := mem.GetSecretByID(ctx, 1, 1)
+	if !strings.HasPrefix(raw.Metadata, encryptedMetadataPrefix) {
+		t.Errorf("Expected plaintext metadata to be encrypted by rekey, got %q", raw.Metadata)
+	}
+
+	wrappedKey, _ := mem.GetDataKey(ctx, 1)
+	if header, _, ok := crypto.ParseHeader(wrappedKey); !ok || header.KeyID != "2" {
+		t.Errorf("Expected data key to be wrapped with key 2, got %+v", header)
+	}
+
+	// The old master key is no longer needed
+	newOnly, _ := NewEncryptedStore(mem, testKeyring(t, rotatedKeySpec))
+	secrets, err := newOnly.GetSecrets(ctx, 1)
+	if err != nil {
+		t.Fatalf("Failed to get secrets with the new key only: %v", err)
+	}
+	if string(secrets[0].Data) != "legacy data" || string(secrets[1].Data) != "new data" {
+		t.Errorf("Unexpected secret data: %q, %q", secrets[0].Data, secrets[1].Data)
+	}
+	if secrets[0].Metadata != "legacy metadata" {
+		t.Errorf("Expected 'legacy metadata', got %q", secrets[0].Metadata)
+	}
+
+	// A second run has nothing left to do
+	result, err = newOnly.Rekey(ctx, nil)
+	if err != nil || result.DataKeysRewrapped != 0 || result.SecretsReencrypted != 0 {
+		t.Errorf("Expected no-op rekey, got %+v, %v", result, err)
+	}
+}
+
+func testKeyring(t *testing.T, specs ...string) *crypto.Keyring {
+	t.Helper()
+	keyring, err := crypto.ParseKeySpecs(context.Background(), specs, crypto.KeySources{})
+	if err != nil {
+		t.Fatalf("Failed to create keyring: %v", err)
+	}
+	return keyring
+}
+
+// TestEncryptedStoreSwappedCiphertext tests that ciphertexts moved between rows fail to decrypt
+func TestEncryptedStoreSwappedCiphertext(t *testing.T) {
+	ctx := context.Background()
+	mem := NewMemStore()
+	store, _ := NewEncryptedStore(mem, testKeyring(t, testKeySpec))
+
+	first, _ := store.CreateSecret(ctx, models.Secret{UserID: 1, Type: models.TextDataType, Data: []byte("first")})
+	second, _ := store.CreateSecret(ctx, models.Secret{UserID: 1, Type: models.TextDataType, Data: []byte("second")})
+	other, _ := store.CreateSecret(ctx, models.Secret{UserID: 2, Type: models.TextDataType, Data: []byte("other")})
+
+	rawFirst, _ := mem.GetSecretByID(ctx, 1, first.ID)
+	rawOther, _ := mem.GetSecretByID(ctx, 2, other.ID)
+
+	tests := []struct {
+		name     string
+		userID   int
+		secretID int
+		data     []byte
+	}{
+		{name: "moved to another secret of the same user", userID: 1, secretID: second.ID, data: rawFirst.Data},
+		{name: "moved to another user", userID: 1, secretID: second.ID, data: rawOther.Data},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current, _ := mem.GetSecretByID(ctx, tt.userID, tt.secretID)
+			replacement := current
+			replacement.Data = tt.data
+			mem.ReplaceSecret(ctx, current, replacement)
+
+			_, err := store.GetSecretByID(ctx, tt.userID, tt.secretID)
+			var integrityErr ErrSecretIntegrity
+			if !errors.As(err, &integrityErr) || integrityErr.SecretID != tt.secretID {
+				t.Errorf("Expected integrity error for secret %d, got %v", tt.secretID, err)
+			}
+		})
+	}
+
+	// Changing the type of a secret without re-encrypting it is detected as well
+	rawFirst.Type = models.BinaryDataType
+	mem.UpdateSecret(ctx, rawFirst)
+	if _, err := store.GetSecretByID(ctx, 1, first.ID); err == nil {
+		t.Error("Expected integrity error after changing the secret type")
+	}
+}
+
+// TestEncryptedStoreStrictBinding tests the migration path for secrets written before binding
+func TestEncryptedStoreStrictBinding(t *testing.T) {
+	ctx := context.Background()
+	mem := NewMemStore()
+	mem.CreateUser(ctx, models.User{Login: "user"})
+
+	master, _ := crypto.NewEncryptor(testEncryptionKey)
+	unbound, _ := master.Encrypt([]byte("unbound data"))
+	mem.CreateSecret(ctx, models.Secret{UserID: 1, Data: unbound})
+
+	store, _ := NewEncryptedStore(mem, testKeyring(t, testKeySpec))
+	store.SetStrictBinding(true)
+	if _, err := store.GetSecretByID(ctx, 1, 1); err == nil {
+		t.Fatal("Expected unbound secret to be rejected in strict mode")
+	}
+
+	if _, err := store.Rekey(ctx, nil); err != nil {
+		t.Fatalf("Rekey failed: %v", err)
+	}
+
+	secret, err := store.GetSecretByID(ctx, 1, 1)
+	if err != nil {
+		t.Fatalf("Expected migrated secret to be readable in strict mode: %v", err)
+	}
+	if string(secret.Data) != "unbound data" {
+		t.Errorf("Expected 'unbound data', got '%s'", secret.Data)
+	}
+}
+
+// TestEncryptedStoreMetadataSearch tests that metadata is encrypted at rest and still searchable
+func TestEncryptedStoreMetadataSearch(t *testing.T) {
+	for _, blindIndex := range []bool{false, true} {
+		t.Run(fmt.Sprintf("blind index %v", blindIndex), func(t *testing.T) {
+			ctx := context.Background()
+			mem := NewMemStore()
+			store, _ := NewEncryptedStore(mem, testKeyring(t, testKeySpec))
+			store.SetBlindIndex(blindIndex)
+
+			site, _ := store.CreateSecret(ctx, models.Secret{UserID: 1, Data: []byte("a"), Metadata: "Логин для сайта example.com"})
+			store.CreateSecret(ctx, models.Secret{UserID: 1, Data: []byte("b"), Metadata: "Bank card"})
+			store.CreateSecret(ctx, models.Secret{UserID: 2, Data: []byte("c"), Metadata: "Логин для сайта example.com"})
+
+			raw, _ := mem.GetSecretByID(ctx, 1, site.ID)
+			if !strings.HasPrefix(raw.Metadata, encryptedMetadataPrefix) || strings.Contains(raw.Metadata, "example") {
+				t.Errorf("Expected metadata to be encrypted at rest, got %q", raw.Metadata)
+			}
+
+			tests := []struct {
+				name     string
+				query    models.SecretQuery
+				expected []int
+			}{
+				{name: "exact metadata", query: models.SecretQuery{Metadata: "Логин для сайта example.com"}, expected: []int{site.ID}},
+				{name: "partial metadata", query: models.SecretQuery{Metadata: "Логин"}, expected: []int{}},
+				{name: "keyword", query: models.SecretQuery{Keyword: "ЛОГИН"}, expected: []int{site.ID}},
+				{name: "keyword and metadata", query: models.SecretQuery{Keyword: "card", Metadata: "Логин для сайта example.com"}, expected: []int{}},
+				{name: "no match", query: models.SecretQuery{Keyword: "missing"}, expected: []int{}},
+			}
+
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					secrets, err := store.SearchSecrets(ctx, 1, tt.query)
+					if err != nil {
+						t.Fatalf("Search failed: %v", err)
+					}
+					ids := []int{}
+					for _, secret := range secrets {
+						ids = append(ids, secret.ID)
+					}
+					if !slices.Equal(ids, tt.expected) {
+						t.Errorf("Expected secrets %v, got %v", tt.expected, ids)
+					}
+				})
+			}
+
+			// Updated metadata replaces the old index terms
+			site.Metadata = "Renamed"
+			if _, err := store.UpdateSecret(ctx, site); err != nil {
+				t.Fatalf("Failed to update secret: %v", err)
+			}
+			if secrets, _ := store.SearchSecrets(ctx, 1, models.SecretQuery{Keyword: "renamed"}); len(secrets) != 1 {
+				t.Errorf("Expected renamed secret to be found, got %d secrets", len(secrets))
+			}
+			if secrets, _ := store.SearchSecrets(ctx, 1, models.SecretQuery{Keyword: "логин"}); len(secrets) != 0 {
+				t.Errorf("Expected old keyword not to match, got %d secrets", len(secrets))
+			}
+		})
+	}
+}
+
+// TestEncryptedStoreTOTP tests that TOTP secrets are encrypted at rest and bound to their user
+func TestEncryptedStoreTOTP(t *testing.T) {
+	ctx := context.Background()
+	mem := NewMemStore()
+	store, _ := NewEncryptedStore(mem, testKeyring(t, testKeySpec))
+
+	totpSecret := []byte("12345678901234567890")
+	if err := store.SaveTOTP(ctx, models.TOTP{UserID: 1, Secret: totpSecret}); err != nil {
+		t.Fatalf("Failed to save TOTP: %v", err)
+	}
+	if err := store.SaveTOTP(ctx, models.TOTP{UserID: 2, Secret: totpSecret}); err != nil {
+		t.Fatalf("Failed to save TOTP: %v", err)
+	}
+
+	raw, _ := mem.GetTOTP(ctx, 1)
+	if bytes.Contains(raw.Secret, totpSecret) {
+		t.Error("TOTP secret is stored in plaintext")
+	}
+
+	totp, err := store.GetTOTP(ctx, 1)
+	if err != nil {
+		t.Fatalf("Failed to get TOTP: %v", err)
+	}
+	if !bytes.Equal(totp.Secret, totpSecret) {
+		t.Errorf("Expected TOTP secret %q, got %q", totpSecret, totp.Secret)
+	}
+
+	// A ciphertext copied to another user does not decrypt
+	raw.UserID = 2
+	mem.SaveTOTP(ctx, raw)
+	if _, err := store.GetTOTP(ctx, 2); err == nil {
+		t.Error("Expected error for a TOTP secret copied from another user")
+	}
+}
+
+// TestEncryptedStoreRevisions tests that revisions and timestamps pass through encryption
+// and that updates from an old revision are rejected
+func TestEncryptedStoreRevisions(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewEncryptedStore(NewMemStore(), testKeyring(t, testKeySpec))
+	if err != nil {
+		t.Fatalf("Failed to create encrypted store: %v", err)
+	}
+
+	created, err := store.CreateSecret(ctx, models.Secret{UserID: 1, Data: []byte("v1"), Metadata: "note"})
+	if err != nil {
+		t.Fatalf("Failed to create secret: %v", err)
+	}
+	if created.Revision != 1 || created.CreatedAt.IsZero() || !created.UpdatedAt.Equal(created.CreatedAt) {
+		t.Fatalf("Expected revision 1 with timestamps, got %+v", created)
+	}
+
+	update := created
+	update.Data = []byte("v2")
+	updated, err := store.UpdateSecret(ctx, update)
+	if err != nil {
+		t.Fatalf("Failed to update secret: %v", err)
+	}
+	if updated.Revision != 2 || !updated.CreatedAt.Equal(created.CreatedAt) || updated.UpdatedAt.Before(created.UpdatedAt) {
+		t.Errorf("Expected revision 2 with the creation time kept, got %+v", updated)
+	}
+
+	// created is now stale
+	var conflictErr ErrRevisionConflict
+	if _, err := store.UpdateSecret(ctx, created); !errors.As(err, &conflictErr) || conflictErr.Revision != 2 {
+		t.Errorf("Expected a conflict with revision 2, got %v", err)
+	}
+
+	// Updates without a revision are unconditional
+	update.Revision = 0
+	if updated, err := store.UpdateSecret(ctx, update); err != nil || updated.Revision != 3 {
+		t.Errorf("Expected revision 3, got %+v, %v", updated, err)
+	}
+	stored, _ := store.GetSecretByID(ctx, 1, created.ID)
+	if stored.Revision != 3 || string(stored.Data) != "v2" {
+		t.Errorf("Expected the stored secret at revision 3, got %+v", stored)
+	}
+}
+
+// failingIndexStore is a MemStore whose blind index cannot be written
+type failingIndexStore struct {
+	*MemStore
+	created []models.Secret
+}
+
+func (s *failingIndexStore) CreateSecret(ctx context.Context, secret models.Secret) (models.Secret, error) {
+	s.created = append(s.created, secret)
+	return s.MemStore.CreateSecret(ctx, secret)
+}
+
+func (s *failingIndexStore) SetSecretIndex(ctx context.Context, userID, secretID int, terms [][]byte) error {
+	return errors.New("index unavailable")
+}
+
+// TestEncryptedStoreCreateAtomic tests that secrets are inserted encrypted in one step and
+// that a failed creation leaves no secret behind
+func TestEncryptedStoreCreateAtomic(t *testing.T) {
+	ctx := context.Background()
+	mem := &failingIndexStore{MemStore: NewMemStore()}
+	store, err := NewEncryptedStore(mem, testKeyring(t, testKeySpec))
+	if err != nil {
+		t.Fatalf("Failed to create encrypted store: %v", err)
+	}
+
+	created, err := store.CreateSecret(ctx, models.Secret{UserID: 1, Data: []byte("data"), Metadata: "note"})
+	if err != nil {
+		t.Fatalf("Failed to create secret: %v", err)
+	}
+	if len(mem.created) != 1 || mem.created[0].ID != created.ID || len(mem.created[0].Data) == 0 || bytes.Contains(mem.created[0].Data, []byte("data")) {
+		t.Errorf("Expected one insert of the encrypted secret, got %+v", mem.created)
+	}
+
+	store.SetBlindIndex(true)
+	if _, err := store.CreateSecret(ctx, models.Secret{UserID: 1, Data: []byte("unindexed"), Metadata: "note"}); err == nil {
+		t.Fatal("Expected creation to fail without the index")
+	}
+	if secrets, _ := mem.GetSecrets(ctx, 1); len(secrets) != 1 {
+		t.Errorf("Expected only the first secret to be stored, got %d secrets", len(secrets))
+	}
+}
+
+// failingReplaceStore is a MemStore that cannot replace one secret
+type failingReplaceStore struct {
+	*MemStore
+	secretID int
+}
+
+func (s *failingReplaceStore) ReplaceSecret(ctx context.Context, old, new models.Secret) (bool, error) {
+	if old.ID == s.secretID {
+		return false, errors.New("disk full")
+	}
+	return s.MemStore.ReplaceSecret(ctx, old, new)
+}
+
+// TestEncryptedStoreRekeyFailures tests that a secret that cannot be migrated is reported
+// without stopping the run and is migrated by the next run
+func TestEncryptedStoreRekeyFailures(t *testing.T) {
+	ctx := context.Background()
+	mem := NewMemStore()
+	mem.CreateUser(ctx, models.User{Login: "user"})
+	master, _ := crypto.NewEncryptor(testEncryptionKey)
+	for _, data := range []string{"first", "second"} {
+		legacyData, _ := master.Encrypt([]byte(data))
+		mem.CreateSecret(ctx, models.Secret{UserID: 1, Data: legacyData})
+	}
+
+	failing, _ := NewEncryptedStore(&failingReplaceStore{MemStore: mem, secretID: 1}, testKeyring(t, testKeySpec))
+	result, err := failing.Rekey(ctx, nil)
+	var incompleteErr ErrRekeyIncomplete
+	if !errors.As(err, &incompleteErr) || incompleteErr.Secrets != 1 {
+		t.Fatalf("Expected an incomplete rekey with 1 secret, got %v", err)
+	}
+	if !slices.Equal(result.ErrorSecretIDs, []int{1}) || result.SecretsReencrypted != 1 || result.UsersDone != 1 {
+		t.Errorf("Expected secret 1 to fail and secret 2 to be migrated, got %+v", result)
+	}
+
+	store, _ := NewEncryptedStore(mem, testKeyring(t, testKeySpec))
+	result, err = store.Rekey(ctx, nil)
+	if err != nil || result.SecretsReencrypted != 1 || len(result.ErrorSecretIDs) != 0 {
+		t.Errorf("Expected the rerun to migrate secret 1, got %+v, %v", result, err)
+	}
+}
@@ -18,9 +18,13 @@ func NewErrUserExists(login string) ErrUserExists {
 // ErrUserNotFound is returned when a user is not found.
 type ErrUserNotFound struct {
 	Login string
+	ID    int
 }
 
 func (e ErrUserNotFound) Error() string {
+	if e.Login == "" {
+		return fmt.Sprintf("user with ID %d not found", e.ID)
+	}
 	return fmt.Sprintf("user with login '%s' not found", e.Login)
 }
 
@@ -28,6 +32,10 @@ func NewErrUserNotFound(login string) ErrUserNotFound {
 	return ErrUserNotFound{Login: login}
 }
 
+func NewErrUserIDNotFound(id int) ErrUserNotFound {
+	return ErrUserNotFound{ID: id}
+}
+
 // ErrSecretNotFound is returned when a secret is not found.
 type ErrSecretNotFound struct {
 	SecretID int
@@ -40,3 +48,136 @@ func (e ErrSecretNotFound) Error() string {
 func NewErrSecretNotFound(secretID int) ErrSecretNotFound {
 	return ErrSecretNotFound{SecretID: secretID}
 }
+
+// ErrRevisionConflict is returned when a secret is updated from a revision that is not current.
+type ErrRevisionConflict struct {
+	SecretID int
+	// Revision is the current revision of the secret
+	Revision int
+}
+
+func (e ErrRevisionConflict) Error() string {
+	return fmt.Sprintf("secret with ID '%d' was modified, its current revision is %d", e.SecretID, e.Revision)
+}
+
+func NewErrRevisionConflict(secretID, revision int) ErrRevisionConflict {
+	return ErrRevisionConflict{SecretID: secretID, Revision: revision}
+}
+
+// ErrDataKeyNotFound is returned when a user has no data key yet.
+type ErrDataKeyNotFound struct {
+	UserID int
+}
+
+func (e ErrDataKeyNotFound) Error() string {
+	return fmt.Sprintf("data key for user '%d' not found", e.UserID)
+}
+
+func NewErrDataKeyNotFound(userID int) ErrDataKeyNotFound {
+	return ErrDataKeyNotFound{UserID: userID}
+}
+
+// ErrSecretIntegrity is returned when a secret's ciphertext does not belong to it,
+// e.g. because it was copied from another row.
+type ErrSecretIntegrity struct {
+	SecretID int
+}
+
+func (e ErrSecretIntegrity) Error() string {
+	return fmt.Sprintf("secret with ID '%d' failed integrity check", e.SecretID)
+}
+
+func NewErrSecretIntegrity(secretID int) ErrSecretIntegrity {
+	return ErrSecretIntegrity{SecretID: secretID}
+}
+
+// ErrRefreshTokenNotFound is returned when a refresh token does not exist or its family was revoked.
+type ErrRefreshTokenNotFound struct{}
+
+func (e ErrRefreshTokenNotFound) Error() string {
+	return "refresh token not found"
+}
+
+func NewErrRefreshTokenNotFound() ErrRefreshTokenNotFound {
+	return ErrRefreshTokenNotFound{}
+}
+
+// ErrSessionNotFound is returned when a session does not exist or belongs to another user.
+type ErrSessionNotFound struct {
+	SessionID string
+}
+
+func (e ErrSessionNotFound) Error() string {
+	return fmt.Sprintf("session '%s' not found", e.SessionID)
+}
+
+func NewErrSessionNotFound(sessionID string) ErrSessionNotFound {
+	return ErrSessionNotFound{SessionID: sessionID}
+}
+
+// ErrTOTPNotFound is returned when a user has not enrolled in two-factor authentication.
+type ErrTOTPNotFound struct {
+	UserID int
+}
+
+func (e ErrTOTPNotFound) Error() string {
+	return fmt.Sprintf("two-factor authentication not configured for user %d", e.UserID)
+}
+
+func NewErrTOTPNotFound(userID int) ErrTOTPNotFound {
+	return ErrTOTPNotFound{UserID: userID}
+}
+
+// ErrAPITokenNotFound is returned when an API token does not exist or belongs to another user.
+type ErrAPITokenNotFound struct {
+	TokenID string
+}
+
+func (e ErrAPITokenNotFound) Error() string {
+	if e.TokenID == "" {
+		return "API token not found"
+	}
+	return fmt.Sprintf("API token '%s' not found", e.TokenID)
+}
+
+func NewErrAPITokenNotFound(tokenID string) ErrAPITokenNotFound {
+	return ErrAPITokenNotFound{TokenID: tokenID}
+}
+
+// ErrInviteNotFound is returned when an invite does not exist.
+type ErrInviteNotFound struct {
+	InviteID string
+}
+
+func (e ErrInviteNotFound) Error() string {
+	return fmt.Sprintf("invite '%s' not found", e.InviteID)
+}
+
+func NewErrInviteNotFound(inviteID string) ErrInviteNotFound {
+	return ErrInviteNotFound{InviteID: inviteID}
+}
+
+// ErrInvalidInvite is returned when an invite code matches no unused, unexpired invite.
+type ErrInvalidInvite struct{}
+
+func (e ErrInvalidInvite) Error() string {
+	return "invalid, used or expired invite code"
+}
+
+func NewErrInvalidInvite() ErrInvalidInvite {
+	return ErrInvalidInvite{}
+}
+
+// ErrIdentityNotFound is returned when no user is linked to an identity provider account.
+type ErrIdentityNotFound struct {
+	Issuer  string
+	Subject string
+}
+
+func (e ErrIdentityNotFound) Error() string {
+	return fmt.Sprintf("no user linked to '%s' at '%s'", e.Subject, e.Issuer)
+}
+
+func NewErrIdentityNotFound(issuer, subject string) ErrIdentityNotFound {
+	return ErrIdentityNotFound{Issuer: issuer, Subject: subject}
+}
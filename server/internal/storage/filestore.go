@@ -1,27 +1,57 @@
 package storage
 
 import (
+	"bytes"
 	"context"
 	"gophkeeper/server/internal/models"
+	"slices"
+	"sort"
 	"sync"
+	"time"
 )
 
 // MemStore is an in-memory data store.
 type MemStore struct {
-	mu           sync.RWMutex
-	users        map[string]models.User  // map[login]User
-	secrets      map[int][]models.Secret // map[userID][]Secret
-	nextUserID   int
-	nextSecretID int
+	mu            sync.RWMutex
+	users         map[string]models.User          // map[login]User
+	secrets       map[int][]models.Secret         // map[userID][]Secret
+	dataKeys      map[int][]byte                  // map[userID]wrapped data key
+	keySalts      map[string][]byte               // map[keyID]salt
+	sealConfigs   map[string][]byte               // map[keyID]seal configuration
+	refreshTokens map[string]models.RefreshToken  // map[tokenHash]RefreshToken
+	revokedTokens map[string]time.Time            // map[tokenID]expiresAt
+	sessions      map[string]models.Session       // map[sessionID]Session
+	apiTokens     map[string]models.APIToken      // map[tokenID]APIToken
+	identities    map[string]models.UserIdentity  // map[identityKey]UserIdentity
+	totps         map[int]models.TOTP             // map[userID]TOTP
+	loginAttempts map[string]models.LoginAttempts // map[key]LoginAttempts
+	secretIndex   map[int][][]byte                // map[secretID]blind index terms
+	invites       map[string]models.Invite        // map[inviteID]Invite
+	recoveryCodes map[int][][]byte                // map[userID]account recovery code hashes
+	nextUserID    int
+	nextSecretID  int
 }
 
 // NewMemStore creates and returns a new MemStore.
 func NewMemStore() *MemStore {
 	return &MemStore{
-		users:        make(map[string]models.User),
-		secrets:      make(map[int][]models.Secret),
-		nextUserID:   1,
-		nextSecretID: 1,
+		users:         make(map[string]models.User),
+		secrets:       make(map[int][]models.Secret),
+		dataKeys:      make(map[int][]byte),
+		keySalts:      make(map[string][]byte),
+		sealConfigs:   make(map[string][]byte),
+		refreshTokens: make(map[string]models.RefreshToken),
+		revokedTokens: make(map[string]time.Time),
+		sessions:      make(map[string]models.Session),
+		apiTokens:     make(map[string]models.APIToken),
+		identities:    make(map[string]models.UserIdentity),
+		totps:         make(map[int]models.TOTP),
+		loginAttempts: make(map[string]models.LoginAttempts),
+		secretIndex:   make(map[int][][]byte),
+		invites:       make(map[string]models.Invite),
+		recoveryCodes: make(map[int][][]byte),
+		nextUserID:    1,
+		nextSecretID:  1,
 	}
 }
 
@@ -60,6 +90,115 @@ func (s *MemStore) GetUserByLogin(ctx context.Context, login string) (models.Use
 	return user, nil
 }
 
+// GetUserByID retrieves a user by their ID.
+func (s *MemStore) GetUserByID(ctx context.Context, id int) (models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return models.User{}, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, user := range s.users {
+		if user.ID == id {
+			return user, nil
+		}
+	}
+	return models.User{}, NewErrUserIDNotFound(id)
+}
+
+// SetUserPassword replaces the password hash of a user.
+func (s *MemStore) SetUserPassword(ctx context.Context, userID int, password string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for login, user := range s.users {
+		if user.ID == userID {
+			user.Password = password
+			s.users[login] = user
+			return nil
+		}
+	}
+	return NewErrUserIDNotFound(userID)
+}
+
+// SetUserRoles replaces the roles of a user.
+func (s *MemStore) SetUserRoles(ctx context.Context, userID int, roles []string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for login, user := range s.users {
+		if user.ID == userID {
+			user.Roles = slices.Clone(roles)
+			s.users[login] = user
+			return nil
+		}
+	}
+	return NewErrUserIDNotFound(userID)
+}
+
+// GetUserByIdentity returns the user linked to an account at an identity provider.
+func (s *MemStore) GetUserByIdentity(ctx context.Context, issuer, subject string) (models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return models.User{}, err
+	}
+	s.mu.RLock()
+	identity, exists := s.identities[identityKey(issuer, subject)]
+	s.mu.RUnlock()
+
+	if !exists {
+		return models.User{}, NewErrIdentityNotFound(issuer, subject)
+	}
+	return s.GetUserByID(ctx, identity.UserID)
+}
+
+// LinkIdentity links an identity provider account to a user unless it is already linked
+// and returns the link that is persisted.
+func (s *MemStore) LinkIdentity(ctx context.Context, identity models.UserIdentity) (models.UserIdentity, error) {
+	if err := ctx.Err(); err != nil {
+		return models.UserIdentity{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := identityKey(identity.Issuer, identity.Subject)
+	if existing, exists := s.identities[key]; exists {
+		return existing, nil
+	}
+	s.identities[key] = identity
+	return identity, nil
+}
+
+// identityKey is the key of an identity provider account in MemStore.identities.
+func identityKey(issuer, subject string) string {
+	return issuer + "\x00" + subject
+}
+
+// GetUserIDs retrieves the IDs of all users.
+func (s *MemStore) GetUserIDs(ctx context.Context) ([]int, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	userIDs := make([]int, 0, len(s.users))
+	for _, user := range s.users {
+		userIDs = append(userIDs, user.ID)
+	}
+	sort.Ints(userIDs)
+	return userIDs, nil
+}
+
 // CreateSecret adds a new secret for a user.
 func (s *MemStore) CreateSecret(ctx context.Context, secret models.Secret) (models.Secret, error) {
 	if err := ctx.Err(); err != nil {
@@ -68,12 +207,30 @@ func (s *MemStore) CreateSecret(ctx context.Context, secret models.Secret) (mode
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	secret.ID = s.nextSecretID
+	if secret.ID == 0 {
+		secret.ID = s.nextSecretID
+		s.nextSecretID++
+	}
+	secret.CreatedAt = time.Now()
+	secret.UpdatedAt = secret.CreatedAt
+	secret.Revision = 1
 	s.secrets[secret.UserID] = append(s.secrets[secret.UserID], secret)
-	s.nextSecretID++
 	return secret, nil
 }
 
+// NextSecretID reserves the ID of a secret that is created later.
+func (s *MemStore) NextSecretID(ctx context.Context) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := s.nextSecretID
+	s.nextSecretID++
+	return id, nil
+}
+
 // GetSecrets retrieves all secrets for a specific user.
 func (s *MemStore) GetSecrets(ctx context.Context, userID int) ([]models.Secret, error) {
 	if err := ctx.Err(); err != nil {
@@ -86,7 +243,11 @@ func (s *MemStore) GetSecrets(ctx context.Context, userID int) ([]models.Secret,
 	if !exists {
 		return []models.Secret{}, nil
 	}
-	return userSecrets, nil
+
+	// Return a copy so callers cannot modify the stored secrets
+	result := make([]models.Secret, len(userSecrets))
+	copy(result, userSecrets)
+	return result, nil
 }
 
 // GetSecretByID retrieves a specific secret for a user by its ID.
@@ -118,6 +279,12 @@ func (s *MemStore) UpdateSecret(ctx context.Context, secret models.Secret) (mode
 	if userSecrets, exists := s.secrets[secret.UserID]; exists {
 		for i, sct := range userSecrets {
 			if sct.ID == secret.ID {
+				if secret.Revision != 0 && secret.Revision != sct.Revision {
+					return models.Secret{}, NewErrRevisionConflict(secret.ID, sct.Revision)
+				}
+				secret.CreatedAt = sct.CreatedAt
+				secret.UpdatedAt = time.Now()
+				secret.Revision = sct.Revision + 1
 				s.secrets[secret.UserID][i] = secret
 				return secret, nil
 			}
@@ -139,9 +306,726 @@ func (s *MemStore) DeleteSecret(ctx context.Context, userID, secretID int) error
 		for i, secret := range userSecrets {
 			if secret.ID == secretID {
 				s.secrets[userID] = append(userSecrets[:i], userSecrets[i+1:]...)
+				delete(s.secretIndex, secretID)
 				return nil
 			}
 		}
 	}
 	return NewErrSecretNotFound(secretID)
 }
+
+// SearchSecrets retrieves the secrets of a user that satisfy the query.
+func (s *MemStore) SearchSecrets(ctx context.Context, userID int, query models.SecretQuery) ([]models.Secret, error) {
+	secrets, err := s.GetSecrets(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return filterSecrets(secrets, query), nil
+}
+
+// ReplaceSecret sets the data and metadata of a secret if they have not changed since it was read.
+func (s *MemStore) ReplaceSecret(ctx context.Context, old, new models.Secret) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, secret := range s.secrets[old.UserID] {
+		if secret.ID == old.ID {
+			if !bytes.Equal(secret.Data, old.Data) || secret.Metadata != old.Metadata {
+				return false, nil
+			}
+			s.secrets[old.UserID][i].Data = new.Data
+			s.secrets[old.UserID][i].Metadata = new.Metadata
+			return true, nil
+		}
+	}
+	return false, NewErrSecretNotFound(old.ID)
+}
+
+// SetSecretIndex replaces the blind index terms of a secret.
+func (s *MemStore) SetSecretIndex(ctx context.Context, userID, secretID int, terms [][]byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, secret := range s.secrets[userID] {
+		if secret.ID == secretID {
+			s.secretIndex[secretID] = terms
+			return nil
+		}
+	}
+	return NewErrSecretNotFound(secretID)
+}
+
+// GetSecretIDsByIndex retrieves the IDs of the secrets of a user indexed with the term.
+func (s *MemStore) GetSecretIDsByIndex(ctx context.Context, userID int, term []byte) ([]int, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	secretIDs := []int{}
+	for _, secret := range s.secrets[userID] {
+		for _, indexed := range s.secretIndex[secret.ID] {
+			if bytes.Equal(indexed, term) {
+				secretIDs = append(secretIDs, secret.ID)
+				break
+			}
+		}
+	}
+	return secretIDs, nil
+}
+
+// GetDataKey retrieves the wrapped data key of a user.
+func (s *MemStore) GetDataKey(ctx context.Context, userID int) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	wrappedKey, exists := s.dataKeys[userID]
+	if !exists {
+		return nil, NewErrDataKeyNotFound(userID)
+	}
+	return wrappedKey, nil
+}
+
+// CreateDataKey stores a wrapped data key for a user unless one already exists.
+func (s *MemStore) CreateDataKey(ctx context.Context, userID int, wrappedKey []byte) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, exists := s.dataKeys[userID]; exists {
+		return existing, nil
+	}
+	s.dataKeys[userID] = wrappedKey
+	return wrappedKey, nil
+}
+
+// ReplaceDataKey sets the wrapped data key of a user if it has not changed since it was read.
+func (s *MemStore) ReplaceDataKey(ctx context.Context, userID int, oldKey, newKey []byte) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, exists := s.dataKeys[userID]
+	if !exists {
+		return false, NewErrDataKeyNotFound(userID)
+	}
+	if !bytes.Equal(existing, oldKey) {
+		return false, nil
+	}
+	s.dataKeys[userID] = newKey
+	return true, nil
+}
+
+// CreateKeySalt stores the salt of a master key unless one already exists.
+func (s *MemStore) CreateKeySalt(ctx context.Context, keyID string, salt []byte) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, exists := s.keySalts[keyID]; exists {
+		return existing, nil
+	}
+	s.keySalts[keyID] = salt
+	return salt, nil
+}
+
+// GetSealConfig retrieves the configuration of a sealed master key, or nil if there is none.
+func (s *MemStore) GetSealConfig(ctx context.Context, keyID string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.sealConfigs[keyID], nil
+}
+
+// CreateSealConfig stores the configuration of a sealed master key unless one already exists.
+func (s *MemStore) CreateSealConfig(ctx context.Context, keyID string, config []byte) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, exists := s.sealConfigs[keyID]; exists {
+		return existing, nil
+	}
+	s.sealConfigs[keyID] = config
+	return config, nil
+}
+
+// CreateRefreshToken stores a new refresh token.
+func (s *MemStore) CreateRefreshToken(ctx context.Context, token models.RefreshToken) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.refreshTokens[string(token.TokenHash)] = token
+	return nil
+}
+
+// GetRefreshToken returns a refresh token without using it.
+func (s *MemStore) GetRefreshToken(ctx context.Context, tokenHash []byte) (models.RefreshToken, error) {
+	if err := ctx.Err(); err != nil {
+		return models.RefreshToken{}, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	token, exists := s.refreshTokens[string(tokenHash)]
+	if !exists {
+		return models.RefreshToken{}, NewErrRefreshTokenNotFound()
+	}
+	return token, nil
+}
+
+// UseRefreshToken marks a refresh token as used and returns it with its previous Used state.
+func (s *MemStore) UseRefreshToken(ctx context.Context, tokenHash []byte) (models.RefreshToken, error) {
+	if err := ctx.Err(); err != nil {
+		return models.RefreshToken{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, exists := s.refreshTokens[string(tokenHash)]
+	if !exists {
+		return models.RefreshToken{}, NewErrRefreshTokenNotFound()
+	}
+
+	used := token
+	used.Used = true
+	s.refreshTokens[string(tokenHash)] = used
+	return token, nil
+}
+
+// RevokeRefreshTokenFamily deletes all refresh tokens of a family.
+func (s *MemStore) RevokeRefreshTokenFamily(ctx context.Context, familyID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for hash, token := range s.refreshTokens {
+		if token.FamilyID == familyID {
+			delete(s.refreshTokens, hash)
+		}
+	}
+	return nil
+}
+
+// RevokeToken records an access token ID as revoked until the token expires.
+func (s *MemStore) RevokeToken(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.revokedTokens[tokenID] = expiresAt
+	return nil
+}
+
+// RevokeTokenOnce records an access token ID as revoked and reports false if it was revoked already.
+func (s *MemStore) RevokeTokenOnce(ctx context.Context, tokenID string, expiresAt time.Time) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.revokedTokens[tokenID]; ok {
+		return false, nil
+	}
+	s.revokedTokens[tokenID] = expiresAt
+	return true, nil
+}
+
+// IsTokenRevoked reports whether an access token ID has been revoked.
+func (s *MemStore) IsTokenRevoked(ctx context.Context, tokenID string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, revoked := s.revokedTokens[tokenID]
+	return revoked, nil
+}
+
+// DeleteExpiredRevokedTokens removes revocations of tokens that expired before now.
+func (s *MemStore) DeleteExpiredRevokedTokens(ctx context.Context, now time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for tokenID, expiresAt := range s.revokedTokens {
+		if expiresAt.Before(now) {
+			delete(s.revokedTokens, tokenID)
+		}
+	}
+	return nil
+}
+
+// CreateSession stores a new session.
+func (s *MemStore) CreateSession(ctx context.Context, session models.Session) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sessions[session.ID] = session
+	return nil
+}
+
+// GetSessions returns the sessions of a user, most recently seen first.
+func (s *MemStore) GetSessions(ctx context.Context, userID int) ([]models.Session, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sessions := []models.Session{}
+	for _, session := range s.sessions {
+		if session.UserID == userID {
+			sessions = append(sessions, session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt)
+	})
+	return sessions, nil
+}
+
+// TouchSession records activity of a session from the given IP address.
+func (s *MemStore) TouchSession(ctx context.Context, sessionID, ip string, seenAt time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, exists := s.sessions[sessionID]
+	if !exists {
+		return NewErrSessionNotFound(sessionID)
+	}
+	session.IP = ip
+	session.LastSeenAt = seenAt
+	s.sessions[sessionID] = session
+	return nil
+}
+
+// DeleteSession deletes a session of a user together with its refresh tokens.
+func (s *MemStore) DeleteSession(ctx context.Context, userID int, sessionID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, exists := s.sessions[sessionID]
+	if !exists || session.UserID != userID {
+		return NewErrSessionNotFound(sessionID)
+	}
+	delete(s.sessions, sessionID)
+
+	for hash, token := range s.refreshTokens {
+		if token.FamilyID == sessionID {
+			delete(s.refreshTokens, hash)
+		}
+	}
+	return nil
+}
+
+// CreateAPIToken stores a new API token.
+func (s *MemStore) CreateAPIToken(ctx context.Context, token models.APIToken) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.apiTokens[token.ID] = token
+	return nil
+}
+
+// GetAPITokens returns the API tokens of a user, newest first.
+func (s *MemStore) GetAPITokens(ctx context.Context, userID int) ([]models.APIToken, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tokens := []models.APIToken{}
+	for _, token := range s.apiTokens {
+		if token.UserID == userID {
+			tokens = append(tokens, token)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].CreatedAt.After(tokens[j].CreatedAt)
+	})
+	return tokens, nil
+}
+
+// GetAPITokenByHash returns the API token with the given hash.
+func (s *MemStore) GetAPITokenByHash(ctx context.Context, tokenHash []byte) (models.APIToken, error) {
+	if err := ctx.Err(); err != nil {
+		return models.APIToken{}, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, token := range s.apiTokens {
+		if bytes.Equal(token.TokenHash, tokenHash) {
+			return token, nil
+		}
+	}
+	return models.APIToken{}, NewErrAPITokenNotFound("")
+}
+
+// TouchAPIToken records the use of an API token.
+func (s *MemStore) TouchAPIToken(ctx context.Context, tokenID string, usedAt time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, exists := s.apiTokens[tokenID]
+	if !exists {
+		return NewErrAPITokenNotFound(tokenID)
+	}
+	token.LastUsedAt = &usedAt
+	s.apiTokens[tokenID] = token
+	return nil
+}
+
+// DeleteAPIToken revokes an API token of a user.
+func (s *MemStore) DeleteAPIToken(ctx context.Context, userID int, tokenID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, exists := s.apiTokens[tokenID]
+	if !exists || token.UserID != userID {
+		return NewErrAPITokenNotFound(tokenID)
+	}
+	delete(s.apiTokens, tokenID)
+	return nil
+}
+
+// CreateInvite stores a new invite.
+func (s *MemStore) CreateInvite(ctx context.Context, invite models.Invite) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.invites[invite.ID] = invite
+	return nil
+}
+
+// GetInvites returns all invites, newest first.
+func (s *MemStore) GetInvites(ctx context.Context) ([]models.Invite, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	invites := []models.Invite{}
+	for _, invite := range s.invites {
+		invites = append(invites, invite)
+	}
+	sort.Slice(invites, func(i, j int) bool {
+		return invites[i].CreatedAt.After(invites[j].CreatedAt)
+	})
+	return invites, nil
+}
+
+// CreateUserWithInvite creates a user and marks an unused, unexpired invite as used by it.
+func (s *MemStore) CreateUserWithInvite(ctx context.Context, user models.User, codeHash []byte, now time.Time) (models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return models.User{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	inviteID := ""
+	for id, invite := range s.invites {
+		if bytes.Equal(invite.CodeHash, codeHash) && invite.UsedAt == nil && now.Before(invite.ExpiresAt) {
+			inviteID = id
+			break
+		}
+	}
+	if inviteID == "" {
+		return models.User{}, NewErrInvalidInvite()
+	}
+	if _, exists := s.users[user.Login]; exists {
+		return models.User{}, NewErrUserExists(user.Login)
+	}
+
+	user.ID = s.nextUserID
+	s.users[user.Login] = user
+	s.nextUserID++
+
+	invite := s.invites[inviteID]
+	invite.UsedBy, invite.UsedAt = user.Login, &now
+	s.invites[inviteID] = invite
+	return user, nil
+}
+
+// DeleteInvite revokes an invite.
+func (s *MemStore) DeleteInvite(ctx context.Context, inviteID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.invites[inviteID]; !exists {
+		return NewErrInviteNotFound(inviteID)
+	}
+	delete(s.invites, inviteID)
+	return nil
+}
+
+// SaveTOTP creates or replaces the two-factor enrollment of a user.
+func (s *MemStore) SaveTOTP(ctx context.Context, totp models.TOTP) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.totps[totp.UserID] = totp
+	return nil
+}
+
+// GetTOTP returns the two-factor enrollment of a user.
+func (s *MemStore) GetTOTP(ctx context.Context, userID int) (models.TOTP, error) {
+	if err := ctx.Err(); err != nil {
+		return models.TOTP{}, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	totp, exists := s.totps[userID]
+	if !exists {
+		return models.TOTP{}, NewErrTOTPNotFound(userID)
+	}
+	return totp, nil
+}
+
+// DeleteTOTP removes the two-factor enrollment of a user.
+func (s *MemStore) DeleteTOTP(ctx context.Context, userID int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.totps[userID]; !exists {
+		return NewErrTOTPNotFound(userID)
+	}
+	delete(s.totps, userID)
+	return nil
+}
+
+// UseTOTPStep records the time step of an accepted code.
+func (s *MemStore) UseTOTPStep(ctx context.Context, userID int, step int64) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	totp, exists := s.totps[userID]
+	if !exists {
+		return false, NewErrTOTPNotFound(userID)
+	}
+	if step <= totp.LastUsedStep {
+		return false, nil
+	}
+	totp.LastUsedStep = step
+	s.totps[userID] = totp
+	return true, nil
+}
+
+// UseRecoveryCode removes an unused recovery code.
+func (s *MemStore) UseRecoveryCode(ctx context.Context, userID int, codeHash []byte) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	totp, exists := s.totps[userID]
+	if !exists {
+		return false, NewErrTOTPNotFound(userID)
+	}
+	for i, code := range totp.RecoveryCodes {
+		if bytes.Equal(code, codeHash) {
+			// Copy so that slices returned by GetTOTP are not modified
+			totp.RecoveryCodes = append(totp.RecoveryCodes[:i:i], totp.RecoveryCodes[i+1:]...)
+			s.totps[userID] = totp
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// SetAccountRecoveryCodes replaces the account recovery codes of a user.
+func (s *MemStore) SetAccountRecoveryCodes(ctx context.Context, userID int, codeHashes [][]byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.recoveryCodes[userID] = slices.Clone(codeHashes)
+	return nil
+}
+
+// CountAccountRecoveryCodes returns the number of unused account recovery codes of a user.
+func (s *MemStore) CountAccountRecoveryCodes(ctx context.Context, userID int) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.recoveryCodes[userID]), nil
+}
+
+// UseAccountRecoveryCode removes an unused account recovery code.
+func (s *MemStore) UseAccountRecoveryCode(ctx context.Context, userID int, codeHash []byte) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	codes := s.recoveryCodes[userID]
+	for i, code := range codes {
+		if bytes.Equal(code, codeHash) {
+			s.recoveryCodes[userID] = slices.Delete(codes, i, i+1)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// GetLoginAttempts returns the failed login attempts recorded for a key.
+func (s *MemStore) GetLoginAttempts(ctx context.Context, key string) (models.LoginAttempts, error) {
+	if err := ctx.Err(); err != nil {
+		return models.LoginAttempts{}, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	attempts, exists := s.loginAttempts[key]
+	if !exists {
+		return models.LoginAttempts{Key: key}, nil
+	}
+	return attempts, nil
+}
+
+// RecordLoginFailure counts a failed login for a key.
+func (s *MemStore) RecordLoginFailure(ctx context.Context, key string, now, resetBefore time.Time) (models.LoginAttempts, error) {
+	if err := ctx.Err(); err != nil {
+		return models.LoginAttempts{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempts, exists := s.loginAttempts[key]
+	if !exists {
+		attempts = models.LoginAttempts{Key: key}
+	}
+	if attempts.LastFailure.Before(resetBefore) {
+		attempts.Failures = 0
+	}
+	attempts.Failures++
+	attempts.LastFailure = now
+	s.loginAttempts[key] = attempts
+	return attempts, nil
+}
+
+// LockLogin rejects logins for a key until the given time.
+func (s *MemStore) LockLogin(ctx context.Context, key string, until time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempts, exists := s.loginAttempts[key]
+	if !exists {
+		attempts = models.LoginAttempts{Key: key}
+	}
+	if until.After(attempts.LockedUntil) {
+		attempts.LockedUntil = until
+	}
+	s.loginAttempts[key] = attempts
+	return nil
+}
+
+// ResetLoginAttempts forgets the failures and lock of a key.
+func (s *MemStore) ResetLoginAttempts(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.loginAttempts, key)
+	return nil
+}
+
+// DeleteStaleLoginAttempts removes entries that are no longer relevant.
+func (s *MemStore) DeleteStaleLoginAttempts(ctx context.Context, before, now time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, attempts := range s.loginAttempts {
+		if attempts.LastFailure.Before(before) && !attempts.LockedUntil.After(now) {
+			delete(s.loginAttempts, key)
+		}
+	}
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"gophkeeper/server/internal/models"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
@@ -55,6 +56,16 @@ func (s *PostgresStore) initSchema(ctx context.Context) error {
 			login VARCHAR(255) UNIQUE NOT NULL,
 			password VARCHAR(255) NOT NULL
 		)`,
+		// Password hashes may be longer than 255 bytes. The type is changed only once, because
+		// ALTER COLUMN TYPE rewrites the table under an exclusive lock
+		`DO $$ BEGIN
+			IF EXISTS (SELECT 1 FROM information_schema.columns
+				WHERE table_schema = current_schema() AND table_name = 'users'
+					AND column_name = 'password' AND data_type <> 'text') THEN
+				ALTER TABLE users ALTER COLUMN password TYPE TEXT;
+			END IF;
+		END $$`,
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS roles TEXT[] NOT NULL DEFAULT '{}'`,
 		`CREATE TABLE IF NOT EXISTS secrets (
 			id SERIAL PRIMARY KEY,
 			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
@@ -63,6 +74,106 @@ func (s *PostgresStore) initSchema(ctx context.Context) error {
 			metadata TEXT
 		)`,
 		`CREATE INDEX IF NOT EXISTS idx_secrets_user_id ON secrets(user_id)`,
+		`ALTER TABLE secrets ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()`,
+		`ALTER TABLE secrets ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()`,
+		`ALTER TABLE secrets ADD COLUMN IF NOT EXISTS revision INTEGER NOT NULL DEFAULT 1`,
+		`CREATE TABLE IF NOT EXISTS data_keys (
+			user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+			wrapped_key BYTEA NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)`,
+		`CREATE TABLE IF NOT EXISTS secret_index (
+			secret_id INTEGER NOT NULL REFERENCES secrets(id) ON DELETE CASCADE,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			term BYTEA NOT NULL,
+			PRIMARY KEY (secret_id, term)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_secret_index_user_term ON secret_index(user_id, term)`,
+		`CREATE TABLE IF NOT EXISTS key_salts (
+			key_id VARCHAR(255) PRIMARY KEY,
+			salt BYTEA NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS seal_configs (
+			key_id VARCHAR(255) PRIMARY KEY,
+			config BYTEA NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS refresh_tokens (
+			token_hash BYTEA PRIMARY KEY,
+			family_id VARCHAR(64) NOT NULL,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			created_at TIMESTAMPTZ NOT NULL,
+			expires_at TIMESTAMPTZ NOT NULL,
+			used BOOLEAN NOT NULL DEFAULT FALSE
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family ON refresh_tokens(family_id)`,
+		`CREATE TABLE IF NOT EXISTS revoked_tokens (
+			token_id VARCHAR(64) PRIMARY KEY,
+			expires_at TIMESTAMPTZ NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_revoked_tokens_expires ON revoked_tokens(expires_at)`,
+		`CREATE TABLE IF NOT EXISTS sessions (
+			id VARCHAR(64) PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			device_name VARCHAR(255) NOT NULL,
+			client_version VARCHAR(255) NOT NULL,
+			ip VARCHAR(64) NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL,
+			last_seen_at TIMESTAMPTZ NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id)`,
+		`CREATE TABLE IF NOT EXISTS user_identities (
+			issuer VARCHAR(255) NOT NULL,
+			subject VARCHAR(255) NOT NULL,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			created_at TIMESTAMPTZ NOT NULL,
+			PRIMARY KEY (issuer, subject)
+		)`,
+		`CREATE TABLE IF NOT EXISTS api_tokens (
+			id VARCHAR(64) PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			name VARCHAR(255) NOT NULL,
+			service_account VARCHAR(255) NOT NULL DEFAULT '',
+			token_hash BYTEA NOT NULL UNIQUE,
+			read_only BOOLEAN NOT NULL DEFAULT FALSE,
+			secret_ids INTEGER[],
+			keywords TEXT[],
+			created_at TIMESTAMPTZ NOT NULL,
+			expires_at TIMESTAMPTZ,
+			last_used_at TIMESTAMPTZ
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_api_tokens_user_id ON api_tokens(user_id)`,
+		`CREATE TABLE IF NOT EXISTS user_totp (
+			user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+			secret BYTEA NOT NULL,
+			enabled BOOLEAN NOT NULL DEFAULT FALSE,
+			last_used_step BIGINT NOT NULL DEFAULT 0,
+			created_at TIMESTAMPTZ NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS login_attempts (
+			key VARCHAR(320) PRIMARY KEY,
+			failures INTEGER NOT NULL,
+			last_failure TIMESTAMPTZ NOT NULL,
+			locked_until TIMESTAMPTZ NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS totp_recovery_codes (
+			user_id INTEGER NOT NULL REFERENCES user_totp(user_id) ON DELETE CASCADE,
+			code_hash BYTEA NOT NULL,
+			PRIMARY KEY (user_id, code_hash)
+		)`,
+		`CREATE TABLE IF NOT EXISTS account_recovery_codes (
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			code_hash BYTEA NOT NULL,
+			PRIMARY KEY (user_id, code_hash)
+		)`,
+		`CREATE TABLE IF NOT EXISTS invites (
+			id VARCHAR(64) PRIMARY KEY,
+			code_hash BYTEA NOT NULL UNIQUE,
+			created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+			created_at TIMESTAMPTZ NOT NULL,
+			expires_at TIMESTAMPTZ NOT NULL,
+			used_by VARCHAR(255) NOT NULL DEFAULT '',
+			used_at TIMESTAMPTZ
+		)`,
 	}
 
 	for _, query := range queries {
@@ -95,10 +206,10 @@ func (s *PostgresStore) CreateUser(ctx context.Context, user models.User) (model
 // GetUserByLogin retrieves a user by their login.
 func (s *PostgresStore) GetUserByLogin(ctx context.Context, login string) (models.User, error) {
 
-	query := `SELECT id, login, password FROM users WHERE login = $1`
+	query := `SELECT id, login, password, roles FROM users WHERE login = $1`
 
 	var user models.User
-	err := s.pool.QueryRow(ctx, query, login).Scan(&user.ID, &user.Login, &user.Password)
+	err := s.pool.QueryRow(ctx, query, login).Scan(&user.ID, &user.Login, &user.Password, &user.Roles)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return models.User{}, NewErrUserNotFound(login)
@@ -109,12 +220,124 @@ func (s *PostgresStore) GetUserByLogin(ctx context.Context, login string) (model
 	return user, nil
 }
 
+// GetUserByID retrieves a user by their ID.
+func (s *PostgresStore) GetUserByID(ctx context.Context, id int) (models.User, error) {
+
+	query := `SELECT id, login, password, roles FROM users WHERE id = $1`
+
+	var user models.User
+	err := s.pool.QueryRow(ctx, query, id).Scan(&user.ID, &user.Login, &user.Password, &user.Roles)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.User{}, NewErrUserIDNotFound(id)
+		}
+		return models.User{}, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	return user, nil
+}
+
+// SetUserPassword replaces the password hash of a user.
+func (s *PostgresStore) SetUserPassword(ctx context.Context, userID int, password string) error {
+
+	tag, err := s.pool.Exec(ctx, `UPDATE users SET password = $1 WHERE id = $2`, password, userID)
+	if err != nil {
+		return fmt.Errorf("failed to set user password: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return NewErrUserIDNotFound(userID)
+	}
+
+	return nil
+}
+
+// SetUserRoles replaces the roles of a user.
+func (s *PostgresStore) SetUserRoles(ctx context.Context, userID int, roles []string) error {
+
+	if roles == nil {
+		roles = []string{}
+	}
+	tag, err := s.pool.Exec(ctx, `UPDATE users SET roles = $1 WHERE id = $2`, roles, userID)
+	if err != nil {
+		return fmt.Errorf("failed to set user roles: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return NewErrUserIDNotFound(userID)
+	}
+
+	return nil
+}
+
+// GetUserByIdentity returns the user linked to an account at an identity provider.
+func (s *PostgresStore) GetUserByIdentity(ctx context.Context, issuer, subject string) (models.User, error) {
+
+	query := `SELECT u.id, u.login, u.password, u.roles FROM users u
+		JOIN user_identities i ON i.user_id = u.id WHERE i.issuer = $1 AND i.subject = $2`
+
+	var user models.User
+	err := s.pool.QueryRow(ctx, query, issuer, subject).Scan(&user.ID, &user.Login, &user.Password, &user.Roles)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.User{}, NewErrIdentityNotFound(issuer, subject)
+		}
+		return models.User{}, fmt.Errorf("failed to get user by identity: %w", err)
+	}
+
+	return user, nil
+}
+
+// LinkIdentity links an identity provider account to a user unless it is already linked
+// and returns the link that is persisted.
+func (s *PostgresStore) LinkIdentity(ctx context.Context, identity models.UserIdentity) (models.UserIdentity, error) {
+
+	query := `INSERT INTO user_identities (issuer, subject, user_id, created_at) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (issuer, subject) DO NOTHING`
+
+	if _, err := s.pool.Exec(ctx, query, identity.Issuer, identity.Subject, identity.UserID, identity.CreatedAt); err != nil {
+		return models.UserIdentity{}, fmt.Errorf("failed to link identity: %w", err)
+	}
+
+	// Another request may have won the race, so return whatever is persisted
+	persisted := models.UserIdentity{Issuer: identity.Issuer, Subject: identity.Subject}
+	err := s.pool.QueryRow(ctx, `SELECT user_id, created_at FROM user_identities WHERE issuer = $1 AND subject = $2`,
+		identity.Issuer, identity.Subject).Scan(&persisted.UserID, &persisted.CreatedAt)
+	if err != nil {
+		return models.UserIdentity{}, fmt.Errorf("failed to get identity: %w", err)
+	}
+
+	return persisted, nil
+}
+
+// GetUserIDs retrieves the IDs of all users.
+func (s *PostgresStore) GetUserIDs(ctx context.Context) ([]int, error) {
+
+	query := `SELECT id FROM users ORDER BY id`
+
+	rows, err := s.pool.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user IDs: %w", err)
+	}
+	defer rows.Close()
+
+	userIDs, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan user IDs: %w", err)
+	}
+
+	return userIDs, nil
+}
+
 // CreateSecret adds a new secret for a user.
 func (s *PostgresStore) CreateSecret(ctx context.Context, secret models.Secret) (models.Secret, error) {
 
-	query := `INSERT INTO secrets (user_id, type, data, metadata) VALUES ($1, $2, $3, $4) RETURNING id`
+	// A reserved ID is taken from the sequence already, so it is inserted explicitly
+	query := `INSERT INTO secrets (id, user_id, type, data, metadata)
+		VALUES (COALESCE(NULLIF($1, 0), nextval(pg_get_serial_sequence('secrets', 'id'))), $2, $3, $4, $5)
+		RETURNING id, created_at, updated_at, revision`
 
-	err := s.pool.QueryRow(ctx, query, secret.UserID, secret.Type, secret.Data, secret.Metadata).Scan(&secret.ID)
+	err := s.pool.QueryRow(ctx, query, secret.ID, secret.UserID, secret.Type, secret.Data, secret.Metadata).Scan(
+		&secret.ID, &secret.CreatedAt, &secret.UpdatedAt, &secret.Revision,
+	)
 	if err != nil {
 		return models.Secret{}, fmt.Errorf("failed to create secret: %w", err)
 	}
@@ -122,10 +345,20 @@ func (s *PostgresStore) CreateSecret(ctx context.Context, secret models.Secret)
 	return secret, nil
 }
 
+// NextSecretID reserves the ID of a secret that is created later.
+func (s *PostgresStore) NextSecretID(ctx context.Context) (int, error) {
+	var id int
+	err := s.pool.QueryRow(ctx, `SELECT nextval(pg_get_serial_sequence('secrets', 'id'))`).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to reserve secret ID: %w", err)
+	}
+	return id, nil
+}
+
 // GetSecrets retrieves all secrets for a specific user.
 func (s *PostgresStore) GetSecrets(ctx context.Context, userID int) ([]models.Secret, error) {
 
-	query := `SELECT id, user_id, type, data, metadata FROM secrets WHERE user_id = $1`
+	query := `SELECT id, user_id, type, data, metadata, created_at, updated_at, revision FROM secrets WHERE user_id = $1`
 
 	rows, err := s.pool.Query(ctx, query, userID)
 	if err != nil {
@@ -136,7 +369,8 @@ func (s *PostgresStore) GetSecrets(ctx context.Context, userID int) ([]models.Se
 	var secrets []models.Secret
 	for rows.Next() {
 		var secret models.Secret
-		err := rows.Scan(&secret.ID, &secret.UserID, &secret.Type, &secret.Data, &secret.Metadata)
+		err := rows.Scan(&secret.ID, &secret.UserID, &secret.Type, &secret.Data, &secret.Metadata,
+			&secret.CreatedAt, &secret.UpdatedAt, &secret.Revision)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan secret: %w", err)
 		}
@@ -157,11 +391,13 @@ func (s *PostgresStore) GetSecrets(ctx context.Context, userID int) ([]models.Se
 // GetSecretByID retrieves a specific secret for a user by its ID.
 func (s *PostgresStore) GetSecretByID(ctx context.Context, userID, secretID int) (models.Secret, error) {
 
-	query := `SELECT id, user_id, type, data, metadata FROM secrets WHERE id = $1 AND user_id = $2`
+	query := `SELECT id, user_id, type, data, metadata, created_at, updated_at, revision
+		FROM secrets WHERE id = $1 AND user_id = $2`
 
 	var secret models.Secret
 	err := s.pool.QueryRow(ctx, query, secretID, userID).Scan(
 		&secret.ID, &secret.UserID, &secret.Type, &secret.Data, &secret.Metadata,
+		&secret.CreatedAt, &secret.UpdatedAt, &secret.Revision,
 	)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
@@ -176,18 +412,30 @@ func (s *PostgresStore) GetSecretByID(ctx context.Context, userID, secretID int)
 // UpdateSecret updates an existing secret for a user.
 func (s *PostgresStore) UpdateSecret(ctx context.Context, secret models.Secret) (models.Secret, error) {
 
-	query := `UPDATE secrets SET type = $1, data = $2, metadata = $3 WHERE id = $4 AND user_id = $5`
+	query := `UPDATE secrets SET type = $1, data = $2, metadata = $3, updated_at = NOW(), revision = revision + 1
+		WHERE id = $4 AND user_id = $5 AND ($6 = 0 OR revision = $6)
+		RETURNING created_at, updated_at, revision`
 
-	result, err := s.pool.Exec(ctx, query, secret.Type, secret.Data, secret.Metadata, secret.ID, secret.UserID)
-	if err != nil {
+	err := s.pool.QueryRow(ctx, query, secret.Type, secret.Data, secret.Metadata, secret.ID, secret.UserID, secret.Revision).Scan(
+		&secret.CreatedAt, &secret.UpdatedAt, &secret.Revision,
+	)
+	if err == nil {
+		return secret, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
 		return models.Secret{}, fmt.Errorf("failed to update secret: %w", err)
 	}
 
-	if result.RowsAffected() == 0 {
+	// The secret does not exist or has another revision
+	var revision int
+	err = s.pool.QueryRow(ctx, `SELECT revision FROM secrets WHERE id = $1 AND user_id = $2`, secret.ID, secret.UserID).Scan(&revision)
+	if errors.Is(err, pgx.ErrNoRows) {
 		return models.Secret{}, NewErrSecretNotFound(secret.ID)
 	}
-
-	return secret, nil
+	if err != nil {
+		return models.Secret{}, fmt.Errorf("failed to update secret: %w", err)
+	}
+	return models.Secret{}, NewErrRevisionConflict(secret.ID, revision)
 }
 
 // DeleteSecret deletes a secret for a user by its ID.
@@ -206,3 +454,790 @@ func (s *PostgresStore) DeleteSecret(ctx context.Context, userID, secretID int)
 
 	return nil
 }
+
+// SearchSecrets retrieves the secrets of a user that satisfy the query.
+func (s *PostgresStore) SearchSecrets(ctx context.Context, userID int, query models.SecretQuery) ([]models.Secret, error) {
+	secrets, err := s.GetSecrets(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return filterSecrets(secrets, query), nil
+}
+
+// ReplaceSecret sets the data and metadata of a secret if they have not changed since it was read.
+func (s *PostgresStore) ReplaceSecret(ctx context.Context, old, new models.Secret) (bool, error) {
+
+	query := `UPDATE secrets SET data = $1, metadata = $2
+		WHERE id = $3 AND user_id = $4 AND data = $5 AND metadata IS NOT DISTINCT FROM $6`
+
+	result, err := s.pool.Exec(ctx, query, new.Data, new.Metadata, old.ID, old.UserID, old.Data, old.Metadata)
+	if err != nil {
+		return false, fmt.Errorf("failed to replace secret: %w", err)
+	}
+
+	return result.RowsAffected() > 0, nil
+}
+
+// SetSecretIndex replaces the blind index terms of a secret.
+func (s *PostgresStore) SetSecretIndex(ctx context.Context, userID, secretID int, terms [][]byte) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM secret_index WHERE secret_id = $1 AND user_id = $2`, secretID, userID); err != nil {
+		return fmt.Errorf("failed to clear secret index: %w", err)
+	}
+
+	for _, term := range terms {
+		query := `INSERT INTO secret_index (secret_id, user_id, term) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`
+		if _, err := tx.Exec(ctx, query, secretID, userID, term); err != nil {
+			return fmt.Errorf("failed to write secret index: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit secret index: %w", err)
+	}
+	return nil
+}
+
+// GetSecretIDsByIndex retrieves the IDs of the secrets of a user indexed with the term.
+func (s *PostgresStore) GetSecretIDsByIndex(ctx context.Context, userID int, term []byte) ([]int, error) {
+
+	query := `SELECT secret_id FROM secret_index WHERE user_id = $1 AND term = $2 ORDER BY secret_id`
+
+	rows, err := s.pool.Query(ctx, query, userID, term)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search secret index: %w", err)
+	}
+	defer rows.Close()
+
+	secretIDs, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan secret IDs: %w", err)
+	}
+
+	return secretIDs, nil
+}
+
+// GetDataKey retrieves the wrapped data key of a user.
+func (s *PostgresStore) GetDataKey(ctx context.Context, userID int) ([]byte, error) {
+
+	query := `SELECT wrapped_key FROM data_keys WHERE user_id = $1`
+
+	var wrappedKey []byte
+	err := s.pool.QueryRow(ctx, query, userID).Scan(&wrappedKey)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, NewErrDataKeyNotFound(userID)
+		}
+		return nil, fmt.Errorf("failed to get data key: %w", err)
+	}
+
+	return wrappedKey, nil
+}
+
+// CreateDataKey stores a wrapped data key for a user unless one already exists.
+func (s *PostgresStore) CreateDataKey(ctx context.Context, userID int, wrappedKey []byte) ([]byte, error) {
+
+	query := `INSERT INTO data_keys (user_id, wrapped_key) VALUES ($1, $2) ON CONFLICT (user_id) DO NOTHING`
+
+	if _, err := s.pool.Exec(ctx, query, userID, wrappedKey); err != nil {
+		return nil, fmt.Errorf("failed to create data key: %w", err)
+	}
+
+	// Another request may have won the race, so return whatever is persisted
+	return s.GetDataKey(ctx, userID)
+}
+
+// ReplaceDataKey sets the wrapped data key of a user if it has not changed since it was read.
+func (s *PostgresStore) ReplaceDataKey(ctx context.Context, userID int, oldKey, newKey []byte) (bool, error) {
+
+	query := `UPDATE data_keys SET wrapped_key = $1 WHERE user_id = $2 AND wrapped_key = $3`
+
+	result, err := s.pool.Exec(ctx, query, newKey, userID, oldKey)
+	if err != nil {
+		return false, fmt.Errorf("failed to replace data key: %w", err)
+	}
+
+	return result.RowsAffected() > 0, nil
+}
+
+// CreateKeySalt stores the salt of a master key unless one already exists.
+func (s *PostgresStore) CreateKeySalt(ctx context.Context, keyID string, salt []byte) ([]byte, error) {
+
+	query := `INSERT INTO key_salts (key_id, salt) VALUES ($1, $2) ON CONFLICT (key_id) DO NOTHING`
+
+	if _, err := s.pool.Exec(ctx, query, keyID, salt); err != nil {
+		return nil, fmt.Errorf("failed to create key salt: %w", err)
+	}
+
+	query = `SELECT salt FROM key_salts WHERE key_id = $1`
+
+	var persisted []byte
+	if err := s.pool.QueryRow(ctx, query, keyID).Scan(&persisted); err != nil {
+		return nil, fmt.Errorf("failed to get key salt: %w", err)
+	}
+
+	return persisted, nil
+}
+
+// GetSealConfig retrieves the configuration of a sealed master key, or nil if there is none.
+func (s *PostgresStore) GetSealConfig(ctx context.Context, keyID string) ([]byte, error) {
+
+	query := `SELECT config FROM seal_configs WHERE key_id = $1`
+
+	var config []byte
+	if err := s.pool.QueryRow(ctx, query, keyID).Scan(&config); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get seal configuration: %w", err)
+	}
+
+	return config, nil
+}
+
+// CreateSealConfig stores the configuration of a sealed master key unless one already exists.
+func (s *PostgresStore) CreateSealConfig(ctx context.Context, keyID string, config []byte) ([]byte, error) {
+
+	query := `INSERT INTO seal_configs (key_id, config) VALUES ($1, $2) ON CONFLICT (key_id) DO NOTHING`
+
+	if _, err := s.pool.Exec(ctx, query, keyID, config); err != nil {
+		return nil, fmt.Errorf("failed to create seal configuration: %w", err)
+	}
+
+	return s.GetSealConfig(ctx, keyID)
+}
+
+// CreateRefreshToken stores a new refresh token.
+func (s *PostgresStore) CreateRefreshToken(ctx context.Context, token models.RefreshToken) error {
+
+	query := `INSERT INTO refresh_tokens (token_hash, family_id, user_id, created_at, expires_at) VALUES ($1, $2, $3, $4, $5)`
+
+	if _, err := s.pool.Exec(ctx, query, token.TokenHash, token.FamilyID, token.UserID, token.CreatedAt, token.ExpiresAt); err != nil {
+		return fmt.Errorf("failed to create refresh token: %w", err)
+	}
+
+	return nil
+}
+
+// GetRefreshToken returns a refresh token without using it.
+func (s *PostgresStore) GetRefreshToken(ctx context.Context, tokenHash []byte) (models.RefreshToken, error) {
+
+	query := `SELECT family_id, user_id, created_at, expires_at, used FROM refresh_tokens WHERE token_hash = $1`
+
+	token := models.RefreshToken{TokenHash: tokenHash}
+	err := s.pool.QueryRow(ctx, query, tokenHash).Scan(&token.FamilyID, &token.UserID, &token.CreatedAt, &token.ExpiresAt, &token.Used)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.RefreshToken{}, NewErrRefreshTokenNotFound()
+		}
+		return models.RefreshToken{}, fmt.Errorf("failed to get refresh token: %w", err)
+	}
+
+	return token, nil
+}
+
+// UseRefreshToken marks a refresh token as used and returns it with its previous Used state.
+// The row is locked so that concurrent uses of the same token see each other.
+func (s *PostgresStore) UseRefreshToken(ctx context.Context, tokenHash []byte) (models.RefreshToken, error) {
+
+	query := `UPDATE refresh_tokens t SET used = TRUE
+		FROM (SELECT token_hash, used FROM refresh_tokens WHERE token_hash = $1 FOR UPDATE) old
+		WHERE t.token_hash = old.token_hash
+		RETURNING t.family_id, t.user_id, t.created_at, t.expires_at, old.used`
+
+	token := models.RefreshToken{TokenHash: tokenHash}
+	err := s.pool.QueryRow(ctx, query, tokenHash).Scan(&token.FamilyID, &token.UserID, &token.CreatedAt, &token.ExpiresAt, &token.Used)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.RefreshToken{}, NewErrRefreshTokenNotFound()
+		}
+		return models.RefreshToken{}, fmt.Errorf("failed to use refresh token: %w", err)
+	}
+
+	return token, nil
+}
+
+// RevokeRefreshTokenFamily deletes all refresh tokens of a family.
+func (s *PostgresStore) RevokeRefreshTokenFamily(ctx context.Context, familyID string) error {
+
+	query := `DELETE FROM refresh_tokens WHERE family_id = $1`
+
+	if _, err := s.pool.Exec(ctx, query, familyID); err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+
+	return nil
+}
+
+// RevokeToken records an access token ID as revoked until the token expires.
+func (s *PostgresStore) RevokeToken(ctx context.Context, tokenID string, expiresAt time.Time) error {
+
+	query := `INSERT INTO revoked_tokens (token_id, expires_at) VALUES ($1, $2) ON CONFLICT (token_id) DO NOTHING`
+
+	if _, err := s.pool.Exec(ctx, query, tokenID, expiresAt); err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+
+	return nil
+}
+
+// RevokeTokenOnce records an access token ID as revoked and reports false if it was revoked already.
+func (s *PostgresStore) RevokeTokenOnce(ctx context.Context, tokenID string, expiresAt time.Time) (bool, error) {
+
+	query := `INSERT INTO revoked_tokens (token_id, expires_at) VALUES ($1, $2) ON CONFLICT (token_id) DO NOTHING`
+
+	tag, err := s.pool.Exec(ctx, query, tokenID, expiresAt)
+	if err != nil {
+		return false, fmt.Errorf("failed to revoke token: %w", err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// IsTokenRevoked reports whether an access token ID has been revoked.
+func (s *PostgresStore) IsTokenRevoked(ctx context.Context, tokenID string) (bool, error) {
+
+	query := `SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE token_id = $1)`
+
+	var revoked bool
+	if err := s.pool.QueryRow(ctx, query, tokenID).Scan(&revoked); err != nil {
+		return false, fmt.Errorf("failed to check token revocation: %w", err)
+	}
+
+	return revoked, nil
+}
+
+// DeleteExpiredRevokedTokens removes revocations of tokens that expired before now.
+func (s *PostgresStore) DeleteExpiredRevokedTokens(ctx context.Context, now time.Time) error {
+
+	query := `DELETE FROM revoked_tokens WHERE expires_at < $1`
+
+	if _, err := s.pool.Exec(ctx, query, now); err != nil {
+		return fmt.Errorf("failed to delete expired revoked tokens: %w", err)
+	}
+
+	return nil
+}
+
+// CreateSession stores a new session.
+func (s *PostgresStore) CreateSession(ctx context.Context, session models.Session) error {
+
+	query := `INSERT INTO sessions (id, user_id, device_name, client_version, ip, created_at, last_seen_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`
+
+	_, err := s.pool.Exec(ctx, query, session.ID, session.UserID, session.DeviceName, session.ClientVersion,
+		session.IP, session.CreatedAt, session.LastSeenAt)
+	if err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+
+	return nil
+}
+
+// GetSessions returns the sessions of a user, most recently seen first.
+func (s *PostgresStore) GetSessions(ctx context.Context, userID int) ([]models.Session, error) {
+
+	query := `SELECT id, user_id, device_name, client_version, ip, created_at, last_seen_at
+		FROM sessions WHERE user_id = $1 ORDER BY last_seen_at DESC`
+
+	rows, err := s.pool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		var session models.Session
+		if err := rows.Scan(&session.ID, &session.UserID, &session.DeviceName, &session.ClientVersion,
+			&session.IP, &session.CreatedAt, &session.LastSeenAt); err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating sessions: %w", err)
+	}
+
+	return sessions, nil
+}
+
+// TouchSession records activity of a session from the given IP address.
+func (s *PostgresStore) TouchSession(ctx context.Context, sessionID, ip string, seenAt time.Time) error {
+
+	query := `UPDATE sessions SET ip = $1, last_seen_at = $2 WHERE id = $3`
+
+	result, err := s.pool.Exec(ctx, query, ip, seenAt, sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to update session: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return NewErrSessionNotFound(sessionID)
+	}
+
+	return nil
+}
+
+// DeleteSession deletes a session of a user together with its refresh tokens.
+func (s *PostgresStore) DeleteSession(ctx context.Context, userID int, sessionID string) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	result, err := tx.Exec(ctx, `DELETE FROM sessions WHERE id = $1 AND user_id = $2`, sessionID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return NewErrSessionNotFound(sessionID)
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM refresh_tokens WHERE family_id = $1`, sessionID); err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// apiTokenColumns are the columns scanned by scanAPIToken.
+const apiTokenColumns = `id, user_id, name, service_account, token_hash, read_only, secret_ids, keywords,
+	created_at, expires_at, last_used_at`
+
+// scanAPIToken scans a row of apiTokenColumns.
+func scanAPIToken(row pgx.Row) (models.APIToken, error) {
+	var token models.APIToken
+	err := row.Scan(&token.ID, &token.UserID, &token.Name, &token.ServiceAccount, &token.TokenHash,
+		&token.Scope.ReadOnly, &token.Scope.SecretIDs, &token.Scope.Keywords,
+		&token.CreatedAt, &token.ExpiresAt, &token.LastUsedAt)
+	return token, err
+}
+
+// CreateAPIToken stores a new API token.
+func (s *PostgresStore) CreateAPIToken(ctx context.Context, token models.APIToken) error {
+
+	query := `INSERT INTO api_tokens (id, user_id, name, service_account, token_hash, read_only, secret_ids, keywords,
+		created_at, expires_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+
+	_, err := s.pool.Exec(ctx, query, token.ID, token.UserID, token.Name, token.ServiceAccount, token.TokenHash,
+		token.Scope.ReadOnly, token.Scope.SecretIDs, token.Scope.Keywords, token.CreatedAt, token.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to create API token: %w", err)
+	}
+
+	return nil
+}
+
+// GetAPITokens returns the API tokens of a user, newest first.
+func (s *PostgresStore) GetAPITokens(ctx context.Context, userID int) ([]models.APIToken, error) {
+
+	query := `SELECT ` + apiTokenColumns + ` FROM api_tokens WHERE user_id = $1 ORDER BY created_at DESC`
+
+	rows, err := s.pool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API tokens: %w", err)
+	}
+	defer rows.Close()
+
+	tokens := []models.APIToken{}
+	for rows.Next() {
+		token, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan API token: %w", err)
+		}
+		tokens = append(tokens, token)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating API tokens: %w", err)
+	}
+
+	return tokens, nil
+}
+
+// GetAPITokenByHash returns the API token with the given hash.
+func (s *PostgresStore) GetAPITokenByHash(ctx context.Context, tokenHash []byte) (models.APIToken, error) {
+
+	query := `SELECT ` + apiTokenColumns + ` FROM api_tokens WHERE token_hash = $1`
+
+	token, err := scanAPIToken(s.pool.QueryRow(ctx, query, tokenHash))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.APIToken{}, NewErrAPITokenNotFound("")
+		}
+		return models.APIToken{}, fmt.Errorf("failed to get API token: %w", err)
+	}
+
+	return token, nil
+}
+
+// TouchAPIToken records the use of an API token.
+func (s *PostgresStore) TouchAPIToken(ctx context.Context, tokenID string, usedAt time.Time) error {
+
+	query := `UPDATE api_tokens SET last_used_at = $1 WHERE id = $2`
+
+	result, err := s.pool.Exec(ctx, query, usedAt, tokenID)
+	if err != nil {
+		return fmt.Errorf("failed to update API token: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return NewErrAPITokenNotFound(tokenID)
+	}
+
+	return nil
+}
+
+// DeleteAPIToken revokes an API token of a user.
+func (s *PostgresStore) DeleteAPIToken(ctx context.Context, userID int, tokenID string) error {
+
+	query := `DELETE FROM api_tokens WHERE id = $1 AND user_id = $2`
+
+	result, err := s.pool.Exec(ctx, query, tokenID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete API token: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return NewErrAPITokenNotFound(tokenID)
+	}
+
+	return nil
+}
+
+// CreateInvite stores a new invite.
+func (s *PostgresStore) CreateInvite(ctx context.Context, invite models.Invite) error {
+
+	query := `INSERT INTO invites (id, code_hash, created_by, created_at, expires_at) VALUES ($1, $2, $3, $4, $5)`
+
+	_, err := s.pool.Exec(ctx, query, invite.ID, invite.CodeHash, invite.CreatedBy, invite.CreatedAt, invite.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to create invite: %w", err)
+	}
+
+	return nil
+}
+
+// GetInvites returns all invites, newest first.
+func (s *PostgresStore) GetInvites(ctx context.Context) ([]models.Invite, error) {
+
+	query := `SELECT id, code_hash, created_by, created_at, expires_at, used_by, used_at FROM invites ORDER BY created_at DESC`
+
+	rows, err := s.pool.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get invites: %w", err)
+	}
+	defer rows.Close()
+
+	invites := []models.Invite{}
+	for rows.Next() {
+		var invite models.Invite
+		if err := rows.Scan(&invite.ID, &invite.CodeHash, &invite.CreatedBy, &invite.CreatedAt, &invite.ExpiresAt,
+			&invite.UsedBy, &invite.UsedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan invite: %w", err)
+		}
+		invites = append(invites, invite)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating invites: %w", err)
+	}
+
+	return invites, nil
+}
+
+// CreateUserWithInvite creates a user and marks an unused, unexpired invite as used by it
+// in one transaction.
+func (s *PostgresStore) CreateUserWithInvite(ctx context.Context, user models.User, codeHash []byte, now time.Time) (models.User, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return models.User{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// The update locks the invite until the transaction ends
+	query := `UPDATE invites SET used_by = $2, used_at = $3
+		WHERE code_hash = $1 AND used_at IS NULL AND expires_at > $3`
+
+	result, err := tx.Exec(ctx, query, codeHash, user.Login, now)
+	if err != nil {
+		return models.User{}, fmt.Errorf("failed to use invite: %w", err)
+	}
+	if result.RowsAffected() != 1 {
+		return models.User{}, NewErrInvalidInvite()
+	}
+
+	err = tx.QueryRow(ctx, `INSERT INTO users (login, password) VALUES ($1, $2) RETURNING id`, user.Login, user.Password).Scan(&user.ID)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return models.User{}, NewErrUserExists(user.Login)
+		}
+		return models.User{}, fmt.Errorf("failed to create user: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return models.User{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return user, nil
+}
+
+// DeleteInvite revokes an invite.
+func (s *PostgresStore) DeleteInvite(ctx context.Context, inviteID string) error {
+
+	query := `DELETE FROM invites WHERE id = $1`
+
+	result, err := s.pool.Exec(ctx, query, inviteID)
+	if err != nil {
+		return fmt.Errorf("failed to delete invite: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return NewErrInviteNotFound(inviteID)
+	}
+
+	return nil
+}
+
+// SaveTOTP creates or replaces the two-factor enrollment of a user.
+func (s *PostgresStore) SaveTOTP(ctx context.Context, totp models.TOTP) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `INSERT INTO user_totp (user_id, secret, enabled, last_used_step, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret = EXCLUDED.secret, enabled = EXCLUDED.enabled,
+			last_used_step = EXCLUDED.last_used_step, created_at = EXCLUDED.created_at`
+
+	if _, err := tx.Exec(ctx, query, totp.UserID, totp.Secret, totp.Enabled, totp.LastUsedStep, totp.CreatedAt); err != nil {
+		return fmt.Errorf("failed to save TOTP: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM totp_recovery_codes WHERE user_id = $1`, totp.UserID); err != nil {
+		return fmt.Errorf("failed to replace recovery codes: %w", err)
+	}
+	for _, code := range totp.RecoveryCodes {
+		if _, err := tx.Exec(ctx, `INSERT INTO totp_recovery_codes (user_id, code_hash) VALUES ($1, $2)`, totp.UserID, code); err != nil {
+			return fmt.Errorf("failed to store recovery code: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// GetTOTP returns the two-factor enrollment of a user.
+func (s *PostgresStore) GetTOTP(ctx context.Context, userID int) (models.TOTP, error) {
+
+	query := `SELECT user_id, secret, enabled, last_used_step, created_at FROM user_totp WHERE user_id = $1`
+
+	var totp models.TOTP
+	err := s.pool.QueryRow(ctx, query, userID).Scan(&totp.UserID, &totp.Secret, &totp.Enabled, &totp.LastUsedStep, &totp.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.TOTP{}, NewErrTOTPNotFound(userID)
+		}
+		return models.TOTP{}, fmt.Errorf("failed to get TOTP: %w", err)
+	}
+
+	rows, err := s.pool.Query(ctx, `SELECT code_hash FROM totp_recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return models.TOTP{}, fmt.Errorf("failed to get recovery codes: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var code []byte
+		if err := rows.Scan(&code); err != nil {
+			return models.TOTP{}, fmt.Errorf("failed to scan recovery code: %w", err)
+		}
+		totp.RecoveryCodes = append(totp.RecoveryCodes, code)
+	}
+
+	if err := rows.Err(); err != nil {
+		return models.TOTP{}, fmt.Errorf("error iterating recovery codes: %w", err)
+	}
+
+	return totp, nil
+}
+
+// DeleteTOTP removes the two-factor enrollment of a user.
+func (s *PostgresStore) DeleteTOTP(ctx context.Context, userID int) error {
+
+	result, err := s.pool.Exec(ctx, `DELETE FROM user_totp WHERE user_id = $1`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete TOTP: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return NewErrTOTPNotFound(userID)
+	}
+
+	return nil
+}
+
+// UseTOTPStep records the time step of an accepted code.
+func (s *PostgresStore) UseTOTPStep(ctx context.Context, userID int, step int64) (bool, error) {
+
+	query := `UPDATE user_totp SET last_used_step = $1 WHERE user_id = $2 AND last_used_step < $1`
+
+	result, err := s.pool.Exec(ctx, query, step, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to update TOTP: %w", err)
+	}
+
+	return result.RowsAffected() == 1, nil
+}
+
+// UseRecoveryCode removes an unused recovery code.
+func (s *PostgresStore) UseRecoveryCode(ctx context.Context, userID int, codeHash []byte) (bool, error) {
+
+	query := `DELETE FROM totp_recovery_codes WHERE user_id = $1 AND code_hash = $2`
+
+	result, err := s.pool.Exec(ctx, query, userID, codeHash)
+	if err != nil {
+		return false, fmt.Errorf("failed to use recovery code: %w", err)
+	}
+
+	return result.RowsAffected() == 1, nil
+}
+
+// SetAccountRecoveryCodes replaces the account recovery codes of a user.
+func (s *PostgresStore) SetAccountRecoveryCodes(ctx context.Context, userID int, codeHashes [][]byte) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM account_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+	for _, code := range codeHashes {
+		if _, err := tx.Exec(ctx, `INSERT INTO account_recovery_codes (user_id, code_hash) VALUES ($1, $2)`, userID, code); err != nil {
+			return fmt.Errorf("failed to store recovery code: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// CountAccountRecoveryCodes returns the number of unused account recovery codes of a user.
+func (s *PostgresStore) CountAccountRecoveryCodes(ctx context.Context, userID int) (int, error) {
+
+	query := `SELECT COUNT(*) FROM account_recovery_codes WHERE user_id = $1`
+
+	var count int
+	if err := s.pool.QueryRow(ctx, query, userID).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count recovery codes: %w", err)
+	}
+
+	return count, nil
+}
+
+// UseAccountRecoveryCode removes an unused account recovery code.
+func (s *PostgresStore) UseAccountRecoveryCode(ctx context.Context, userID int, codeHash []byte) (bool, error) {
+
+	query := `DELETE FROM account_recovery_codes WHERE user_id = $1 AND code_hash = $2`
+
+	result, err := s.pool.Exec(ctx, query, userID, codeHash)
+	if err != nil {
+		return false, fmt.Errorf("failed to use recovery code: %w", err)
+	}
+
+	return result.RowsAffected() == 1, nil
+}
+
+// GetLoginAttempts returns the failed login attempts recorded for a key.
+func (s *PostgresStore) GetLoginAttempts(ctx context.Context, key string) (models.LoginAttempts, error) {
+
+	query := `SELECT key, failures, last_failure, locked_until FROM login_attempts WHERE key = $1`
+
+	attempts := models.LoginAttempts{Key: key}
+	err := s.pool.QueryRow(ctx, query, key).Scan(&attempts.Key, &attempts.Failures, &attempts.LastFailure, &attempts.LockedUntil)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return models.LoginAttempts{}, fmt.Errorf("failed to get login attempts: %w", err)
+	}
+
+	return attempts, nil
+}
+
+// RecordLoginFailure atomically counts a failed login for a key.
+func (s *PostgresStore) RecordLoginFailure(ctx context.Context, key string, now, resetBefore time.Time) (models.LoginAttempts, error) {
+
+	query := `INSERT INTO login_attempts (key, failures, last_failure, locked_until)
+		VALUES ($1, 1, $2, $4)
+		ON CONFLICT (key) DO UPDATE
+		SET failures = CASE WHEN login_attempts.last_failure < $3 THEN 1 ELSE login_attempts.failures + 1 END,
+			last_failure = EXCLUDED.last_failure
+		RETURNING key, failures, last_failure, locked_until`
+
+	var attempts models.LoginAttempts
+	err := s.pool.QueryRow(ctx, query, key, now, resetBefore, time.Time{}).Scan(
+		&attempts.Key, &attempts.Failures, &attempts.LastFailure, &attempts.LockedUntil)
+	if err != nil {
+		return models.LoginAttempts{}, fmt.Errorf("failed to record login failure: %w", err)
+	}
+
+	return attempts, nil
+}
+
+// LockLogin rejects logins for a key until the given time.
+func (s *PostgresStore) LockLogin(ctx context.Context, key string, until time.Time) error {
+
+	query := `INSERT INTO login_attempts (key, failures, last_failure, locked_until)
+		VALUES ($1, 0, $3, $2)
+		ON CONFLICT (key) DO UPDATE
+		SET locked_until = GREATEST(login_attempts.locked_until, EXCLUDED.locked_until)`
+
+	if _, err := s.pool.Exec(ctx, query, key, until, time.Time{}); err != nil {
+		return fmt.Errorf("failed to lock login: %w", err)
+	}
+
+	return nil
+}
+
+// ResetLoginAttempts forgets the failures and lock of a key.
+func (s *PostgresStore) ResetLoginAttempts(ctx context.Context, key string) error {
+
+	if _, err := s.pool.Exec(ctx, `DELETE FROM login_attempts WHERE key = $1`, key); err != nil {
+		return fmt.Errorf("failed to reset login attempts: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteStaleLoginAttempts removes entries that are no longer relevant.
+func (s *PostgresStore) DeleteStaleLoginAttempts(ctx context.Context, before, now time.Time) error {
+
+	query := `DELETE FROM login_attempts WHERE last_failure < $1 AND locked_until <= $2`
+
+	if _, err := s.pool.Exec(ctx, query, before, now); err != nil {
+		return fmt.Errorf("failed to delete stale login attempts: %w", err)
+	}
+
+	return nil
+}
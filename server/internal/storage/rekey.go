@@ -0,0 +1,205 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gophkeeper/server/internal/models"
+)
+
+// RekeyProgress reports the progress of a re-encryption run
+type RekeyProgress struct {
+	UsersTotal         int
+	UsersDone          int
+	DataKeysRewrapped  int
+	SecretsReencrypted int
+	// SecretsSkipped counts secrets that changed while being migrated;
+	// they were written by a regular update and are already in the current format
+	SecretsSkipped int
+	// FailedSecretIDs lists secrets whose ciphertext does not belong to them
+	FailedSecretIDs []int
+	// ErrorSecretIDs lists secrets that could not be migrated for another reason,
+	// e.g. a storage error; running Rekey again retries them
+	ErrorSecretIDs []int
+	// ErrorUserIDs lists users whose data key or secrets could not be read
+	ErrorUserIDs []int
+}
+
+// Rekey migrates stored data to the primary master key and the current ciphertext format:
+// data keys wrapped with an older master key are rewrapped, and secrets encrypted directly
+// with a master key, in the legacy format or without binding to their record are
+// re-encrypted with the owner's data key. Secrets failing the integrity check are
+// left untouched and reported in FailedSecretIDs.
+// It is safe to run while the server is serving requests: rows are replaced only if they
+// have not changed since they were read. progress, if not nil, is called after every user
+//
+// A user or secret that cannot be migrated does not stop the run: it is recorded in
+// ErrorUserIDs or ErrorSecretIDs and Rekey returns ErrRekeyIncomplete at the end, so the
+// migration can be run again once the cause is fixed
+func (es *EncryptedStore) Rekey(ctx context.Context, progress func(RekeyProgress)) (RekeyProgress, error) {
+	var p RekeyProgress
+	var firstErr error
+	fail := func(err error) {
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	if es.keyring == nil {
+		return p, fmt.Errorf("encryption is disabled")
+	}
+
+	userIDs, err := es.store.GetUserIDs(ctx)
+	if err != nil {
+		return p, fmt.Errorf("failed to list users: %w", err)
+	}
+	p.UsersTotal = len(userIDs)
+
+	for _, userID := range userIDs {
+		if err := ctx.Err(); err != nil {
+			return p, err
+		}
+
+		rewrapped, err := es.rewrapDataKey(ctx, userID)
+		if err == nil {
+			if rewrapped {
+				p.DataKeysRewrapped++
+			}
+			err = es.reencryptSecrets(ctx, userID, &p, fail)
+		}
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return p, ctxErr
+			}
+			p.ErrorUserIDs = append(p.ErrorUserIDs, userID)
+			fail(err)
+		}
+
+		p.UsersDone++
+		if progress != nil {
+			progress(p)
+		}
+	}
+
+	if firstErr != nil {
+		return p, ErrRekeyIncomplete{Users: len(p.ErrorUserIDs), Secrets: len(p.ErrorSecretIDs), Err: firstErr}
+	}
+	return p, nil
+}
+
+// ErrRekeyIncomplete is returned by Rekey when some users or secrets could not be migrated.
+// Err is the first failure.
+type ErrRekeyIncomplete struct {
+	Users   int
+	Secrets int
+	Err     error
+}
+
+func (e ErrRekeyIncomplete) Error() string {
+	return fmt.Sprintf("%d users and %d secrets could not be migrated, first error: %v", e.Users, e.Secrets, e.Err)
+}
+
+func (e ErrRekeyIncomplete) Unwrap() error {
+	return e.Err
+}
+
+// rewrapDataKey rewraps the user's data key with the primary master key if needed
+func (es *EncryptedStore) rewrapDataKey(ctx context.Context, userID int) (bool, error) {
+	wrappedKey, err := es.store.GetDataKey(ctx, userID)
+	if err != nil {
+		var dataKeyNotFoundErr ErrDataKeyNotFound
+		if errors.As(err, &dataKeyNotFoundErr) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to get data key for user %d: %w", userID, err)
+	}
+
+	if !es.keyring.NeedsRotation(wrappedKey) {
+		return false, nil
+	}
+
+	dataKey, err := es.keyring.UnwrapKey(ctx, wrappedKey)
+	if err != nil {
+		return false, fmt.Errorf("failed to unwrap data key for user %d: %w", userID, err)
+	}
+	defer clear(dataKey)
+
+	rewrappedKey, err := es.keyring.WrapKey(ctx, dataKey)
+	if err != nil {
+		return false, err
+	}
+
+	replaced, err := es.store.ReplaceDataKey(ctx, userID, wrappedKey, rewrappedKey)
+	if err != nil {
+		return false, fmt.Errorf("failed to store data key for user %d: %w", userID, err)
+	}
+	return replaced, nil
+}
+
+// reencryptSecrets re-encrypts the user's secrets whose data or metadata is not encrypted with
+// their data key and bound to the record, and rebuilds their blind index if it is enabled
+// Secrets that cannot be migrated are recorded in p and passed to fail; the error returned
+// means the secrets of the user could not be read at all
+func (es *EncryptedStore) reencryptSecrets(ctx context.Context, userID int, p *RekeyProgress, fail func(error)) error {
+	secrets, err := es.store.GetSecrets(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get secrets for user %d: %w", userID, err)
+	}
+
+	for _, stored := range secrets {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := es.reencryptSecret(ctx, stored, p); err != nil {
+			p.ErrorSecretIDs = append(p.ErrorSecretIDs, stored.ID)
+			fail(err)
+		}
+	}
+
+	return nil
+}
+
+// reencryptSecret migrates one secret and counts it in p
+func (es *EncryptedStore) reencryptSecret(ctx context.Context, stored models.Secret, p *RekeyProgress) error {
+	if isMigrated(stored) {
+		// Already migrated; verify it still belongs to the secret
+		secret, err := es.decryptSecretWith(ctx, stored, true)
+		if err != nil {
+			var integrityErr ErrSecretIntegrity
+			if !errors.As(err, &integrityErr) {
+				return fmt.Errorf("failed to decrypt secret %d: %w", stored.ID, err)
+			}
+			p.FailedSecretIDs = append(p.FailedSecretIDs, stored.ID)
+			return nil
+		}
+
+		if err := es.updateIndex(ctx, secret); err != nil {
+			return fmt.Errorf("failed to index secret %d: %w", stored.ID, err)
+		}
+		return nil
+	}
+
+	secret, err := es.decryptSecretWith(ctx, stored, false)
+	if err != nil {
+		var integrityErr ErrSecretIntegrity
+		if !errors.As(err, &integrityErr) {
+			return fmt.Errorf("failed to decrypt secret %d: %w", stored.ID, err)
+		}
+		p.FailedSecretIDs = append(p.FailedSecretIDs, stored.ID)
+		return nil
+	}
+
+	err = es.storeEncrypted(ctx, stored, secret)
+	clear(secret.Data)
+	if err != nil {
+		var secretNotFoundErr ErrSecretNotFound
+		if errors.As(err, &secretNotFoundErr) || errors.Is(err, errConcurrentModification) {
+			p.SecretsSkipped++
+			return nil
+		}
+		return fmt.Errorf("failed to store secret %d: %w", stored.ID, err)
+	}
+
+	p.SecretsReencrypted++
+	return nil
+}
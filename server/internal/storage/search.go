@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"gophkeeper/server/internal/models"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// Kinds of blind index terms
+const (
+	indexKindMetadata = "metadata"
+	indexKindKeyword  = "keyword"
+)
+
+// matchesQuery reports whether a plaintext secret satisfies the query
+func matchesQuery(secret models.Secret, query models.SecretQuery) bool {
+	if query.Metadata != "" && secret.Metadata != query.Metadata {
+		return false
+	}
+	if query.Keyword != "" && !HasKeyword(secret.Metadata, query.Keyword) {
+		return false
+	}
+	return true
+}
+
+// HasKeyword reports whether metadata contains the keyword as a word, matching it
+// the way SecretQuery.Keyword does
+func HasKeyword(metadata, keyword string) bool {
+	return slices.Contains(metadataKeywords(metadata), normalizeKeyword(keyword))
+}
+
+// filterSecrets returns the secrets that satisfy the query
+func filterSecrets(secrets []models.Secret, query models.SecretQuery) []models.Secret {
+	result := make([]models.Secret, 0, len(secrets))
+	for _, secret := range secrets {
+		if matchesQuery(secret, query) {
+			result = append(result, secret)
+		}
+	}
+	return result
+}
+
+// metadataKeywords splits metadata into distinct lowercase words
+func metadataKeywords(metadata string) []string {
+	words := strings.FieldsFunc(metadata, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	keywords := make([]string, 0, len(words))
+	for _, word := range words {
+		keyword := normalizeKeyword(word)
+		if !slices.Contains(keywords, keyword) {
+			keywords = append(keywords, keyword)
+		}
+	}
+	return keywords
+}
+
+func normalizeKeyword(word string) string {
+	return strings.ToLower(strings.TrimSpace(word))
+}
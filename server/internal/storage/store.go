@@ -3,15 +3,148 @@ package storage
 import (
 	"context"
 	"gophkeeper/server/internal/models"
+	"time"
 )
 
 type Store interface {
 	CreateUser(ctx context.Context, user models.User) (models.User, error)
 	GetUserByLogin(ctx context.Context, login string) (models.User, error)
+	GetUserByID(ctx context.Context, id int) (models.User, error)
+	GetUserIDs(ctx context.Context) ([]int, error)
+	// SetUserPassword replaces the password hash of a user.
+	SetUserPassword(ctx context.Context, userID int, password string) error
+	// SetUserRoles replaces the roles of a user.
+	SetUserRoles(ctx context.Context, userID int, roles []string) error
+	// GetUserByIdentity returns the user linked to an account at an identity provider.
+	GetUserByIdentity(ctx context.Context, issuer, subject string) (models.User, error)
+	// LinkIdentity links an identity provider account to a user unless it is already linked
+	// and returns the link that is persisted.
+	LinkIdentity(ctx context.Context, identity models.UserIdentity) (models.UserIdentity, error)
 
+	// CreateSecret adds a secret. If the ID of secret is set, it must have been reserved
+	// with NextSecretID.
 	CreateSecret(ctx context.Context, secret models.Secret) (models.Secret, error)
+	// NextSecretID reserves the ID of a secret that is created later, so that data bound
+	// to the ID can be prepared before the secret is stored.
+	NextSecretID(ctx context.Context) (int, error)
 	GetSecrets(ctx context.Context, userID int) ([]models.Secret, error)
 	GetSecretByID(ctx context.Context, userID, secretID int) (models.Secret, error)
+	// UpdateSecret replaces a secret and increments its revision. If the revision of secret
+	// is set, it must equal the stored revision, otherwise ErrRevisionConflict is returned.
 	UpdateSecret(ctx context.Context, secret models.Secret) (models.Secret, error)
 	DeleteSecret(ctx context.Context, userID, secretID int) error
+	// SearchSecrets returns the user's secrets that satisfy the query.
+	SearchSecrets(ctx context.Context, userID int, query models.SecretQuery) ([]models.Secret, error)
+	// ReplaceSecret sets the data and metadata of a secret only if they still equal
+	// those of old and reports whether the secret was updated.
+	ReplaceSecret(ctx context.Context, old, new models.Secret) (bool, error)
+
+	// SetSecretIndex replaces the blind index terms of a secret.
+	SetSecretIndex(ctx context.Context, userID, secretID int, terms [][]byte) error
+	// GetSecretIDsByIndex returns the IDs of the user's secrets indexed with the term.
+	GetSecretIDsByIndex(ctx context.Context, userID int, term []byte) ([]int, error)
+
+	// GetDataKey returns the wrapped data key of a user.
+	GetDataKey(ctx context.Context, userID int) ([]byte, error)
+	// CreateDataKey stores a wrapped data key for a user unless one already exists
+	// and returns the wrapped key that is persisted.
+	CreateDataKey(ctx context.Context, userID int, wrappedKey []byte) ([]byte, error)
+	// ReplaceDataKey sets the wrapped data key of a user only if it still equals oldKey
+	// and reports whether the key was updated.
+	ReplaceDataKey(ctx context.Context, userID int, oldKey, newKey []byte) (bool, error)
+	// CreateKeySalt stores the salt of a passphrase-derived master key unless one already exists
+	// and returns the salt that is persisted.
+	CreateKeySalt(ctx context.Context, keyID string, salt []byte) ([]byte, error)
+	// GetSealConfig returns the configuration of a Shamir-sealed master key, or nil if it has not been initialized.
+	GetSealConfig(ctx context.Context, keyID string) ([]byte, error)
+	// CreateSealConfig stores the configuration of a Shamir-sealed master key unless one already exists
+	// and returns the configuration that is persisted.
+	CreateSealConfig(ctx context.Context, keyID string, config []byte) ([]byte, error)
+
+	// CreateRefreshToken stores a new refresh token.
+	CreateRefreshToken(ctx context.Context, token models.RefreshToken) error
+	// GetRefreshToken returns a refresh token without using it.
+	GetRefreshToken(ctx context.Context, tokenHash []byte) (models.RefreshToken, error)
+	// UseRefreshToken atomically marks a refresh token as used and returns it.
+	// The returned token's Used field reports whether it had already been used before this call.
+	UseRefreshToken(ctx context.Context, tokenHash []byte) (models.RefreshToken, error)
+	// RevokeRefreshTokenFamily deletes all refresh tokens of a family.
+	RevokeRefreshTokenFamily(ctx context.Context, familyID string) error
+
+	// RevokeToken records an access token ID as revoked until the token expires.
+	RevokeToken(ctx context.Context, tokenID string, expiresAt time.Time) error
+	// RevokeTokenOnce records an access token ID as revoked until the token expires and
+	// reports false if it was revoked already.
+	RevokeTokenOnce(ctx context.Context, tokenID string, expiresAt time.Time) (bool, error)
+	// IsTokenRevoked reports whether an access token ID has been revoked.
+	IsTokenRevoked(ctx context.Context, tokenID string) (bool, error)
+	// DeleteExpiredRevokedTokens removes revocations of tokens that expired before now.
+	DeleteExpiredRevokedTokens(ctx context.Context, now time.Time) error
+
+	// CreateSession stores a new session.
+	CreateSession(ctx context.Context, session models.Session) error
+	// GetSessions returns the sessions of a user, most recently seen first.
+	GetSessions(ctx context.Context, userID int) ([]models.Session, error)
+	// TouchSession records activity of a session from the given IP address.
+	TouchSession(ctx context.Context, sessionID, ip string, seenAt time.Time) error
+	// DeleteSession deletes a session of a user together with its refresh tokens.
+	DeleteSession(ctx context.Context, userID int, sessionID string) error
+
+	// CreateAPIToken stores a new API token.
+	CreateAPIToken(ctx context.Context, token models.APIToken) error
+	// GetAPITokens returns the API tokens of a user, newest first.
+	GetAPITokens(ctx context.Context, userID int) ([]models.APIToken, error)
+	// GetAPITokenByHash returns the API token with the given hash.
+	GetAPITokenByHash(ctx context.Context, tokenHash []byte) (models.APIToken, error)
+	// TouchAPIToken records the use of an API token.
+	TouchAPIToken(ctx context.Context, tokenID string, usedAt time.Time) error
+	// DeleteAPIToken revokes an API token of a user.
+	DeleteAPIToken(ctx context.Context, userID int, tokenID string) error
+
+	// CreateInvite stores a new invite.
+	CreateInvite(ctx context.Context, invite models.Invite) error
+	// GetInvites returns all invites, newest first.
+	GetInvites(ctx context.Context) ([]models.Invite, error)
+	// CreateUserWithInvite creates a user and marks the unused invite with the given hash
+	// that has not expired at now as used by the user, atomically. It returns
+	// ErrInvalidInvite if there is no such invite and ErrUserExists if the login is taken;
+	// the invite stays unused in both cases.
+	CreateUserWithInvite(ctx context.Context, user models.User, codeHash []byte, now time.Time) (models.User, error)
+	// DeleteInvite revokes an invite.
+	DeleteInvite(ctx context.Context, inviteID string) error
+
+	// SaveTOTP creates or replaces the two-factor enrollment of a user.
+	SaveTOTP(ctx context.Context, totp models.TOTP) error
+	// GetTOTP returns the two-factor enrollment of a user.
+	GetTOTP(ctx context.Context, userID int) (models.TOTP, error)
+	// DeleteTOTP removes the two-factor enrollment of a user.
+	DeleteTOTP(ctx context.Context, userID int) error
+	// UseTOTPStep records the time step of an accepted code. It returns false if
+	// the same or a later step was already used.
+	UseTOTPStep(ctx context.Context, userID int, step int64) (bool, error)
+	// UseRecoveryCode removes an unused recovery code. It returns false if the code
+	// does not exist or was already used.
+	UseRecoveryCode(ctx context.Context, userID int, codeHash []byte) (bool, error)
+
+	// SetAccountRecoveryCodes replaces the account recovery codes of a user.
+	SetAccountRecoveryCodes(ctx context.Context, userID int, codeHashes [][]byte) error
+	// CountAccountRecoveryCodes returns the number of unused account recovery codes of a user.
+	CountAccountRecoveryCodes(ctx context.Context, userID int) (int, error)
+	// UseAccountRecoveryCode removes an unused account recovery code. It returns false if
+	// the code does not exist or was already used.
+	UseAccountRecoveryCode(ctx context.Context, userID int, codeHash []byte) (bool, error)
+
+	// GetLoginAttempts returns the failed login attempts recorded for a key.
+	// A key without failures yields a zero LoginAttempts.
+	GetLoginAttempts(ctx context.Context, key string) (models.LoginAttempts, error)
+	// RecordLoginFailure atomically counts a failed login for a key and returns the result.
+	// Failures recorded before resetBefore are forgotten.
+	RecordLoginFailure(ctx context.Context, key string, now, resetBefore time.Time) (models.LoginAttempts, error)
+	// LockLogin rejects logins for a key until the given time unless it is already locked longer.
+	LockLogin(ctx context.Context, key string, until time.Time) error
+	// ResetLoginAttempts forgets the failures and lock of a key.
+	ResetLoginAttempts(ctx context.Context, key string) error
+	// DeleteStaleLoginAttempts removes entries that are not locked at now and whose
+	// last failure was before the given time.
+	DeleteStaleLoginAttempts(ctx context.Context, before, now time.Time) error
 }